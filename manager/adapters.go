@@ -63,8 +63,11 @@ func (a *firewallIntegrationAdapter) EnsureZone(ctx context.Context, siteID, nam
 	}
 	return service.ZoneInfo{ZoneID: z.ID, ZoneName: z.Name}, nil
 }
-func (a *firewallIntegrationAdapter) EnsurePolicies(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
-	return a.ic.EnsurePolicies(ctx, siteID, name, zoneID)
+func (a *firewallIntegrationAdapter) EnsurePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return a.ic.EnsurePolicies(ctx, siteID, name, zoneID, rules)
+}
+func (a *firewallIntegrationAdapter) ReplacePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return a.ic.ReplacePolicies(ctx, siteID, name, zoneID, rules)
 }
 func (a *firewallIntegrationAdapter) DeletePolicy(ctx context.Context, siteID, policyID string) error {
 	err := a.ic.DeletePolicy(ctx, siteID, policyID)
@@ -80,6 +83,34 @@ func (a *firewallIntegrationAdapter) DeleteZone(ctx context.Context, siteID, zon
 	}
 	return err
 }
+func (a *firewallIntegrationAdapter) ListZones(ctx context.Context, siteID string) ([]domain.Zone, error) {
+	return a.ic.ListZones(ctx, siteID)
+}
+func (a *firewallIntegrationAdapter) ListPolicies(ctx context.Context, siteID string) ([]domain.Policy, error) {
+	return a.ic.ListPolicies(ctx, siteID)
+}
+func (a *firewallIntegrationAdapter) FindInternalZoneID(ctx context.Context, siteID string) (string, error) {
+	return a.ic.FindInternalZoneID(ctx, siteID)
+}
+func (a *firewallIntegrationAdapter) FindSystemZoneIDs(ctx context.Context, siteID string) (string, string, error) {
+	return a.ic.FindSystemZoneIDs(ctx, siteID)
+}
+func (a *firewallIntegrationAdapter) EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	return a.ic.EnsureWanPortPolicy(ctx, siteID, port, name, extID, gwID)
+}
+func (a *firewallIntegrationAdapter) ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	return a.ic.ReplaceWanPortPolicy(ctx, siteID, port, name, extID, gwID)
+}
+func (a *firewallIntegrationAdapter) ListDNSPolicies(ctx context.Context, siteID string) ([]domain.DNSPolicy, error) {
+	return a.ic.ListDNSPolicies(ctx, siteID)
+}
+func (a *firewallIntegrationAdapter) DeleteDNSPolicy(ctx context.Context, siteID, policyID string) error {
+	err := a.ic.DeleteDNSPolicy(ctx, siteID, policyID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
 
 type firewallManifestAdapter struct {
 	ms ManifestStore
@@ -108,6 +139,24 @@ func (a *firewallManifestAdapter) SetWgS2sZone(tunnelID string, zs ZoneManifest)
 func (a *firewallManifestAdapter) RemoveWgS2sTunnel(tunnelID string) error {
 	return a.ms.RemoveWgS2sTunnel(tunnelID)
 }
+func (a *firewallManifestAdapter) GetPolicyTemplates() []domain.PolicyTemplate {
+	return a.ms.GetPolicyTemplates()
+}
+func (a *firewallManifestAdapter) SetPolicyTemplates(t []domain.PolicyTemplate) error {
+	return a.ms.SetPolicyTemplates(t)
+}
+func (a *firewallManifestAdapter) GetWanPortsSnapshot() map[string]domain.WanPortEntry {
+	return a.ms.GetWanPortsSnapshot()
+}
+func (a *firewallManifestAdapter) SetWanPort(marker, policyID, policyName string, port int) error {
+	return a.ms.SetWanPort(marker, policyID, policyName, port)
+}
+func (a *firewallManifestAdapter) GetSystemZoneIDs() (string, string) {
+	return a.ms.GetSystemZoneIDs()
+}
+func (a *firewallManifestAdapter) GetDNSPolicy(marker string) (domain.DNSPolicyEntry, bool) {
+	return a.ms.GetDNSPolicy(marker)
+}
 
 type firewallOpsAdapter struct {
 	fw FirewallService
@@ -285,7 +334,7 @@ func localSubnetProvider() []service.SubnetEntry {
 	raw := parseLocalSubnets()
 	out := make([]service.SubnetEntry, len(raw))
 	for i, s := range raw {
-		out[i] = service.SubnetEntry{CIDR: s.CIDR, Name: s.Name, Type: s.Type}
+		out[i] = service.SubnetEntry{CIDR: s.CIDR, Name: s.Name, Type: s.Type, Iface: s.Iface}
 	}
 	return out
 }
@@ -71,12 +71,14 @@ type UpdateInfo = domain.UpdateInfo
 // state/ types
 type Manifest = state.Manifest
 type LogBuffer = state.LogBuffer
+type TrafficHistory = state.TrafficHistory
 type logEntry = state.LogEntry
 
 var (
-	LoadManifest = state.LoadManifest
-	NewLogBuffer = state.NewLogBuffer
-	newLogEntry  = state.NewLogEntry
+	LoadManifest      = state.LoadManifest
+	NewLogBuffer      = state.NewLogBuffer
+	NewTrafficHistory = state.NewTrafficHistory
+	newLogEntry       = state.NewLogEntry
 )
 
 // Constants
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"os/exec"
-	"strconv"
 	"strings"
 	"time"
 
@@ -63,7 +61,7 @@ func runCleanup() error {
 	removeWgS2sUDAPIRules(ctx, uc)
 	removeWgS2sInterfaces()
 	removeSubnetsEntries(ctx, uc)
-	removeExitNodeRules()
+	removeExitNodeRules(ctx)
 
 	removeIntegrationResources()
 
@@ -286,50 +284,14 @@ func removeIntegrationResourcesByDiscovery(ic IntegrationAPI) {
 	slog.Info("cleanup: discovery fallback complete")
 }
 
-func removeExitNodeRules() {
-	for _, fam := range []string{"-4", "-6"} {
-		out, err := exec.Command("ip", fam, "rule", "show").Output()
-		if err != nil {
-			slog.Warn("cleanup: ip rule show failed", "family", fam, "err", err)
-			continue
-		}
-		lookupStr := fmt.Sprintf("lookup %d", service.ExitRouteTable)
-		scanner := bufio.NewScanner(strings.NewReader(string(out)))
-		for scanner.Scan() {
-			line := scanner.Text()
-			if !strings.Contains(line, lookupStr) {
-				continue
-			}
-			idx := strings.IndexByte(line, ':')
-			if idx <= 0 {
-				continue
-			}
-			prio, err := strconv.Atoi(strings.TrimSpace(line[:idx]))
-			if err != nil || prio < service.ExitRuleBasePrio || prio > service.ExitRuleMaxPrio {
-				continue
-			}
-			if delErr := exec.Command("ip", fam, "rule", "del", "prio", strconv.Itoa(prio)).Run(); delErr != nil {
-				slog.Warn("cleanup: exit node ip rule removal failed", "family", fam, "prio", prio, "err", delErr)
-			} else {
-				slog.Info("cleanup: exit node ip rule removed", "family", fam, "prio", prio)
-			}
-		}
-	}
-
-	masqRules := []struct {
-		cmd string
-		src string
-	}{
-		{"iptables", config.TailscaleCGNAT},
-		{"ip6tables", "fd7a:115c:a1e0::/48"},
-	}
-	for _, r := range masqRules {
-		if err := exec.Command(r.cmd, "-t", "nat", "-D", "POSTROUTING",
-			"-o", config.TailscaleInterface, "!", "-s", r.src,
-			"-j", "MASQUERADE", "-m", "comment", "--comment", service.ExitMasqComment).Run(); err == nil {
-			slog.Info("cleanup: exit node masquerade rule removed", "cmd", r.cmd)
-		}
+// removeExitNodeRules tears down the exit node rules, routes and masquerade
+// through the same backends the daemon installed them with.
+func removeExitNodeRules(ctx context.Context) {
+	if err := service.NewExitNodeService(nil, nil).Cleanup(ctx); err != nil {
+		slog.Warn("cleanup: exit node removal incomplete", "err", err)
+		return
 	}
+	slog.Info("cleanup: exit node rules removed")
 }
 
 func deleteResourceBestEffort(kind, id string, fn func() error) {
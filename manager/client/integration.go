@@ -155,6 +155,12 @@ func (c *IntegrationClient) HasAPIKey() bool {
 	return c.apiKey != ""
 }
 
+// WithAPIKey returns a client for the same endpoint using key, so a key can
+// be tried without replacing the one c holds.
+func (c *IntegrationClient) WithAPIKey(key string) domain.IntegrationAPI {
+	return &IntegrationClient{apiKey: key, baseURL: c.baseURL, httpClient: c.httpClient}
+}
+
 func (c *IntegrationClient) getAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -427,7 +433,23 @@ func (c *IntegrationClient) EnsureZone(ctx context.Context, siteID, name string)
 	return c.CreateZone(ctx, siteID, name)
 }
 
-func (c *IntegrationClient) EnsurePolicies(ctx context.Context, siteID, zoneName, zoneID string) ([]string, error) {
+// EnsurePolicies makes sure the policies between the zone and Internal
+// exist per rules, or the default allow-all pair when rules is empty, and
+// returns their IDs in order. Policies are found by name and adopted as they
+// are: content drift is logged and left for ReplacePolicies, which only an
+// explicit reconcile runs.
+func (c *IntegrationClient) EnsurePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return c.ensurePolicies(ctx, siteID, zoneName, zoneID, rules, false)
+}
+
+// ReplacePolicies is EnsurePolicies for a reconcile: a copy whose content
+// has drifted is replaced, the new copy created before the old one is
+// deleted so a template never leaves a gap.
+func (c *IntegrationClient) ReplacePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return c.ensurePolicies(ctx, siteID, zoneName, zoneID, rules, true)
+}
+
+func (c *IntegrationClient) ensurePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule, replace bool) ([]string, error) {
 	internalZoneID, err := c.FindInternalZoneID(ctx, siteID)
 	if err != nil {
 		return nil, fmt.Errorf("find internal zone: %w", err)
@@ -438,49 +460,58 @@ func (c *IntegrationClient) EnsurePolicies(ctx context.Context, siteID, zoneName
 		return nil, fmt.Errorf("list existing policies: %w", err)
 	}
 
-	wantPolicies := []CreatePolicyRequest{
-		{
-			Enabled:         true,
-			Name:            fmt.Sprintf("VPN Pack: Allow %s to Internal", zoneName),
-			Action:          domain.PolicyAction{Type: "ALLOW", AllowReturnTraffic: true},
-			Source:          domain.PolicyEndpoint{ZoneID: zoneID},
-			Destination:     domain.PolicyEndpoint{ZoneID: internalZoneID},
-			IPProtocolScope: domain.IPProtocolScope{IPVersion: "IPV4_AND_IPV6"},
-			LoggingEnabled:  false,
-		},
-		{
-			Enabled:         true,
-			Name:            fmt.Sprintf("VPN Pack: Allow Internal to %s", zoneName),
-			Action:          domain.PolicyAction{Type: "ALLOW", AllowReturnTraffic: true},
-			Source:          domain.PolicyEndpoint{ZoneID: internalZoneID},
-			Destination:     domain.PolicyEndpoint{ZoneID: zoneID},
-			IPProtocolScope: domain.IPProtocolScope{IPVersion: "IPV4_AND_IPV6"},
-			LoggingEnabled:  false,
-		},
-	}
-
 	var ids []string
-	for _, want := range wantPolicies {
-		if id := findExistingPolicy(existing, want.Name); id != "" {
+	for _, want := range domain.ZonePolicies(zoneName, zoneID, internalZoneID, rules) {
+		id, err := c.ensurePolicy(ctx, siteID, existing, want, replace)
+		if id != "" {
 			ids = append(ids, id)
-			continue
 		}
-		pol, err := c.CreatePolicy(ctx, siteID, want)
 		if err != nil {
-			return ids, fmt.Errorf("create policy %q: %w", want.Name, err)
+			return ids, err
 		}
-		ids = append(ids, pol.ID)
 	}
 	return ids, nil
 }
 
-func findExistingPolicy(policies []domain.Policy, name string) string {
-	for _, p := range policies {
-		if p.Name == name {
-			return p.ID
+// ensurePolicy returns the ID of the live copy of want, creating it if there
+// is none. Without replace the first copy by name is adopted whatever its
+// content; with it, a copy that matches is kept or created and the others
+// are deleted.
+func (c *IntegrationClient) ensurePolicy(ctx context.Context, siteID string, existing []domain.Policy, want domain.Policy, replace bool) (string, error) {
+	id, drifted := domain.MatchPolicy(existing, want)
+	if !replace {
+		if id == "" && len(drifted) > 0 {
+			slog.Warn("policy drifted, left for reconcile", "name", want.Name, "id", drifted[0])
+			return drifted[0], nil
 		}
+		drifted = nil
+	}
+	if id == "" {
+		pol, err := c.CreatePolicy(ctx, siteID, createPolicyRequest(want))
+		if err != nil {
+			return "", fmt.Errorf("create policy %q: %w", want.Name, err)
+		}
+		id = pol.ID
+	}
+	for _, old := range drifted {
+		if err := c.DeletePolicy(ctx, siteID, old); err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return id, fmt.Errorf("delete drifted policy %q: %w", want.Name, err)
+		}
+		slog.Info("replaced drifted policy", "name", want.Name, "old", old, "new", id)
+	}
+	return id, nil
+}
+
+func createPolicyRequest(p domain.Policy) CreatePolicyRequest {
+	return CreatePolicyRequest{
+		Enabled:         p.Enabled,
+		Name:            p.Name,
+		Action:          p.Action,
+		Source:          p.Source,
+		Destination:     p.Destination,
+		IPProtocolScope: p.IPProtocolScope,
+		LoggingEnabled:  p.LoggingEnabled,
 	}
-	return ""
 }
 
 func (c *IntegrationClient) DiscoverSiteID(ctx context.Context) (string, error) {
@@ -516,49 +547,24 @@ func (c *IntegrationClient) FindSystemZoneIDs(ctx context.Context, siteID string
 	return externalID, gatewayID, nil
 }
 
-func (c *IntegrationClient) createWanPortPolicy(ctx context.Context, siteID string, port int, name, externalZoneID, gatewayZoneID string) (*domain.Policy, error) {
-	req := CreatePolicyRequest{
-		Enabled: true,
-		Name:    name,
-		Action:  domain.PolicyAction{Type: "ALLOW", AllowReturnTraffic: false},
-		Source:  domain.PolicyEndpoint{ZoneID: externalZoneID},
-		Destination: domain.PolicyEndpoint{
-			ZoneID: gatewayZoneID,
-			TrafficFilter: &domain.TrafficFilter{
-				Type: "PORT",
-				PortFilter: domain.PortFilter{
-					Type:          "PORTS",
-					MatchOpposite: false,
-					Items:         []domain.PortFilterItem{{Type: "PORT_NUMBER", Value: port}},
-				},
-			},
-		},
-		IPProtocolScope: domain.IPProtocolScope{
-			IPVersion: "IPV4",
-			ProtocolFilter: &domain.ProtocolFilter{
-				Type:          "NAMED_PROTOCOL",
-				Protocol:      domain.ProtocolName{Name: "UDP"},
-				MatchOpposite: false,
-			},
-		},
-		LoggingEnabled: false,
-	}
-	return c.CreatePolicy(ctx, siteID, req)
+// EnsureWanPortPolicy returns the ID of the policy opening port, creating
+// it if no policy goes by name. A drifted copy is adopted as it is.
+func (c *IntegrationClient) EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, externalZoneID, gatewayZoneID string) (string, error) {
+	return c.ensureWanPortPolicy(ctx, siteID, port, name, externalZoneID, gatewayZoneID, false)
 }
 
-func (c *IntegrationClient) EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, externalZoneID, gatewayZoneID string) (string, error) {
+// ReplaceWanPortPolicy is EnsureWanPortPolicy for a reconcile: a copy whose
+// content has drifted is replaced.
+func (c *IntegrationClient) ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, externalZoneID, gatewayZoneID string) (string, error) {
+	return c.ensureWanPortPolicy(ctx, siteID, port, name, externalZoneID, gatewayZoneID, true)
+}
+
+func (c *IntegrationClient) ensureWanPortPolicy(ctx context.Context, siteID string, port int, name, externalZoneID, gatewayZoneID string, replace bool) (string, error) {
 	existing, err := c.ListPolicies(ctx, siteID)
 	if err != nil {
 		return "", fmt.Errorf("list existing policies: %w", err)
 	}
-	if id := findExistingPolicy(existing, name); id != "" {
-		return id, nil
-	}
-	pol, err := c.createWanPortPolicy(ctx, siteID, port, name, externalZoneID, gatewayZoneID)
-	if err != nil {
-		return "", fmt.Errorf("create WAN port policy %q: %w", name, err)
-	}
-	return pol.ID, nil
+	return c.ensurePolicy(ctx, siteID, existing, domain.WanPortPolicy(name, port, externalZoneID, gatewayZoneID), replace)
 }
 
 type createDNSPolicyRequest struct {
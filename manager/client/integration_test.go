@@ -162,7 +162,8 @@ func TestNoopIntegrationAPI_FailsClosed(t *testing.T) {
 		{"DiscoverSiteID", func() error { _, err := api.DiscoverSiteID(ctx); return err }},
 		{"CreateZone", func() error { _, err := api.CreateZone(ctx, "s", "n"); return err }},
 		{"EnsureZone", func() error { _, err := api.EnsureZone(ctx, "s", "n"); return err }},
-		{"EnsurePolicies", func() error { _, err := api.EnsurePolicies(ctx, "s", "n", "z"); return err }},
+		{"EnsurePolicies", func() error { _, err := api.EnsurePolicies(ctx, "s", "n", "z", nil); return err }},
+		{"ReplacePolicies", func() error { _, err := api.ReplacePolicies(ctx, "s", "n", "z", nil); return err }},
 		{"ListPolicies", func() error { _, err := api.ListPolicies(ctx, "s"); return err }},
 		{"DeletePolicy", func() error { return api.DeletePolicy(ctx, "s", "p") }},
 		{"DeleteZone", func() error { return api.DeleteZone(ctx, "s", "z") }},
@@ -170,6 +171,7 @@ func TestNoopIntegrationAPI_FailsClosed(t *testing.T) {
 		{"ListZones", func() error { _, err := api.ListZones(ctx, "s"); return err }},
 		{"FindSystemZoneIDs", func() error { _, _, err := api.FindSystemZoneIDs(ctx, "s"); return err }},
 		{"EnsureWanPortPolicy", func() error { _, err := api.EnsureWanPortPolicy(ctx, "s", 1, "n", "e", "g"); return err }},
+		{"ReplaceWanPortPolicy", func() error { _, err := api.ReplaceWanPortPolicy(ctx, "s", 1, "n", "e", "g"); return err }},
 		{"EnsureDNSForwardDomain", func() error { _, err := api.EnsureDNSForwardDomain(ctx, "s", "d", "ip"); return err }},
 		{"DeleteDNSPolicy", func() error { return api.DeleteDNSPolicy(ctx, "s", "p") }},
 		{"ListDNSPolicies", func() error { _, err := api.ListDNSPolicies(ctx, "s"); return err }},
@@ -411,53 +413,6 @@ func TestIntegrationDiscoverSiteID(t *testing.T) {
 	}
 }
 
-func TestFindExistingPolicy(t *testing.T) {
-	policies := []domain.Policy{
-		{ID: "pol-1", Name: "VPN Pack: Allow Tailscale to Internal"},
-		{ID: "pol-2", Name: "VPN Pack: Allow Internal to Tailscale"},
-		{ID: "pol-3", Name: "Block All"},
-	}
-
-	tests := []struct {
-		name     string
-		policies []domain.Policy
-		search   string
-		wantID   string
-	}{
-		{
-			name:     "found first",
-			policies: policies,
-			search:   "VPN Pack: Allow Tailscale to Internal",
-			wantID:   "pol-1",
-		},
-		{
-			name:     "found last",
-			policies: policies,
-			search:   "Block All",
-			wantID:   "pol-3",
-		},
-		{
-			name:     "not found",
-			policies: policies,
-			search:   "Nonexistent Policy",
-			wantID:   "",
-		},
-		{
-			name:     "empty slice",
-			policies: nil,
-			search:   "Any",
-			wantID:   "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := findExistingPolicy(tt.policies, tt.search)
-			assert.Equal(t, tt.wantID, got)
-		})
-	}
-}
-
 func TestWanPortPolicyName(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -614,3 +569,129 @@ func TestIntegrationErrorsOmitUpstreamBody(t *testing.T) {
 		})
 	}
 }
+
+// policyAPI is an in-memory firewall policy store behind the Integration
+// API routes EnsurePolicies uses.
+type policyAPI struct {
+	policies []domain.Policy
+	next     int
+	deleted  []string
+}
+
+func (a *policyAPI) handler(t *testing.T) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := func(data any) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+		}
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/firewall/zones"):
+			list([]domain.Zone{{ID: "z-internal", Name: "Internal"}})
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/firewall/policies"):
+			list(a.policies)
+		case r.Method == "POST":
+			var p domain.Policy
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+			a.next++
+			p.ID = fmt.Sprintf("new-%d", a.next)
+			a.policies = append(a.policies, p)
+			_ = json.NewEncoder(w).Encode(p)
+		case r.Method == "DELETE":
+			id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			a.deleted = append(a.deleted, id)
+		default:
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestEnsurePolicies_Template(t *testing.T) {
+	api := &policyAPI{}
+	ic := newTestIntegrationClient(t, api.handler(t))
+	rules := []domain.PolicyRule{
+		{Name: "RDP", Direction: domain.PolicyInbound, Action: "ALLOW", Protocol: "TCP", Ports: []int{3389}, Destinations: []string{"192.168.10.0/24", "192.168.20.5"}},
+		{Name: "Printers", Direction: domain.PolicyOutbound, Action: "BLOCK"},
+	}
+
+	ids, err := ic.EnsurePolicies(context.Background(), "s1", "Tailscale", "z-ts", rules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-1", "new-2"}, ids)
+
+	rdp := api.policies[0]
+	assert.Equal(t, "VPN Pack: Tailscale: RDP", rdp.Name)
+	assert.Equal(t, "z-ts", rdp.Source.ZoneID)
+	assert.Equal(t, "z-internal", rdp.Destination.ZoneID)
+	assert.True(t, rdp.Action.AllowReturnTraffic)
+	require.NotNil(t, rdp.Destination.TrafficFilter)
+	assert.Equal(t, "IP_ADDRESS", rdp.Destination.TrafficFilter.Type)
+	assert.Equal(t, []domain.IPAddressFilterItem{
+		{Type: "SUBNET", Value: "192.168.10.0/24"},
+		{Type: "IP_ADDRESS", Value: "192.168.20.5"},
+	}, rdp.Destination.TrafficFilter.IPAddressFilter.Items)
+	assert.Equal(t, []domain.PortFilterItem{{Type: "PORT_NUMBER", Value: 3389}}, rdp.Destination.TrafficFilter.PortFilter.Items)
+	assert.Equal(t, "IPV4", rdp.IPProtocolScope.IPVersion)
+	assert.Equal(t, "TCP", rdp.IPProtocolScope.ProtocolFilter.Protocol.Name)
+
+	block := api.policies[1]
+	assert.Equal(t, "z-internal", block.Source.ZoneID)
+	assert.Equal(t, "z-ts", block.Destination.ZoneID)
+	assert.False(t, block.Action.AllowReturnTraffic)
+	assert.Nil(t, block.Destination.TrafficFilter)
+
+	// Unchanged policies are found again, not recreated.
+	ids, err = ic.EnsurePolicies(context.Background(), "s1", "Tailscale", "z-ts", rules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-1", "new-2"}, ids)
+	assert.Empty(t, api.deleted)
+}
+
+func TestEnsurePolicies_DriftedPolicy(t *testing.T) {
+	api := &policyAPI{}
+	ic := newTestIntegrationClient(t, api.handler(t))
+	ctx := context.Background()
+
+	ids, err := ic.EnsurePolicies(ctx, "s1", "Branch", "z-br", nil)
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+	assert.Equal(t, "VPN Pack: Allow Branch to Internal", api.policies[0].Name)
+
+	// Someone disables one of ours in the UniFi UI.
+	api.policies[0].Enabled = false
+	ids, err = ic.EnsurePolicies(ctx, "s1", "Branch", "z-br", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-1", "new-2"}, ids, "setup adopts the edited copy")
+	assert.Len(t, api.policies, 2)
+	assert.Empty(t, api.deleted)
+
+	ids, err = ic.ReplacePolicies(ctx, "s1", "Branch", "z-br", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-3", "new-2"}, ids)
+	assert.Equal(t, []string{"new-1"}, api.deleted, "the drifted copy goes once its replacement exists")
+}
+
+func TestEnsureWanPortPolicy_DriftedPolicy(t *testing.T) {
+	api := &policyAPI{}
+	ic := newTestIntegrationClient(t, api.handler(t))
+	ctx := context.Background()
+	name := WanPortPolicyName(41641, config.WanMarkerTailscaleWG)
+
+	id, err := ic.EnsureWanPortPolicy(ctx, "s1", 41641, name, "z-ext", "z-gw")
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", id)
+
+	id, err = ic.EnsureWanPortPolicy(ctx, "s1", 41641, name, "z-ext", "z-gw")
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", id, "an intact policy is found again")
+
+	// Someone widens it to TCP in the UniFi UI.
+	api.policies[0].IPProtocolScope.ProtocolFilter.Protocol.Name = "TCP_UDP"
+	id, err = ic.EnsureWanPortPolicy(ctx, "s1", 41641, name, "z-ext", "z-gw")
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", id, "opening the port adopts the edited copy")
+	assert.Empty(t, api.deleted)
+
+	id, err = ic.ReplaceWanPortPolicy(ctx, "s1", 41641, name, "z-ext", "z-gw")
+	require.NoError(t, err)
+	assert.Equal(t, "new-2", id)
+	assert.Equal(t, []string{"new-1"}, api.deleted)
+}
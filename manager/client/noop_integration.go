@@ -25,6 +25,8 @@ func NoopIntegrationAPI() domain.IntegrationAPI { return noopIntegrationAPI{} }
 func (noopIntegrationAPI) HasAPIKey() bool { return false }
 func (noopIntegrationAPI) SetAPIKey(string) {}
 
+func (n noopIntegrationAPI) WithAPIKey(string) domain.IntegrationAPI { return n }
+
 func (noopIntegrationAPI) Validate(context.Context) (*domain.AppInfo, error) {
 	return nil, ErrIntegrationDisabled
 }
@@ -41,7 +43,11 @@ func (noopIntegrationAPI) EnsureZone(context.Context, string, string) (*domain.Z
 	return nil, ErrIntegrationDisabled
 }
 
-func (noopIntegrationAPI) EnsurePolicies(context.Context, string, string, string) ([]string, error) {
+func (noopIntegrationAPI) EnsurePolicies(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+	return nil, ErrIntegrationDisabled
+}
+
+func (noopIntegrationAPI) ReplacePolicies(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
 	return nil, ErrIntegrationDisabled
 }
 
@@ -73,6 +79,10 @@ func (noopIntegrationAPI) EnsureWanPortPolicy(context.Context, string, int, stri
 	return "", ErrIntegrationDisabled
 }
 
+func (noopIntegrationAPI) ReplaceWanPortPolicy(context.Context, string, int, string, string, string) (string, error) {
+	return "", ErrIntegrationDisabled
+}
+
 func (noopIntegrationAPI) EnsureDNSForwardDomain(context.Context, string, string, string) (*domain.DNSPolicy, error) {
 	return nil, ErrIntegrationDisabled
 }
@@ -9,6 +9,8 @@ const (
 	NginxConfigSrc         = PersistentBase + "/config/nginx-vpnpack.conf"
 	NginxTokenPath         = PersistentBase + "/config/nginx-token"
 	WgS2sConfigDir         = PersistentBase + "/config/wg-s2s"
+	ManifestSnapshotDir    = PersistentBase + "/config/manifest-snapshots"
+	TrafficHistoryPath     = PersistentBase + "/traffic-history.json"
 	TailscaledDefaultsPath = PersistentBase + "/tailscaled.defaults"
 	VersionFilePath        = PersistentBase + "/VERSION"
 )
@@ -20,6 +22,7 @@ const (
 	NginxConfigDest = NginxConfigDir + "/shared-runnable-vpnpack.conf"
 	NginxConfigFile = "shared-runnable-vpnpack.conf"
 	UniFiCertPath   = "/data/unifi-core/config/unifi-core.crt"
+	DHCPLeasesPath  = "/data/udapi-config/dnsmasq.lease"
 )
 
 const (
@@ -63,6 +66,39 @@ const IntegrationCacheTTL = 30 * time.Second
 
 const LogReconnectDelay = 2 * time.Second
 
+// WgS2sEndpointResolve is how often S2S peers with a DDNS endpoint and a
+// stale handshake get their hostname looked up again.
+const WgS2sEndpointResolve = 30 * time.Second
+
+// WgS2sFailoverCheck is the interval of the S2S failover health monitor.
+const WgS2sFailoverCheck = 10 * time.Second
+
+// ExitFailoverCheck is the interval of the remote exit node failover
+// monitor; ExitFailoverGrace is the grace period of a policy without its own.
+const (
+	ExitFailoverCheck = 10 * time.Second
+	ExitFailoverGrace = time.Minute
+)
+
+// WgS2sReachabilityCheck is the interval of the S2S reachability probes.
+const WgS2sReachabilityCheck = 30 * time.Second
+
+// TrafficHistorySave is how often the traffic history is written to
+// TrafficHistoryPath; it is also written on shutdown.
+const TrafficHistorySave = 15 * time.Minute
+
+// ExitDestinationRefresh is how often the domains of a destinations-mode
+// exit policy are re-resolved into their ipsets.
+const ExitDestinationRefresh = 5 * time.Minute
+
+// ManifestSnapshots is how many snapshots of the manifest are kept in
+// ManifestSnapshotDir, one per save.
+const ManifestSnapshots = 30
+
+// IntegrationInventory is how often the Integration API objects we own are
+// listed to look for orphans.
+const IntegrationInventory = 15 * time.Minute
+
 const TailscaleInterface = "tailscale0"
 
 const MongoPort = "27117"
@@ -6,4 +6,6 @@ var (
 	ErrUnauthorized   = errors.New("integration API: unauthorized (invalid or missing API key)")
 	ErrNotFound       = errors.New("integration API: resource not found")
 	ErrIntegrationAPI = errors.New("integration API error")
+
+	ErrSnapshotNotFound = errors.New("manifest snapshot not found")
 )
@@ -47,21 +47,31 @@ type ManifestStore interface {
 
 	GetExitNodePolicy() ExitNodePolicy
 	SetExitNodePolicy(p ExitNodePolicy) error
+	GetExitSchedules() []ExitSchedule
+	SetExitSchedules(s []ExitSchedule) error
+	GetPolicyTemplates() []PolicyTemplate
+	SetPolicyTemplates(t []PolicyTemplate) error
 
 	GetAdvertiseExitNodeEnabled() bool
 	SetAdvertiseExitNode(enabled bool) error
 	GetRemoteExitNode() *RemoteExitNode
 	SetRemoteExitNode(r *RemoteExitNode) error
+
+	ListSnapshots() ([]ManifestSnapshot, error)
+	DiffSnapshot(fromID, toID string) ([]ManifestChange, error)
+	RestoreSnapshot(id string) error
 }
 
 type IntegrationAPI interface {
 	SetAPIKey(key string)
 	HasAPIKey() bool
+	WithAPIKey(key string) IntegrationAPI
 	Validate(ctx context.Context) (*AppInfo, error)
 	DiscoverSiteID(ctx context.Context) (string, error)
 	CreateZone(ctx context.Context, siteID, name string) (*Zone, error)
 	EnsureZone(ctx context.Context, siteID, name string) (*Zone, error)
-	EnsurePolicies(ctx context.Context, siteID, name, zoneID string) ([]string, error)
+	EnsurePolicies(ctx context.Context, siteID, name, zoneID string, rules []PolicyRule) ([]string, error)
+	ReplacePolicies(ctx context.Context, siteID, name, zoneID string, rules []PolicyRule) ([]string, error)
 	ListPolicies(ctx context.Context, siteID string) ([]Policy, error)
 	DeletePolicy(ctx context.Context, siteID, policyID string) error
 	DeleteZone(ctx context.Context, siteID, zoneID string) error
@@ -69,6 +79,7 @@ type IntegrationAPI interface {
 	ListZones(ctx context.Context, siteID string) ([]Zone, error)
 	FindSystemZoneIDs(ctx context.Context, siteID string) (string, string, error)
 	EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
 	EnsureDNSForwardDomain(ctx context.Context, siteID, domain, resolverIP string) (*DNSPolicy, error)
 	DeleteDNSPolicy(ctx context.Context, siteID, policyID string) error
 	ListDNSPolicies(ctx context.Context, siteID string) ([]DNSPolicy, error)
@@ -125,5 +136,12 @@ type WgS2sControl interface {
 	GetTunnels() []TunnelConfig
 	GetStatuses() []WgS2sStatus
 	GetPublicKey(id string) (string, error)
+	GetPresharedKey(id, peerPublicKey string) (string, error)
+	PrepareKeyRotation(id string, scheduledAt time.Time) (*WgKeyRotation, error)
+	CommitKeyRotation(id string) error
+	CancelKeyRotation(id string) error
+	ReResolveEndpoints(ctx context.Context, now time.Time) []WgS2sEndpointChange
+	CheckFailover(ctx context.Context, now time.Time) []WgS2sFailoverEvent
+	RunReachabilityProbes(ctx context.Context, now time.Time) []WgS2sReachabilityEvent
 	Close()
 }
@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ZonePolicies is the desired set of policies between a VPN Pack zone and
+// Internal: one per template rule, or the default allow-all pair when rules
+// is empty. Rules are validated by the service layer; here they are only
+// translated. IDs are left empty.
+func ZonePolicies(zoneName, zoneID, internalZoneID string, rules []PolicyRule) []Policy {
+	if len(rules) == 0 {
+		return []Policy{
+			{
+				Enabled:         true,
+				Name:            fmt.Sprintf("VPN Pack: Allow %s to Internal", zoneName),
+				Action:          PolicyAction{Type: "ALLOW", AllowReturnTraffic: true},
+				Source:          PolicyEndpoint{ZoneID: zoneID},
+				Destination:     PolicyEndpoint{ZoneID: internalZoneID},
+				IPProtocolScope: IPProtocolScope{IPVersion: "IPV4_AND_IPV6"},
+			},
+			{
+				Enabled:         true,
+				Name:            fmt.Sprintf("VPN Pack: Allow Internal to %s", zoneName),
+				Action:          PolicyAction{Type: "ALLOW", AllowReturnTraffic: true},
+				Source:          PolicyEndpoint{ZoneID: internalZoneID},
+				Destination:     PolicyEndpoint{ZoneID: zoneID},
+				IPProtocolScope: IPProtocolScope{IPVersion: "IPV4_AND_IPV6"},
+			},
+		}
+	}
+	out := make([]Policy, 0, len(rules))
+	for _, r := range rules {
+		src, dst := zoneID, internalZoneID
+		if r.Direction == PolicyOutbound {
+			src, dst = internalZoneID, zoneID
+		}
+		out = append(out, Policy{
+			Enabled:         true,
+			Name:            fmt.Sprintf("VPN Pack: %s: %s", zoneName, r.Name),
+			Action:          PolicyAction{Type: r.Action, AllowReturnTraffic: r.Action == "ALLOW"},
+			Source:          PolicyEndpoint{ZoneID: src},
+			Destination:     PolicyEndpoint{ZoneID: dst, TrafficFilter: ruleTrafficFilter(r)},
+			IPProtocolScope: ruleProtocolScope(r),
+		})
+	}
+	return out
+}
+
+// WanPortPolicy is the desired policy opening UDP port on the WAN.
+func WanPortPolicy(name string, port int, externalZoneID, gatewayZoneID string) Policy {
+	return Policy{
+		Enabled: true,
+		Name:    name,
+		Action:  PolicyAction{Type: "ALLOW", AllowReturnTraffic: false},
+		Source:  PolicyEndpoint{ZoneID: externalZoneID},
+		Destination: PolicyEndpoint{
+			ZoneID: gatewayZoneID,
+			TrafficFilter: &TrafficFilter{
+				Type: "PORT",
+				PortFilter: &PortFilter{
+					Type:  "PORTS",
+					Items: []PortFilterItem{{Type: "PORT_NUMBER", Value: port}},
+				},
+			},
+		},
+		IPProtocolScope: IPProtocolScope{
+			IPVersion: "IPV4",
+			ProtocolFilter: &ProtocolFilter{
+				Type:     "NAMED_PROTOCOL",
+				Protocol: ProtocolName{Name: "UDP"},
+			},
+		},
+	}
+}
+
+func ruleTrafficFilter(r PolicyRule) *TrafficFilter {
+	var ports *PortFilter
+	if len(r.Ports) > 0 {
+		ports = &PortFilter{Type: "PORTS"}
+		for _, p := range r.Ports {
+			ports.Items = append(ports.Items, PortFilterItem{Type: "PORT_NUMBER", Value: p})
+		}
+	}
+	if len(r.Destinations) == 0 {
+		if ports == nil {
+			return nil
+		}
+		return &TrafficFilter{Type: "PORT", PortFilter: ports}
+	}
+	addrs := &IPAddressFilter{Type: "IP_ADDRESSES"}
+	for _, d := range r.Destinations {
+		item := IPAddressFilterItem{Type: "IP_ADDRESS", Value: d}
+		if strings.Contains(d, "/") {
+			item.Type = "SUBNET"
+		}
+		addrs.Items = append(addrs.Items, item)
+	}
+	return &TrafficFilter{Type: "IP_ADDRESS", IPAddressFilter: addrs, PortFilter: ports}
+}
+
+// ruleProtocolScope narrows the IP version to the destinations' family,
+// which the API requires once addresses are matched.
+func ruleProtocolScope(r PolicyRule) IPProtocolScope {
+	scope := IPProtocolScope{IPVersion: "IPV4_AND_IPV6"}
+	if len(r.Destinations) > 0 {
+		scope.IPVersion = "IPV4"
+		if strings.Contains(r.Destinations[0], ":") {
+			scope.IPVersion = "IPV6"
+		}
+	}
+	if r.Protocol != "" {
+		scope.ProtocolFilter = &ProtocolFilter{
+			Type:     "NAMED_PROTOCOL",
+			Protocol: ProtocolName{Name: r.Protocol},
+		}
+	}
+	return scope
+}
+
+// PolicyDrift lists the fields, by their JSON name, in which a live policy
+// differs from the desired one. ID, name, metadata and logging, which is
+// left to the operator, are not compared.
+func PolicyDrift(have, want Policy) []string {
+	var fields []string
+	for _, f := range []struct {
+		name       string
+		have, want any
+	}{
+		{"enabled", have.Enabled, want.Enabled},
+		{"action", have.Action, want.Action},
+		{"source", have.Source, want.Source},
+		{"destination", have.Destination, want.Destination},
+		{"ipProtocolScope", have.IPProtocolScope, want.IPProtocolScope},
+	} {
+		if !jsonEqual(f.have, f.want) {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
+
+// jsonEqual compares the wire form, which is what the API acts on.
+func jsonEqual(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(x) == string(y)
+}
+
+// MatchPolicy looks want up by name among live: the ID of the first copy
+// with no drift, and the IDs of the other copies. Policies the API derived
+// for return traffic are not ours to manage.
+func MatchPolicy(live []Policy, want Policy) (id string, others []string) {
+	for _, p := range live {
+		if p.Name != want.Name || (p.Metadata != nil && p.Metadata.Origin == PolicyOriginDerived) {
+			continue
+		}
+		if id == "" && len(PolicyDrift(p, want)) == 0 {
+			id = p.ID
+			continue
+		}
+		others = append(others, p.ID)
+	}
+	return id, others
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestZonePoliciesDefaultPair(t *testing.T) {
+	got := ZonePolicies("Tailscale", "z-ts", "z-int", nil)
+	if len(got) != 2 {
+		t.Fatalf("len = %d, want 2", len(got))
+	}
+	if got[0].Name != "VPN Pack: Allow Tailscale to Internal" || got[0].Source.ZoneID != "z-ts" || got[0].Destination.ZoneID != "z-int" {
+		t.Fatalf("inbound policy = %+v", got[0])
+	}
+	if got[1].Name != "VPN Pack: Allow Internal to Tailscale" || got[1].Source.ZoneID != "z-int" || got[1].Destination.ZoneID != "z-ts" {
+		t.Fatalf("outbound policy = %+v", got[1])
+	}
+}
+
+func TestPolicyDrift(t *testing.T) {
+	want := ZonePolicies("Branch", "z-br", "z-int", []PolicyRule{{
+		Name: "RDP", Direction: PolicyInbound, Action: "ALLOW",
+		Protocol: "TCP", Ports: []int{3389}, Destinations: []string{"192.168.10.0/24"},
+	}})[0]
+
+	// A live policy round-trips through the API's JSON and carries its ID,
+	// metadata and logging flag; none of that is drift.
+	b, _ := json.Marshal(want)
+	var live Policy
+	if err := json.Unmarshal(b, &live); err != nil {
+		t.Fatal(err)
+	}
+	live.ID, live.LoggingEnabled = "p1", true
+	live.Metadata = &PolicyMetadata{Origin: PolicyOriginUserDefined}
+	if d := PolicyDrift(live, want); len(d) != 0 {
+		t.Fatalf("drift of an intact policy = %v", d)
+	}
+
+	live.Enabled = false
+	live.Action.Type = "BLOCK"
+	live.Destination.TrafficFilter.PortFilter.Items[0].Value = 3390
+	if d := PolicyDrift(live, want); !slices.Equal(d, []string{"enabled", "action", "destination"}) {
+		t.Fatalf("drift = %v", d)
+	}
+}
+
+func TestMatchPolicy(t *testing.T) {
+	want := ZonePolicies("Tailscale", "z-ts", "z-int", nil)[0]
+	edited := want
+	edited.ID, edited.Enabled = "edited", false
+	intact := want
+	intact.ID = "intact"
+	derived := Policy{ID: "d", Name: want.Name, Metadata: &PolicyMetadata{Origin: PolicyOriginDerived}}
+
+	id, others := MatchPolicy([]Policy{edited, derived, intact}, want)
+	if id != "intact" || !slices.Equal(others, []string{"edited"}) {
+		t.Fatalf("MatchPolicy = %q, %v", id, others)
+	}
+	id, others = MatchPolicy([]Policy{derived}, want)
+	if id != "" || len(others) != 0 {
+		t.Fatalf("derived policies must be ignored, got %q, %v", id, others)
+	}
+}
@@ -83,9 +83,12 @@ type PolicyEndpoint struct {
 	TrafficFilter *TrafficFilter `json:"trafficFilter,omitempty"`
 }
 
+// TrafficFilter narrows a policy endpoint. Type "PORT" carries a PortFilter;
+// "IP_ADDRESS" an IPAddressFilter and, optionally, a PortFilter.
 type TrafficFilter struct {
-	Type       string     `json:"type"`
-	PortFilter PortFilter `json:"portFilter"`
+	Type            string           `json:"type"`
+	PortFilter      *PortFilter      `json:"portFilter,omitempty"`
+	IPAddressFilter *IPAddressFilter `json:"ipAddressFilter,omitempty"`
 }
 
 type PortFilter struct {
@@ -99,6 +102,18 @@ type PortFilterItem struct {
 	Value int    `json:"value"`
 }
 
+type IPAddressFilter struct {
+	Type          string                `json:"type"`
+	MatchOpposite bool                  `json:"matchOpposite"`
+	Items         []IPAddressFilterItem `json:"items"`
+}
+
+// IPAddressFilterItem is one address (Type "IP_ADDRESS") or CIDR ("SUBNET").
+type IPAddressFilterItem struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
 type IPProtocolScope struct {
 	IPVersion      string          `json:"ipVersion,omitempty"`
 	ProtocolFilter *ProtocolFilter `json:"protocolFilter,omitempty"`
@@ -114,6 +129,36 @@ type ProtocolName struct {
 	Name string `json:"name"`
 }
 
+// PolicyDirection is the way a PolicyRule lets traffic flow: inbound from a
+// VPN Pack zone to Internal, outbound from Internal to the zone.
+type PolicyDirection string
+
+const (
+	PolicyInbound  PolicyDirection = "inbound"
+	PolicyOutbound PolicyDirection = "outbound"
+)
+
+// PolicyRule is one firewall policy of a PolicyTemplate. Action is "ALLOW"
+// or "BLOCK". Protocol ("TCP" or "UDP", empty for any) and Ports restrict
+// the service; Destinations, addresses or CIDRs, restrict the hosts on the
+// receiving side. Leaving all three empty matches the whole zone pair.
+type PolicyRule struct {
+	Name         string          `json:"name"`
+	Direction    PolicyDirection `json:"direction"`
+	Action       string          `json:"action"`
+	Protocol     string          `json:"protocol,omitempty"`
+	Ports        []int           `json:"ports,omitempty"`
+	Destinations []string        `json:"destinations,omitempty"`
+}
+
+// PolicyTemplate replaces the default allow-all policy pair between a VPN
+// Pack zone and Internal with Rules. Zone is the name the zone was set up
+// with: "Tailscale", or the zone name of a WireGuard S2S tunnel.
+type PolicyTemplate struct {
+	Zone  string       `json:"zone"`
+	Rules []PolicyRule `json:"rules"`
+}
+
 type SiteInfo struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -123,6 +168,22 @@ type AppInfo struct {
 	ApplicationVersion string `json:"applicationVersion"`
 }
 
+// ManifestSnapshot is the manifest as one of its saves wrote it.
+type ManifestSnapshot struct {
+	ID      string    `json:"id"`
+	TakenAt time.Time `json:"takenAt"`
+}
+
+// ManifestChange is a value that differs between two versions of the
+// manifest. Path is its JSON path, such as "wgS2s.t1.zoneId" or
+// "tailscale.policyIds[1]"; From is absent for an added value and To for a
+// removed one.
+type ManifestChange struct {
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
 type DNSPolicy struct {
 	ID        string `json:"id"`
 	Type      string `json:"type"`
@@ -134,33 +195,114 @@ type DNSPolicy struct {
 type ExitNodeMode string
 
 const (
-	ExitNodeOff       ExitNodeMode = "off"
-	ExitNodeAll       ExitNodeMode = "all"
-	ExitNodeSelective ExitNodeMode = "selective"
+	ExitNodeOff          ExitNodeMode = "off"
+	ExitNodeAll          ExitNodeMode = "all"
+	ExitNodeSelective    ExitNodeMode = "selective"
+	ExitNodeDestinations ExitNodeMode = "destinations"
+	ExitNodeNetworks     ExitNodeMode = "networks"
 )
 
+// ExitNodeClient is one selective-mode client, given either by IP/CIDR or
+// by MAC address. A MAC client follows its device across DHCP leases. With
+// Schedule set, the client is only routed while that schedule is active.
 type ExitNodeClient struct {
-	IP    string `json:"ip"`
-	Label string `json:"label,omitempty"`
-}
-
+	IP       string `json:"ip,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// ExitSchedule is a named time window for exit node routing. It is active
+// during every minute, in the gateway's local time, that one of its Cron
+// expressions matches. The expressions use the five cron fields (minute,
+// hour, day of month, month, day of week), so "* 8-14 * * mon-fri" covers
+// 08:00 to 14:59 on weekdays.
+type ExitSchedule struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Cron []string `json:"cron"`
+}
+
+// ExitNodePolicy selects what goes through the remote exit node: traffic
+// from every LAN bridge (all), from Clients (selective), from the subnets of
+// the UniFi Networks whose interfaces are listed in Networks (networks), or
+// to Destinations and to the addresses Domains resolve to (destinations).
+// KillSwitch makes that traffic unreachable while the exit route is down,
+// instead of letting it fall back to the WAN. With Schedule set, the policy
+// only routes anything while that ExitSchedule is active.
 type ExitNodePolicy struct {
-	Mode    ExitNodeMode     `json:"mode"`
-	Clients []ExitNodeClient `json:"clients,omitempty"`
-}
-
+	Mode         ExitNodeMode     `json:"mode"`
+	Clients      []ExitNodeClient `json:"clients,omitempty"`
+	Networks     []string         `json:"networks,omitempty"`
+	Destinations []string         `json:"destinations,omitempty"`
+	Domains      []string         `json:"domains,omitempty"`
+	KillSwitch   bool             `json:"killSwitch,omitempty"`
+	Schedule     string           `json:"schedule,omitempty"`
+}
+
+// RemoteExitNode is the exit peer this gateway uses. Candidates, when set,
+// is its failover order: the primary first, then the backups. PeerID is
+// whichever candidate is active. FailoverGraceSec is how long a peer must
+// stay offline before it is left, and how long the primary must stay online
+// before it is taken back.
 type RemoteExitNode struct {
-	PeerID  string           `json:"peerId"`
-	Mode    ExitNodeMode     `json:"mode"`
-	Clients []ExitNodeClient `json:"clients,omitempty"`
+	PeerID           string           `json:"peerId"`
+	Mode             ExitNodeMode     `json:"mode"`
+	Clients          []ExitNodeClient `json:"clients,omitempty"`
+	Networks         []string         `json:"networks,omitempty"`
+	Destinations     []string         `json:"destinations,omitempty"`
+	Domains          []string         `json:"domains,omitempty"`
+	KillSwitch       bool             `json:"killSwitch,omitempty"`
+	Schedule         string           `json:"schedule,omitempty"`
+	Candidates       []string         `json:"candidates,omitempty"`
+	FailoverGraceSec int              `json:"failoverGraceSec,omitempty"`
+}
+
+// Policy is the local routing policy the remote exit node runs with.
+func (r *RemoteExitNode) Policy() ExitNodePolicy {
+	return ExitNodePolicy{
+		Mode:         r.Mode,
+		Clients:      r.Clients,
+		Networks:     r.Networks,
+		Destinations: r.Destinations,
+		Domains:      r.Domains,
+		KillSwitch:   r.KillSwitch,
+		Schedule:     r.Schedule,
+	}
 }
 
 type RemoteExitNodeStatus struct {
-	PeerID   string           `json:"peerId"`
-	HostName string           `json:"hostName"`
-	Online   bool             `json:"online"`
-	Mode     string           `json:"mode"`
-	Clients  []ExitNodeClient `json:"clients,omitempty"`
+	PeerID           string                `json:"peerId"`
+	HostName         string                `json:"hostName"`
+	Online           bool                  `json:"online"`
+	Mode             string                `json:"mode"`
+	Clients          []ExitNodeClient      `json:"clients,omitempty"`
+	Networks         []string              `json:"networks,omitempty"`
+	Destinations     []string              `json:"destinations,omitempty"`
+	Domains          []string              `json:"domains,omitempty"`
+	KillSwitch       bool                  `json:"killSwitch,omitempty"`
+	Schedule         string                `json:"schedule,omitempty"`
+	Candidates       []RemoteExitCandidate `json:"candidates,omitempty"`
+	FailoverGraceSec int                   `json:"failoverGraceSec,omitempty"`
+	FailedOver       bool                  `json:"failedOver,omitempty"`
+}
+
+// RemoteExitCandidate is one entry of the failover order as last seen in
+// the tailnet.
+type RemoteExitCandidate struct {
+	PeerID   string `json:"peerId"`
+	HostName string `json:"hostName"`
+	Online   bool   `json:"online"`
+}
+
+// RemoteExitFailoverEvent is one switch of the remote exit node between
+// failover candidates.
+type RemoteExitFailoverEvent struct {
+	From     string `json:"from"`
+	FromName string `json:"fromName"`
+	To       string `json:"to"`
+	ToName   string `json:"toName"`
+	Reason   string `json:"reason"`
 }
 
 type SubnetConflict struct {
@@ -279,6 +421,8 @@ type RoutingWarning struct {
 	Severity string `json:"severity"`
 	Message  string `json:"message"`
 	Value    string `json:"value,omitempty"`
+	// Fixable means POST /api/routing-health/fix/{check} can remediate it.
+	Fixable bool `json:"fixable,omitempty"`
 }
 
 type RoutingHealth struct {
@@ -2,35 +2,200 @@ package domain
 
 import "time"
 
+// TunnelConfig describes one wg-s2sN interface. Peers is the source of truth
+// for the remote side; PeerPublicKey/PeerEndpoint mirror the first peer and
+// AllowedIPs is the union of every peer's AllowedIPs, so single-peer clients
+// and the firewall/ipset paths keep working unchanged on hub tunnels.
+// TunnelAddresses holds the interface addresses, at most one per family;
+// TunnelAddress mirrors the first so IPv4-only clients see what they always
+// did.
+// PresharedKey is write-only: it is folded into the first peer on create or
+// update and never returned or written to tunnels.json. On update an empty
+// PresharedKey keeps the peer's PSK; ClearPresharedKey removes it.
+// KeyCreatedAt is when the current private key was generated; it is zero on
+// configs that predate key rotation, where CreatedAt stands in.
+// Failover, when set, makes the tunnel a member of a failover group.
+// Probes are reachability checks into the remote subnets; on update a
+// non-nil list replaces them and an empty one removes them all.
 type TunnelConfig struct {
-	ID                  string    `json:"id"`
-	Name                string    `json:"name"`
-	InterfaceName       string    `json:"interfaceName"`
-	ListenPort          int       `json:"listenPort"`
-	TunnelAddress       string    `json:"tunnelAddress"`
-	PeerPublicKey       string    `json:"peerPublicKey"`
-	PeerEndpoint        string    `json:"peerEndpoint"`
-	AllowedIPs          []string  `json:"allowedIPs"`
-	LocalSubnets        []string  `json:"localSubnets,omitempty"`
-	PersistentKeepalive int       `json:"persistentKeepalive"`
-	MTU                 int       `json:"mtu"`
-	RouteMetric         int       `json:"routeMetric,omitempty"`
-	Enabled             bool      `json:"enabled"`
-	CreatedAt           time.Time `json:"createdAt"`
+	ID                  string          `json:"id"`
+	Name                string          `json:"name"`
+	InterfaceName       string          `json:"interfaceName"`
+	ListenPort          int             `json:"listenPort"`
+	TunnelAddress       string          `json:"tunnelAddress"`
+	TunnelAddresses     []string        `json:"tunnelAddresses,omitempty"`
+	PeerPublicKey       string          `json:"peerPublicKey"`
+	PeerEndpoint        string          `json:"peerEndpoint"`
+	AllowedIPs          []string        `json:"allowedIPs"`
+	PresharedKey        string          `json:"presharedKey,omitempty"`
+	ClearPresharedKey   bool            `json:"clearPresharedKey,omitempty"`
+	Peers               []WgPeer        `json:"peers,omitempty"`
+	LocalSubnets        []string        `json:"localSubnets,omitempty"`
+	PersistentKeepalive int             `json:"persistentKeepalive"`
+	MTU                 int             `json:"mtu"`
+	RouteMetric         int             `json:"routeMetric,omitempty"`
+	Enabled             bool            `json:"enabled"`
+	CreatedAt           time.Time       `json:"createdAt"`
+	KeyCreatedAt        time.Time       `json:"keyCreatedAt,omitzero"`
+	KeyRotation         *WgKeyRotation  `json:"keyRotation,omitempty"`
+	Failover            *WgFailover     `json:"failover,omitempty"`
+	Probes              []WgHealthProbe `json:"probes,omitempty"`
 }
 
+// WgFailover joins a tunnel to a failover group. Members of a group reach
+// the same remote subnets; among the healthy ones, the lowest RouteMetric
+// carries the traffic. A member counts as failed when none of its peers has
+// handshaken within the handshake timeout or, if Probe is set, when the
+// probe through the tunnel fails. Its routes are then demoted behind every
+// configurable metric rather than removed, so the subnets never fall
+// through to the default route.
+// On update a non-nil Failover replaces the setting; an empty Group removes
+// the tunnel from its group.
+type WgFailover struct {
+	Group string         `json:"group"`
+	Probe *WgHealthProbe `json:"probe,omitempty"`
+}
+
+// WgHealthProbe is an active check sent out of the tunnel interface. Kind
+// "icmp" pings Target; "tcp" connects to Target:Port, and a refused
+// connection still counts as reachable since the reset came back through
+// the tunnel.
+type WgHealthProbe struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Port   int    `json:"port,omitempty"`
+}
+
+// WgKeyRotation is a prepared private key that is not yet on the interface.
+// Its public half is handed to the remote side ahead of the switch so both
+// ends can flip together. ScheduledAt zero means the switch is manual.
+type WgKeyRotation struct {
+	PendingPublicKey string    `json:"pendingPublicKey"`
+	PreparedAt       time.Time `json:"preparedAt"`
+	ScheduledAt      time.Time `json:"scheduledAt,omitzero"`
+}
+
+// WgKeepaliveOff as a peer's PersistentKeepalive disables keepalives for that
+// peer, where 0 would inherit the tunnel-level value.
+const WgKeepaliveOff = -1
+
+// WgPeer is one remote site on a tunnel. PersistentKeepalive=0 inherits the
+// tunnel-level value and WgKeepaliveOff turns keepalives off. PresharedKey
+// is only populated on input and inside the tunnel manager (it is stored in
+// the 0600 <id>.psk file); API responses carry PresharedKeySet instead. A
+// peer sent on update without a PresharedKey keeps its PSK unless
+// ClearPresharedKey is set.
+type WgPeer struct {
+	Name                string   `json:"name,omitempty"`
+	PublicKey           string   `json:"publicKey"`
+	Endpoint            string   `json:"endpoint,omitempty"`
+	AllowedIPs          []string `json:"allowedIPs"`
+	PersistentKeepalive int      `json:"persistentKeepalive,omitempty"`
+	PresharedKey        string   `json:"presharedKey,omitempty"`
+	PresharedKeySet     bool     `json:"presharedKeySet,omitempty"`
+	ClearPresharedKey   bool     `json:"clearPresharedKey,omitempty"`
+}
+
+// WgS2sStatus is the per-tunnel runtime view. The flat handshake/transfer
+// fields aggregate over all peers (latest handshake, summed counters,
+// connected if any peer is); Peers carries the per-peer breakdown.
+// Connected only says the peers handshake; Reachable is set once the
+// tunnel's probes have run and is false if any of them failed last time,
+// i.e. the remote LAN is not answering through the tunnel.
 type WgS2sStatus struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	InterfaceName string    `json:"interfaceName"`
-	Enabled       bool      `json:"enabled"`
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	InterfaceName string            `json:"interfaceName"`
+	Enabled       bool              `json:"enabled"`
+	Connected     bool              `json:"connected"`
+	LastHandshake time.Time         `json:"lastHandshake"`
+	TransferRx    int64             `json:"transferRx"`
+	TransferTx    int64             `json:"transferTx"`
+	Endpoint      string            `json:"endpoint"`
+	ListenPort    int               `json:"listenPort"`
+	LocalAddress  string            `json:"localAddress"`
+	RemoteSubnets []string          `json:"remoteSubnets"`
+	ForwardINOk   bool              `json:"forwardINOk"`
+	Peers         []WgS2sPeerStatus `json:"peers,omitempty"`
+	KeyCreatedAt  time.Time         `json:"keyCreatedAt"`
+	KeyStale      bool              `json:"keyStale,omitempty"`
+	KeyRotation   *WgKeyRotation    `json:"keyRotation,omitempty"`
+	Failover      *WgFailoverState  `json:"failover,omitempty"`
+	Reachable     *bool             `json:"reachable,omitempty"`
+	Probes        []WgProbeResult   `json:"probes,omitempty"`
+}
+
+// WgProbeResult is the recent history of one of the tunnel's reachability
+// probes. Loss is the failed share (0..1) of the last few attempts;
+// LatencyMs is the round trip of the latest successful one. Reachable is
+// the outcome of the latest attempt, LastError its error if it failed.
+type WgProbeResult struct {
+	Kind        string    `json:"kind"`
+	Target      string    `json:"target"`
+	Port        int       `json:"port,omitempty"`
+	Reachable   bool      `json:"reachable"`
+	LatencyMs   float64   `json:"latencyMs,omitempty"`
+	Loss        float64   `json:"loss"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	CheckedAt   time.Time `json:"checkedAt"`
+}
+
+// WgFailoverState is a group member's role as last decided by the failover
+// monitor: "active" carries the traffic, "standby" is healthy but behind a
+// lower metric, "failed" has its routes demoted. Reason says why a member
+// failed; Since is when the role last changed.
+type WgFailoverState struct {
+	Group  string    `json:"group"`
+	Role   string    `json:"role"`
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+type WgS2sPeerStatus struct {
+	Name          string    `json:"name,omitempty"`
+	PublicKey     string    `json:"publicKey"`
+	Endpoint      string    `json:"endpoint"`
+	AllowedIPs    []string  `json:"allowedIPs"`
 	Connected     bool      `json:"connected"`
 	LastHandshake time.Time `json:"lastHandshake"`
 	TransferRx    int64     `json:"transferRx"`
 	TransferTx    int64     `json:"transferTx"`
-	Endpoint      string    `json:"endpoint"`
-	ListenPort    int       `json:"listenPort"`
-	LocalAddress  string    `json:"localAddress"`
-	RemoteSubnets []string  `json:"remoteSubnets"`
-	ForwardINOk   bool      `json:"forwardINOk"`
+}
+
+// WgS2sEndpointChange reports a peer whose hostname endpoint now resolves to
+// a different address and was re-pointed on the live interface. Endpoint is
+// the configured host:port; the addresses are what the kernel used before
+// and after. OldAddress is empty if the kernel had no endpoint for the peer.
+type WgS2sEndpointChange struct {
+	TunnelID      string `json:"tunnelId"`
+	TunnelName    string `json:"tunnelName"`
+	PeerName      string `json:"peerName,omitempty"`
+	PeerPublicKey string `json:"peerPublicKey"`
+	Endpoint      string `json:"endpoint"`
+	OldAddress    string `json:"oldAddress,omitempty"`
+	NewAddress    string `json:"newAddress"`
+}
+
+// WgS2sFailoverEvent is one role change of a failover group member.
+type WgS2sFailoverEvent struct {
+	TunnelID   string `json:"tunnelId"`
+	TunnelName string `json:"tunnelName"`
+	Group      string `json:"group"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// WgS2sReachabilityEvent reports a reachability probe whose target stopped
+// answering through the tunnel or answers again. Error is the failed
+// attempt's error.
+type WgS2sReachabilityEvent struct {
+	TunnelID   string `json:"tunnelId"`
+	TunnelName string `json:"tunnelName"`
+	Kind       string `json:"kind"`
+	Target     string `json:"target"`
+	Port       int    `json:"port,omitempty"`
+	Reachable  bool   `json:"reachable"`
+	Error      string `json:"error,omitempty"`
 }
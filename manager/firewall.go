@@ -52,8 +52,9 @@ type FirewallManager struct {
 	chainProbe func(chain, match string) bool
 	ipsetProbe func(setName, match string) bool
 
-	// UDAPI write-side seams. Tests substitute fakes; production wires them
-	// to the real udapi.* helpers in NewFirewallManager.
+	// UDAPI write-side seams, the only way rules and ipset entries are
+	// written. Tests substitute fakes and dry runs substitute recorders;
+	// production wires them to the real udapi.* helpers in NewFirewallManager.
 	addInterfaceRules    func(ctx context.Context, iface, marker, chainPrefix string) error
 	removeInterfaceRules func(ctx context.Context, iface, marker string) error
 	ensureZoneSubnets    func(ctx context.Context, setName string, cidrs []string) error
@@ -157,7 +158,7 @@ func (fm *FirewallManager) rediscoverAndSaveWgS2s(ctx context.Context, tunnelID
 
 func (fm *FirewallManager) RemoveWgS2sFirewall(ctx context.Context, tunnelID, iface string, allowedIPs []string) {
 	marker := wgS2sMarkerPrefix + iface
-	if err := udapi.RemoveInterfaceRules(ctx, fm.udapi, iface, marker); err != nil {
+	if err := fm.removeInterfaceRules(ctx, iface, marker); err != nil {
 		slog.Warn("wg-s2s firewall rule removal failed", "iface", iface, "err", err)
 	}
 	fm.RemoveWgS2sIPSetEntries(ctx, tunnelID, allowedIPs)
@@ -170,7 +171,7 @@ func (fm *FirewallManager) RemoveWgS2sIPSetEntries(ctx context.Context, tunnelID
 	}
 	ipsetName := zoneIPSetName(chainPrefix)
 	for _, cidr := range cidrs {
-		if err := udapi.RemoveZoneSubnet(ctx, fm.udapi, ipsetName, cidr); err != nil {
+		if err := fm.removeZoneSubnet(ctx, ipsetName, cidr); err != nil {
 			slog.Warn("wg-s2s ipset entry removal failed", "ipset", ipsetName, "cidr", cidr, "err", err)
 		}
 	}
@@ -342,7 +343,7 @@ func (fm *FirewallManager) RestoreTailscaleRules(ctx context.Context) error {
 	ts := fm.manifest.GetTailscaleZone()
 	if chainPrefix == config.DefaultChainPrefix && ts.ZoneID != "" {
 		if rediscovered := fm.DiscoverChainPrefix(ctx, ts.ZoneID); rediscovered != "" {
-			_ = udapi.RemoveInterfaceRules(ctx, fm.udapi, config.TailscaleInterface, marker)
+			_ = fm.removeInterfaceRules(ctx, config.TailscaleInterface, marker)
 			chainPrefix = rediscovered
 			if err := fm.manifest.SetTailscaleZone(ts.ZoneID, ts.ZoneName, ts.PolicyIDs, rediscovered); err != nil {
 				slog.Warn("manifest save failed", "err", err)
@@ -355,27 +356,27 @@ func (fm *FirewallManager) RestoreTailscaleRules(ctx context.Context) error {
 }
 
 func (fm *FirewallManager) RemoveTailscaleInterfaceRules(ctx context.Context) error {
-	return udapi.RemoveInterfaceRules(ctx, fm.udapi, config.TailscaleInterface, config.FirewallMarker)
+	return fm.removeInterfaceRules(ctx, config.TailscaleInterface, config.FirewallMarker)
 }
 
 func (fm *FirewallManager) EnsureTailscaleRules(ctx context.Context, chainPrefix string) error {
 	if chainPrefix != config.DefaultChainPrefix {
-		fwd := fm.hasChainRule(config.ChainForwardInUser, "-i "+config.TailscaleInterface)
-		inp := fm.hasChainRule(config.ChainInputUserHook, "-i "+config.TailscaleInterface)
-		out := fm.hasChainRule(config.ChainOutputUserHook, "-o "+config.TailscaleInterface)
-		ipsetOK := fm.hasIPSetEntry(fmt.Sprintf("UBIOS4%s_subnets", chainPrefix), config.TailscaleCGNAT)
+		fwd := fm.chainProbe(config.ChainForwardInUser, "-i "+config.TailscaleInterface)
+		inp := fm.chainProbe(config.ChainInputUserHook, "-i "+config.TailscaleInterface)
+		out := fm.chainProbe(config.ChainOutputUserHook, "-o "+config.TailscaleInterface)
+		ipsetOK := fm.ipsetProbe(fmt.Sprintf("UBIOS4%s_subnets", chainPrefix), config.TailscaleCGNAT)
 		if fwd && inp && out && ipsetOK {
 			return nil
 		}
 	}
 
 	marker := config.FirewallMarker
-	if err := udapi.AddInterfaceRulesForZone(ctx, fm.udapi, config.TailscaleInterface, marker, chainPrefix); err != nil {
+	if err := fm.addInterfaceRules(ctx, config.TailscaleInterface, marker, chainPrefix); err != nil {
 		return err
 	}
 
 	ipsetName := zoneIPSetName(chainPrefix)
-	if err := udapi.EnsureZoneSubnet(ctx, fm.udapi, ipsetName, config.TailscaleCGNAT); err != nil {
+	if err := fm.ensureZoneSubnets(ctx, ipsetName, []string{config.TailscaleCGNAT}); err != nil {
 		return fmt.Errorf("zone ipset %s: %w", ipsetName, err)
 	}
 	return nil
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
@@ -12,8 +13,10 @@ import (
 	"time"
 
 	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
 	"unifi-tailscale/manager/internal/wgs2s"
 	"unifi-tailscale/manager/service"
+	"unifi-tailscale/manager/state"
 )
 
 func spaHandler() http.Handler {
@@ -192,6 +195,18 @@ func (s *Server) handleSetSettings(w http.ResponseWriter, r *http.Request) {
 	if err := readJSON(w, r, &req); err != nil {
 		return
 	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		if err := s.settings.PlanSettings(r.Context(), &req, p.fw, settingsManifestAdapter{p.manifest}); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(nil))
+		return
+	}
 	result, err := s.settings.SetSettings(r.Context(), &req)
 	if err != nil {
 		writeServiceError(w, err)
@@ -210,6 +225,156 @@ func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+func (s *Server) handleRoutingHealth(w http.ResponseWriter, r *http.Request) {
+	rh := s.routingHealth.Check(r.Context())
+	if rh == nil {
+		rh = &domain.RoutingHealth{}
+	}
+	writeJSON(w, http.StatusOK, rh)
+}
+
+// handleFixRoutingHealth is the only path that changes the system for a
+// routing-health check; the periodic checks only report.
+func (s *Server) handleFixRoutingHealth(w http.ResponseWriter, r *http.Request) {
+	rh, err := s.routingHealth.Fix(r.Context(), r.PathValue("check"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if rh == nil {
+		rh = &domain.RoutingHealth{}
+	}
+	writeJSON(w, http.StatusOK, rh)
+}
+
+func (s *Server) handleListPolicyTemplates(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"templates": s.fwOrch.PolicyTemplates()})
+}
+
+// handleSetPolicyTemplate creates or replaces the template of a zone and
+// applies it at once.
+func (s *Server) handleSetPolicyTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	var req domain.PolicyTemplate
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		tpl, err := p.orch.SetPolicyTemplate(req)
+		if err == nil {
+			err = p.orch.ApplyPolicyTemplate(r.Context(), tpl.Zone)
+		}
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(map[string]any{"template": tpl, "applied": true}))
+		return
+	}
+	tpl, err := s.fwOrch.SetPolicyTemplate(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	applied, err := s.applyPolicyTemplate(r.Context(), tpl.Zone)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"template": tpl, "applied": applied})
+}
+
+func (s *Server) handleDeletePolicyTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	zone := r.PathValue("zone")
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		err := p.orch.DeletePolicyTemplate(zone)
+		if err == nil {
+			err = p.orch.ApplyPolicyTemplate(r.Context(), zone)
+		}
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(map[string]any{"applied": true}))
+		return
+	}
+	if err := s.fwOrch.DeletePolicyTemplate(zone); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	applied, err := s.applyPolicyTemplate(r.Context(), zone)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"applied": applied})
+}
+
+func (s *Server) handleFirewallDrift(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	report, err := s.fwOrch.DetectDrift(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleReconcileFirewallDrift is the only path that acts on drift; the
+// report alone never touches the controller.
+func (s *Server) handleReconcileFirewallDrift(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		report, err := p.orch.ReconcileDrift(r.Context())
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(report))
+		return
+	}
+	var report *service.DriftReport
+	var err error
+	if !s.guardedSetup(func() { report, err = s.fwOrch.ReconcileDrift(r.Context()) }) {
+		writeError(w, http.StatusConflict, "another firewall reconcile is in progress")
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
 func (s *Server) handleBugReport(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Note string `json:"note"`
@@ -238,6 +403,19 @@ func (s *Server) handleSetIntegrationKey(w http.ResponseWriter, r *http.Request)
 	if err := readJSON(w, r, &req); err != nil {
 		return
 	}
+	if isDryRun(r) {
+		p, ok := s.planFirewallWith(w, s.ic.WithAPIKey(strings.TrimSpace(req.APIKey)))
+		if !ok {
+			return
+		}
+		st, err := s.integration.PlanKey(r.Context(), req.APIKey, integrationICAdapter{p.ic}, p.manifest, planKeyNotifier{p})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(st))
+		return
+	}
 	st, err := s.integration.SetKey(r.Context(), req.APIKey)
 	if err != nil {
 		writeServiceError(w, err)
@@ -247,6 +425,18 @@ func (s *Server) handleSetIntegrationKey(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Server) handleDeleteIntegrationKey(w http.ResponseWriter, r *http.Request) {
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		if err := s.integration.PlanDeleteKey(r.Context(), integrationICAdapter{p.ic}, planKeyNotifier{p}); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(nil))
+		return
+	}
 	if err := s.integration.DeleteKey(r.Context()); err != nil {
 		slog.Warn("failed to remove API key", "err", err)
 		writeError(w, http.StatusInternalServerError, "failed to remove API key")
@@ -260,6 +450,102 @@ func (s *Server) handleTestIntegrationKey(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusOK, s.integration.TestKey(r.Context()))
 }
 
+func (s *Server) handleIntegrationInventory(w http.ResponseWriter, r *http.Request) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	inv, err := s.fwOrch.Inventory(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// handleIntegrationGC deletes orphaned Integration API objects, all of them
+// or the ones listed in ids. A dry run previews the deletes.
+func (s *Server) handleIntegrationGC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return
+	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		result, err := p.orch.CollectOrphans(r.Context(), req.IDs)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(result))
+		return
+	}
+	var result *service.OrphanGCResult
+	var err error
+	if !s.guardedSetup(func() { result, err = s.fwOrch.CollectOrphans(r.Context(), req.IDs) }) {
+		writeError(w, http.StatusConflict, "another firewall reconcile is in progress")
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleListManifestSnapshots(w http.ResponseWriter, r *http.Request) {
+	snaps, err := s.manifest.ListSnapshots()
+	if err != nil {
+		slog.Warn("manifest snapshots unreadable", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to list manifest snapshots")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"snapshots": snaps})
+}
+
+// handleDiffManifestSnapshot diffs snapshot id against the snapshot in
+// ?to=, or against the current manifest.
+func (s *Server) handleDiffManifestSnapshot(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.manifest.DiffSnapshot(r.PathValue("id"), r.URL.Query().Get("to"))
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"changes": changes})
+}
+
+func (s *Server) handleRestoreManifestSnapshot(w http.ResponseWriter, r *http.Request) {
+	var result *manifestRestoreResult
+	var err error
+	if !s.guardedSetup(func() { result, err = s.restoreManifest(r.Context(), r.PathValue("id")) }) {
+		writeError(w, http.StatusConflict, "another firewall reconcile is in progress")
+		return
+	}
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeSnapshotError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrSnapshotNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	slog.Warn("manifest snapshot unreadable", "err", err)
+	writeError(w, http.StatusInternalServerError, "manifest snapshot unreadable")
+}
+
 func (s *Server) handleGetRoutes(w http.ResponseWriter, r *http.Request) {
 	resp, err := s.routing.GetRoutes(r.Context())
 	if err != nil {
@@ -336,6 +622,19 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"lines": entries})
 }
 
+func (s *Server) handleMetricsHistory(w http.ResponseWriter, r *http.Request) {
+	rng := r.URL.Query().Get("range")
+	if rng == "" {
+		rng = state.TrafficRangeHour
+	}
+	series, ok := s.traffic.Rates(rng, time.Now())
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("range must be %q or %q", state.TrafficRangeHour, state.TrafficRangeDay))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"range": rng, "series": series})
+}
+
 func (s *Server) handleGetRemoteExit(w http.ResponseWriter, r *http.Request) {
 	resp, err := s.remoteExitSvc.GetAvailable(r.Context())
 	if err != nil {
@@ -366,6 +665,47 @@ func (s *Server) handleDisableRemoteExit(w http.ResponseWriter, r *http.Request)
 	writeOK(w)
 }
 
+func (s *Server) handleListExitSchedules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"schedules": s.exitSvc.ListSchedules(time.Now())})
+}
+
+func (s *Server) handleCreateExitSchedule(w http.ResponseWriter, r *http.Request) {
+	var req domain.ExitSchedule
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	sch, err := s.exitSvc.CreateSchedule(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sch)
+}
+
+// handleUpdateExitSchedule applies the new window at once instead of
+// waiting for the next restore pass.
+func (s *Server) handleUpdateExitSchedule(w http.ResponseWriter, r *http.Request) {
+	var req domain.ExitSchedule
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	sch, err := s.exitSvc.UpdateSchedule(r.PathValue("id"), req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	s.restoreExitNodeRules(r.Context())
+	writeJSON(w, http.StatusOK, sch)
+}
+
+func (s *Server) handleDeleteExitSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := s.exitSvc.DeleteSchedule(r.PathValue("id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
 func (s *Server) handleWgS2sListTunnels(w http.ResponseWriter, r *http.Request) {
 	if !s.wgS2sSvc.Available() {
 		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
@@ -383,6 +723,20 @@ func (s *Server) handleWgS2sCreateTunnel(w http.ResponseWriter, r *http.Request)
 	if err := readJSON(w, r, &req); err != nil {
 		return
 	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		fw := &wgS2sFirewallAdapter{fw: p.fw, orch: p.orch}
+		result, err := s.wgS2sSvc.PlanCreateTunnel(r.Context(), &req, fw, &wgS2sManifestAdapter{ms: p.manifest})
+		if err != nil {
+			writeWgS2sError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(result))
+		return
+	}
 	result, err := s.wgS2sSvc.CreateTunnel(r.Context(), &req)
 	if err != nil {
 		writeWgS2sError(w, err)
@@ -391,6 +745,23 @@ func (s *Server) handleWgS2sCreateTunnel(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusCreated, result)
 }
 
+func (s *Server) handleWgS2sImportTunnel(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	var req service.WgS2sImportRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	result, err := s.wgS2sSvc.ImportTunnel(r.Context(), &req)
+	if err != nil {
+		writeWgS2sError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
 func (s *Server) handleWgS2sUpdateTunnel(w http.ResponseWriter, r *http.Request) {
 	if !s.wgS2sSvc.Available() {
 		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
@@ -408,11 +779,56 @@ func (s *Server) handleWgS2sUpdateTunnel(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusOK, result)
 }
 
+// handleWgS2sApplyMTU probes the tunnel's path MTU and, when the tunnel MTU
+// does not fit it, lowers the MTU through the regular update path.
+func (s *Server) handleWgS2sApplyMTU(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	id := r.PathValue("id")
+	pm, err := s.diagnostics.TunnelPathMTU(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if pm.PathMTU == 0 {
+		writeError(w, http.StatusBadGateway, "path MTU probe failed: "+pm.Error)
+		return
+	}
+	resp := struct {
+		PathMTU *service.PathMTUResult        `json:"pathMTU"`
+		Tunnel  *service.TunnelUpdateResponse `json:"tunnel,omitempty"`
+	}{PathMTU: pm}
+	if pm.RecommendedMTU != 0 {
+		resp.Tunnel, err = s.wgS2sSvc.UpdateTunnel(r.Context(), id, wgs2s.TunnelConfig{MTU: pm.RecommendedMTU})
+		if err != nil {
+			writeWgS2sError(w, err)
+			return
+		}
+		slog.Info("wg-s2s MTU lowered to path MTU", "id", id, "pathMTU", pm.PathMTU, "mtu", pm.RecommendedMTU)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) handleWgS2sDeleteTunnel(w http.ResponseWriter, r *http.Request) {
 	if !s.wgS2sSvc.Available() {
 		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
 		return
 	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		fw := &wgS2sFirewallAdapter{fw: p.fw, orch: p.orch}
+		if err := s.wgS2sSvc.PlanDeleteTunnel(r.Context(), r.PathValue("id"), fw, &wgS2sManifestAdapter{ms: p.manifest}); err != nil {
+			writeWgS2sError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(nil))
+		return
+	}
 	if err := s.wgS2sSvc.DeleteTunnel(r.Context(), r.PathValue("id")); err != nil {
 		writeWgS2sError(w, err)
 		return
@@ -445,11 +861,122 @@ func (s *Server) handleWgS2sDisableTunnel(w http.ResponseWriter, r *http.Request
 	writeOK(w)
 }
 
+func (s *Server) handleWgS2sScheduleKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	var req service.KeyRotationRequest
+	if r.Body != nil && r.ContentLength > 0 {
+		if err := readJSON(w, r, &req); err != nil {
+			return
+		}
+	}
+	rot, err := s.wgS2sSvc.ScheduleKeyRotation(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rot)
+}
+
+func (s *Server) handleWgS2sCreatePairing(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	var req service.PairingBundleRequest
+	if r.Body != nil && r.ContentLength > 0 {
+		if err := readJSON(w, r, &req); err != nil {
+			return
+		}
+	}
+	bundle, err := s.wgS2sSvc.CreatePairingBundle(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		writeWgS2sError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+func (s *Server) handleWgS2sImportPairing(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	var req service.PairingImportRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	result, err := s.wgS2sSvc.ImportPairingBundle(r.Context(), &req)
+	if err != nil {
+		writeWgS2sError(w, err)
+		return
+	}
+	// The reply carries the preshared key of the new tunnel.
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, result)
+}
+
+func (s *Server) handleWgS2sCompletePairing(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	var req service.PairingCompleteRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return
+	}
+	if err := s.wgS2sSvc.CompletePairing(r.Context(), r.PathValue("id"), &req); err != nil {
+		writeWgS2sError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (s *Server) handleWgS2sCommitKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	if err := s.wgS2sSvc.CommitKeyRotation(r.Context(), r.PathValue("id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (s *Server) handleWgS2sCancelKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if !s.wgS2sSvc.Available() {
+		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
+		return
+	}
+	if err := s.wgS2sSvc.CancelKeyRotation(r.Context(), r.PathValue("id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
 func (s *Server) handleWgS2sSetupZone(w http.ResponseWriter, r *http.Request) {
 	if !s.wgS2sSvc.Available() {
 		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
 		return
 	}
+	if isDryRun(r) {
+		p, ok := s.planFirewall(w)
+		if !ok {
+			return
+		}
+		fw := &wgS2sFirewallAdapter{fw: p.fw, orch: p.orch}
+		result, err := s.wgS2sSvc.PlanZoneForTunnel(r.Context(), r.PathValue("id"), fw, &wgS2sManifestAdapter{ms: p.manifest})
+		if err != nil {
+			writeWgS2sError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.finish(result))
+		return
+	}
 	result, err := s.wgS2sSvc.SetupZoneForTunnel(r.Context(), r.PathValue("id"))
 	if err != nil {
 		writeWgS2sError(w, err)
@@ -468,16 +995,28 @@ func (s *Server) handleWgS2sGenerateKeypair(w http.ResponseWriter, r *http.Reque
 	writeJSON(w, http.StatusOK, kp)
 }
 
+func (s *Server) handleWgS2sGeneratePSK(w http.ResponseWriter, r *http.Request) {
+	psk, err := s.wgS2sSvc.GeneratePresharedKey()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, psk)
+}
+
 func (s *Server) handleWgS2sGetConfig(w http.ResponseWriter, r *http.Request) {
 	if !s.wgS2sSvc.Available() {
 		writeError(w, http.StatusServiceUnavailable, "WG S2S manager not initialized")
 		return
 	}
-	config, err := s.wgS2sSvc.GetConfig(r.Context(), r.PathValue("id"))
+	config, err := s.wgS2sSvc.GetConfig(r.Context(), r.PathValue("id"), r.URL.Query().Get("peer"))
 	if err != nil {
 		writeServiceError(w, err)
 		return
 	}
+	// The export may carry a preshared key.
+	w.Header().Set("Cache-Control", "no-store")
 	writeJSON(w, http.StatusOK, map[string]string{"config": config})
 }
 
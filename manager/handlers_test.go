@@ -20,8 +20,10 @@ import (
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
 
+	"unifi-tailscale/manager/domain"
 	"unifi-tailscale/manager/internal/wgs2s"
 	"unifi-tailscale/manager/service"
+	"unifi-tailscale/manager/state"
 )
 
 func validBase64Key(t *testing.T) string {
@@ -78,6 +80,40 @@ func TestCreateTunnelFirewallOK(t *testing.T) {
 	assert.Nil(t, resp["firewall"])
 }
 
+func TestHandleWgS2sImportTunnel(t *testing.T) {
+	var gotKey string
+	s := newTestServer(func(s *Server) {
+		s.wgManager = &mockWgS2sControl{
+			createTunnelFn: func(cfg wgs2s.TunnelConfig, pk string) (*wgs2s.TunnelConfig, error) {
+				gotKey = pk
+				cfg.ID, cfg.InterfaceName = "t1", "wg-s2s0"
+				return &cfg, nil
+			},
+			getPublicKeyFn: func(string) (string, error) { return "pubkey", nil },
+		}
+	})
+
+	priv := validBase64Key(t)
+	body, _ := json.Marshal(service.WgS2sImportRequest{
+		Name: "imported",
+		Config: "[Interface]\nPrivateKey = " + priv + "\nAddress = 10.0.0.1/30\nListenPort = 51820\n" +
+			"[Peer]\nPublicKey = " + validBase64Key(t) + "\nAllowedIPs = 10.9.0.0/24\n",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/wg-s2s/import", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	s.handleWgS2sImportTunnel(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, priv, gotKey)
+	assert.NotContains(t, w.Body.String(), priv, "the imported private key must not be echoed back")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/wg-s2s/import",
+		bytes.NewReader([]byte(`{"name":"x","config":"[Interface]\nBogus = 1\n"}`)))
+	w = httptest.NewRecorder()
+	s.handleWgS2sImportTunnel(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestCreateTunnelFirewallPartial(t *testing.T) {
 	tunnel := &wgs2s.TunnelConfig{
 		ID: "t1", Name: "test", InterfaceName: "wg-s2s0",
@@ -464,6 +500,30 @@ func TestHandleLogs(t *testing.T) {
 	assert.Contains(t, body, "lines")
 }
 
+func TestHandleMetricsHistory(t *testing.T) {
+	s := newTestServer()
+	t0 := time.Now().Add(-time.Minute)
+	s.traffic.Observe(trafficKindWgS2s, "t1", t0, 0, 0)
+	s.traffic.Observe(trafficKindWgS2s, "t1", t0.Add(5*time.Second), 5000, 1000)
+
+	w := httptest.NewRecorder()
+	s.handleMetricsHistory(w, httptest.NewRequest(http.MethodGet, "/api/metrics/history", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Range  string                                     `json:"range"`
+		Series map[string]map[string][]state.TrafficPoint `json:"series"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "hour", body.Range)
+	require.Len(t, body.Series[trafficKindWgS2s]["t1"], 1)
+	assert.Equal(t, 500.0, body.Series[trafficKindWgS2s]["t1"][0].RxRate)
+
+	w = httptest.NewRecorder()
+	s.handleMetricsHistory(w, httptest.NewRequest(http.MethodGet, "/api/metrics/history?range=week", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 // --- Group 4: Integration API ---
 
 func TestHandleSetIntegrationKey(t *testing.T) {
@@ -727,6 +787,22 @@ func TestHandleWgS2sGenerateKeypair(t *testing.T) {
 	assert.NotEmpty(t, body["privateKey"])
 }
 
+func TestHandleWgS2sGeneratePSK(t *testing.T) {
+	s := newTestServer(func(s *Server) {
+		s.wgManager = &mockWgS2sControl{}
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/wg-s2s/generate-psk", nil)
+	w := httptest.NewRecorder()
+	s.handleWgS2sGeneratePSK(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body["presharedKey"], 44)
+}
+
 func TestHandleWgS2sGetConfig(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		s := newTestServer(func(s *Server) {
@@ -905,3 +981,43 @@ func TestHandleHealth(t *testing.T) {
 	assert.Equal(t, StatusDegraded, snap.Watchers["firewall"].Status)
 	assert.Equal(t, "key_expired", snap.Watchers["firewall"].DegradedReason)
 }
+
+func TestHandleRestoreManifestSnapshot(t *testing.T) {
+	var restored string
+	s := newTestServer(func(s *Server) {
+		s.manifest = &mockManifestStore{
+			diffSnapshotFn: func(fromID, toID string) ([]domain.ManifestChange, error) {
+				if fromID != "100" {
+					return nil, domain.ErrSnapshotNotFound
+				}
+				assert.Empty(t, toID, "diffed against the current manifest")
+				return []domain.ManifestChange{{Path: "siteId", From: "site-old", To: "site-new"}}, nil
+			},
+			restoreSnapshotFn: func(id string) error {
+				restored = id
+				return nil
+			},
+		}
+	})
+	s.exitSvc = nil
+
+	restore := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/manifest/snapshots/"+id+"/restore", nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.handleRestoreManifestSnapshot(w, req)
+		return w
+	}
+
+	w := restore("100")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "100", restored)
+	var result manifestRestoreResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []domain.ManifestChange{{Path: "siteId", From: "site-new", To: "site-old"}}, result.Changes, "the changes the restore made")
+
+	restored = ""
+	w = restore("200")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, restored)
+}
@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
+	"path/filepath"
+	"slices"
 
 	"unifi-tailscale/manager/domain"
 	"unifi-tailscale/manager/state"
 )
 
 type TunnelConfig = domain.TunnelConfig
+type Peer = domain.WgPeer
 
 type TunnelsConfig struct {
 	Tunnels []TunnelConfig `json:"tunnels"`
@@ -25,11 +29,34 @@ func loadConfig(path string) (*TunnelsConfig, error) {
 	if recovered {
 		slog.Warn("tunnels.json corrupted; loaded empty config and quarantined original", "path", path)
 	}
+	dir := filepath.Dir(path)
+	for i := range cfg.Tunnels {
+		t := &cfg.Tunnels[i]
+		psks, err := loadPresharedKeys(dir, t.ID)
+		if err != nil {
+			slog.Warn("wg-s2s: preshared keys unreadable; peers will come up without them", "id", t.ID, "err", err)
+		}
+		for j := range t.Peers {
+			t.Peers[j].PresharedKey = psks[t.Peers[j].PublicKey]
+		}
+		NormalizePeers(t)
+		NormalizeAddresses(t)
+	}
 	return &cfg, nil
 }
 
+// saveConfig writes each tunnel's preshared keys to its <id>.psk file, then
+// tunnels.json with the keys stripped.
 func saveConfig(path string, cfg *TunnelsConfig) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	dir := filepath.Dir(path)
+	out := TunnelsConfig{Version: cfg.Version, Tunnels: make([]TunnelConfig, len(cfg.Tunnels))}
+	for i, t := range cfg.Tunnels {
+		if err := savePresharedKeys(dir, t.ID, presharedKeysOf(t)); err != nil {
+			return err
+		}
+		out.Tunnels[i] = withoutPresharedKeys(t)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal config: %w", err)
 	}
@@ -39,7 +66,8 @@ func saveConfig(path string, cfg *TunnelsConfig) error {
 	return nil
 }
 
-func nextInterfaceName(existing []TunnelConfig) string {
+// NextInterfaceName returns the first wg-s2sN name not used by existing.
+func NextInterfaceName(existing []TunnelConfig) string {
 	used := make(map[string]bool, len(existing))
 	for _, t := range existing {
 		used[t.InterfaceName] = true
@@ -59,3 +87,136 @@ func generateID() (string, error) {
 	}
 	return fmt.Sprintf("%x", b), nil
 }
+
+// peersOf returns the tunnel's peer list. Configs written before multi-peer
+// support (and API clients that only send the flat peer fields) describe a
+// single peer via PeerPublicKey/PeerEndpoint/AllowedIPs/PresharedKey; those
+// are synthesized into a one-element list.
+func peersOf(cfg TunnelConfig) []Peer {
+	if len(cfg.Peers) > 0 {
+		return cfg.Peers
+	}
+	if cfg.PeerPublicKey == "" && len(cfg.AllowedIPs) == 0 {
+		return nil
+	}
+	return []Peer{{
+		PublicKey:    cfg.PeerPublicKey,
+		Endpoint:     cfg.PeerEndpoint,
+		AllowedIPs:   cfg.AllowedIPs,
+		PresharedKey: cfg.PresharedKey,
+	}}
+}
+
+// NormalizePeers makes Peers authoritative and re-derives the flat fields
+// from it: PeerPublicKey/PeerEndpoint from the first peer, AllowedIPs as the
+// union across all peers. A flat PresharedKey is moved onto the first peer
+// rather than mirrored, so the secret only ever lives in one place.
+func NormalizePeers(cfg *TunnelConfig) {
+	cfg.Peers = slices.Clone(peersOf(*cfg))
+	if len(cfg.Peers) > 0 && cfg.PresharedKey != "" && cfg.Peers[0].PresharedKey == "" {
+		cfg.Peers[0].PresharedKey = cfg.PresharedKey
+	}
+	cfg.PresharedKey = ""
+	if len(cfg.Peers) == 0 {
+		return
+	}
+	for i := range cfg.Peers {
+		cfg.Peers[i].PresharedKeySet = cfg.Peers[i].PresharedKey != ""
+	}
+	cfg.PeerPublicKey = cfg.Peers[0].PublicKey
+	cfg.PeerEndpoint = cfg.Peers[0].Endpoint
+	cfg.AllowedIPs = unionAllowedIPs(cfg.Peers)
+}
+
+// addressesOf returns the tunnel's interface addresses. Configs written
+// before dual-stack support only carry TunnelAddress.
+func addressesOf(cfg TunnelConfig) []string {
+	if len(cfg.TunnelAddresses) > 0 {
+		return cfg.TunnelAddresses
+	}
+	if cfg.TunnelAddress == "" {
+		return nil
+	}
+	return []string{cfg.TunnelAddress}
+}
+
+// NormalizeAddresses makes TunnelAddresses authoritative and mirrors its
+// first entry into TunnelAddress.
+func NormalizeAddresses(cfg *TunnelConfig) {
+	cfg.TunnelAddresses = slices.Clone(addressesOf(*cfg))
+	if len(cfg.TunnelAddresses) > 0 {
+		cfg.TunnelAddress = cfg.TunnelAddresses[0]
+	}
+}
+
+// replaceAddressFamily swaps the entry of addr's family for addr, or appends
+// it when the list has none of that family. This is what a flat
+// TunnelAddress update means on a dual-stack tunnel.
+func replaceAddressFamily(addrs []string, addr string) []string {
+	out := slices.Clone(addrs)
+	for i, a := range out {
+		if isIPv6CIDR(a) == isIPv6CIDR(addr) {
+			out[i] = addr
+			return out
+		}
+	}
+	return append(out, addr)
+}
+
+func isIPv6CIDR(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
+
+// withoutPresharedKeys returns a copy of cfg safe to hand outside the
+// manager or write to tunnels.json: PresharedKeySet survives, the keys and
+// the clear flags do not. Peers is cloned so the caller cannot alias
+// m.config.
+func withoutPresharedKeys(cfg TunnelConfig) TunnelConfig {
+	cfg.PresharedKey, cfg.ClearPresharedKey = "", false
+	cfg.Peers = slices.Clone(cfg.Peers)
+	for i := range cfg.Peers {
+		cfg.Peers[i].PresharedKey, cfg.Peers[i].ClearPresharedKey = "", false
+	}
+	return cfg
+}
+
+// presharedKeysOf maps peer public key to preshared key for the peers that
+// have one.
+func presharedKeysOf(cfg TunnelConfig) map[string]string {
+	out := make(map[string]string)
+	for _, p := range cfg.Peers {
+		if p.PublicKey != "" && p.PresharedKey != "" {
+			out[p.PublicKey] = p.PresharedKey
+		}
+	}
+	return out
+}
+
+func unionAllowedIPs(peers []Peer) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range peers {
+		for _, cidr := range p.AllowedIPs {
+			key := normalizeCIDR(cidr)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, cidr)
+		}
+	}
+	return out
+}
+
+// peerKeepalive returns the peer's keepalive, falling back to the tunnel's.
+// A peer set to domain.WgKeepaliveOff gets none.
+func peerKeepalive(cfg TunnelConfig, p Peer) int {
+	if p.PersistentKeepalive == domain.WgKeepaliveOff {
+		return 0
+	}
+	if p.PersistentKeepalive > 0 {
+		return p.PersistentKeepalive
+	}
+	return cfg.PersistentKeepalive
+}
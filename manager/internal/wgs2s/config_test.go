@@ -151,7 +151,7 @@ func TestNextInterfaceName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, nextInterfaceName(tt.existing))
+			assert.Equal(t, tt.want, NextInterfaceName(tt.existing))
 		})
 	}
 }
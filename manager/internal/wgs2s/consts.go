@@ -6,8 +6,8 @@ const (
 	// NAT traversal keepalive interval (seconds); standard value to maintain UDP hole-punch.
 	defaultPersistentKeepalive = 25
 
-	// WireGuard interface MTU; accounts for WG overhead (60 bytes) below standard 1500 Ethernet MTU.
-	defaultMTU = 1420
+	// WireGuard interface MTU; accounts for WG overhead (80 bytes with an IPv6 outer header) below standard 1500 Ethernet MTU.
+	DefaultMTU = 1420
 
 	// Default kernel route metric for S2S routes in main table.
 	// Wins over default route (metric 0 connected routes excluded) but loses to connected routes.
@@ -16,4 +16,32 @@ const (
 	// Peer is considered connected if last handshake was within this duration.
 	// Matches the WireGuard rekey interval (REKEY_AFTER_TIME).
 	handshakeTimeout = 3 * time.Minute
+
+	// Private keys older than this are flagged in status so the dashboard
+	// can suggest a rotation. WireGuard has no hard key lifetime; this is
+	// housekeeping, not a protocol limit.
+	keyStaleAfter = 180 * 24 * time.Hour
+
+	// Upper bound for one DDNS endpoint lookup, so a dead resolver cannot
+	// hold up the re-resolve sweep.
+	endpointLookupTimeout = 5 * time.Second
+
+	// Added to the metric of a failed failover member's routes. Larger than
+	// any configurable RouteMetric, so every healthy member wins, while the
+	// demoted routes still keep the subnets off the default route.
+	failoverDemoteMetric = 10000
+
+	// Consecutive healthy checks before a failed member is restored, so a
+	// link that flaps does not drag traffic back and forth.
+	failoverRecoverChecks = 3
+
+	// Upper bound for one active health probe through a tunnel.
+	healthProbeTimeout = 3 * time.Second
+
+	// Reachability probe attempts kept per target; loss is reported over
+	// this window.
+	reachabilityWindow = 10
+
+	// Reachability probes in flight at once across all tunnels.
+	reachabilityParallel = 4
 )
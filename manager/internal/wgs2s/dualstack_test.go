@@ -0,0 +1,81 @@
+package wgs2s
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNormalizeAddresses_FoldsLegacyTunnelAddress(t *testing.T) {
+	cfg := TunnelConfig{TunnelAddress: "10.255.0.1/30"}
+	NormalizeAddresses(&cfg)
+	if !slices.Equal(cfg.TunnelAddresses, []string{"10.255.0.1/30"}) {
+		t.Fatalf("TunnelAddresses = %v, want legacy address folded in", cfg.TunnelAddresses)
+	}
+
+	cfg = TunnelConfig{TunnelAddress: "stale", TunnelAddresses: []string{"fd00::1/64", "10.0.0.1/30"}}
+	NormalizeAddresses(&cfg)
+	if cfg.TunnelAddress != "fd00::1/64" {
+		t.Fatalf("TunnelAddress = %q, want first list entry", cfg.TunnelAddress)
+	}
+}
+
+func TestApplyUpdates_FlatTunnelAddressReplacesSameFamily(t *testing.T) {
+	base := TunnelConfig{ID: "A", TunnelAddresses: []string{"10.255.0.1/30", "fd00:255::1/126"}}
+	NormalizeAddresses(&base)
+
+	merged, err := applyUpdates(base, TunnelConfig{TunnelAddress: "fd00:256::1/126"})
+	if err != nil {
+		t.Fatalf("applyUpdates: %v", err)
+	}
+	if want := []string{"10.255.0.1/30", "fd00:256::1/126"}; !slices.Equal(merged.TunnelAddresses, want) {
+		t.Fatalf("TunnelAddresses = %v, want %v", merged.TunnelAddresses, want)
+	}
+	if !needsRecreate(base, merged) {
+		t.Fatal("an address change must recreate the interface")
+	}
+
+	merged, err = applyUpdates(base, TunnelConfig{TunnelAddresses: []string{"10.255.0.1/30"}})
+	if err != nil {
+		t.Fatalf("applyUpdates: %v", err)
+	}
+	if !slices.Equal(merged.TunnelAddresses, []string{"10.255.0.1/30"}) || merged.TunnelAddress != "10.255.0.1/30" {
+		t.Fatalf("TunnelAddresses list must replace the old one, got %v", merged.TunnelAddresses)
+	}
+}
+
+// TestClaimPeerRoutes_IPv6AtMetric proves IPv6 AllowedIPs go through the same
+// ref-counted claim path as IPv4, as AF_INET6 routes at the tunnel's metric.
+func TestClaimPeerRoutes_IPv6AtMetric(t *testing.T) {
+	mgr, fk := newTestManager(t)
+	key := testPeerKey(t)
+	cfg := TunnelConfig{
+		ID: "D", InterfaceName: "wg-s2s0", RouteMetric: 200,
+		Peers: []Peer{{PublicKey: key, AllowedIPs: []string{"10.1.0.0/24", "fd00:1::/64"}}},
+	}
+	NormalizePeers(&cfg)
+	idx := fk.createIface(cfg.InterfaceName)
+	if err := mgr.claimPeerRoutes(cfg, idx); err != nil {
+		t.Fatalf("claimPeerRoutes: %v", err)
+	}
+	if !fk.hasRoute("fd00:1::/64") || !fk.hasRoute("10.1.0.0/24") {
+		t.Fatal("both families must be routed")
+	}
+	if !mgr.routeRefs.owns("fd00:1::/64", peerOwnerID("D", key), 200) {
+		t.Fatal("IPv6 route must be owned at the tunnel's metric")
+	}
+
+	msg, err := buildRouteMessage("fd00:1::/64", idx, 200)
+	if err != nil {
+		t.Fatalf("buildRouteMessage: %v", err)
+	}
+	if msg.Family != unix.AF_INET6 || msg.DstLength != 64 || msg.Attributes.Priority != 200 {
+		t.Fatalf("route message = family %d /%d metric %d", msg.Family, msg.DstLength, msg.Attributes.Priority)
+	}
+
+	mgr.releasePeerRoutes(cfg, idx)
+	if fk.hasRoute("fd00:1::/64") {
+		t.Fatal("IPv6 route survived release")
+	}
+}
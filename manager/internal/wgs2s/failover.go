@@ -0,0 +1,260 @@
+package wgs2s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"unifi-tailscale/manager/domain"
+)
+
+type (
+	WgFailover         = domain.WgFailover
+	WgHealthProbe      = domain.WgHealthProbe
+	WgFailoverState    = domain.WgFailoverState
+	WgS2sFailoverEvent = domain.WgS2sFailoverEvent
+)
+
+// Failover member roles, as reported in WgFailoverState.Role.
+const (
+	FailoverActive  = "active"
+	FailoverStandby = "standby"
+	FailoverFailed  = "failed"
+)
+
+type failoverMember struct {
+	firstSeen     time.Time
+	demoted       bool
+	healthyStreak int
+	role          string
+	since         time.Time
+	reason        string
+}
+
+// failoverCheck is one member's health verdict for a round, decided on a
+// snapshot of the config so probes can run without m.mu.
+type failoverCheck struct {
+	cfg     TunnelConfig
+	healthy bool
+	reason  string
+}
+
+func failoverGroupOf(cfg TunnelConfig) string {
+	if !cfg.Enabled || cfg.Failover == nil {
+		return ""
+	}
+	return cfg.Failover.Group
+}
+
+// CheckFailover runs one round of the failover monitor. Every enabled group
+// member is judged on its handshake age and, if it has one, its probe. A
+// healthy member that turns unhealthy has its routes demoted at once; a
+// failed member is restored after failoverRecoverChecks healthy rounds in a
+// row. Members get handshakeTimeout of grace after the monitor first sees
+// them, so a tunnel that was just brought up is not failed before it had a
+// chance to handshake. The returned events are the role changes of this
+// round.
+func (m *TunnelManager) CheckFailover(ctx context.Context, now time.Time) []WgS2sFailoverEvent {
+	checks := m.failoverSnapshot(now)
+	for i := range checks {
+		c := &checks[i]
+		probe := c.cfg.Failover.Probe
+		if !c.healthy || probe == nil {
+			continue
+		}
+		if _, err := m.probe(ctx, c.cfg.InterfaceName, *probe); err != nil {
+			c.healthy = false
+			c.reason = fmt.Sprintf("%s probe to %s failed", probe.Kind, probe.Target)
+			m.log.Debug("failover probe failed", "id", c.cfg.ID, "err", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applyFailoverChecks(checks)
+	m.pruneFailover()
+	return m.assignFailoverRoles(now)
+}
+
+func (m *TunnelManager) failoverSnapshot(now time.Time) []failoverCheck {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var checks []failoverCheck
+	for _, t := range m.config.Tunnels {
+		if failoverGroupOf(t) == "" {
+			continue
+		}
+		if m.failover == nil {
+			m.failover = make(map[string]*failoverMember)
+		}
+		st := m.failover[t.ID]
+		if st == nil {
+			st = &failoverMember{firstSeen: now}
+			m.failover[t.ID] = st
+		}
+
+		c := failoverCheck{cfg: t, healthy: true}
+		if now.Sub(st.firstSeen) >= handshakeTimeout {
+			devPeers, err := m.devicePeers(t.InterfaceName)
+			switch {
+			case err != nil:
+				c.healthy, c.reason = false, "interface not available"
+			case !anyRecentHandshake(devPeers, now):
+				c.healthy, c.reason = false, fmt.Sprintf("no handshake for %s", handshakeTimeout)
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func (m *TunnelManager) applyFailoverChecks(checks []failoverCheck) {
+	for _, c := range checks {
+		idx := m.findTunnel(c.cfg.ID)
+		if idx < 0 {
+			continue
+		}
+		cfg := m.config.Tunnels[idx]
+		st := m.failover[cfg.ID]
+		// Edited while the probes ran; judge it again next round.
+		if st == nil || failoverGroupOf(cfg) != failoverGroupOf(c.cfg) {
+			continue
+		}
+
+		if !c.healthy {
+			st.healthyStreak = 0
+			st.reason = c.reason
+			if !st.demoted {
+				if err := m.setDemoted(cfg, st, true); err != nil {
+					m.log.Warn("failover: demote routes failed", "id", cfg.ID, "err", err)
+				}
+			}
+			continue
+		}
+		st.healthyStreak++
+		if st.demoted && st.healthyStreak >= failoverRecoverChecks {
+			if err := m.setDemoted(cfg, st, false); err != nil {
+				m.log.Warn("failover: restore routes failed", "id", cfg.ID, "err", err)
+				continue
+			}
+			st.reason = ""
+		}
+	}
+}
+
+// pruneFailover drops state for tunnels that left their group, were disabled
+// or deleted. A member that leaves while demoted gets its routes back first,
+// so the metric recorded in the route ref-counter stays what routeMetric
+// computes once the state is gone.
+func (m *TunnelManager) pruneFailover() {
+	for id, st := range m.failover {
+		idx := m.findTunnel(id)
+		if idx >= 0 && failoverGroupOf(m.config.Tunnels[idx]) != "" {
+			continue
+		}
+		if idx >= 0 && st.demoted && m.config.Tunnels[idx].Enabled {
+			if err := m.setDemoted(m.config.Tunnels[idx], st, false); err != nil {
+				m.log.Warn("failover: restore routes failed", "id", id, "err", err)
+				continue
+			}
+		}
+		delete(m.failover, id)
+	}
+}
+
+func (m *TunnelManager) assignFailoverRoles(now time.Time) []WgS2sFailoverEvent {
+	best := make(map[string]int)
+	for _, t := range m.config.Tunnels {
+		group := failoverGroupOf(t)
+		st := m.failover[t.ID]
+		if group == "" || st == nil || st.demoted {
+			continue
+		}
+		if cur, ok := best[group]; !ok || effectiveMetric(t.RouteMetric) < cur {
+			best[group] = effectiveMetric(t.RouteMetric)
+		}
+	}
+
+	var events []WgS2sFailoverEvent
+	for _, t := range m.config.Tunnels {
+		group := failoverGroupOf(t)
+		st := m.failover[t.ID]
+		if group == "" || st == nil {
+			continue
+		}
+		role := FailoverStandby
+		switch {
+		case st.demoted:
+			role = FailoverFailed
+		case effectiveMetric(t.RouteMetric) == best[group]:
+			role = FailoverActive
+		}
+		if role == st.role {
+			continue
+		}
+		if st.role != "" {
+			events = append(events, WgS2sFailoverEvent{
+				TunnelID: t.ID, TunnelName: t.Name, Group: group,
+				From: st.role, To: role, Reason: st.reason,
+			})
+			m.log.Info("failover role changed", "id", t.ID, "name", t.Name, "group", group,
+				"from", st.role, "to", role, "reason", st.reason)
+		}
+		st.role = role
+		st.since = now
+	}
+	return events
+}
+
+// setDemoted moves the tunnel's routes between its own metric and the
+// demoted one. The new routes are claimed before the old ones are released,
+// so the tunnel's subnets are never without a route.
+func (m *TunnelManager) setDemoted(cfg TunnelConfig, st *failoverMember, demoted bool) error {
+	from := m.routeMetric(cfg)
+	st.demoted = demoted
+	to := m.routeMetric(cfg)
+
+	ifIndex, ok := m.lookupIface(cfg.InterfaceName)
+	if !ok {
+		return nil
+	}
+	if err := m.claimPeerRoutesAt(cfg, ifIndex, to); err != nil {
+		st.demoted = !demoted
+		return err
+	}
+	m.releasePeerRoutesAt(cfg, ifIndex, from)
+	return nil
+}
+
+// routeMetric is the metric the tunnel's routes are installed at: its own,
+// or pushed behind every configurable one while the failover monitor has it
+// demoted.
+func (m *TunnelManager) routeMetric(cfg TunnelConfig) int {
+	metric := effectiveMetric(cfg.RouteMetric)
+	if st := m.failover[cfg.ID]; st != nil && st.demoted {
+		metric += failoverDemoteMetric
+	}
+	return metric
+}
+
+func (m *TunnelManager) applyFailoverStatus(statuses []WgS2sStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range statuses {
+		st := m.failover[statuses[i].ID]
+		if st == nil || st.role == "" {
+			continue
+		}
+		idx := m.findTunnel(statuses[i].ID)
+		if idx < 0 {
+			continue
+		}
+		statuses[i].Failover = &WgFailoverState{
+			Group:  failoverGroupOf(m.config.Tunnels[idx]),
+			Role:   st.role,
+			Since:  st.since,
+			Reason: st.reason,
+		}
+	}
+}
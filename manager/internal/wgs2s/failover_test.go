@@ -0,0 +1,167 @@
+package wgs2s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// newFailoverManager brings up tunnels with one peer each routing
+// 10.50.0.0/24. The handshake and probeErr maps, keyed by interface, drive the
+// health checks and may be changed by the test between rounds.
+func newFailoverManager(t *testing.T, handshake map[string]time.Time, probeErr map[string]error, tunnels ...TunnelConfig) *TunnelManager {
+	t.Helper()
+	mgr, fk := newTestManager(t)
+	for i := range tunnels {
+		tunnels[i].Enabled = true
+		tunnels[i].Peers = []Peer{{PublicKey: testPeerKey(t), AllowedIPs: []string{"10.50.0.0/24"}}}
+		idx := fk.createIface(tunnels[i].InterfaceName)
+		if err := mgr.claimPeerRoutes(tunnels[i], idx); err != nil {
+			t.Fatalf("claimPeerRoutes(%s): %v", tunnels[i].ID, err)
+		}
+	}
+	mgr.config.Tunnels = tunnels
+	mgr.devicePeersForTest = func(iface string) ([]wgtypes.Peer, error) {
+		return []wgtypes.Peer{{LastHandshakeTime: handshake[iface]}}, nil
+	}
+	mgr.probe = func(_ context.Context, iface string, _ WgHealthProbe) (time.Duration, error) {
+		return time.Millisecond, probeErr[iface]
+	}
+	return mgr
+}
+
+// ownsFailoverRoute reports whether tunnel id's peer holds 10.50.0.0/24 at
+// metric.
+func ownsFailoverRoute(mgr *TunnelManager, id string, metric int) bool {
+	cfg := mgr.config.Tunnels[mgr.findTunnel(id)]
+	return mgr.routeRefs.owns("10.50.0.0/24", peerOwnerID(id, cfg.Peers[0].PublicKey), metric)
+}
+
+func primaryAndBackup() []TunnelConfig {
+	return []TunnelConfig{
+		{ID: "P", Name: "primary", InterfaceName: "wg-s2s0", RouteMetric: 100, Failover: &WgFailover{Group: "hq"}},
+		{ID: "B", Name: "backup", InterfaceName: "wg-s2s1", RouteMetric: 200, Failover: &WgFailover{Group: "hq"}},
+	}
+}
+
+func TestCheckFailover_DemotesUnhealthyPrimary(t *testing.T) {
+	t0 := time.Now()
+	tests := []struct {
+		name     string
+		probe    *WgHealthProbe
+		now      time.Time
+		shake    time.Time
+		probeErr error
+	}{
+		{"stale handshake", nil, t0.Add(handshakeTimeout + time.Minute), t0.Add(-time.Hour), nil},
+		{"probe failure within handshake grace", &WgHealthProbe{Kind: HealthProbeICMP, Target: "10.50.0.1"},
+			t0, time.Time{}, errors.New("100% packet loss")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnels := primaryAndBackup()
+			tunnels[0].Failover.Probe = tt.probe
+			handshake := map[string]time.Time{}
+			probeErr := map[string]error{}
+			mgr := newFailoverManager(t, handshake, probeErr, tunnels...)
+			mgr.CheckFailover(context.Background(), t0)
+
+			handshake["wg-s2s0"] = tt.shake
+			handshake["wg-s2s1"] = tt.now.Add(-time.Second)
+			probeErr["wg-s2s0"] = tt.probeErr
+			mgr.CheckFailover(context.Background(), tt.now)
+
+			st := mgr.failover["P"]
+			if st.role != FailoverFailed || st.reason == "" {
+				t.Fatalf("primary must fail, got %+v", st)
+			}
+			if mgr.failover["B"].role != FailoverActive {
+				t.Fatalf("backup must take over, got %+v", mgr.failover["B"])
+			}
+			if ownsFailoverRoute(mgr, "P", 100) || !ownsFailoverRoute(mgr, "P", 100+failoverDemoteMetric) {
+				t.Fatal("failed primary's routes must move to the demoted metric")
+			}
+			if !ownsFailoverRoute(mgr, "B", 200) {
+				t.Fatal("backup routes must stay in place")
+			}
+			statuses := []WgS2sStatus{{ID: "P"}}
+			mgr.applyFailoverStatus(statuses)
+			if statuses[0].Failover == nil || statuses[0].Failover.Role != FailoverFailed || statuses[0].Failover.Group != "hq" {
+				t.Fatalf("status must carry the failover state, got %+v", statuses[0].Failover)
+			}
+		})
+	}
+}
+
+func TestCheckFailover_RestoresPrimaryAfterRecovery(t *testing.T) {
+	handshake := map[string]time.Time{}
+	mgr := newFailoverManager(t, handshake, nil, primaryAndBackup()...)
+	t0 := time.Now()
+
+	if ev := mgr.CheckFailover(context.Background(), t0); len(ev) != 0 {
+		t.Fatalf("first round only assigns roles, got events %+v", ev)
+	}
+	if mgr.failover["P"].role != FailoverActive || mgr.failover["B"].role != FailoverStandby {
+		t.Fatal("want P active, B standby after the first round")
+	}
+
+	t1 := t0.Add(handshakeTimeout + time.Minute)
+	handshake["wg-s2s0"] = t0.Add(-time.Hour)
+	handshake["wg-s2s1"] = t1.Add(-time.Second)
+	ev := mgr.CheckFailover(context.Background(), t1)
+	if len(ev) != 2 || ev[0].TunnelID != "P" || ev[0].To != FailoverFailed || ev[1].TunnelID != "B" || ev[1].To != FailoverActive {
+		t.Fatalf("unexpected events %+v", ev)
+	}
+
+	handshake["wg-s2s0"] = t1
+	for i := 1; i < failoverRecoverChecks; i++ {
+		if ev := mgr.CheckFailover(context.Background(), t1); len(ev) != 0 {
+			t.Fatalf("round %d: recovery must wait for %d healthy rounds, got %+v", i, failoverRecoverChecks, ev)
+		}
+	}
+	ev = mgr.CheckFailover(context.Background(), t1)
+	if len(ev) != 2 || ev[0].To != FailoverActive || ev[1].To != FailoverStandby {
+		t.Fatalf("unexpected recovery events %+v", ev)
+	}
+	if !ownsFailoverRoute(mgr, "P", 100) || ownsFailoverRoute(mgr, "P", 100+failoverDemoteMetric) {
+		t.Fatal("recovered primary's routes must be back at its own metric")
+	}
+}
+
+func TestCheckFailover_LeavingGroupRestoresRoutes(t *testing.T) {
+	tunnels := primaryAndBackup()
+	tunnels[0].Failover.Probe = &WgHealthProbe{Kind: HealthProbeICMP, Target: "10.50.0.1"}
+	mgr := newFailoverManager(t, nil, map[string]error{"wg-s2s0": errors.New("timeout")}, tunnels...)
+	mgr.CheckFailover(context.Background(), time.Now())
+	if !ownsFailoverRoute(mgr, "P", 100+failoverDemoteMetric) {
+		t.Fatal("setup: primary should be demoted")
+	}
+
+	mgr.config.Tunnels[0].Failover = nil
+	mgr.CheckFailover(context.Background(), time.Now())
+
+	if _, ok := mgr.failover["P"]; ok {
+		t.Fatal("state of a tunnel outside any group must be dropped")
+	}
+	if !ownsFailoverRoute(mgr, "P", 100) || ownsFailoverRoute(mgr, "P", 100+failoverDemoteMetric) {
+		t.Fatal("routes must return to the tunnel's own metric when it leaves the group")
+	}
+}
+
+func TestApplyUpdates_FailoverEmptyGroupClears(t *testing.T) {
+	base := TunnelConfig{ID: "A", Failover: &WgFailover{Group: "hq"}}
+	merged, err := applyUpdates(base, TunnelConfig{Failover: &WgFailover{}})
+	if err != nil {
+		t.Fatalf("applyUpdates: %v", err)
+	}
+	if merged.Failover != nil {
+		t.Fatalf("empty group must remove the tunnel from its group, got %+v", merged.Failover)
+	}
+	merged, _ = applyUpdates(base, TunnelConfig{Name: "renamed"})
+	if merged.Failover == nil || merged.Failover.Group != "hq" {
+		t.Fatal("an update without failover must keep the group")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -61,4 +62,103 @@ func deleteKeyFiles(configDir, id string) {
 	}
 	_ = os.Remove(filepath.Join(configDir, id+".key"))
 	_ = os.Remove(filepath.Join(configDir, id+".pub"))
+	_ = os.Remove(filepath.Join(configDir, id+".psk"))
+	_ = os.Remove(filepath.Join(configDir, id+".key.pending"))
+}
+
+// generatePendingKey creates the next private key for a rotation and stores
+// it as <id>.key.pending. The live <id>.key is untouched until the rotation
+// is committed.
+func generatePendingKey(configDir, id string) (wgtypes.Key, error) {
+	if !validTunnelID(id) {
+		return wgtypes.Key{}, fmt.Errorf("invalid tunnel ID: %q", id)
+	}
+	privKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("generate private key: %w", err)
+	}
+	if err := state.WriteFile(filepath.Join(configDir, id+".key.pending"), []byte(privKey.String()), 0600); err != nil {
+		return wgtypes.Key{}, fmt.Errorf("write pending private key: %w", err)
+	}
+	return privKey, nil
+}
+
+func loadPendingKey(configDir, id string) (wgtypes.Key, error) {
+	if !validTunnelID(id) {
+		return wgtypes.Key{}, fmt.Errorf("invalid tunnel ID: %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, id+".key.pending"))
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("read pending private key: %w", err)
+	}
+	return wgtypes.ParseKey(strings.TrimSpace(string(data)))
+}
+
+func deletePendingKey(configDir, id string) {
+	if !validTunnelID(id) {
+		return
+	}
+	_ = os.Remove(filepath.Join(configDir, id+".key.pending"))
+}
+
+// savePresharedKeys writes a tunnel's preshared keys to <id>.psk, one
+// "<peer public key> <preshared key>" pair per line, through the same 0600
+// atomic path as the private key. An empty map removes the file so a tunnel
+// whose last PSK was dropped does not keep a stale secret on disk.
+func savePresharedKeys(configDir, id string, psks map[string]string) error {
+	if !validTunnelID(id) {
+		return fmt.Errorf("invalid tunnel ID: %q", id)
+	}
+	path := filepath.Join(configDir, id+".psk")
+	if len(psks) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove preshared keys: %w", err)
+		}
+		return nil
+	}
+
+	peers := make([]string, 0, len(psks))
+	for peer := range psks {
+		peers = append(peers, peer)
+	}
+	slices.Sort(peers)
+	var b strings.Builder
+	for _, peer := range peers {
+		fmt.Fprintf(&b, "%s %s\n", peer, psks[peer])
+	}
+	if err := state.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("write preshared keys: %w", err)
+	}
+	return nil
+}
+
+// loadPresharedKeys reads <id>.psk. A missing file means the tunnel has no
+// preshared keys and is not an error.
+func loadPresharedKeys(configDir, id string) (map[string]string, error) {
+	if !validTunnelID(id) {
+		return nil, fmt.Errorf("invalid tunnel ID: %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, id+".psk"))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read preshared keys: %w", err)
+	}
+	psks := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		peer, psk, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("preshared keys line %d: malformed", n+1)
+		}
+		if _, err := wgtypes.ParseKey(strings.TrimSpace(psk)); err != nil {
+			return nil, fmt.Errorf("preshared keys line %d: %w", n+1, err)
+		}
+		psks[peer] = strings.TrimSpace(psk)
+	}
+	return psks, nil
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"slices"
@@ -50,8 +51,19 @@ type TunnelManager struct {
 	lookupIface func(name string) (uint32, bool)
 	listIfaces  func(prefix string) []ifaceEntry
 	deleteLink  func(idx uint32) error
+	lookupHost  func(ctx context.Context, host string) ([]netip.Addr, error)
+	probe       func(ctx context.Context, iface string, p WgHealthProbe) (time.Duration, error)
 	log         *slog.Logger
 
+	// failover holds the monitor's per-tunnel state for failover group
+	// members, keyed by tunnel ID. A demoted entry shifts the metric every
+	// route claim and release uses for that tunnel (see routeMetric).
+	failover map[string]*failoverMember
+
+	// reachability holds the recent results of each tunnel's reachability
+	// probes, keyed by tunnel ID and then by probeKey.
+	reachability map[string]map[string]*probeHistory
+
 	// bringUpForTest, when set, replaces the production bringUp pipeline so
 	// tests can drive RestoreAll without touching real netlink/wireguard.
 	bringUpForTest func(cfg TunnelConfig) error
@@ -60,6 +72,19 @@ type TunnelManager struct {
 	// observe save invocations (state snapshots, call ordering) or inject
 	// failures without touching a real filesystem.
 	saveOverride func() error
+
+	// syncPeersForTest, when set, replaces the wgctrl peer diff applied by
+	// hotUpdate so tests can observe which peers are added/removed.
+	syncPeersForTest func(iface string, remove []string, upsert []*peerConfig) error
+
+	// setPrivateKeyForTest, when set, replaces the wgctrl private-key swap
+	// performed by CommitKeyRotation.
+	setPrivateKeyForTest func(iface string, key wgtypes.Key) error
+
+	// devicePeersForTest and updatePeerForTest replace the wgctrl device
+	// query and single-peer update used by ReResolveEndpoints.
+	devicePeersForTest func(iface string) ([]wgtypes.Peer, error)
+	updatePeerForTest  func(iface string, peer *peerConfig) error
 }
 
 type ifaceEntry struct {
@@ -101,6 +126,8 @@ func NewTunnelManager(configDir string, log *slog.Logger) (*TunnelManager, error
 		lookupIface: getInterfaceIndex,
 		listIfaces:  listInterfacesByPrefix,
 		deleteLink:  func(idx uint32) error { return deleteInterface(rtConn, idx) },
+		lookupHost:  lookupHostAddrs,
+		probe:       runHealthProbe,
 		log:         log,
 	}, nil
 }
@@ -114,42 +141,61 @@ func (m *TunnelManager) Close() {
 	}
 }
 
-func (m *TunnelManager) CreateTunnel(cfg TunnelConfig, privateKey string) (*TunnelConfig, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// PrepareNewTunnel runs the checks CreateTunnel makes before it touches the
+// system, the listen port being free among them, and fills in cfg's
+// defaults. A dry run calls it to fail where the create would.
+func PrepareNewTunnel(cfg *TunnelConfig, privateKey string) error {
 	if cfg.Name == "" {
-		return nil, fmt.Errorf("tunnel name is required")
+		return fmt.Errorf("tunnel name is required")
 	}
 	if cfg.ListenPort == 0 {
-		return nil, fmt.Errorf("listen port is required")
+		return fmt.Errorf("listen port is required")
 	}
-	if cfg.TunnelAddress == "" {
-		return nil, fmt.Errorf("tunnel address is required")
+	NormalizeAddresses(cfg)
+	if len(cfg.TunnelAddresses) == 0 {
+		return fmt.Errorf("tunnel address is required")
 	}
-
-	if err := checkPortAvailable(cfg.ListenPort); err != nil {
-		return nil, fmt.Errorf("port %d: %w", cfg.ListenPort, err)
+	if privateKey != "" {
+		if _, err := wgtypes.ParseKey(strings.TrimSpace(privateKey)); err != nil {
+			return fmt.Errorf("parse private key: %w", err)
+		}
 	}
 
-	var err error
-	cfg.ID, err = generateID()
-	if err != nil {
-		return nil, err
+	if err := checkPortAvailable(cfg.ListenPort); err != nil {
+		return fmt.Errorf("port %d: %w", cfg.ListenPort, err)
 	}
-	cfg.InterfaceName = nextInterfaceName(m.config.Tunnels)
-	cfg.CreatedAt = time.Now()
-	cfg.Enabled = true
 
 	if cfg.PersistentKeepalive == 0 {
 		cfg.PersistentKeepalive = defaultPersistentKeepalive
 	}
 	if cfg.MTU == 0 {
-		cfg.MTU = defaultMTU
+		cfg.MTU = DefaultMTU
 	}
 	if cfg.RouteMetric == 0 {
 		cfg.RouteMetric = defaultRouteMetric
 	}
+	NormalizePeers(cfg)
+	return nil
+}
+
+func (m *TunnelManager) CreateTunnel(cfg TunnelConfig, privateKey string) (*TunnelConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := PrepareNewTunnel(&cfg, privateKey); err != nil {
+		return nil, err
+	}
+
+	var err error
+	cfg.ID, err = generateID()
+	if err != nil {
+		return nil, err
+	}
+	cfg.InterfaceName = NextInterfaceName(m.config.Tunnels)
+	cfg.CreatedAt = time.Now()
+	cfg.KeyCreatedAt = cfg.CreatedAt
+	cfg.KeyRotation = nil
+	cfg.Enabled = true
 
 	var privKey wgtypes.Key
 	if privateKey != "" {
@@ -176,7 +222,8 @@ func (m *TunnelManager) CreateTunnel(cfg TunnelConfig, privateKey string) (*Tunn
 	}
 
 	m.log.Info("tunnel created", "id", cfg.ID, "name", cfg.Name, "iface", cfg.InterfaceName)
-	return &cfg, nil
+	result := withoutPresharedKeys(cfg)
+	return &result, nil
 }
 
 func (m *TunnelManager) DeleteTunnel(id string) error {
@@ -267,7 +314,7 @@ func (m *TunnelManager) EnableTunnel(id string) error {
 				if !ok {
 					return nil
 				}
-				m.releaseRoutes(cfgVal.ID, ifIdx, cfgVal.AllowedIPs, effectiveMetric(cfgVal.RouteMetric))
+				m.releasePeerRoutes(cfgVal, ifIdx)
 				return m.deleteLink(ifIdx)
 			},
 		},
@@ -304,25 +351,64 @@ func (m *TunnelManager) DisableTunnel(id string) error {
 	})
 }
 
-func applyUpdates(base, updates TunnelConfig) TunnelConfig {
+// applyUpdates merges non-zero fields of updates into base. Peers, when
+// present, replaces the whole peer list; the flat PeerPublicKey/PeerEndpoint/
+// AllowedIPs/PresharedKey fields edit the sole peer and are rejected on
+// multi-peer tunnels where it would be ambiguous which peer they address.
+// A non-empty PresharedKey rotates that peer's PSK; an empty one keeps it,
+// and ClearPresharedKey removes it.
+// TunnelAddresses likewise replaces the address list, while a flat
+// TunnelAddress only replaces the address of its own family.
+func applyUpdates(base, updates TunnelConfig) (TunnelConfig, error) {
 	merged := base
+	merged.Peers = slices.Clone(peersOf(base))
+	flatPeerEdit := updates.PeerPublicKey != "" || updates.PeerEndpoint != "" ||
+		updates.AllowedIPs != nil || updates.PresharedKey != "" || updates.ClearPresharedKey
+	switch {
+	case updates.Peers != nil:
+		merged.Peers = slices.Clone(updates.Peers)
+		// Clients never see stored PSKs, so a peer sent back without one
+		// keeps whatever its public key had before.
+		prev := presharedKeysOf(base)
+		for i := range merged.Peers {
+			if merged.Peers[i].PresharedKey == "" && !merged.Peers[i].ClearPresharedKey {
+				merged.Peers[i].PresharedKey = prev[merged.Peers[i].PublicKey]
+			}
+		}
+	case flatPeerEdit && len(merged.Peers) > 1:
+		return TunnelConfig{}, fmt.Errorf("tunnel %s has %d peers; update peers instead of peerPublicKey/peerEndpoint/allowedIPs",
+			base.ID, len(merged.Peers))
+	case flatPeerEdit:
+		if len(merged.Peers) == 0 {
+			merged.Peers = []Peer{{}}
+		}
+		p := &merged.Peers[0]
+		if updates.PeerPublicKey != "" {
+			p.PublicKey = updates.PeerPublicKey
+		}
+		if updates.PeerEndpoint != "" {
+			p.Endpoint = updates.PeerEndpoint
+		}
+		if updates.AllowedIPs != nil {
+			p.AllowedIPs = updates.AllowedIPs
+		}
+		if updates.PresharedKey != "" {
+			p.PresharedKey = updates.PresharedKey
+		} else if updates.ClearPresharedKey {
+			p.PresharedKey = ""
+		}
+	}
 	if updates.Name != "" {
 		merged.Name = updates.Name
 	}
 	if updates.ListenPort != 0 {
 		merged.ListenPort = updates.ListenPort
 	}
-	if updates.TunnelAddress != "" {
-		merged.TunnelAddress = updates.TunnelAddress
-	}
-	if updates.PeerPublicKey != "" {
-		merged.PeerPublicKey = updates.PeerPublicKey
-	}
-	if updates.PeerEndpoint != "" {
-		merged.PeerEndpoint = updates.PeerEndpoint
-	}
-	if updates.AllowedIPs != nil {
-		merged.AllowedIPs = updates.AllowedIPs
+	switch {
+	case updates.TunnelAddresses != nil:
+		merged.TunnelAddresses = slices.Clone(updates.TunnelAddresses)
+	case updates.TunnelAddress != "":
+		merged.TunnelAddresses = replaceAddressFamily(addressesOf(base), updates.TunnelAddress)
 	}
 	if updates.LocalSubnets != nil {
 		merged.LocalSubnets = updates.LocalSubnets
@@ -336,14 +422,30 @@ func applyUpdates(base, updates TunnelConfig) TunnelConfig {
 	if updates.RouteMetric != 0 {
 		merged.RouteMetric = updates.RouteMetric
 	}
-	return merged
+	if updates.Failover != nil {
+		merged.Failover = nil
+		if updates.Failover.Group != "" {
+			f := *updates.Failover
+			merged.Failover = &f
+		}
+	}
+	if updates.Probes != nil {
+		merged.Probes = nil
+		if len(updates.Probes) > 0 {
+			merged.Probes = slices.Clone(updates.Probes)
+		}
+	}
+	NormalizePeers(&merged)
+	NormalizeAddresses(&merged)
+	return merged, nil
 }
 
+// needsRecreate reports whether an update touches interface-level settings.
+// Peer additions, removals and key swaps are applied hot by syncPeers.
 func needsRecreate(old, merged TunnelConfig) bool {
 	return old.ListenPort != merged.ListenPort ||
-		old.TunnelAddress != merged.TunnelAddress ||
-		old.MTU != merged.MTU ||
-		old.PeerPublicKey != merged.PeerPublicKey
+		!slices.Equal(addressesOf(old), addressesOf(merged)) ||
+		old.MTU != merged.MTU
 }
 
 func (m *TunnelManager) UpdateTunnel(id string, updates TunnelConfig) (*TunnelConfig, error) {
@@ -358,18 +460,28 @@ func (m *TunnelManager) UpdateTunnel(id string, updates TunnelConfig) (*TunnelCo
 	cfg := &m.config.Tunnels[idx]
 	wasEnabled := cfg.Enabled
 
-	merged := applyUpdates(*cfg, updates)
+	merged, err := applyUpdates(*cfg, updates)
+	if err != nil {
+		return nil, err
+	}
 
-	if merged.TunnelAddress != "" {
-		if _, _, err := net.ParseCIDR(merged.TunnelAddress); err != nil {
-			return nil, fmt.Errorf("invalid tunnel address %q: %w", merged.TunnelAddress, err)
+	if len(merged.TunnelAddresses) == 0 {
+		return nil, fmt.Errorf("tunnel address is required")
+	}
+	for _, addr := range merged.TunnelAddresses {
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			return nil, fmt.Errorf("invalid tunnel address %q: %w", addr, err)
 		}
 	}
 
 	if wasEnabled {
-		if merged.PeerEndpoint != "" && merged.PeerEndpoint != cfg.PeerEndpoint {
-			if _, err := net.ResolveUDPAddr("udp", merged.PeerEndpoint); err != nil {
-				return nil, fmt.Errorf("preflight: cannot resolve peer endpoint %s: %w", merged.PeerEndpoint, err)
+		_, upsert := diffPeers(*cfg, merged)
+		for _, p := range upsert {
+			if p.Endpoint == "" {
+				continue
+			}
+			if _, err := net.ResolveUDPAddr("udp", p.Endpoint); err != nil {
+				return nil, fmt.Errorf("preflight: cannot resolve peer endpoint %s: %w", p.Endpoint, err)
 			}
 		}
 		if merged.ListenPort != cfg.ListenPort && merged.ListenPort != 0 {
@@ -380,8 +492,6 @@ func (m *TunnelManager) UpdateTunnel(id string, updates TunnelConfig) (*TunnelCo
 	}
 
 	recreate := !wasEnabled || needsRecreate(*cfg, merged)
-	oldAllowedIPs := cfg.AllowedIPs
-	oldMetric := effectiveMetric(cfg.RouteMetric)
 	oldCfg := *cfg
 
 	// Kernel-first: drive the kernel ops against a local copy so m.config
@@ -394,7 +504,7 @@ func (m *TunnelManager) UpdateTunnel(id string, updates TunnelConfig) (*TunnelCo
 			return nil, err
 		}
 	} else if wasEnabled && !recreate {
-		if err := m.hotUpdate(local, oldAllowedIPs, oldMetric); err != nil {
+		if err := m.hotUpdate(oldCfg, local); err != nil {
 			m.log.Warn("hot update failed, falling back to recreate", "id", local.ID, "err", err)
 			if err := m.recreateTunnel(&local, true); err != nil {
 				return nil, err
@@ -408,18 +518,16 @@ func (m *TunnelManager) UpdateTunnel(id string, updates TunnelConfig) (*TunnelCo
 		return nil, err
 	}
 
-	result := m.config.Tunnels[idx]
+	result := withoutPresharedKeys(m.config.Tunnels[idx])
 	return &result, nil
 }
 
-func (m *TunnelManager) hotUpdate(cfg TunnelConfig, oldAllowedIPs []string, oldMetric int) error {
-	peer := &peerConfig{
-		PublicKey:           cfg.PeerPublicKey,
-		Endpoint:            cfg.PeerEndpoint,
-		AllowedIPs:          cfg.AllowedIPs,
-		PersistentKeepalive: cfg.PersistentKeepalive,
-	}
-	if err := updatePeer(m.wgClient, cfg.InterfaceName, peer); err != nil {
+// hotUpdate applies a peer-level change to a live interface: removed peers
+// are dropped, new or changed peers are upserted, and only the routes of
+// peers whose AllowedIPs (or the tunnel metric) changed are re-claimed.
+func (m *TunnelManager) hotUpdate(old, cfg TunnelConfig) error {
+	remove, upsert := diffPeers(old, cfg)
+	if err := m.syncPeers(cfg.InterfaceName, remove, upsert); err != nil {
 		return err
 	}
 
@@ -428,18 +536,50 @@ func (m *TunnelManager) hotUpdate(cfg TunnelConfig, oldAllowedIPs []string, oldM
 		return fmt.Errorf("interface %s not found", cfg.InterfaceName)
 	}
 
-	newMetric := effectiveMetric(cfg.RouteMetric)
-	if !slices.Equal(oldAllowedIPs, cfg.AllowedIPs) || oldMetric != newMetric {
-		m.releaseRoutes(cfg.ID, ifIndex, oldAllowedIPs, oldMetric)
-		if err := m.claimRoutes(cfg.ID, ifIndex, cfg.AllowedIPs, newMetric); err != nil {
+	oldMetric := m.routeMetric(old)
+	newMetric := m.routeMetric(cfg)
+	oldPeers := peerAllowedIPs(old)
+	newPeers := peerAllowedIPs(cfg)
+	unchanged := func(key string) bool {
+		prev, inOld := oldPeers[key]
+		next, inNew := newPeers[key]
+		return inOld && inNew && oldMetric == newMetric && slices.Equal(prev, next)
+	}
+
+	for _, p := range peersOf(old) {
+		if !unchanged(p.PublicKey) {
+			m.releaseRoutes(peerOwnerID(old.ID, p.PublicKey), ifIndex, p.AllowedIPs, oldMetric)
+		}
+	}
+	for _, p := range peersOf(cfg) {
+		if unchanged(p.PublicKey) {
+			continue
+		}
+		if err := m.claimRoutes(peerOwnerID(cfg.ID, p.PublicKey), ifIndex, p.AllowedIPs, newMetric); err != nil {
 			return fmt.Errorf("hot update: claimRoutes: %w", err)
 		}
 	}
 
-	m.log.Info("tunnel hot-updated", "id", cfg.ID, "name", cfg.Name)
+	m.log.Info("tunnel hot-updated", "id", cfg.ID, "name", cfg.Name,
+		"peersRemoved", len(remove), "peersUpserted", len(upsert))
 	return nil
 }
 
+func (m *TunnelManager) syncPeers(iface string, remove []string, upsert []*peerConfig) error {
+	if m.syncPeersForTest != nil {
+		return m.syncPeersForTest(iface, remove, upsert)
+	}
+	return syncPeers(m.wgClient, iface, remove, upsert)
+}
+
+func peerAllowedIPs(cfg TunnelConfig) map[string][]string {
+	out := make(map[string][]string)
+	for _, p := range peersOf(cfg) {
+		out[p.PublicKey] = p.AllowedIPs
+	}
+	return out
+}
+
 func (m *TunnelManager) RestoreAll() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -510,7 +650,9 @@ func (m *TunnelManager) GetTunnels() []TunnelConfig {
 	defer m.mu.Unlock()
 
 	result := make([]TunnelConfig, len(m.config.Tunnels))
-	copy(result, m.config.Tunnels)
+	for i, t := range m.config.Tunnels {
+		result[i] = withoutPresharedKeys(t)
+	}
 	return result
 }
 
@@ -522,7 +664,10 @@ func (m *TunnelManager) GetStatuses() []WgS2sStatus {
 	log := m.log
 	m.mu.Unlock()
 
-	return getAllStatuses(wgClient, tunnels, log)
+	statuses := getAllStatuses(wgClient, tunnels, log)
+	m.applyFailoverStatus(statuses)
+	m.applyReachabilityStatus(statuses)
+	return statuses
 }
 
 func (m *TunnelManager) GetPublicKey(id string) (string, error) {
@@ -537,12 +682,31 @@ func (m *TunnelManager) GetPublicKey(id string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
+// GetPresharedKey returns the PSK shared with one peer of a tunnel, or ""
+// when that peer has none. It is the only way a stored PSK leaves the
+// manager, and exists for the config export.
+func (m *TunnelManager) GetPresharedKey(id, peerPublicKey string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.findTunnel(id)
+	if idx < 0 {
+		return "", fmt.Errorf(errFmtTunnelNotFound, id)
+	}
+	for _, p := range m.config.Tunnels[idx].Peers {
+		if p.PublicKey == peerPublicKey {
+			return p.PresharedKey, nil
+		}
+	}
+	return "", fmt.Errorf("peer %s not found on tunnel %s", peerPublicKey, id)
+}
+
 func (m *TunnelManager) cleanupExistingInterface(cfg TunnelConfig) error {
 	idx, ok := m.lookupIface(cfg.InterfaceName)
 	if !ok {
 		return nil
 	}
-	m.releaseRoutes(cfg.ID, idx, cfg.AllowedIPs, effectiveMetric(cfg.RouteMetric))
+	m.releasePeerRoutes(cfg, idx)
 	if err := m.deleteLink(idx); err != nil {
 		m.log.Warn("delete existing interface failed, reconnecting rtnetlink",
 			"iface", cfg.InterfaceName, "err", err)
@@ -581,20 +745,16 @@ func (m *TunnelManager) bringUp(cfg TunnelConfig, privKey wgtypes.Key) error {
 		}
 	}
 
-	peer := &peerConfig{
-		PublicKey:           cfg.PeerPublicKey,
-		Endpoint:            cfg.PeerEndpoint,
-		AllowedIPs:          cfg.AllowedIPs,
-		PersistentKeepalive: cfg.PersistentKeepalive,
-	}
-	if err := configureDevice(m.wgClient, cfg.InterfaceName, privKey, cfg.ListenPort, peer); err != nil {
+	if err := configureDevice(m.wgClient, cfg.InterfaceName, privKey, cfg.ListenPort, devicePeerConfigs(cfg)); err != nil {
 		cleanup()
 		return err
 	}
 
-	if err := addAddress(m.rtConn, ifIndex, cfg.TunnelAddress); err != nil {
-		cleanup()
-		return fmt.Errorf("add address: %w", err)
+	for _, addr := range addressesOf(cfg) {
+		if err := addAddress(m.rtConn, ifIndex, addr); err != nil {
+			cleanup()
+			return fmt.Errorf("add address %s: %w", addr, err)
+		}
 	}
 
 	if err := setInterfaceUp(m.rtConn, ifIndex); err != nil {
@@ -602,11 +762,9 @@ func (m *TunnelManager) bringUp(cfg TunnelConfig, privKey wgtypes.Key) error {
 		return fmt.Errorf("set interface up: %w", err)
 	}
 
-	if len(cfg.AllowedIPs) > 0 {
-		if err := m.claimRoutes(cfg.ID, ifIndex, cfg.AllowedIPs, effectiveMetric(cfg.RouteMetric)); err != nil {
-			cleanup()
-			return err
-		}
+	if err := m.claimPeerRoutes(cfg, ifIndex); err != nil {
+		cleanup()
+		return err
 	}
 
 	return nil
@@ -684,6 +842,38 @@ func (m *TunnelManager) releaseRoutes(tunnelID string, ifIndex uint32, cidrs []s
 	}
 }
 
+// claimPeerRoutes claims every peer's AllowedIPs under its own owner key. On
+// failure the peers claimed so far are released again.
+func (m *TunnelManager) claimPeerRoutes(cfg TunnelConfig, ifIndex uint32) error {
+	return m.claimPeerRoutesAt(cfg, ifIndex, m.routeMetric(cfg))
+}
+
+func (m *TunnelManager) claimPeerRoutesAt(cfg TunnelConfig, ifIndex uint32, metric int) error {
+	peers := peersOf(cfg)
+	for i, p := range peers {
+		if len(p.AllowedIPs) == 0 {
+			continue
+		}
+		if err := m.claimRoutes(peerOwnerID(cfg.ID, p.PublicKey), ifIndex, p.AllowedIPs, metric); err != nil {
+			for _, prev := range peers[:i] {
+				m.releaseRoutes(peerOwnerID(cfg.ID, prev.PublicKey), ifIndex, prev.AllowedIPs, metric)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TunnelManager) releasePeerRoutes(cfg TunnelConfig, ifIndex uint32) {
+	m.releasePeerRoutesAt(cfg, ifIndex, m.routeMetric(cfg))
+}
+
+func (m *TunnelManager) releasePeerRoutesAt(cfg TunnelConfig, ifIndex uint32, metric int) {
+	for _, p := range peersOf(cfg) {
+		m.releaseRoutes(peerOwnerID(cfg.ID, p.PublicKey), ifIndex, p.AllowedIPs, metric)
+	}
+}
+
 func (m *TunnelManager) unregisterRoutes(tunnelID string, cidrs []string, metric int) {
 	for _, cidr := range cidrs {
 		m.routeRefs.remove(cidr, tunnelID, metric)
@@ -699,7 +889,7 @@ func (m *TunnelManager) tearDown(cfg TunnelConfig) error {
 	if !ok {
 		return nil
 	}
-	m.releaseRoutes(cfg.ID, idx, cfg.AllowedIPs, effectiveMetric(cfg.RouteMetric))
+	m.releasePeerRoutes(cfg, idx)
 	if err := m.deleteLink(idx); err != nil {
 		return fmt.Errorf("deleteInterface %s: %w", cfg.InterfaceName, err)
 	}
@@ -0,0 +1,206 @@
+package wgs2s
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"unifi-tailscale/manager/domain"
+)
+
+func testPeerKey(t *testing.T) string {
+	t.Helper()
+	k, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return k.PublicKey().String()
+}
+
+func TestNormalizePeers_FoldsLegacyFlatFields(t *testing.T) {
+	cfg := TunnelConfig{
+		PeerPublicKey: "key-a",
+		PeerEndpoint:  "198.51.100.1:51820",
+		AllowedIPs:    []string{"10.1.0.0/24"},
+	}
+	NormalizePeers(&cfg)
+
+	if len(cfg.Peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(cfg.Peers))
+	}
+	p := cfg.Peers[0]
+	if p.PublicKey != "key-a" || p.Endpoint != "198.51.100.1:51820" || !slices.Equal(p.AllowedIPs, []string{"10.1.0.0/24"}) {
+		t.Fatalf("legacy fields not folded into peer: %+v", p)
+	}
+}
+
+func TestNormalizePeers_DerivesFlatFieldsFromPeers(t *testing.T) {
+	cfg := TunnelConfig{
+		Peers: []Peer{
+			{PublicKey: "key-a", Endpoint: "a.example:51820", AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: "key-b", AllowedIPs: []string{"10.2.0.0/24", "10.1.0.0/24"}},
+		},
+	}
+	NormalizePeers(&cfg)
+
+	if cfg.PeerPublicKey != "key-a" || cfg.PeerEndpoint != "a.example:51820" {
+		t.Fatalf("flat peer fields must mirror first peer, got %q/%q", cfg.PeerPublicKey, cfg.PeerEndpoint)
+	}
+	want := []string{"10.1.0.0/24", "10.2.0.0/24"}
+	if !slices.Equal(cfg.AllowedIPs, want) {
+		t.Fatalf("AllowedIPs = %v, want union %v", cfg.AllowedIPs, want)
+	}
+}
+
+func TestApplyUpdates_FlatPeerEditRejectedOnHub(t *testing.T) {
+	base := TunnelConfig{ID: "A", Peers: []Peer{
+		{PublicKey: "key-a", AllowedIPs: []string{"10.1.0.0/24"}},
+		{PublicKey: "key-b", AllowedIPs: []string{"10.2.0.0/24"}},
+	}}
+	if _, err := applyUpdates(base, TunnelConfig{PeerEndpoint: "x.example:1"}); err == nil {
+		t.Fatal("expected flat peer edit on a multi-peer tunnel to be rejected")
+	}
+}
+
+func TestApplyUpdates_FlatPeerEditTargetsSolePeer(t *testing.T) {
+	base := TunnelConfig{ID: "A", Peers: []Peer{
+		{PublicKey: "key-a", Endpoint: "old.example:1", AllowedIPs: []string{"10.1.0.0/24"}},
+	}}
+	merged, err := applyUpdates(base, TunnelConfig{PeerEndpoint: "new.example:1"})
+	if err != nil {
+		t.Fatalf("applyUpdates: %v", err)
+	}
+	if merged.Peers[0].Endpoint != "new.example:1" || merged.PeerEndpoint != "new.example:1" {
+		t.Fatalf("endpoint edit not applied: %+v", merged.Peers[0])
+	}
+	if base.Peers[0].Endpoint != "old.example:1" {
+		t.Fatal("applyUpdates mutated the base config's peer slice")
+	}
+}
+
+// TestHotUpdate_AddRemovePeerKeepsOtherRoutes covers the hub case: adding a
+// spoke and removing another must be applied as a peer diff on the live
+// interface, and only the affected spokes' routes may change.
+func TestHotUpdate_AddRemovePeerKeepsOtherRoutes(t *testing.T) {
+	mgr, fk := newTestManager(t)
+	keyA, keyB, keyC := testPeerKey(t), testPeerKey(t), testPeerKey(t)
+	old := TunnelConfig{
+		ID: "H", InterfaceName: "wg-s2s0", Enabled: true,
+		ListenPort: 51820, TunnelAddress: "10.255.0.1/24",
+		Peers: []Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: keyB, AllowedIPs: []string{"10.2.0.0/24"}},
+		},
+	}
+	NormalizePeers(&old)
+	mgr.config.Tunnels = []TunnelConfig{old}
+	idx := fk.createIface(old.InterfaceName)
+	if err := mgr.claimPeerRoutes(old, idx); err != nil {
+		t.Fatalf("claimPeerRoutes: %v", err)
+	}
+
+	var removed []string
+	var upserted []string
+	mgr.syncPeersForTest = func(_ string, remove []string, upsert []*peerConfig) error {
+		removed = append(removed, remove...)
+		for _, p := range upsert {
+			upserted = append(upserted, p.PublicKey)
+		}
+		return nil
+	}
+	mgr.bringUpForTest = func(TunnelConfig) error {
+		t.Fatal("peer add/remove must not recreate the interface")
+		return nil
+	}
+	mgr.saveOverride = func() error { return nil }
+
+	updated, err := mgr.UpdateTunnel("H", TunnelConfig{Peers: []Peer{
+		{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}},
+		{PublicKey: keyC, AllowedIPs: []string{"10.3.0.0/24"}},
+	}})
+	if err != nil {
+		t.Fatalf("UpdateTunnel: %v", err)
+	}
+
+	if !slices.Equal(removed, []string{keyB}) {
+		t.Fatalf("removed = %v, want only peer B", removed)
+	}
+	if !slices.Equal(upserted, []string{keyC}) {
+		t.Fatalf("upserted = %v, want only peer C (A is unchanged)", upserted)
+	}
+	if !fk.hasRoute("10.1.0.0/24") || !fk.hasRoute("10.3.0.0/24") {
+		t.Fatal("routes for kept/added peers missing")
+	}
+	if fk.hasRoute("10.2.0.0/24") {
+		t.Fatal("route of removed peer B survived")
+	}
+	if !mgr.routeRefs.owns("10.3.0.0/24", peerOwnerID("H", keyC), effectiveMetric(0)) {
+		t.Fatal("route ownership must be keyed per peer")
+	}
+	if !slices.Equal(updated.AllowedIPs, []string{"10.1.0.0/24", "10.3.0.0/24"}) {
+		t.Fatalf("AllowedIPs union not refreshed: %v", updated.AllowedIPs)
+	}
+}
+
+func TestApplyDevicePeers_PerPeerRowsAndAggregate(t *testing.T) {
+	now := time.Now()
+	pkA, _ := wgtypes.GeneratePrivateKey()
+	pkB, _ := wgtypes.GeneratePrivateKey()
+	st := WgS2sStatus{Peers: []WgS2sPeerStatus{
+		{PublicKey: pkA.PublicKey().String()},
+		{PublicKey: pkB.PublicKey().String()},
+	}}
+
+	applyDevicePeers(&st, []wgtypes.Peer{
+		{
+			PublicKey:         pkB.PublicKey(),
+			LastHandshakeTime: now.Add(-10 * time.Minute),
+			ReceiveBytes:      5, TransmitBytes: 7,
+		},
+		{
+			PublicKey:         pkA.PublicKey(),
+			Endpoint:          &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 51820},
+			LastHandshakeTime: now.Add(-30 * time.Second),
+			ReceiveBytes:      100, TransmitBytes: 200,
+		},
+	}, now)
+
+	if !st.Peers[0].Connected || st.Peers[1].Connected {
+		t.Fatalf("per-peer connected flags wrong: %+v", st.Peers)
+	}
+	if !st.Connected {
+		t.Fatal("tunnel must be connected when any peer is")
+	}
+	if st.TransferRx != 105 || st.TransferTx != 207 {
+		t.Fatalf("aggregate transfer = %d/%d, want 105/207", st.TransferRx, st.TransferTx)
+	}
+	if !st.LastHandshake.Equal(now.Add(-30 * time.Second)) {
+		t.Fatalf("aggregate handshake must be the latest, got %v", st.LastHandshake)
+	}
+	if st.Endpoint != "198.51.100.1:51820" {
+		t.Fatalf("tunnel endpoint must mirror first peer, got %q", st.Endpoint)
+	}
+}
+
+func TestPeerKeepalive(t *testing.T) {
+	cfg := TunnelConfig{PersistentKeepalive: 25}
+	tests := []struct {
+		name string
+		peer int
+		want int
+	}{
+		{"inherits tunnel value", 0, 25},
+		{"own value wins", 10, 10},
+		{"off disables", domain.WgKeepaliveOff, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerKeepalive(cfg, Peer{PersistentKeepalive: tt.peer}); got != tt.want {
+				t.Fatalf("peerKeepalive = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
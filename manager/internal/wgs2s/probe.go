@@ -0,0 +1,80 @@
+package wgs2s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Health probe kinds, see WgHealthProbe.
+const (
+	HealthProbeICMP = "icmp"
+	HealthProbeTCP  = "tcp"
+)
+
+var pingRTT = regexp.MustCompile(`time=([0-9.]+) ?ms`)
+
+// runHealthProbe sends one probe out of iface and returns its round-trip
+// time. Both kinds are pinned to the interface, so a reply proves the path
+// through this tunnel and not through whichever route currently wins for
+// the target.
+func runHealthProbe(ctx context.Context, iface string, p WgHealthProbe) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	switch p.Kind {
+	case HealthProbeTCP:
+		d := net.Dialer{Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, iface)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}}
+		start := time.Now()
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(p.Target, strconv.Itoa(p.Port)))
+		rtt := time.Since(start)
+		if errors.Is(err, unix.ECONNREFUSED) {
+			return rtt, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return rtt, conn.Close()
+	case HealthProbeICMP:
+		wait := strconv.Itoa(int(healthProbeTimeout / time.Second))
+		start := time.Now()
+		out, err := exec.CommandContext(ctx, "ping", "-c", "1", "-W", wait, "-I", iface, p.Target).CombinedOutput()
+		if err != nil {
+			return 0, fmt.Errorf("ping %s: %w", p.Target, err)
+		}
+		if m := pingRTT.FindSubmatch(out); m != nil {
+			if ms, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+				return time.Duration(ms * float64(time.Millisecond)), nil
+			}
+		}
+		return time.Since(start), nil
+	default:
+		return 0, fmt.Errorf("unknown probe kind %q", p.Kind)
+	}
+}
+
+func anyRecentHandshake(peers []wgtypes.Peer, now time.Time) bool {
+	for _, p := range peers {
+		if !p.LastHandshakeTime.IsZero() && now.Sub(p.LastHandshakeTime) < handshakeTimeout {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package wgs2s
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func testPSK(t *testing.T) string {
+	t.Helper()
+	k, err := wgtypes.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate psk: %v", err)
+	}
+	return k.String()
+}
+
+func TestPresharedKeys_SaveLoadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	peerA, peerB := testPeerKey(t), testPeerKey(t)
+	want := map[string]string{peerA: testPSK(t), peerB: testPSK(t)}
+
+	if err := savePresharedKeys(dir, "rt", want); err != nil {
+		t.Fatalf("savePresharedKeys: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "rt.psk"))
+	if err != nil {
+		t.Fatalf("stat psk file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("psk file mode = %o, want 0600", perm)
+	}
+
+	got, err := loadPresharedKeys(dir, "rt")
+	if err != nil {
+		t.Fatalf("loadPresharedKeys: %v", err)
+	}
+	if len(got) != 2 || got[peerA] != want[peerA] || got[peerB] != want[peerB] {
+		t.Fatalf("round trip mismatch: got %v", got)
+	}
+
+	// Dropping the last PSK must not leave the secret on disk.
+	if err := savePresharedKeys(dir, "rt", nil); err != nil {
+		t.Fatalf("savePresharedKeys(empty): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rt.psk")); !os.IsNotExist(err) {
+		t.Fatalf("psk file should be removed, stat err = %v", err)
+	}
+	got, err = loadPresharedKeys(dir, "rt")
+	if err != nil || len(got) != 0 {
+		t.Fatalf("missing psk file should load as empty, got %v / %v", got, err)
+	}
+}
+
+func TestDeleteKeyFiles_RemovesPresharedKeys(t *testing.T) {
+	dir := t.TempDir()
+	if err := savePresharedKeys(dir, "del", map[string]string{testPeerKey(t): testPSK(t)}); err != nil {
+		t.Fatalf("savePresharedKeys: %v", err)
+	}
+	deleteKeyFiles(dir, "del")
+	if _, err := os.Stat(filepath.Join(dir, "del.psk")); !os.IsNotExist(err) {
+		t.Fatalf("psk file survived deleteKeyFiles, stat err = %v", err)
+	}
+}
+
+// TestUpdateTunnel_PresharedKeyRotation covers the PSK lifecycle on a hub:
+// re-sending a peer without its PSK keeps it (clients never see the stored
+// value), supplying a new one rotates it hot, and the key only ever lands in
+// the .psk file — not in tunnels.json or anything GetTunnels returns.
+func TestUpdateTunnel_PresharedKeyRotation(t *testing.T) {
+	mgr, fk := newTestManager(t)
+	keyA, keyB := testPeerKey(t), testPeerKey(t)
+	oldPSK, newPSK := testPSK(t), testPSK(t)
+	cfg := TunnelConfig{
+		ID: "P", InterfaceName: "wg-s2s0", Enabled: true,
+		ListenPort: 51820, TunnelAddress: "10.255.0.1/24",
+		Peers: []Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}, PresharedKey: oldPSK},
+			{PublicKey: keyB, AllowedIPs: []string{"10.2.0.0/24"}},
+		},
+	}
+	NormalizePeers(&cfg)
+	mgr.config.Tunnels = []TunnelConfig{cfg}
+	idx := fk.createIface(cfg.InterfaceName)
+	if err := mgr.claimPeerRoutes(cfg, idx); err != nil {
+		t.Fatalf("claimPeerRoutes: %v", err)
+	}
+
+	var upserted []*peerConfig
+	mgr.syncPeersForTest = func(_ string, _ []string, upsert []*peerConfig) error {
+		upserted = append(upserted, upsert...)
+		return nil
+	}
+
+	listed := mgr.GetTunnels()[0]
+	if listed.Peers[0].PresharedKey != "" || !listed.Peers[0].PresharedKeySet {
+		t.Fatalf("GetTunnels must hide the PSK but flag it: %+v", listed.Peers[0])
+	}
+
+	// Echo the listed peers back unchanged: nothing to push, PSK kept.
+	if _, err := mgr.UpdateTunnel("P", TunnelConfig{Peers: listed.Peers}); err != nil {
+		t.Fatalf("UpdateTunnel(echo): %v", err)
+	}
+	if len(upserted) != 0 {
+		t.Fatalf("echoing peers must not touch the kernel, upserted %d", len(upserted))
+	}
+	if psk, _ := mgr.GetPresharedKey("P", keyA); psk != oldPSK {
+		t.Fatal("PSK lost when peers were re-sent without it")
+	}
+
+	peers := listed.Peers
+	peers[0].PresharedKey = newPSK
+	updated, err := mgr.UpdateTunnel("P", TunnelConfig{Peers: peers})
+	if err != nil {
+		t.Fatalf("UpdateTunnel(rotate): %v", err)
+	}
+	if len(upserted) != 1 || upserted[0].PublicKey != keyA || upserted[0].PresharedKey != newPSK {
+		t.Fatalf("rotation must upsert only peer A with the new PSK, got %+v", upserted)
+	}
+	if updated.Peers[0].PresharedKey != "" {
+		t.Fatal("UpdateTunnel result leaked the PSK")
+	}
+	if psk, _ := mgr.GetPresharedKey("P", keyA); psk != newPSK {
+		t.Fatal("GetPresharedKey did not return the rotated PSK")
+	}
+
+	data, err := os.ReadFile(filepath.Join(mgr.configDir, configFileName))
+	if err != nil {
+		t.Fatalf("read tunnels.json: %v", err)
+	}
+	if strings.Contains(string(data), newPSK) || strings.Contains(string(data), oldPSK) {
+		t.Fatal("tunnels.json must not contain preshared keys")
+	}
+	psks, err := loadPresharedKeys(mgr.configDir, "P")
+	if err != nil || psks[keyA] != newPSK || len(psks) != 1 {
+		t.Fatalf(".psk file = %v / %v, want only peer A's rotated key", psks, err)
+	}
+}
+
+// TestUpdateTunnel_ClearPresharedKey covers removing a PSK, which an empty
+// PresharedKey cannot express: per peer through the peers list, and on the
+// sole peer through the flat field.
+func TestUpdateTunnel_ClearPresharedKey(t *testing.T) {
+	mgr, fk := newTestManager(t)
+	keyA, keyB := testPeerKey(t), testPeerKey(t)
+	pskA, pskB := testPSK(t), testPSK(t)
+	cfg := TunnelConfig{
+		ID: "P", InterfaceName: "wg-s2s0", Enabled: true,
+		ListenPort: 51820, TunnelAddress: "10.255.0.1/24",
+		Peers: []Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}, PresharedKey: pskA},
+			{PublicKey: keyB, AllowedIPs: []string{"10.2.0.0/24"}, PresharedKey: pskB},
+		},
+	}
+	NormalizePeers(&cfg)
+	mgr.config.Tunnels = []TunnelConfig{cfg}
+	idx := fk.createIface(cfg.InterfaceName)
+	if err := mgr.claimPeerRoutes(cfg, idx); err != nil {
+		t.Fatalf("claimPeerRoutes: %v", err)
+	}
+	var upserted []*peerConfig
+	mgr.syncPeersForTest = func(_ string, _ []string, upsert []*peerConfig) error {
+		upserted = append(upserted, upsert...)
+		return nil
+	}
+
+	peers := mgr.GetTunnels()[0].Peers
+	peers[0].ClearPresharedKey = true
+	updated, err := mgr.UpdateTunnel("P", TunnelConfig{Peers: peers})
+	if err != nil {
+		t.Fatalf("UpdateTunnel(clear): %v", err)
+	}
+	if len(upserted) != 1 || upserted[0].PublicKey != keyA || upserted[0].PresharedKey != "" {
+		t.Fatalf("clearing must upsert only peer A without a PSK, got %+v", upserted)
+	}
+	if updated.Peers[0].PresharedKeySet || !updated.Peers[1].PresharedKeySet {
+		t.Fatalf("only peer A's PSK is cleared: %+v", updated.Peers)
+	}
+	if updated.Peers[0].ClearPresharedKey {
+		t.Fatal("the clear flag must not be kept")
+	}
+	psks, err := loadPresharedKeys(mgr.configDir, "P")
+	if err != nil || len(psks) != 1 || psks[keyB] != pskB {
+		t.Fatalf(".psk file = %v / %v, want only peer B's key", psks, err)
+	}
+	data, err := os.ReadFile(filepath.Join(mgr.configDir, configFileName))
+	if err != nil {
+		t.Fatalf("read tunnels.json: %v", err)
+	}
+	if strings.Contains(string(data), "clearPresharedKey") {
+		t.Fatal("tunnels.json must not contain the clear flag")
+	}
+
+	single := TunnelConfig{PeerPublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}, PresharedKey: pskA}
+	NormalizePeers(&single)
+	merged, err := applyUpdates(single, TunnelConfig{ClearPresharedKey: true})
+	if err != nil {
+		t.Fatalf("applyUpdates: %v", err)
+	}
+	if merged.Peers[0].PresharedKey != "" {
+		t.Fatal("the flat clear flag must remove the sole peer's PSK")
+	}
+}
+
+func TestBuildPeerConfig_AlwaysSetsPresharedKey(t *testing.T) {
+	pc, err := buildPeerConfig(&peerConfig{PublicKey: testPeerKey(t)}, true)
+	if err != nil {
+		t.Fatalf("buildPeerConfig: %v", err)
+	}
+	if pc.PresharedKey == nil || *pc.PresharedKey != (wgtypes.Key{}) {
+		t.Fatalf("a peer without a PSK must set the zero key to remove an old one, got %v", pc.PresharedKey)
+	}
+}
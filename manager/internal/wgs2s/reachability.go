@@ -0,0 +1,196 @@
+package wgs2s
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"unifi-tailscale/manager/domain"
+)
+
+type (
+	WgProbeResult          = domain.WgProbeResult
+	WgS2sReachabilityEvent = domain.WgS2sReachabilityEvent
+)
+
+// probeHistory is the rolling window of one probe's outcomes, oldest first.
+type probeHistory struct {
+	outcomes []bool
+	result   WgProbeResult
+}
+
+// probeRun is one probe attempt, planned under m.mu and executed without it.
+type probeRun struct {
+	tunnelID string
+	iface    string
+	probe    WgHealthProbe
+	rtt      time.Duration
+	err      error
+}
+
+func probeKey(p WgHealthProbe) string {
+	return p.Kind + "|" + p.Target + "|" + strconv.Itoa(p.Port)
+}
+
+// RunReachabilityProbes sends every enabled tunnel's reachability probes
+// once and folds the outcomes into the rolling per-probe history reported
+// by GetStatuses. A handshake only proves the peer is alive; these probes
+// show whether the remote LAN actually answers through the tunnel. The
+// returned events are the probes whose target went unreachable or came
+// back in this round.
+func (m *TunnelManager) RunReachabilityProbes(ctx context.Context, now time.Time) []WgS2sReachabilityEvent {
+	runs := m.reachabilitySnapshot()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, reachabilityParallel)
+	for i := range runs {
+		r := &runs[i]
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r.rtt, r.err = m.probe(ctx, r.iface, r.probe)
+		})
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recordReachability(runs, now)
+}
+
+func (m *TunnelManager) reachabilitySnapshot() []probeRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var runs []probeRun
+	for _, t := range m.config.Tunnels {
+		if !t.Enabled {
+			continue
+		}
+		for _, p := range t.Probes {
+			runs = append(runs, probeRun{tunnelID: t.ID, iface: t.InterfaceName, probe: p})
+		}
+	}
+	return runs
+}
+
+// recordReachability appends this round's outcomes and drops the history
+// of tunnels and probes that are gone from the config. A probe's first
+// attempt only yields an event if it failed.
+func (m *TunnelManager) recordReachability(runs []probeRun, now time.Time) []WgS2sReachabilityEvent {
+	seen := make(map[string]map[string]bool)
+	var events []WgS2sReachabilityEvent
+	for _, r := range runs {
+		idx := m.findTunnel(r.tunnelID)
+		if idx < 0 {
+			continue
+		}
+		cfg := m.config.Tunnels[idx]
+		key := probeKey(r.probe)
+		if seen[cfg.ID] == nil {
+			seen[cfg.ID] = make(map[string]bool)
+		}
+		seen[cfg.ID][key] = true
+
+		if m.reachability == nil {
+			m.reachability = make(map[string]map[string]*probeHistory)
+		}
+		if m.reachability[cfg.ID] == nil {
+			m.reachability[cfg.ID] = make(map[string]*probeHistory)
+		}
+		h := m.reachability[cfg.ID][key]
+		first := h == nil
+		if first {
+			h = &probeHistory{}
+			m.reachability[cfg.ID][key] = h
+		}
+		wasReachable := h.result.Reachable
+		h.record(r, now)
+
+		changed := h.result.Reachable != wasReachable
+		if first {
+			changed = !h.result.Reachable
+		}
+		if changed {
+			events = append(events, WgS2sReachabilityEvent{
+				TunnelID: cfg.ID, TunnelName: cfg.Name,
+				Target: r.probe.Target, Kind: r.probe.Kind, Port: r.probe.Port,
+				Reachable: h.result.Reachable, Error: h.result.LastError,
+			})
+		}
+		if r.err != nil {
+			m.log.Debug("reachability probe failed", "id", cfg.ID, "target", r.probe.Target, "err", r.err)
+		}
+	}
+
+	for id, probes := range m.reachability {
+		for key := range probes {
+			if !seen[id][key] {
+				delete(probes, key)
+			}
+		}
+		if len(probes) == 0 {
+			delete(m.reachability, id)
+		}
+	}
+	return events
+}
+
+func (h *probeHistory) record(r probeRun, now time.Time) {
+	h.outcomes = append(h.outcomes, r.err == nil)
+	if len(h.outcomes) > reachabilityWindow {
+		h.outcomes = h.outcomes[len(h.outcomes)-reachabilityWindow:]
+	}
+	failed := 0
+	for _, ok := range h.outcomes {
+		if !ok {
+			failed++
+		}
+	}
+
+	res := &h.result
+	res.Kind, res.Target, res.Port = r.probe.Kind, r.probe.Target, r.probe.Port
+	res.CheckedAt = now
+	res.Loss = float64(failed) / float64(len(h.outcomes))
+	res.Reachable = r.err == nil
+	res.LastError = ""
+	if r.err != nil {
+		res.LastError = r.err.Error()
+		return
+	}
+	res.LastSuccess = now
+	res.LatencyMs = float64(r.rtt.Microseconds()) / 1000
+}
+
+// applyReachabilityStatus attaches the probe results to the statuses, in
+// the order the probes are configured. Reachable stays nil until every
+// probe of the tunnel has run at least once.
+func (m *TunnelManager) applyReachabilityStatus(statuses []WgS2sStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range statuses {
+		idx := m.findTunnel(statuses[i].ID)
+		if idx < 0 {
+			continue
+		}
+		probes := m.config.Tunnels[idx].Probes
+		history := m.reachability[statuses[i].ID]
+		if len(probes) == 0 || history == nil {
+			continue
+		}
+		reachable, complete := true, true
+		for _, p := range probes {
+			h := history[probeKey(p)]
+			if h == nil {
+				complete = false
+				continue
+			}
+			statuses[i].Probes = append(statuses[i].Probes, h.result)
+			reachable = reachable && h.result.Reachable
+		}
+		if complete {
+			statuses[i].Reachable = &reachable
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package wgs2s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newReachabilityManager(t *testing.T, probeErr map[string]error, probes ...WgHealthProbe) *TunnelManager {
+	t.Helper()
+	mgr, _ := newTestManager(t)
+	mgr.config.Tunnels = []TunnelConfig{{ID: "A", Name: "branch", InterfaceName: "wg-s2s0", Enabled: true, Probes: probes}}
+	mgr.probe = func(_ context.Context, _ string, p WgHealthProbe) (time.Duration, error) {
+		return 12500 * time.Microsecond, probeErr[p.Target]
+	}
+	return mgr
+}
+
+func TestRunReachabilityProbes_TracksLossLatencyAndLastSuccess(t *testing.T) {
+	probeErr := map[string]error{}
+	mgr := newReachabilityManager(t, probeErr,
+		WgHealthProbe{Kind: HealthProbeICMP, Target: "10.50.0.1"},
+		WgHealthProbe{Kind: HealthProbeTCP, Target: "10.50.0.10", Port: 443})
+	t0 := time.Now()
+
+	if ev := mgr.RunReachabilityProbes(context.Background(), t0); len(ev) != 0 {
+		t.Fatalf("reachable targets on the first round are not news, got %+v", ev)
+	}
+	probeErr["10.50.0.10"] = errors.New("i/o timeout")
+	t1 := t0.Add(time.Minute)
+	ev := mgr.RunReachabilityProbes(context.Background(), t1)
+	if len(ev) != 1 || ev[0].Target != "10.50.0.10" || ev[0].Reachable || ev[0].Error == "" {
+		t.Fatalf("unexpected events %+v", ev)
+	}
+
+	statuses := []WgS2sStatus{{ID: "A", Connected: true}}
+	mgr.applyReachabilityStatus(statuses)
+	st := statuses[0]
+	if st.Reachable == nil || *st.Reachable {
+		t.Fatal("a failing probe must mark the tunnel unreachable")
+	}
+	if len(st.Probes) != 2 {
+		t.Fatalf("probes = %+v, want one result per configured probe", st.Probes)
+	}
+	ok, bad := st.Probes[0], st.Probes[1]
+	if ok.LatencyMs != 12.5 || ok.Loss != 0 || !ok.LastSuccess.Equal(t1) {
+		t.Errorf("healthy probe = %+v", ok)
+	}
+	if bad.Reachable || bad.Loss != 0.5 || !bad.LastSuccess.Equal(t0) || bad.LastError == "" {
+		t.Errorf("failing probe = %+v, want 50%% loss and last success at the first round", bad)
+	}
+}
+
+func TestRunReachabilityProbes_LossWindowAndPruning(t *testing.T) {
+	probeErr := map[string]error{"10.50.0.1": errors.New("timeout")}
+	mgr := newReachabilityManager(t, probeErr, WgHealthProbe{Kind: HealthProbeICMP, Target: "10.50.0.1"})
+	now := time.Now()
+
+	if ev := mgr.RunReachabilityProbes(context.Background(), now); len(ev) != 1 {
+		t.Fatalf("a first failure must be reported, got %+v", ev)
+	}
+	delete(probeErr, "10.50.0.1")
+	for range reachabilityWindow {
+		mgr.RunReachabilityProbes(context.Background(), now)
+	}
+	if h := mgr.reachability["A"][probeKey(mgr.config.Tunnels[0].Probes[0])]; h.result.Loss != 0 {
+		t.Fatalf("loss = %v, the failure must age out of the window", h.result.Loss)
+	}
+
+	mgr.config.Tunnels[0].Probes = nil
+	mgr.RunReachabilityProbes(context.Background(), now)
+	if len(mgr.reachability) != 0 {
+		t.Fatal("history of removed probes must be dropped")
+	}
+	statuses := []WgS2sStatus{{ID: "A"}}
+	mgr.applyReachabilityStatus(statuses)
+	if statuses[0].Reachable != nil || statuses[0].Probes != nil {
+		t.Fatalf("a tunnel without probes reports no reachability, got %+v", statuses[0])
+	}
+}
@@ -0,0 +1,194 @@
+package wgs2s
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"unifi-tailscale/manager/domain"
+)
+
+type WgS2sEndpointChange = domain.WgS2sEndpointChange
+
+// staleHostPeer is a peer whose configured endpoint names a host and whose
+// session has gone quiet, captured under m.mu so the DNS lookup can run
+// without it.
+type staleHostPeer struct {
+	tunnelID string
+	peer     Peer
+	host     string
+	port     uint16
+	current  netip.AddrPort
+}
+
+// ReResolveEndpoints looks up the hostname endpoint of every peer on an
+// enabled tunnel whose last handshake is older than handshakeTimeout and, if
+// the kernel's endpoint is not among the addresses the name now resolves to,
+// re-points that peer in place. The interface, its routes and the other
+// peers' sessions are left alone. Peers with a literal IP endpoint, or none,
+// are never touched: WireGuard already roams them on authenticated traffic.
+func (m *TunnelManager) ReResolveEndpoints(ctx context.Context, now time.Time) []WgS2sEndpointChange {
+	var changes []WgS2sEndpointChange
+	for _, sp := range m.staleHostPeers(now) {
+		lookupCtx, cancel := context.WithTimeout(ctx, endpointLookupTimeout)
+		addrs, err := m.lookupHost(lookupCtx, sp.host)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			m.log.Debug("endpoint re-resolve failed", "id", sp.tunnelID, "host", sp.host, "err", err)
+			continue
+		}
+		for i := range addrs {
+			addrs[i] = addrs[i].Unmap()
+		}
+		if sp.current.IsValid() && slices.Contains(addrs, sp.current.Addr().Unmap()) {
+			continue
+		}
+		next := netip.AddrPortFrom(preferIPv4(addrs), sp.port)
+		if change, ok := m.repointPeer(sp, next); ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func (m *TunnelManager) staleHostPeers(now time.Time) []staleHostPeer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []staleHostPeer
+	for _, t := range m.config.Tunnels {
+		if !t.Enabled {
+			continue
+		}
+		var candidates []staleHostPeer
+		for _, p := range peersOf(t) {
+			host, port, ok := endpointHost(p.Endpoint)
+			if ok && p.PublicKey != "" {
+				candidates = append(candidates, staleHostPeer{tunnelID: t.ID, peer: p, host: host, port: port})
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		devPeers, err := m.devicePeers(t.InterfaceName)
+		if err != nil {
+			m.log.Debug("wgctrl device query failed", "iface", t.InterfaceName, "err", err)
+			continue
+		}
+		byKey := make(map[string]wgtypes.Peer, len(devPeers))
+		for _, dp := range devPeers {
+			byKey[dp.PublicKey.String()] = dp
+		}
+		for _, c := range candidates {
+			dp, ok := byKey[c.peer.PublicKey]
+			if !ok {
+				continue
+			}
+			if !dp.LastHandshakeTime.IsZero() && now.Sub(dp.LastHandshakeTime) < handshakeTimeout {
+				continue
+			}
+			if dp.Endpoint != nil {
+				c.current = dp.Endpoint.AddrPort()
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// repointPeer applies a freshly resolved endpoint, provided the peer still
+// exists with the same configured endpoint; an edit that raced the lookup
+// wins over it.
+func (m *TunnelManager) repointPeer(sp staleHostPeer, next netip.AddrPort) (WgS2sEndpointChange, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.findTunnel(sp.tunnelID)
+	if idx < 0 || !m.config.Tunnels[idx].Enabled {
+		return WgS2sEndpointChange{}, false
+	}
+	cfg := m.config.Tunnels[idx]
+	i := slices.IndexFunc(peersOf(cfg), func(p Peer) bool {
+		return p.PublicKey == sp.peer.PublicKey && p.Endpoint == sp.peer.Endpoint
+	})
+	if i < 0 {
+		return WgS2sEndpointChange{}, false
+	}
+
+	pc := toPeerConfig(cfg, peersOf(cfg)[i])
+	pc.Endpoint = next.String()
+	if err := m.updatePeer(cfg.InterfaceName, pc); err != nil {
+		m.log.Warn("endpoint re-resolve: update peer failed", "id", cfg.ID, "host", sp.host, "err", err)
+		return WgS2sEndpointChange{}, false
+	}
+
+	change := WgS2sEndpointChange{
+		TunnelID:      cfg.ID,
+		TunnelName:    cfg.Name,
+		PeerName:      sp.peer.Name,
+		PeerPublicKey: sp.peer.PublicKey,
+		Endpoint:      sp.peer.Endpoint,
+		NewAddress:    pc.Endpoint,
+	}
+	if sp.current.IsValid() {
+		change.OldAddress = sp.current.String()
+	}
+	m.log.Info("peer endpoint re-resolved", "id", cfg.ID, "name", cfg.Name,
+		"endpoint", change.Endpoint, "old", change.OldAddress, "new", change.NewAddress)
+	return change, true
+}
+
+func (m *TunnelManager) devicePeers(iface string) ([]wgtypes.Peer, error) {
+	if m.devicePeersForTest != nil {
+		return m.devicePeersForTest(iface)
+	}
+	dev, err := m.wgClient.Device(iface)
+	if err != nil {
+		return nil, err
+	}
+	return dev.Peers, nil
+}
+
+func (m *TunnelManager) updatePeer(iface string, peer *peerConfig) error {
+	if m.updatePeerForTest != nil {
+		return m.updatePeerForTest(iface, peer)
+	}
+	return updatePeer(m.wgClient, iface, peer)
+}
+
+// endpointHost splits a host:port endpoint whose host is a name rather than
+// an IP literal.
+func endpointHost(endpoint string) (string, uint16, bool) {
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil || host == "" {
+		return "", 0, false
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return "", 0, false
+	}
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, false
+	}
+	return host, uint16(port), true
+}
+
+// preferIPv4 picks the address the kernel would have been given by
+// net.ResolveUDPAddr at bring-up: the first IPv4 one, else the first.
+func preferIPv4(addrs []netip.Addr) netip.Addr {
+	for _, a := range addrs {
+		if a.Is4() {
+			return a
+		}
+	}
+	return addrs[0]
+}
+
+func lookupHostAddrs(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
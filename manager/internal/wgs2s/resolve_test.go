@@ -0,0 +1,140 @@
+package wgs2s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// newResolveManager returns a manager with one tunnel holding peers. dev is
+// the kernel's view of the peers, dns answers the lookups, and every peer
+// update is appended to updates.
+func newResolveManager(t *testing.T, dev []wgtypes.Peer, dns map[string][]netip.Addr, updates *[]*peerConfig, peers ...Peer) *TunnelManager {
+	t.Helper()
+	mgr, _ := newTestManager(t)
+	mgr.config.Tunnels = []TunnelConfig{{
+		ID: "D", Name: "branch", InterfaceName: "wg-s2s0", Enabled: true, Peers: peers,
+	}}
+	mgr.devicePeersForTest = func(string) ([]wgtypes.Peer, error) { return dev, nil }
+	mgr.lookupHost = func(_ context.Context, host string) ([]netip.Addr, error) {
+		addrs, ok := dns[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return addrs, nil
+	}
+	mgr.updatePeerForTest = func(_ string, pc *peerConfig) error {
+		*updates = append(*updates, pc)
+		return nil
+	}
+	return mgr
+}
+
+func kernelPeer(t *testing.T, key, endpoint string, handshake time.Time) wgtypes.Peer {
+	t.Helper()
+	pk, err := wgtypes.ParseKey(key)
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	p := wgtypes.Peer{PublicKey: pk, LastHandshakeTime: handshake}
+	if endpoint != "" {
+		p.Endpoint = net.UDPAddrFromAddrPort(netip.MustParseAddrPort(endpoint))
+	}
+	return p
+}
+
+func TestReResolveEndpoints_RepointsStalePeer(t *testing.T) {
+	key := testPeerKey(t)
+	now := time.Now()
+	var updates []*peerConfig
+	mgr := newResolveManager(t,
+		[]wgtypes.Peer{kernelPeer(t, key, "198.51.100.1:51820", now.Add(-10*time.Minute))},
+		map[string][]netip.Addr{"hq.example.net": {netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("203.0.113.7")}},
+		&updates,
+		Peer{Name: "hq", PublicKey: key, Endpoint: "hq.example.net:51820", AllowedIPs: []string{"10.1.0.0/24"}})
+
+	changes := mgr.ReResolveEndpoints(context.Background(), now)
+
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	c := changes[0]
+	if c.OldAddress != "198.51.100.1:51820" || c.NewAddress != "203.0.113.7:51820" || c.Endpoint != "hq.example.net:51820" {
+		t.Fatalf("unexpected change %+v", c)
+	}
+	if len(updates) != 1 || updates[0].Endpoint != "203.0.113.7:51820" {
+		t.Fatalf("peer must be updated with the resolved IPv4 address, got %+v", updates)
+	}
+	if updates[0].AllowedIPs[0] != "10.1.0.0/24" {
+		t.Fatal("update must carry the peer's AllowedIPs, which the kernel replaces")
+	}
+}
+
+func TestReResolveEndpoints_LeavesPeerAlone(t *testing.T) {
+	key := testPeerKey(t)
+	now := time.Now()
+	tests := []struct {
+		name     string
+		endpoint string
+		kernel   string
+		shake    time.Time
+		dns      map[string][]netip.Addr
+		disabled bool
+		absent   bool
+	}{
+		{"recent handshake", "a.example.net:51820", "198.51.100.1:51820", now.Add(-time.Minute),
+			map[string][]netip.Addr{"a.example.net": {netip.MustParseAddr("203.0.113.1")}}, false, false},
+		{"address unchanged", "b.example.net:51820", "198.51.100.2:51820", time.Time{},
+			map[string][]netip.Addr{"b.example.net": {netip.MustParseAddr("203.0.113.2"), netip.MustParseAddr("198.51.100.2")}}, false, false},
+		{"literal endpoint", "198.51.100.9:51820", "198.51.100.9:51820", time.Time{}, nil, false, false},
+		{"lookup failure", "gone.example.net:51820", "", time.Time{}, nil, false, false},
+		{"not in kernel", "d.example.net:51820", "", time.Time{},
+			map[string][]netip.Addr{"d.example.net": {netip.MustParseAddr("203.0.113.6")}}, false, true},
+		{"disabled tunnel", "c.example.net:51820", "", time.Time{},
+			map[string][]netip.Addr{"c.example.net": {netip.MustParseAddr("203.0.113.5")}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updates []*peerConfig
+			var dev []wgtypes.Peer
+			if !tt.absent {
+				dev = append(dev, kernelPeer(t, key, tt.kernel, tt.shake))
+			}
+			mgr := newResolveManager(t, dev, tt.dns, &updates,
+				Peer{PublicKey: key, Endpoint: tt.endpoint})
+			mgr.config.Tunnels[0].Enabled = !tt.disabled
+
+			if changes := mgr.ReResolveEndpoints(context.Background(), now); len(changes) != 0 {
+				t.Fatalf("expected no changes, got %+v", changes)
+			}
+			if len(updates) != 0 {
+				t.Fatalf("no peer may be touched, got %d updates", len(updates))
+			}
+		})
+	}
+}
+
+func TestEndpointHost(t *testing.T) {
+	tests := []struct {
+		in   string
+		host string
+		ok   bool
+	}{
+		{"vpn.example.net:51820", "vpn.example.net", true},
+		{"198.51.100.1:51820", "", false},
+		{"[2001:db8::1]:51820", "", false},
+		{"vpn.example.net", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		host, _, ok := endpointHost(tt.in)
+		if ok != tt.ok || host != tt.host {
+			t.Errorf("endpointHost(%q) = %q, %v; want %q, %v", tt.in, host, ok, tt.host, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package wgs2s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/ops"
+)
+
+type WgKeyRotation = domain.WgKeyRotation
+
+// KeyCreatedAt returns when the tunnel's current private key was generated.
+// Tunnels created before rotation existed never recorded it; their key is as
+// old as the tunnel.
+func KeyCreatedAt(cfg TunnelConfig) time.Time {
+	if !cfg.KeyCreatedAt.IsZero() {
+		return cfg.KeyCreatedAt
+	}
+	return cfg.CreatedAt
+}
+
+// PrepareKeyRotation generates the tunnel's next private key and returns the
+// pending rotation, whose public key the remote side must add before the
+// switch. The live key keeps serving traffic until CommitKeyRotation.
+//
+// Calling it again while a rotation is pending only moves ScheduledAt: the
+// pending key may already have been handed to the remote side, so it must
+// not change underneath it. Cancel first to get a fresh key.
+func (m *TunnelManager) PrepareKeyRotation(id string, scheduledAt time.Time) (*WgKeyRotation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.findTunnel(id)
+	if idx < 0 {
+		return nil, fmt.Errorf(errFmtTunnelNotFound, id)
+	}
+	cfg := &m.config.Tunnels[idx]
+
+	if cfg.KeyRotation != nil {
+		prev := *cfg.KeyRotation
+		next := prev
+		next.ScheduledAt = scheduledAt
+		cfg.KeyRotation = &next
+		if err := m.save(); err != nil {
+			cfg.KeyRotation = &prev
+			return nil, err
+		}
+		return &next, nil
+	}
+
+	privKey, err := generatePendingKey(m.configDir, id)
+	if err != nil {
+		return nil, err
+	}
+	rot := WgKeyRotation{
+		PendingPublicKey: privKey.PublicKey().String(),
+		PreparedAt:       time.Now(),
+		ScheduledAt:      scheduledAt,
+	}
+	cfg.KeyRotation = &rot
+	if err := m.save(); err != nil {
+		cfg.KeyRotation = nil
+		deletePendingKey(m.configDir, id)
+		return nil, err
+	}
+
+	m.log.Info("key rotation prepared", "id", id, "name", cfg.Name, "scheduledAt", scheduledAt)
+	result := rot
+	return &result, nil
+}
+
+// CancelKeyRotation discards a pending rotation. It is a no-op when none is
+// pending.
+func (m *TunnelManager) CancelKeyRotation(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.findTunnel(id)
+	if idx < 0 {
+		return fmt.Errorf(errFmtTunnelNotFound, id)
+	}
+	cfg := &m.config.Tunnels[idx]
+	if cfg.KeyRotation == nil {
+		return nil
+	}
+
+	prev := cfg.KeyRotation
+	cfg.KeyRotation = nil
+	if err := m.save(); err != nil {
+		cfg.KeyRotation = prev
+		return err
+	}
+	deletePendingKey(m.configDir, id)
+	m.log.Info("key rotation cancelled", "id", id, "name", cfg.Name)
+	return nil
+}
+
+// CommitKeyRotation makes the pending key live. The interface key, the key
+// files and the persisted metadata switch together: if any step fails the
+// earlier ones are rolled back, so the tunnel never runs on a key that disk
+// does not know about (or vice versa).
+func (m *TunnelManager) CommitKeyRotation(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.findTunnel(id)
+	if idx < 0 {
+		return fmt.Errorf(errFmtTunnelNotFound, id)
+	}
+	cfgVal := m.config.Tunnels[idx]
+	if cfgVal.KeyRotation == nil {
+		return fmt.Errorf("tunnel %s has no pending key rotation", id)
+	}
+
+	oldKey, err := loadPrivateKey(m.configDir, id)
+	if err != nil {
+		return fmt.Errorf("load key: %w", err)
+	}
+	newKey, err := loadPendingKey(m.configDir, id)
+	if err != nil {
+		return err
+	}
+	if newKey.PublicKey().String() != cfgVal.KeyRotation.PendingPublicKey {
+		return fmt.Errorf("pending key file does not match the advertised public key")
+	}
+
+	now := time.Now()
+	err = ops.Run(context.Background(), []ops.Op{
+		{
+			Name: "switch interface private key",
+			Do: func(_ context.Context) error {
+				if !cfgVal.Enabled {
+					return nil
+				}
+				return m.setPrivateKey(cfgVal.InterfaceName, newKey)
+			},
+			Undo: func(_ context.Context) error {
+				if !cfgVal.Enabled {
+					return nil
+				}
+				return m.setPrivateKey(cfgVal.InterfaceName, oldKey)
+			},
+		},
+		{
+			Name: "replace key files",
+			Do: func(_ context.Context) error {
+				_, err := saveKeyFiles(m.configDir, id, newKey)
+				return err
+			},
+			Undo: func(_ context.Context) error {
+				_, err := saveKeyFiles(m.configDir, id, oldKey)
+				return err
+			},
+		},
+		{
+			Name: "persist key metadata",
+			Do: func(_ context.Context) error {
+				m.config.Tunnels[idx].KeyCreatedAt = now
+				m.config.Tunnels[idx].KeyRotation = nil
+				if err := m.save(); err != nil {
+					m.config.Tunnels[idx] = cfgVal
+					return err
+				}
+				return nil
+			},
+			Undo: func(_ context.Context) error {
+				m.config.Tunnels[idx] = cfgVal
+				_ = m.save()
+				return nil
+			},
+		},
+		ops.Noop("delete pending key file", func(_ context.Context) error {
+			deletePendingKey(m.configDir, id)
+			return nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.log.Info("key rotation committed", "id", id, "name", cfgVal.Name)
+	return nil
+}
+
+func (m *TunnelManager) setPrivateKey(iface string, key wgtypes.Key) error {
+	if m.setPrivateKeyForTest != nil {
+		return m.setPrivateKeyForTest(iface, key)
+	}
+	return setPrivateKey(m.wgClient, iface, key)
+}
@@ -0,0 +1,121 @@
+package wgs2s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func newRotationTestManager(t *testing.T) (*TunnelManager, wgtypes.Key) {
+	t.Helper()
+	mgr, _ := newTestManager(t)
+	oldKey, err := generateKeypair(mgr.configDir, "R")
+	if err != nil {
+		t.Fatalf("generateKeypair: %v", err)
+	}
+	mgr.config.Tunnels = []TunnelConfig{{
+		ID: "R", Name: "rot", InterfaceName: "wg-s2s0", Enabled: true,
+		CreatedAt: time.Now().Add(-400 * 24 * time.Hour),
+	}}
+	return mgr, oldKey
+}
+
+func TestPrepareKeyRotation_RescheduleKeepsPendingKey(t *testing.T) {
+	mgr, _ := newRotationTestManager(t)
+
+	first, err := mgr.PrepareKeyRotation("R", time.Time{})
+	if err != nil {
+		t.Fatalf("PrepareKeyRotation: %v", err)
+	}
+	at := time.Now().Add(time.Hour)
+	second, err := mgr.PrepareKeyRotation("R", at)
+	if err != nil {
+		t.Fatalf("PrepareKeyRotation(reschedule): %v", err)
+	}
+	if second.PendingPublicKey != first.PendingPublicKey {
+		t.Fatal("rescheduling must not replace a key the remote side may already have")
+	}
+	if !second.ScheduledAt.Equal(at) {
+		t.Fatalf("ScheduledAt = %v, want %v", second.ScheduledAt, at)
+	}
+}
+
+func TestCommitKeyRotation_SwitchesInterfaceAndFiles(t *testing.T) {
+	mgr, oldKey := newRotationTestManager(t)
+	rot, err := mgr.PrepareKeyRotation("R", time.Time{})
+	if err != nil {
+		t.Fatalf("PrepareKeyRotation: %v", err)
+	}
+
+	var applied []wgtypes.Key
+	mgr.setPrivateKeyForTest = func(_ string, k wgtypes.Key) error {
+		applied = append(applied, k)
+		return nil
+	}
+	if err := mgr.CommitKeyRotation("R"); err != nil {
+		t.Fatalf("CommitKeyRotation: %v", err)
+	}
+
+	if len(applied) != 1 || applied[0].PublicKey().String() != rot.PendingPublicKey {
+		t.Fatalf("interface must get exactly the pending key, got %d swaps", len(applied))
+	}
+	pub, err := mgr.GetPublicKey("R")
+	if err != nil || pub != rot.PendingPublicKey {
+		t.Fatalf("public key file = %q (%v), want pending key", pub, err)
+	}
+	if pub == oldKey.PublicKey().String() {
+		t.Fatal("key files still hold the old key")
+	}
+	got := mgr.GetTunnels()[0]
+	if got.KeyRotation != nil {
+		t.Fatal("pending rotation must be cleared after commit")
+	}
+	if time.Since(KeyCreatedAt(got)) > time.Minute {
+		t.Fatalf("KeyCreatedAt not refreshed: %v", got.KeyCreatedAt)
+	}
+	if _, err := loadPendingKey(mgr.configDir, "R"); err == nil {
+		t.Fatal("pending key file must be removed after commit")
+	}
+}
+
+// TestCommitKeyRotation_RollsBackOnSaveFailure proves the saga contract: when
+// persisting the metadata fails, the interface goes back to the old key and
+// the key files are restored, so disk and kernel agree on the old key.
+func TestCommitKeyRotation_RollsBackOnSaveFailure(t *testing.T) {
+	mgr, oldKey := newRotationTestManager(t)
+	if _, err := mgr.PrepareKeyRotation("R", time.Time{}); err != nil {
+		t.Fatalf("PrepareKeyRotation: %v", err)
+	}
+
+	var current wgtypes.Key
+	mgr.setPrivateKeyForTest = func(_ string, k wgtypes.Key) error {
+		current = k
+		return nil
+	}
+	mgr.saveOverride = func() error { return errors.New("disk full") }
+
+	if err := mgr.CommitKeyRotation("R"); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if current != oldKey {
+		t.Fatal("interface must be switched back to the old key")
+	}
+	if pub, _ := mgr.GetPublicKey("R"); pub != oldKey.PublicKey().String() {
+		t.Fatal("key files must be restored to the old key")
+	}
+	if mgr.GetTunnels()[0].KeyRotation == nil {
+		t.Fatal("rotation must stay pending so it can be retried")
+	}
+	if _, err := loadPendingKey(mgr.configDir, "R"); err != nil {
+		t.Fatalf("pending key must survive a failed commit: %v", err)
+	}
+}
+
+func TestKeyCreatedAt_FallsBackToCreatedAt(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := KeyCreatedAt(TunnelConfig{CreatedAt: created}); !got.Equal(created) {
+		t.Fatalf("KeyCreatedAt = %v, want CreatedAt for legacy configs", got)
+	}
+}
@@ -5,11 +5,23 @@ import (
 	"net"
 )
 
+// routeOwner.tunnelID holds the ownership key: peerOwnerID(tunnel, peer) for
+// routes claimed on behalf of a peer, so two spokes of one hub tunnel (or a
+// spoke being replaced) are tracked independently.
 type routeOwner struct {
 	tunnelID string
 	ifIndex  uint32
 }
 
+// peerOwnerID keys route ownership per peer. A keyless legacy peer owns its
+// routes under the bare tunnel ID.
+func peerOwnerID(tunnelID, peerKey string) string {
+	if peerKey == "" {
+		return tunnelID
+	}
+	return tunnelID + "/" + peerKey
+}
+
 // routeRefCounter tracks shared ownership of kernel routes across S2S tunnels.
 // Linux kernel identifies route uniqueness by (dst, table, tos, priority) without oif,
 // so two tunnels adding the same CIDR with the same metric get EEXIST for the second one.
@@ -5,11 +5,13 @@ import (
 	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	"unifi-tailscale/manager/domain"
 )
 
 type WgS2sStatus = domain.WgS2sStatus
+type WgS2sPeerStatus = domain.WgS2sPeerStatus
 
 func getAllStatuses(wgClient *wgctrl.Client, tunnels []TunnelConfig, log *slog.Logger) []WgS2sStatus {
 	statuses := make([]WgS2sStatus, 0, len(tunnels))
@@ -23,6 +25,17 @@ func getAllStatuses(wgClient *wgctrl.Client, tunnels []TunnelConfig, log *slog.L
 			ListenPort:    t.ListenPort,
 			LocalAddress:  t.TunnelAddress,
 			RemoteSubnets: t.AllowedIPs,
+			KeyCreatedAt:  KeyCreatedAt(t),
+			KeyRotation:   t.KeyRotation,
+		}
+		st.KeyStale = !st.KeyCreatedAt.IsZero() && time.Since(st.KeyCreatedAt) > keyStaleAfter
+		for _, p := range peersOf(t) {
+			st.Peers = append(st.Peers, WgS2sPeerStatus{
+				Name:       p.Name,
+				PublicKey:  p.PublicKey,
+				Endpoint:   p.Endpoint,
+				AllowedIPs: p.AllowedIPs,
+			})
 		}
 
 		if !t.Enabled {
@@ -38,19 +51,45 @@ func getAllStatuses(wgClient *wgctrl.Client, tunnels []TunnelConfig, log *slog.L
 		}
 
 		st.ListenPort = dev.ListenPort
-		if len(dev.Peers) > 0 {
-			p := dev.Peers[0]
-			st.LastHandshake = p.LastHandshakeTime
-			st.TransferRx = p.ReceiveBytes
-			st.TransferTx = p.TransmitBytes
-			st.Connected = !p.LastHandshakeTime.IsZero() && time.Since(p.LastHandshakeTime) < handshakeTimeout
-			if p.Endpoint != nil {
-				st.Endpoint = p.Endpoint.String()
-			}
-		}
+		applyDevicePeers(&st, dev.Peers, time.Now())
 
 		statuses = append(statuses, st)
 	}
 
 	return statuses
 }
+
+// applyDevicePeers fills the per-peer rows of st from the kernel's peer list
+// (matched by public key) and derives the tunnel-level aggregate: latest
+// handshake, summed transfer counters, connected if any peer is.
+func applyDevicePeers(st *WgS2sStatus, devPeers []wgtypes.Peer, now time.Time) {
+	byKey := make(map[string]wgtypes.Peer, len(devPeers))
+	for _, p := range devPeers {
+		byKey[p.PublicKey.String()] = p
+	}
+
+	for i := range st.Peers {
+		ps := &st.Peers[i]
+		p, ok := byKey[ps.PublicKey]
+		if !ok {
+			continue
+		}
+		ps.LastHandshake = p.LastHandshakeTime
+		ps.TransferRx = p.ReceiveBytes
+		ps.TransferTx = p.TransmitBytes
+		ps.Connected = !p.LastHandshakeTime.IsZero() && now.Sub(p.LastHandshakeTime) < handshakeTimeout
+		if p.Endpoint != nil {
+			ps.Endpoint = p.Endpoint.String()
+		}
+
+		st.TransferRx += ps.TransferRx
+		st.TransferTx += ps.TransferTx
+		st.Connected = st.Connected || ps.Connected
+		if ps.LastHandshake.After(st.LastHandshake) {
+			st.LastHandshake = ps.LastHandshake
+		}
+	}
+	if len(st.Peers) > 0 {
+		st.Endpoint = st.Peers[0].Endpoint
+	}
+}
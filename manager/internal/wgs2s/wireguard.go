@@ -3,6 +3,7 @@ package wgs2s
 import (
 	"fmt"
 	"net"
+	"slices"
 	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
@@ -14,6 +15,7 @@ type peerConfig struct {
 	Endpoint            string
 	AllowedIPs          []string
 	PersistentKeepalive int
+	PresharedKey        string
 }
 
 func buildPeerConfig(peer *peerConfig, updateOnly bool) (wgtypes.PeerConfig, error) {
@@ -28,6 +30,17 @@ func buildPeerConfig(peer *peerConfig, updateOnly bool) (wgtypes.PeerConfig, err
 		ReplaceAllowedIPs: true,
 	}
 
+	// Always set the PSK: nil would leave a removed one on an existing peer.
+	// The all-zero key means none.
+	var psk wgtypes.Key
+	if peer.PresharedKey != "" {
+		psk, err = wgtypes.ParseKey(peer.PresharedKey)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("parse preshared key for peer %s: %w", peer.PublicKey, err)
+		}
+	}
+	pc.PresharedKey = &psk
+
 	if peer.Endpoint != "" {
 		endpoint, err := net.ResolveUDPAddr("udp", peer.Endpoint)
 		if err != nil {
@@ -44,10 +57,10 @@ func buildPeerConfig(peer *peerConfig, updateOnly bool) (wgtypes.PeerConfig, err
 		pc.AllowedIPs = append(pc.AllowedIPs, *ipNet)
 	}
 
-	if peer.PersistentKeepalive > 0 {
-		d := time.Duration(peer.PersistentKeepalive) * time.Second
-		pc.PersistentKeepaliveInterval = &d
-	}
+	// Always set the interval: nil would leave an existing peer's keepalive
+	// untouched when it is switched off.
+	d := time.Duration(peer.PersistentKeepalive) * time.Second
+	pc.PersistentKeepaliveInterval = &d
 
 	return pc, nil
 }
@@ -70,19 +83,52 @@ func updatePeer(client *wgctrl.Client, name string, peer *peerConfig) error {
 	return nil
 }
 
-func configureDevice(client *wgctrl.Client, name string, privKey wgtypes.Key, port int, peer *peerConfig) error {
+// syncPeers applies a peer diff to a live interface: keys in remove are
+// dropped and upsert peers are created or updated in place. Peers not named
+// in either list keep their session state, so adding or removing one spoke
+// of a hub tunnel does not disturb the others.
+func syncPeers(client *wgctrl.Client, name string, remove []string, upsert []*peerConfig) error {
+	var pcs []wgtypes.PeerConfig
+	for _, k := range remove {
+		key, err := wgtypes.ParseKey(k)
+		if err != nil {
+			return fmt.Errorf("parse peer public key: %w", err)
+		}
+		pcs = append(pcs, wgtypes.PeerConfig{PublicKey: key, Remove: true})
+	}
+	for _, peer := range upsert {
+		pc, err := buildPeerConfig(peer, false)
+		if err != nil {
+			return err
+		}
+		pcs = append(pcs, pc)
+	}
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	if err := client.ConfigureDevice(name, wgtypes.Config{Peers: pcs}); err != nil {
+		return fmt.Errorf("sync peers on %s: %w", name, err)
+	}
+	return nil
+}
+
+func configureDevice(client *wgctrl.Client, name string, privKey wgtypes.Key, port int, peers []*peerConfig) error {
 	cfg := wgtypes.Config{
 		PrivateKey:   &privKey,
 		ListenPort:   &port,
 		ReplacePeers: true,
 	}
 
-	if peer != nil && peer.PublicKey != "" {
+	for _, peer := range peers {
+		if peer == nil || peer.PublicKey == "" {
+			continue
+		}
 		pc, err := buildPeerConfig(peer, false)
 		if err != nil {
 			return err
 		}
-		cfg.Peers = []wgtypes.PeerConfig{pc}
+		cfg.Peers = append(cfg.Peers, pc)
 	}
 
 	if err := client.ConfigureDevice(name, cfg); err != nil {
@@ -90,3 +136,69 @@ func configureDevice(client *wgctrl.Client, name string, privKey wgtypes.Key, po
 	}
 	return nil
 }
+
+// setPrivateKey swaps the interface's private key in place. Peers, listen
+// port and routes are left alone; sessions re-handshake under the new key.
+func setPrivateKey(client *wgctrl.Client, name string, privKey wgtypes.Key) error {
+	if err := client.ConfigureDevice(name, wgtypes.Config{PrivateKey: &privKey}); err != nil {
+		return fmt.Errorf("set private key on %s: %w", name, err)
+	}
+	return nil
+}
+
+func toPeerConfig(cfg TunnelConfig, p Peer) *peerConfig {
+	return &peerConfig{
+		PublicKey:           p.PublicKey,
+		Endpoint:            p.Endpoint,
+		AllowedIPs:          p.AllowedIPs,
+		PersistentKeepalive: peerKeepalive(cfg, p),
+		PresharedKey:        p.PresharedKey,
+	}
+}
+
+func devicePeerConfigs(cfg TunnelConfig) []*peerConfig {
+	peers := peersOf(cfg)
+	out := make([]*peerConfig, 0, len(peers))
+	for _, p := range peers {
+		out = append(out, toPeerConfig(cfg, p))
+	}
+	return out
+}
+
+// diffPeers compares two revisions of a tunnel and returns the keys to remove
+// and the peers to create or update. Keyless legacy peers are never sent to
+// the kernel.
+func diffPeers(old, cfg TunnelConfig) (remove []string, upsert []*peerConfig) {
+	oldByKey := make(map[string]*peerConfig)
+	for _, p := range peersOf(old) {
+		if p.PublicKey != "" {
+			oldByKey[p.PublicKey] = toPeerConfig(old, p)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, p := range peersOf(cfg) {
+		if p.PublicKey == "" {
+			continue
+		}
+		seen[p.PublicKey] = true
+		next := toPeerConfig(cfg, p)
+		if prev, ok := oldByKey[p.PublicKey]; ok && peerConfigEqual(prev, next) {
+			continue
+		}
+		upsert = append(upsert, next)
+	}
+	for _, p := range peersOf(old) {
+		if p.PublicKey != "" && !seen[p.PublicKey] {
+			remove = append(remove, p.PublicKey)
+		}
+	}
+	return remove, upsert
+}
+
+func peerConfigEqual(a, b *peerConfig) bool {
+	return a.PublicKey == b.PublicKey &&
+		a.Endpoint == b.Endpoint &&
+		a.PersistentKeepalive == b.PersistentKeepalive &&
+		a.PresharedKey == b.PresharedKey &&
+		slices.Equal(a.AllowedIPs, b.AllowedIPs)
+}
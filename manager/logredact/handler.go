@@ -1,7 +1,7 @@
 // Package logredact provides a slog.Handler wrapper that redacts secrets
-// (Tailscale auth/client/api keys, WireGuard public keys, bearer tokens,
-// URL query tokens, X-API-Key header values) from log records before they
-// reach the inner handler.
+// (Tailscale auth/client/api keys, WireGuard public and preshared keys,
+// bearer tokens, URL query tokens, X-API-Key header values) from log records
+// before they reach the inner handler.
 package logredact
 
 import (
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"strings"
 )
 
 type rule struct {
@@ -26,6 +27,11 @@ var rules = []rule{
 	// anchor; a bare key appearing without this header cannot be matched
 	// heuristically without unacceptable false positives.
 	{regexp.MustCompile(`(?i)(x-api-key["']?\s*[:=]\s*["']?)[^\s"',}]+`), "${1}***"},
+	// WireGuard preshared keys in wg-quick ("PresharedKey = …") or JSON
+	// ("presharedKey":"…") form. The bare-key rule below already catches
+	// a well-formed PSK; this one also covers truncated or malformed values
+	// echoed back in validation errors.
+	{regexp.MustCompile(`(?i)(preshared[_-]?key["']?\s*[:=]\s*["']?)[^\s"',}]+`), "${1}***"},
 	{regexp.MustCompile(`[A-Za-z0-9+/]{43}=`), "***"},
 }
 
@@ -56,7 +62,17 @@ func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 	return h.inner.Handle(ctx, rr)
 }
 
+// secretAttrKeys names attributes whose whole value is a secret, whatever
+// its shape. Matching is case-insensitive.
+var secretAttrKeys = map[string]bool{
+	"psk":          true,
+	"presharedkey": true,
+}
+
 func redactAttr(a slog.Attr) slog.Attr {
+	if secretAttrKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "***")
+	}
 	v := a.Value.Resolve()
 	switch v.Kind() {
 	case slog.KindString:
@@ -251,6 +251,40 @@ func TestRedactStringApiKeyHeader(t *testing.T) {
 	}
 }
 
+// Catches a WireGuard preshared key that the bare 44-char rule misses because
+// it is truncated or otherwise malformed (e.g. echoed in a parse error).
+func TestRedactStringPresharedKey(t *testing.T) {
+	cases := []string{
+		"[Peer]\nPresharedKey = Truncated+PskValue/abc\nAllowedIPs = 10.0.0.0/24",
+		`{"presharedKey":"Truncated+PskValue/abc"}`,
+		"preshared_key=Truncated+PskValue/abc",
+	}
+	for _, in := range cases {
+		got := RedactString(in)
+		if strings.Contains(got, "Truncated+PskValue/abc") {
+			t.Fatalf("preshared key leaked (%q): %q", in, got)
+		}
+	}
+}
+
+// An attribute named after a secret is redacted whatever its value looks
+// like, including non-string kinds.
+func TestHandlerRedactsSecretAttrKeys(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+	l.Info("peer", "psk", "short-not-base64", "presharedKey", errors.New("raw-bytes"), "peer", "site-b")
+
+	out := buf.String()
+	for _, secret := range []string{"short-not-base64", "raw-bytes"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("secret attr %q leaked: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "site-b") {
+		t.Fatalf("non-secret attr dropped: %s", out)
+	}
+}
+
 // Guards the existing rules against regressions from the added ones:
 // clean, non-secret text must survive untouched.
 func TestRedactStringPreservesCleanText(t *testing.T) {
@@ -84,6 +84,7 @@ func main() {
 
 	sweepStartupOrphanTmps([]string{
 		filepath.Dir(config.ManifestPath),
+		config.ManifestSnapshotDir,
 		config.WgS2sConfigDir,
 	})
 
@@ -94,11 +95,9 @@ func main() {
 	}
 	if manifest.Recovered() {
 		// BUG-L8: with the manifest gone, the integration zones/policies in
-		// UniFi may be orphaned. Scan-based cleanup that does not depend on
-		// manifest state is the scope of BUG-L17 / Task 10.12; until then,
-		// the operator can run `vpn-pack-manager --cleanup` to remove the
-		// known resources (best-effort while the manifest is empty).
-		slog.Warn("manifest was corrupted at load; quarantined and reset to empty; integration zones may be orphaned — run `vpn-pack-manager --cleanup` to remove residual resources",
+		// UniFi may be orphaned. The integration inventory, which runs right
+		// after startup, flags the ones setup does not adopt again.
+		slog.Warn("manifest was corrupted at load; quarantined and reset to empty; integration zones may be orphaned — review /api/integration/inventory and remove them with /api/integration/gc",
 			"path", config.ManifestPath)
 	}
 
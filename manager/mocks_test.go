@@ -84,10 +84,17 @@ type mockManifestStore struct {
 	resetIntegrationFn              func() error
 	getExitNodePolicyFn             func() domain.ExitNodePolicy
 	setExitNodePolicyFn             func(p domain.ExitNodePolicy) error
+	getExitSchedulesFn              func() []domain.ExitSchedule
+	setExitSchedulesFn              func(s []domain.ExitSchedule) error
+	getPolicyTemplatesFn            func() []domain.PolicyTemplate
+	setPolicyTemplatesFn            func(t []domain.PolicyTemplate) error
 	getAdvertiseExitNodeEnabledFn   func() bool
 	setAdvertiseExitNodeFn          func(enabled bool) error
 	getRemoteExitNodeFn             func() *domain.RemoteExitNode
 	setRemoteExitNodeFn             func(r *domain.RemoteExitNode) error
+	listSnapshotsFn                 func() ([]domain.ManifestSnapshot, error)
+	diffSnapshotFn                  func(fromID, toID string) ([]domain.ManifestChange, error)
+	restoreSnapshotFn               func(id string) error
 }
 
 func (m *mockManifestStore) GetSiteID() string {
@@ -246,6 +253,30 @@ func (m *mockManifestStore) SetExitNodePolicy(p domain.ExitNodePolicy) error {
 	}
 	return nil
 }
+func (m *mockManifestStore) GetExitSchedules() []domain.ExitSchedule {
+	if m.getExitSchedulesFn != nil {
+		return m.getExitSchedulesFn()
+	}
+	return nil
+}
+func (m *mockManifestStore) SetExitSchedules(s []domain.ExitSchedule) error {
+	if m.setExitSchedulesFn != nil {
+		return m.setExitSchedulesFn(s)
+	}
+	return nil
+}
+func (m *mockManifestStore) GetPolicyTemplates() []domain.PolicyTemplate {
+	if m.getPolicyTemplatesFn != nil {
+		return m.getPolicyTemplatesFn()
+	}
+	return nil
+}
+func (m *mockManifestStore) SetPolicyTemplates(t []domain.PolicyTemplate) error {
+	if m.setPolicyTemplatesFn != nil {
+		return m.setPolicyTemplatesFn(t)
+	}
+	return nil
+}
 func (m *mockManifestStore) GetAdvertiseExitNodeEnabled() bool {
 	if m.getAdvertiseExitNodeEnabledFn != nil {
 		return m.getAdvertiseExitNodeEnabledFn()
@@ -270,16 +301,36 @@ func (m *mockManifestStore) SetRemoteExitNode(r *domain.RemoteExitNode) error {
 	}
 	return nil
 }
+func (m *mockManifestStore) ListSnapshots() ([]domain.ManifestSnapshot, error) {
+	if m.listSnapshotsFn != nil {
+		return m.listSnapshotsFn()
+	}
+	return nil, nil
+}
+func (m *mockManifestStore) DiffSnapshot(fromID, toID string) ([]domain.ManifestChange, error) {
+	if m.diffSnapshotFn != nil {
+		return m.diffSnapshotFn(fromID, toID)
+	}
+	return nil, nil
+}
+func (m *mockManifestStore) RestoreSnapshot(id string) error {
+	if m.restoreSnapshotFn != nil {
+		return m.restoreSnapshotFn(id)
+	}
+	return nil
+}
 
 // mockIntegrationAPI implements IntegrationAPI for testing.
 type mockIntegrationAPI struct {
 	setAPIKeyFn              func(key string)
 	hasAPIKeyFn              func() bool
+	withAPIKeyFn             func(key string) IntegrationAPI
 	validateFn               func(ctx context.Context) (*AppInfo, error)
 	discoverSiteIDFn         func(ctx context.Context) (string, error)
 	createZoneFn             func(ctx context.Context, siteID, name string) (*Zone, error)
 	ensureZoneFn             func(ctx context.Context, siteID, name string) (*Zone, error)
-	ensurePoliciesFn         func(ctx context.Context, siteID, name, zoneID string) ([]string, error)
+	ensurePoliciesFn         func(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
+	replacePoliciesFn        func(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
 	listPoliciesFn           func(ctx context.Context, siteID string) ([]Policy, error)
 	deletePolicyFn           func(ctx context.Context, siteID, policyID string) error
 	deleteZoneFn             func(ctx context.Context, siteID, zoneID string) error
@@ -287,6 +338,7 @@ type mockIntegrationAPI struct {
 	listZonesFn              func(ctx context.Context, siteID string) ([]Zone, error)
 	findSystemZoneIDsFn      func(ctx context.Context, siteID string) (string, string, error)
 	ensureWanPortPolicyFn    func(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	replaceWanPortPolicyFn   func(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
 	ensureDNSForwardDomainFn func(ctx context.Context, siteID, domain, resolverIP string) (*DNSPolicy, error)
 	deleteDNSPolicyFn        func(ctx context.Context, siteID, policyID string) error
 	listDNSPoliciesFn        func(ctx context.Context, siteID string) ([]DNSPolicy, error)
@@ -303,6 +355,12 @@ func (m *mockIntegrationAPI) HasAPIKey() bool {
 	}
 	return false
 }
+func (m *mockIntegrationAPI) WithAPIKey(key string) IntegrationAPI {
+	if m.withAPIKeyFn != nil {
+		return m.withAPIKeyFn(key)
+	}
+	return m
+}
 func (m *mockIntegrationAPI) Validate(ctx context.Context) (*AppInfo, error) {
 	if m.validateFn != nil {
 		return m.validateFn(ctx)
@@ -327,9 +385,15 @@ func (m *mockIntegrationAPI) EnsureZone(ctx context.Context, siteID, name string
 	}
 	return &Zone{}, nil
 }
-func (m *mockIntegrationAPI) EnsurePolicies(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+func (m *mockIntegrationAPI) EnsurePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
 	if m.ensurePoliciesFn != nil {
-		return m.ensurePoliciesFn(ctx, siteID, name, zoneID)
+		return m.ensurePoliciesFn(ctx, siteID, name, zoneID, rules)
+	}
+	return nil, nil
+}
+func (m *mockIntegrationAPI) ReplacePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	if m.replacePoliciesFn != nil {
+		return m.replacePoliciesFn(ctx, siteID, name, zoneID, rules)
 	}
 	return nil, nil
 }
@@ -375,6 +439,12 @@ func (m *mockIntegrationAPI) EnsureWanPortPolicy(ctx context.Context, siteID str
 	}
 	return "", nil
 }
+func (m *mockIntegrationAPI) ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	if m.replaceWanPortPolicyFn != nil {
+		return m.replaceWanPortPolicyFn(ctx, siteID, port, name, extID, gwID)
+	}
+	return "", nil
+}
 func (m *mockIntegrationAPI) EnsureDNSForwardDomain(ctx context.Context, siteID, domain, resolverIP string) (*DNSPolicy, error) {
 	if m.ensureDNSForwardDomainFn != nil {
 		return m.ensureDNSForwardDomainFn(ctx, siteID, domain, resolverIP)
@@ -634,6 +704,13 @@ type mockWgS2sControl struct {
 	getTunnelsFn    func() []wgs2s.TunnelConfig
 	getStatusesFn   func() []wgs2s.WgS2sStatus
 	getPublicKeyFn  func(id string) (string, error)
+	getPSKFn        func(id, peerPublicKey string) (string, error)
+	prepareRotFn    func(id string, at time.Time) (*wgs2s.WgKeyRotation, error)
+	commitRotFn     func(id string) error
+	cancelRotFn     func(id string) error
+	reResolveFn     func(now time.Time) []wgs2s.WgS2sEndpointChange
+	checkFailoverFn func(now time.Time) []wgs2s.WgS2sFailoverEvent
+	reachabilityFn  func(now time.Time) []wgs2s.WgS2sReachabilityEvent
 	closeFn         func()
 }
 
@@ -691,6 +768,48 @@ func (m *mockWgS2sControl) GetPublicKey(id string) (string, error) {
 	}
 	return "", nil
 }
+func (m *mockWgS2sControl) GetPresharedKey(id, peerPublicKey string) (string, error) {
+	if m.getPSKFn != nil {
+		return m.getPSKFn(id, peerPublicKey)
+	}
+	return "", nil
+}
+func (m *mockWgS2sControl) PrepareKeyRotation(id string, at time.Time) (*wgs2s.WgKeyRotation, error) {
+	if m.prepareRotFn != nil {
+		return m.prepareRotFn(id, at)
+	}
+	return &wgs2s.WgKeyRotation{ScheduledAt: at}, nil
+}
+func (m *mockWgS2sControl) CommitKeyRotation(id string) error {
+	if m.commitRotFn != nil {
+		return m.commitRotFn(id)
+	}
+	return nil
+}
+func (m *mockWgS2sControl) CancelKeyRotation(id string) error {
+	if m.cancelRotFn != nil {
+		return m.cancelRotFn(id)
+	}
+	return nil
+}
+func (m *mockWgS2sControl) ReResolveEndpoints(_ context.Context, now time.Time) []wgs2s.WgS2sEndpointChange {
+	if m.reResolveFn != nil {
+		return m.reResolveFn(now)
+	}
+	return nil
+}
+func (m *mockWgS2sControl) CheckFailover(_ context.Context, now time.Time) []wgs2s.WgS2sFailoverEvent {
+	if m.checkFailoverFn != nil {
+		return m.checkFailoverFn(now)
+	}
+	return nil
+}
+func (m *mockWgS2sControl) RunReachabilityProbes(_ context.Context, now time.Time) []wgs2s.WgS2sReachabilityEvent {
+	if m.reachabilityFn != nil {
+		return m.reachabilityFn(now)
+	}
+	return nil
+}
 func (m *mockWgS2sControl) Close() {
 	if m.closeFn != nil {
 		m.closeFn()
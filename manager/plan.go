@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/service"
+	"unifi-tailscale/manager/state"
+)
+
+// Dry runs of the firewall-mutating operations. The operation itself runs
+// unchanged, against a sandbox: an Integration API whose writes are recorded
+// and overlaid on the live reads, a copy of the manifest that is never saved,
+// and a FirewallManager whose UDAPI seams record instead of apply. What was
+// recorded is the plan.
+
+const (
+	planCreate = "create"
+	planDelete = "delete"
+
+	planZone      = "zone"
+	planPolicy    = "policy"
+	planDNSPolicy = "dns_policy"
+	planRule      = "udapi_rule"
+	planIPSet     = "ipset_entry"
+)
+
+// PlannedChange is one write a dry run held back. ID is the object's ID for
+// a delete and a placeholder for a create; Name is the zone, policy or
+// DNS domain, the rule marker, or the ipset entry.
+type PlannedChange struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// FirewallPlan is what an operation would change, along with the result it
+// would have returned.
+type FirewallPlan struct {
+	DryRun  bool            `json:"dryRun"`
+	Changes []PlannedChange `json:"changes"`
+	Result  any             `json:"result,omitempty"`
+}
+
+type firewallPlanner struct {
+	ic       *planIntegration
+	manifest ManifestStore
+	fw       *FirewallManager
+	orch     *service.FirewallOrchestrator
+
+	mu          sync.Mutex
+	changes     []PlannedChange
+	next        int
+	zones       []Zone
+	policies    []Policy
+	dnsPolicies []DNSPolicy
+	deleted     map[string]bool
+}
+
+func newFirewallPlanner(ic IntegrationAPI, ms ManifestStore) *firewallPlanner {
+	p := &firewallPlanner{manifest: detachedManifest(ms), deleted: make(map[string]bool)}
+	p.ic = &planIntegration{live: ic, p: p}
+
+	fm := &FirewallManager{ic: p.ic, manifest: p.manifest}
+	fm.chainProbe = fm.hasChainRule
+	fm.ipsetProbe = fm.hasIPSetEntry
+	fm.addInterfaceRules = func(_ context.Context, iface, marker, chainPrefix string) error {
+		p.record(PlannedChange{Action: planCreate, Kind: planRule, Name: marker, Detail: iface + " into the " + chainPrefix + " chains"})
+		return nil
+	}
+	fm.removeInterfaceRules = func(_ context.Context, iface, marker string) error {
+		p.record(PlannedChange{Action: planDelete, Kind: planRule, Name: marker, Detail: iface})
+		return nil
+	}
+	fm.ensureZoneSubnets = func(_ context.Context, setName string, cidrs []string) error {
+		for _, cidr := range cidrs {
+			p.record(PlannedChange{Action: planCreate, Kind: planIPSet, Name: cidr, Detail: setName})
+		}
+		return nil
+	}
+	fm.removeZoneSubnet = func(_ context.Context, setName, cidr string) error {
+		p.record(PlannedChange{Action: planDelete, Kind: planIPSet, Name: cidr, Detail: setName})
+		return nil
+	}
+	p.fw = fm
+
+	p.orch = service.NewFirewallOrchestrator(
+		&firewallIntegrationAdapter{ic: p.ic},
+		&firewallManifestAdapter{ms: p.manifest},
+		&firewallOpsAdapter{fw: fm},
+	)
+	return p
+}
+
+// detachedManifest copies the firewall state of ms into a manifest kept in
+// memory, which the dry run may update freely.
+func detachedManifest(ms ManifestStore) ManifestStore {
+	m := state.NewManifest("")
+	_ = m.SetSiteID(ms.GetSiteID())
+	ts := ms.GetTailscaleZone()
+	_ = m.SetTailscaleZone(ts.ZoneID, ts.ZoneName, ts.PolicyIDs, ts.ChainPrefix)
+	for tunnelID, zm := range ms.GetWgS2sSnapshot() {
+		_ = m.SetWgS2sZone(tunnelID, zm)
+	}
+	for marker, e := range ms.GetWanPortsSnapshot() {
+		_ = m.SetWanPort(marker, e.PolicyID, e.PolicyName, e.Port)
+	}
+	_ = m.SetSystemZoneIDs(ms.GetSystemZoneIDs())
+	if e, ok := ms.GetDNSPolicy(config.DNSMarkerTailscale); ok {
+		_ = m.SetDNSPolicy(config.DNSMarkerTailscale, e.PolicyID, e.Domain, e.IPAddress)
+	}
+	_ = m.SetPolicyTemplates(ms.GetPolicyTemplates())
+	return m
+}
+
+func (p *firewallPlanner) record(c PlannedChange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, c)
+}
+
+// placeholderID names an object the plan creates. Caller holds p.mu.
+func (p *firewallPlanner) placeholderID(kind string) string {
+	p.next++
+	return fmt.Sprintf("planned-%s-%d", kind, p.next)
+}
+
+// finish waits for the rule restores the operation queued in the background
+// and returns the plan.
+func (p *firewallPlanner) finish(result any) *FirewallPlan {
+	p.fw.WaitBackground()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changes := slices.Clone(p.changes)
+	if changes == nil {
+		changes = []PlannedChange{}
+	}
+	return &FirewallPlan{DryRun: true, Changes: changes, Result: result}
+}
+
+// planIntegration reads through to the Integration API and records writes.
+// Its reads include the plan's own creates and deletes, so an operation
+// that checks its work sees the state it would have left. It implements
+// every method itself: a method added to IntegrationAPI fails the build
+// here instead of writing through.
+type planIntegration struct {
+	live IntegrationAPI
+	p    *firewallPlanner
+}
+
+var _ IntegrationAPI = (*planIntegration)(nil)
+
+// SetAPIKey is ignored: the key belongs to the client the plan reads from.
+func (ic *planIntegration) SetAPIKey(string) {}
+
+// WithAPIKey returns ic, for the same reason: a copy of the client beneath
+// would read and write outside the plan.
+func (ic *planIntegration) WithAPIKey(string) IntegrationAPI { return ic }
+
+func (ic *planIntegration) HasAPIKey() bool { return ic.live.HasAPIKey() }
+
+func (ic *planIntegration) Validate(ctx context.Context) (*AppInfo, error) {
+	return ic.live.Validate(ctx)
+}
+
+func (ic *planIntegration) DiscoverSiteID(ctx context.Context) (string, error) {
+	return ic.live.DiscoverSiteID(ctx)
+}
+
+func (ic *planIntegration) FindInternalZoneID(ctx context.Context, siteID string) (string, error) {
+	return ic.live.FindInternalZoneID(ctx, siteID)
+}
+
+func (ic *planIntegration) FindSystemZoneIDs(ctx context.Context, siteID string) (string, string, error) {
+	return ic.live.FindSystemZoneIDs(ctx, siteID)
+}
+
+func (ic *planIntegration) ListZones(ctx context.Context, siteID string) ([]Zone, error) {
+	live, err := ic.live.ListZones(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	ic.p.mu.Lock()
+	defer ic.p.mu.Unlock()
+	return overlay(live, ic.p.zones, func(z Zone) string { return z.ID }, ic.p.deleted), nil
+}
+
+func (ic *planIntegration) ListPolicies(ctx context.Context, siteID string) ([]Policy, error) {
+	live, err := ic.live.ListPolicies(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	ic.p.mu.Lock()
+	defer ic.p.mu.Unlock()
+	return overlay(live, ic.p.policies, func(p Policy) string { return p.ID }, ic.p.deleted), nil
+}
+
+func (ic *planIntegration) ListDNSPolicies(ctx context.Context, siteID string) ([]DNSPolicy, error) {
+	live, err := ic.live.ListDNSPolicies(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	ic.p.mu.Lock()
+	defer ic.p.mu.Unlock()
+	return overlay(live, ic.p.dnsPolicies, func(p DNSPolicy) string { return p.ID }, ic.p.deleted), nil
+}
+
+func overlay[T any](live, created []T, id func(T) string, deleted map[string]bool) []T {
+	out := make([]T, 0, len(live)+len(created))
+	for _, list := range [][]T{live, created} {
+		for _, v := range list {
+			if !deleted[id(v)] {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+func (ic *planIntegration) CreateZone(_ context.Context, _, name string) (*Zone, error) {
+	ic.p.mu.Lock()
+	defer ic.p.mu.Unlock()
+	z := Zone{ID: ic.p.placeholderID(planZone), Name: name}
+	ic.p.zones = append(ic.p.zones, z)
+	ic.p.changes = append(ic.p.changes, PlannedChange{Action: planCreate, Kind: planZone, Name: name, ID: z.ID})
+	return &z, nil
+}
+
+func (ic *planIntegration) EnsureZone(ctx context.Context, siteID, name string) (*Zone, error) {
+	zones, err := ic.ListZones(ctx, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("check existing zone: %w", err)
+	}
+	for _, z := range zones {
+		if z.Name == name {
+			return &z, nil
+		}
+	}
+	return ic.CreateZone(ctx, siteID, name)
+}
+
+func (ic *planIntegration) EnsurePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return ic.ensurePolicies(ctx, siteID, zoneName, zoneID, rules, false)
+}
+
+func (ic *planIntegration) ReplacePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return ic.ensurePolicies(ctx, siteID, zoneName, zoneID, rules, true)
+}
+
+func (ic *planIntegration) ensurePolicies(ctx context.Context, siteID, zoneName, zoneID string, rules []domain.PolicyRule, replace bool) ([]string, error) {
+	internalZoneID, err := ic.FindInternalZoneID(ctx, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("find internal zone: %w", err)
+	}
+	live, err := ic.ListPolicies(ctx, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("list existing policies: %w", err)
+	}
+	var ids []string
+	for _, want := range domain.ZonePolicies(zoneName, zoneID, internalZoneID, rules) {
+		id, err := ic.ensurePolicy(ctx, siteID, live, want, replace)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (ic *planIntegration) EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	return ic.ensureWanPortPolicy(ctx, siteID, port, name, extID, gwID, false)
+}
+
+func (ic *planIntegration) ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	return ic.ensureWanPortPolicy(ctx, siteID, port, name, extID, gwID, true)
+}
+
+func (ic *planIntegration) ensureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string, replace bool) (string, error) {
+	live, err := ic.ListPolicies(ctx, siteID)
+	if err != nil {
+		return "", fmt.Errorf("list existing policies: %w", err)
+	}
+	return ic.ensurePolicy(ctx, siteID, live, domain.WanPortPolicy(name, port, extID, gwID), replace)
+}
+
+// ensurePolicy mirrors the client: a copy of want found by name is adopted,
+// or with replace only an unchanged one, and drifted copies are deleted.
+func (ic *planIntegration) ensurePolicy(ctx context.Context, siteID string, live []Policy, want Policy, replace bool) (string, error) {
+	id, drifted := domain.MatchPolicy(live, want)
+	if !replace {
+		if id == "" && len(drifted) > 0 {
+			return drifted[0], nil
+		}
+		drifted = nil
+	}
+	if id == "" {
+		ic.p.mu.Lock()
+		want.ID = ic.p.placeholderID(planPolicy)
+		ic.p.policies = append(ic.p.policies, want)
+		ic.p.changes = append(ic.p.changes, PlannedChange{Action: planCreate, Kind: planPolicy, Name: want.Name, ID: want.ID})
+		ic.p.mu.Unlock()
+		id = want.ID
+	}
+	for _, old := range drifted {
+		if err := ic.DeletePolicy(ctx, siteID, old); err != nil && !errors.Is(err, ErrNotFound) {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+func (ic *planIntegration) DeletePolicy(ctx context.Context, siteID, policyID string) error {
+	live, err := ic.ListPolicies(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(live, func(p Policy) bool { return p.ID == policyID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	ic.p.markDeleted(PlannedChange{Action: planDelete, Kind: planPolicy, Name: live[i].Name, ID: policyID})
+	return nil
+}
+
+func (ic *planIntegration) DeleteZone(ctx context.Context, siteID, zoneID string) error {
+	zones, err := ic.ListZones(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(zones, func(z Zone) bool { return z.ID == zoneID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	ic.p.markDeleted(PlannedChange{Action: planDelete, Kind: planZone, Name: zones[i].Name, ID: zoneID})
+	return nil
+}
+
+func (ic *planIntegration) EnsureDNSForwardDomain(ctx context.Context, siteID, domainName, resolverIP string) (*DNSPolicy, error) {
+	live, err := ic.ListDNSPolicies(ctx, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("check existing DNS policy: %w", err)
+	}
+	for _, p := range live {
+		if p.Domain == domainName {
+			return &p, nil
+		}
+	}
+	ic.p.mu.Lock()
+	defer ic.p.mu.Unlock()
+	pol := DNSPolicy{ID: ic.p.placeholderID(planDNSPolicy), Type: "FORWARD_DOMAIN", Domain: domainName, IPAddress: resolverIP, Enabled: true}
+	ic.p.dnsPolicies = append(ic.p.dnsPolicies, pol)
+	ic.p.changes = append(ic.p.changes, PlannedChange{Action: planCreate, Kind: planDNSPolicy, Name: domainName, ID: pol.ID, Detail: "forward to " + resolverIP})
+	return &pol, nil
+}
+
+func (ic *planIntegration) DeleteDNSPolicy(ctx context.Context, siteID, policyID string) error {
+	live, err := ic.ListDNSPolicies(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(live, func(p DNSPolicy) bool { return p.ID == policyID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	ic.p.markDeleted(PlannedChange{Action: planDelete, Kind: planDNSPolicy, Name: live[i].Domain, ID: policyID})
+	return nil
+}
+
+func (p *firewallPlanner) markDeleted(c PlannedChange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deleted[c.ID] = true
+	p.changes = append(p.changes, c)
+}
+
+// isDryRun reports whether the request asks for a plan instead of changes.
+func isDryRun(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return v
+}
+
+// planFirewall starts a dry run, or writes 503 when there is no firewall to
+// plan against.
+func (s *Server) planFirewall(w http.ResponseWriter) (*firewallPlanner, bool) {
+	return s.planFirewallWith(w, s.ic)
+}
+
+// planFirewallWith is planFirewall reading through ic, such as a client
+// holding a key that is not saved yet.
+func (s *Server) planFirewallWith(w http.ResponseWriter, ic IntegrationAPI) (*firewallPlanner, bool) {
+	if s.fwOrch == nil {
+		writeError(w, http.StatusServiceUnavailable, "firewall not available")
+		return nil, false
+	}
+	p := newFirewallPlanner(ic, s.manifest)
+	p.orch.SetActiveNames(s.activeIntegrationNames)
+	return p, true
+}
+
+// planKeyNotifier runs what follows a key change against the plan, and
+// leaves the server's health and state alone.
+type planKeyNotifier struct {
+	p *firewallPlanner
+}
+
+func (n planKeyNotifier) OnBeforeKeyDelete(ctx context.Context) {
+	if err := n.p.fw.RemoveDNSForwarding(ctx); err != nil {
+		slog.Warn("planned DNS forwarding cleanup failed", "err", err)
+	}
+}
+
+func (n planKeyNotifier) OnKeyConfigured(ctx context.Context, st *service.IntegrationStatus) {
+	if st.SiteID == "" {
+		return
+	}
+	if err := n.p.orch.SetupTailscaleFirewall(ctx).Err(); err != nil {
+		slog.Warn("planned firewall setup failed", "err", err)
+	}
+	if port := service.ReadTailscaledPort(); port > 0 {
+		if err := n.p.fw.OpenWanPort(ctx, port, config.WanMarkerTailscaleWG); err != nil {
+			slog.Warn("planned tailscale WG WAN port open failed", "port", port, "err", err)
+		}
+	}
+}
+
+func (planKeyNotifier) OnKeyDeleted() {}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tailscale.com/ipn/ipnstate"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/internal/wgs2s"
+	"unifi-tailscale/manager/service"
+)
+
+// readOnlyIntegration fails the test on any write reaching the real API.
+func readOnlyIntegration(t *testing.T) *mockIntegrationAPI {
+	written := func(what string) { t.Errorf("dry run wrote %s", what) }
+	return &mockIntegrationAPI{
+		hasAPIKeyFn: func() bool { return true },
+		listZonesFn: func(context.Context, string) ([]Zone, error) {
+			return []Zone{{ID: "zone-int", Name: "Internal"}}, nil
+		},
+		findInternalZoneIDFn: func(context.Context, string) (string, error) { return "zone-int", nil },
+		createZoneFn: func(context.Context, string, string) (*Zone, error) {
+			written("a zone")
+			return nil, nil
+		},
+		ensureZoneFn: func(context.Context, string, string) (*Zone, error) {
+			written("a zone")
+			return nil, nil
+		},
+		ensurePoliciesFn: func(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+			written("policies")
+			return nil, nil
+		},
+		replacePoliciesFn: func(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+			written("policies")
+			return nil, nil
+		},
+		deletePolicyFn: func(context.Context, string, string) error {
+			written("a policy delete")
+			return nil
+		},
+		ensureDNSForwardDomainFn: func(context.Context, string, string, string) (*DNSPolicy, error) {
+			written("a DNS policy")
+			return nil, nil
+		},
+		deleteDNSPolicyFn: func(context.Context, string, string) error {
+			written("a DNS policy delete")
+			return nil
+		},
+	}
+}
+
+// integrationTrap serves reads from a mock; its nil IntegrationAPI makes
+// any other call panic.
+type integrationTrap struct {
+	IntegrationAPI
+	reads *mockIntegrationAPI
+}
+
+func (ic integrationTrap) HasAPIKey() bool { return ic.reads.HasAPIKey() }
+func (ic integrationTrap) Validate(ctx context.Context) (*AppInfo, error) {
+	return ic.reads.Validate(ctx)
+}
+func (ic integrationTrap) DiscoverSiteID(ctx context.Context) (string, error) {
+	return ic.reads.DiscoverSiteID(ctx)
+}
+func (ic integrationTrap) FindInternalZoneID(ctx context.Context, siteID string) (string, error) {
+	return ic.reads.FindInternalZoneID(ctx, siteID)
+}
+func (ic integrationTrap) FindSystemZoneIDs(ctx context.Context, siteID string) (string, string, error) {
+	return ic.reads.FindSystemZoneIDs(ctx, siteID)
+}
+func (ic integrationTrap) ListZones(ctx context.Context, siteID string) ([]Zone, error) {
+	return ic.reads.ListZones(ctx, siteID)
+}
+func (ic integrationTrap) ListPolicies(ctx context.Context, siteID string) ([]Policy, error) {
+	return ic.reads.ListPolicies(ctx, siteID)
+}
+func (ic integrationTrap) ListDNSPolicies(ctx context.Context, siteID string) ([]DNSPolicy, error) {
+	return ic.reads.ListDNSPolicies(ctx, siteID)
+}
+
+// TestPlanIntegration_NoWriteReachesAPI calls every IntegrationAPI method on
+// the plan and fails when one that is not a read gets through to the real
+// client.
+func TestPlanIntegration_NoWriteReachesAPI(t *testing.T) {
+	p := newFirewallPlanner(integrationTrap{reads: &mockIntegrationAPI{}}, &mockManifestStore{})
+	iface := reflect.TypeOf((*IntegrationAPI)(nil)).Elem()
+	v := reflect.ValueOf(p.ic)
+	ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	for i := range iface.NumMethod() {
+		m := iface.Method(i)
+		t.Run(m.Name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s reached the Integration API in a dry run", m.Name)
+				}
+			}()
+			args := make([]reflect.Value, m.Type.NumIn())
+			for j := range args {
+				if in := m.Type.In(j); in == ctxType {
+					args[j] = reflect.ValueOf(context.Background())
+				} else {
+					args[j] = reflect.Zero(in)
+				}
+			}
+			v.MethodByName(m.Name).Call(args)
+		})
+	}
+}
+
+func TestFirewallPlan_TailscaleSetup(t *testing.T) {
+	saved := false
+	ms := &mockManifestStore{
+		getSiteIDFn: func() string { return "site-1" },
+		hasSiteIDFn: func() bool { return true },
+		setTailscaleZoneFn: func(string, string, []string, string) error {
+			saved = true
+			return nil
+		},
+	}
+	p := newFirewallPlanner(readOnlyIntegration(t), ms)
+
+	result := p.orch.SetupTailscaleFirewall(context.Background())
+	require.True(t, result.OK(), "%v", result.Errors)
+	plan := p.finish(result)
+
+	assert.True(t, plan.DryRun)
+	assert.Equal(t, []PlannedChange{
+		{Action: planCreate, Kind: planZone, Name: "VPN Pack: Tailscale", ID: "planned-zone-1"},
+		{Action: planCreate, Kind: planPolicy, Name: "VPN Pack: Allow Tailscale to Internal", ID: "planned-policy-2"},
+		{Action: planCreate, Kind: planPolicy, Name: "VPN Pack: Allow Internal to Tailscale", ID: "planned-policy-3"},
+		{Action: planCreate, Kind: planRule, Name: config.FirewallMarker, Detail: "tailscale0 into the VPN chains"},
+		{Action: planCreate, Kind: planIPSet, Name: config.TailscaleCGNAT, Detail: "VPN_subnets"},
+	}, plan.Changes)
+	assert.Equal(t, "planned-zone-1", p.manifest.GetTailscaleZone().ZoneID, "the plan's manifest is updated")
+	assert.False(t, saved, "the real manifest is not")
+}
+
+func TestFirewallPlan_CollectOrphans(t *testing.T) {
+	ic := readOnlyIntegration(t)
+	ic.listZonesFn = func(context.Context, string) ([]Zone, error) {
+		return []Zone{{ID: "zone-int", Name: "Internal"}, {ID: "zone-old", Name: "VPN Pack: Old"}}, nil
+	}
+	ic.listPoliciesFn = func(context.Context, string) ([]Policy, error) {
+		return []Policy{{ID: "pol-old", Name: "VPN Pack: Allow Old to Internal"}}, nil
+	}
+	ms := &mockManifestStore{
+		getSiteIDFn: func() string { return "site-1" },
+		hasSiteIDFn: func() bool { return true },
+	}
+	p := newFirewallPlanner(ic, ms)
+
+	result, err := p.orch.CollectOrphans(context.Background(), nil)
+	require.NoError(t, err)
+	plan := p.finish(result)
+
+	assert.Equal(t, []PlannedChange{
+		{Action: planDelete, Kind: planPolicy, Name: "VPN Pack: Allow Old to Internal", ID: "pol-old"},
+		{Action: planDelete, Kind: planZone, Name: "VPN Pack: Old", ID: "zone-old"},
+	}, plan.Changes)
+}
+
+func TestSetSettings_DryRunPlansDNSForwarding(t *testing.T) {
+	ic := readOnlyIntegration(t)
+	ic.listDNSPoliciesFn = func(context.Context, string) ([]DNSPolicy, error) {
+		return []DNSPolicy{{ID: "dns-1", Domain: "old.ts.net"}}, nil
+	}
+	s := newTestServer(func(s *Server) {
+		s.ic = ic
+		s.fw = &mockFirewallService{integrationReadyFn: func() bool { return true }}
+		s.ts = &mockTailscaleControl{statusFn: func(context.Context) (*ipnstate.Status, error) {
+			return &ipnstate.Status{CurrentTailnet: &ipnstate.TailnetStatus{MagicDNSSuffix: "new.ts.net"}}, nil
+		}}
+		s.manifest = &mockManifestStore{
+			getSiteIDFn: func() string { return "site-1" },
+			hasSiteIDFn: func() bool { return true },
+			getDNSPolicyFn: func(string) (DNSPolicyEntry, bool) {
+				return DNSPolicyEntry{PolicyID: "dns-1", Domain: "old.ts.net"}, true
+			},
+			setDNSPolicyFn: func(string, string, string, string) error {
+				t.Error("dry run saved the manifest")
+				return nil
+			},
+		}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/settings?dryRun=true", bytes.NewReader([]byte(`{"acceptDNS":true}`)))
+	w := httptest.NewRecorder()
+	s.handleSetSettings(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var plan FirewallPlan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, []PlannedChange{
+		{Action: planDelete, Kind: planDNSPolicy, Name: "old.ts.net", ID: "dns-1"},
+		{Action: planCreate, Kind: planDNSPolicy, Name: "new.ts.net", ID: "planned-dns_policy-1", Detail: "forward to " + config.TailscaleDNSResolverIP},
+	}, plan.Changes)
+}
+
+func TestSetIntegrationKey_DryRunTriesKeyWithoutSaving(t *testing.T) {
+	keyed := readOnlyIntegration(t)
+	keyed.validateFn = func(context.Context) (*AppInfo, error) { return &AppInfo{ApplicationVersion: "9.1"}, nil }
+	keyed.discoverSiteIDFn = func(context.Context) (string, error) { return "site-1", nil }
+	var tried string
+	s := newTestServer(func(s *Server) {
+		s.ic = &mockIntegrationAPI{
+			setAPIKeyFn: func(string) { t.Error("dry run replaced the live key") },
+			withAPIKeyFn: func(key string) IntegrationAPI {
+				tried = key
+				return keyed
+			},
+		}
+		s.manifest = &mockManifestStore{
+			setSiteIDFn: func(string) error {
+				t.Error("dry run saved the site")
+				return nil
+			},
+		}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/integration/api-key?dryRun=true", bytes.NewReader([]byte(`{"apiKey":" new-key "}`)))
+	w := httptest.NewRecorder()
+	s.handleSetIntegrationKey(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, "new-key", tried)
+	var plan struct {
+		Changes []PlannedChange           `json:"changes"`
+		Result  service.IntegrationStatus `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Contains(t, plan.Changes, PlannedChange{Action: planCreate, Kind: planZone, Name: "VPN Pack: Tailscale", ID: "planned-zone-1"})
+	assert.Equal(t, "site-1", plan.Result.SiteID)
+	assert.Equal(t, "9.1", plan.Result.AppVersion)
+}
+
+func TestSetIntegrationKey_DryRunRejectsInvalidKey(t *testing.T) {
+	keyed := readOnlyIntegration(t)
+	keyed.validateFn = func(context.Context) (*AppInfo, error) { return nil, ErrUnauthorized }
+	s := newTestServer(func(s *Server) {
+		s.ic = &mockIntegrationAPI{withAPIKeyFn: func(string) IntegrationAPI { return keyed }}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/integration/api-key?dryRun=true", bytes.NewReader([]byte(`{"apiKey":"bad"}`)))
+	w := httptest.NewRecorder()
+	s.handleSetIntegrationKey(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteIntegrationKey_DryRunPlansDNSCleanup(t *testing.T) {
+	ic := readOnlyIntegration(t)
+	ic.setAPIKeyFn = func(string) { t.Error("dry run cleared the live key") }
+	ic.listDNSPoliciesFn = func(context.Context, string) ([]DNSPolicy, error) {
+		return []DNSPolicy{{ID: "dns-1", Domain: "tail.ts.net"}}, nil
+	}
+	s := newTestServer(func(s *Server) {
+		s.ic = ic
+		s.manifest = &mockManifestStore{
+			getSiteIDFn: func() string { return "site-1" },
+			hasSiteIDFn: func() bool { return true },
+			getDNSPolicyFn: func(string) (DNSPolicyEntry, bool) {
+				return DNSPolicyEntry{PolicyID: "dns-1", Domain: "tail.ts.net"}, true
+			},
+			removeDNSPolicyFn: func(string) error {
+				t.Error("dry run saved the manifest")
+				return nil
+			},
+		}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/integration/api-key?dryRun=true", nil)
+	w := httptest.NewRecorder()
+	s.handleDeleteIntegrationKey(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var plan FirewallPlan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, []PlannedChange{
+		{Action: planDelete, Kind: planDNSPolicy, Name: "tail.ts.net", ID: "dns-1"},
+	}, plan.Changes)
+}
+
+func TestCreateTunnel_DryRunPlansFirewall(t *testing.T) {
+	s := newTestServer(func(s *Server) {
+		s.ic = readOnlyIntegration(t)
+		s.manifest = &mockManifestStore{
+			getSiteIDFn: func() string { return "site-1" },
+			hasSiteIDFn: func() bool { return true },
+		}
+		s.wgManager = &mockWgS2sControl{
+			getTunnelsFn: func() []wgs2s.TunnelConfig {
+				return []wgs2s.TunnelConfig{{ID: "t0", Name: "other", InterfaceName: "wg-s2s0"}}
+			},
+			createTunnelFn: func(wgs2s.TunnelConfig, string) (*wgs2s.TunnelConfig, error) {
+				t.Error("dry run created the tunnel")
+				return nil, nil
+			},
+		}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/wg-s2s/tunnels?dryRun=true", bytes.NewReader(createTunnelBody(t)))
+	w := httptest.NewRecorder()
+	s.handleWgS2sCreateTunnel(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var plan struct {
+		Changes []PlannedChange              `json:"changes"`
+		Result  service.TunnelCreateResponse `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, "wg-s2s1", plan.Result.InterfaceName)
+	for _, c := range []PlannedChange{
+		{Action: planCreate, Kind: planRule, Name: "wg-s2s-manager:wg-s2s1", Detail: "wg-s2s1 into the VPN chains"},
+		{Action: planCreate, Kind: planIPSet, Name: "10.0.0.0/24", Detail: "VPN_subnets"},
+		{Action: planCreate, Kind: planPolicy, Name: "VPN Pack: WG S2S UDP 51820 (wg-s2s1)", ID: "planned-policy-4"},
+	} {
+		assert.Contains(t, plan.Changes, c)
+	}
+}
+
+func TestDeleteTunnel_DryRunPlansTeardown(t *testing.T) {
+	s := newTestServer(func(s *Server) {
+		s.ic = readOnlyIntegration(t)
+		s.manifest = &mockManifestStore{
+			getSiteIDFn: func() string { return "site-1" },
+			hasSiteIDFn: func() bool { return true },
+		}
+		s.wgManager = &mockWgS2sControl{
+			getTunnelsFn: func() []wgs2s.TunnelConfig {
+				return []wgs2s.TunnelConfig{{
+					ID: "t1", Name: "test", InterfaceName: "wg-s2s0", Enabled: true,
+					ListenPort: 51820, AllowedIPs: []string{"10.0.0.0/24"},
+				}}
+			},
+			deleteTunnelFn: func(string) error {
+				t.Error("dry run deleted the tunnel")
+				return nil
+			},
+		}
+		s.fwOrch = service.NewFirewallOrchestrator(nil, nil, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/wg-s2s/tunnels/t1?dryRun=true", nil)
+	req.SetPathValue("id", "t1")
+	w := httptest.NewRecorder()
+	s.handleWgS2sDeleteTunnel(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var plan FirewallPlan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Contains(t, plan.Changes, PlannedChange{Action: planDelete, Kind: planRule, Name: "wg-s2s-manager:wg-s2s0", Detail: "wg-s2s0"})
+}
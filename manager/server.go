@@ -62,6 +62,7 @@ type Server struct {
 	restoring      atomic.Bool
 	health         *HealthTracker
 	logBuf         *LogBuffer
+	traffic        *TrafficHistory
 	wgManager      WgS2sControl
 	vpnClientsMu   sync.Mutex
 	updater        *updateChecker
@@ -91,6 +92,7 @@ func NewServer(ctx context.Context, opts ServerOptions) *Server {
 		manifest:       opts.Manifest,
 		nginx:          opts.Nginx,
 		logBuf:         opts.LogBuf,
+		traffic:        NewTrafficHistory(),
 		updater:        opts.Updater,
 		health:         NewHealthTracker(opts.Hub),
 		nginxToken:     opts.NginxToken,
@@ -115,6 +117,7 @@ func NewServer(ctx context.Context, opts ServerOptions) *Server {
 			&firewallManifestAdapter{ms: opts.Manifest},
 			&firewallOpsAdapter{fw: opts.Firewall},
 		)
+		s.fwOrch.SetActiveNames(s.activeIntegrationNames)
 	}
 
 	s.integration = service.NewIntegrationService(
@@ -131,6 +134,7 @@ func NewServer(ctx context.Context, opts ServerOptions) *Server {
 		fileKeyStore{},
 	)
 	s.exitSvc = service.NewExitNodeService(opts.Manifest, nil)
+	s.exitSvc.SetSubnetProvider(localSubnetProvider)
 	s.remoteExitSvc = service.NewRemoteExitService(opts.Tailscale, s.exitSvc, opts.Manifest)
 	s.routing = service.NewRoutingService(
 		opts.Tailscale, opts.Firewall, opts.Integration, opts.Manifest,
@@ -149,6 +153,7 @@ func NewServer(ctx context.Context, opts ServerOptions) *Server {
 		ValidateSubnets: subnetValidatorProvider,
 		WanIP:           getWanIP,
 		LocalSubnets:    localSubnetProvider,
+		Pairing:         service.NewFilePairingStore(config.WgS2sConfigDir),
 	})
 
 	mux := s.routes()
@@ -213,6 +218,13 @@ func (s *Server) routes() *http.ServeMux {
 	get("/api/settings", s.handleGetSettings)
 	post("/api/settings", s.handleSetSettings)
 	get("/api/diagnostics", s.handleDiagnostics)
+	get("/api/firewall/templates", s.handleListPolicyTemplates)
+	post("/api/firewall/templates", s.handleSetPolicyTemplate)
+	del("/api/firewall/templates/{zone}", s.handleDeletePolicyTemplate)
+	get("/api/firewall/drift", s.handleFirewallDrift)
+	post("/api/firewall/drift/reconcile", s.handleReconcileFirewallDrift)
+	get("/api/routing-health", s.handleRoutingHealth)
+	post("/api/routing-health/fix/{check}", s.handleFixRoutingHealth)
 	post("/api/bugreport", s.handleBugReport)
 	get("/api/logs", s.handleLogs)
 
@@ -220,24 +232,45 @@ func (s *Server) routes() *http.ServeMux {
 	post("/api/integration/api-key", s.handleSetIntegrationKey)
 	del("/api/integration/api-key", s.handleDeleteIntegrationKey)
 	post("/api/integration/test", s.handleTestIntegrationKey)
+	get("/api/integration/inventory", s.handleIntegrationInventory)
+	post("/api/integration/gc", s.handleIntegrationGC)
+
+	get("/api/manifest/snapshots", s.handleListManifestSnapshots)
+	get("/api/manifest/snapshots/{id}/diff", s.handleDiffManifestSnapshot)
+	post("/api/manifest/snapshots/{id}/restore", s.handleRestoreManifestSnapshot)
 
 	get("/api/exit-node", s.handleGetRemoteExit)
 	post("/api/exit-node", s.handleEnableRemoteExit)
 	del("/api/exit-node", s.handleDisableRemoteExit)
+	get("/api/exit-schedules", s.handleListExitSchedules)
+	post("/api/exit-schedules", s.handleCreateExitSchedule)
+	patch("/api/exit-schedules/{id}", s.handleUpdateExitSchedule)
+	del("/api/exit-schedules/{id}", s.handleDeleteExitSchedule)
 
 	get("/api/wg-s2s/tunnels", s.handleWgS2sListTunnels)
 	post("/api/wg-s2s/tunnels", s.handleWgS2sCreateTunnel)
+	post("/api/wg-s2s/import", s.handleWgS2sImportTunnel)
 	patch("/api/wg-s2s/tunnels/{id}", s.handleWgS2sUpdateTunnel)
 	del("/api/wg-s2s/tunnels/{id}", s.handleWgS2sDeleteTunnel)
 	post("/api/wg-s2s/tunnels/{id}/enable", s.handleWgS2sEnableTunnel)
 	post("/api/wg-s2s/tunnels/{id}/disable", s.handleWgS2sDisableTunnel)
 	post("/api/wg-s2s/tunnels/{id}/setup-zone", s.handleWgS2sSetupZone)
+	post("/api/wg-s2s/tunnels/{id}/mtu", s.handleWgS2sApplyMTU)
+	post("/api/wg-s2s/tunnels/{id}/key-rotation", s.handleWgS2sScheduleKeyRotation)
+	post("/api/wg-s2s/tunnels/{id}/key-rotation/commit", s.handleWgS2sCommitKeyRotation)
+	del("/api/wg-s2s/tunnels/{id}/key-rotation", s.handleWgS2sCancelKeyRotation)
+	post("/api/wg-s2s/tunnels/{id}/pairing", s.handleWgS2sCreatePairing)
+	post("/api/wg-s2s/tunnels/{id}/pairing/complete", s.handleWgS2sCompletePairing)
+	post("/api/wg-s2s/pairing/import", s.handleWgS2sImportPairing)
 	post("/api/wg-s2s/generate-keypair", s.handleWgS2sGenerateKeypair)
+	post("/api/wg-s2s/generate-psk", s.handleWgS2sGeneratePSK)
 	get("/api/wg-s2s/tunnels/{id}/config", s.handleWgS2sGetConfig)
 	get("/api/wg-s2s/wan-ip", s.handleWgS2sWanIP)
 	get("/api/wg-s2s/local-subnets", s.handleWgS2sLocalSubnets)
 	get("/api/wg-s2s/zones", s.handleWgS2sListZones)
 
+	get("/api/metrics/history", s.handleMetricsHistory)
+
 	get("/api/update-check", s.handleUpdateCheck)
 
 	// S2: the SPA route must run through Recover→PeerUIDAuth→Token, not
@@ -279,6 +312,10 @@ func (s *Server) Run(ctx context.Context) error {
 		go s.reconcileWanPortPolicies(ctx)
 	}
 
+	if err := s.traffic.Load(config.TrafficHistoryPath, time.Now()); err != nil {
+		slog.Warn("traffic history not restored", "err", err)
+	}
+	go s.runTrafficHistorySaver(ctx)
 	go s.runWatcher(ctx)
 	go runLogCollector(ctx, s.ts, s.logBuf)
 	go s.runUpdateChecker(ctx)
@@ -378,6 +415,28 @@ func (s *Server) activeS2sTunnels(ctx context.Context) []service.S2sTunnelInfo {
 	return result
 }
 
+// activeIntegrationNames names the WAN port policies of the ports open now,
+// so the orphan inventory spares one the manifest has not recorded yet.
+func (s *Server) activeIntegrationNames(ctx context.Context) []string {
+	var names []string
+	if port := service.ReadTailscaledPort(); port > 0 {
+		names = append(names, wanPortPolicyName(port, config.WanMarkerTailscaleWG))
+	}
+	if s.ts != nil {
+		if prefs, err := s.ts.GetPrefs(ctx); err == nil && prefs.RelayServerPort != nil && *prefs.RelayServerPort > 0 {
+			names = append(names, wanPortPolicyName(int(*prefs.RelayServerPort), config.WanMarkerRelay))
+		}
+	}
+	if s.wgS2sSvc != nil && s.wgS2sSvc.Available() {
+		for _, t := range s.wgS2sSvc.ListTunnels(ctx) {
+			if t.Enabled {
+				names = append(names, wanPortPolicyName(t.ListenPort, config.WanMarkerWgS2sPrefix+t.InterfaceName))
+			}
+		}
+	}
+	return names
+}
+
 func (s *Server) integrationReady() bool {
 	return s.fw != nil && s.fw.IntegrationReady()
 }
@@ -409,6 +468,66 @@ func (s *Server) guardedSetupTailscaleFirewall(ctx context.Context) (*service.Se
 	return result, ran
 }
 
+// manifestRestoreResult is what a manifest rollback changed, and how the
+// reconcile that followed it went.
+type manifestRestoreResult struct {
+	Changes []domain.ManifestChange `json:"changes"`
+	Drift   *service.DriftReport    `json:"drift,omitempty"`
+	Errors  []string                `json:"errors,omitempty"`
+}
+
+// restoreManifest rolls the manifest back to snapshot id and brings the
+// controller and the exit node in line with it: zones, zone policies and WAN
+// port policies through the drift reconcile, then the exit peer in Tailscale
+// and the exit node rules. If the exit peer cannot be set, the manifest
+// follows the one Tailscale uses, as it would on the next sync. A failed
+// reconcile is reported but does not undo the restore. Caller holds the
+// reconcile guard.
+func (s *Server) restoreManifest(ctx context.Context, id string) (*manifestRestoreResult, error) {
+	changes, err := s.manifest.DiffSnapshot(id, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		changes[i].From, changes[i].To = changes[i].To, changes[i].From
+	}
+	if err := s.manifest.RestoreSnapshot(id); err != nil {
+		return nil, err
+	}
+	slog.Info("manifest restored", "snapshot", id, "changes", len(changes))
+
+	result := &manifestRestoreResult{Changes: changes}
+	if s.fwOrch != nil && s.integrationReady() {
+		report, err := s.fwOrch.ReconcileDrift(ctx)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		result.Drift = report
+	}
+	if s.remoteExitSvc != nil {
+		if err := s.remoteExitSvc.PushManifestToTailscale(ctx); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	s.restoreExitNodeRules(ctx)
+	return result, nil
+}
+
+// applyPolicyTemplate re-applies zone's policies under the reconcile guard.
+// It reports false when another reconcile holds the guard; the template is
+// saved, and drift detection reports the policies it changes until a
+// reconcile replaces them.
+func (s *Server) applyPolicyTemplate(ctx context.Context, zone string) (bool, error) {
+	var err error
+	ran := s.guardedSetup(func() {
+		err = s.fwOrch.ApplyPolicyTemplate(ctx, zone)
+	})
+	if !ran {
+		slog.Info("policy template apply skipped: another reconcile in flight", "zone", zone)
+	}
+	return ran, err
+}
+
 func (s *Server) openTailscaleWanPort(ctx context.Context) {
 	port := service.ReadTailscaledPort()
 	if port <= 0 {
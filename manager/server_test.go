@@ -83,6 +83,7 @@ func newTestServer(opts ...func(*Server)) *Server {
 		ic:       &mockIntegrationAPI{},
 		manifest: &mockManifestStore{},
 		logBuf:   NewLogBuffer(100),
+		traffic:  NewTrafficHistory(),
 		updater:  &updateChecker{current: "1.0.0-test", httpClient: &http.Client{}},
 		health:   NewHealthTracker(hub),
 	}
@@ -202,29 +203,53 @@ func TestRouteRegistration(t *testing.T) {
 		{"GET", "/api/settings"},
 		{"POST", "/api/settings"},
 		{"GET", "/api/diagnostics"},
+		{"GET", "/api/firewall/templates"},
+		{"POST", "/api/firewall/templates"},
+		{"DELETE", "/api/firewall/templates/{zone}"},
+		{"GET", "/api/firewall/drift"},
+		{"POST", "/api/firewall/drift/reconcile"},
+		{"GET", "/api/routing-health"},
+		{"POST", "/api/routing-health/fix/{check}"},
 		{"POST", "/api/bugreport"},
 		{"GET", "/api/logs"},
 		{"GET", "/api/integration/status"},
 		{"POST", "/api/integration/api-key"},
 		{"DELETE", "/api/integration/api-key"},
 		{"POST", "/api/integration/test"},
+		{"GET", "/api/integration/inventory"},
+		{"POST", "/api/integration/gc"},
+		{"GET", "/api/manifest/snapshots"},
+		{"GET", "/api/manifest/snapshots/{id}/diff"},
+		{"POST", "/api/manifest/snapshots/{id}/restore"},
 		{"GET", "/api/wg-s2s/tunnels"},
 		{"POST", "/api/wg-s2s/tunnels"},
+		{"POST", "/api/wg-s2s/import"},
 		{"PATCH", "/api/wg-s2s/tunnels/{id}"},
 		{"DELETE", "/api/wg-s2s/tunnels/{id}"},
 		{"POST", "/api/wg-s2s/tunnels/{id}/enable"},
 		{"POST", "/api/wg-s2s/tunnels/{id}/disable"},
+		{"POST", "/api/wg-s2s/tunnels/{id}/mtu"},
+		{"POST", "/api/wg-s2s/tunnels/{id}/key-rotation"},
+		{"POST", "/api/wg-s2s/tunnels/{id}/key-rotation/commit"},
+		{"DELETE", "/api/wg-s2s/tunnels/{id}/key-rotation"},
+		{"POST", "/api/wg-s2s/tunnels/{id}/pairing"},
+		{"POST", "/api/wg-s2s/tunnels/{id}/pairing/complete"},
+		{"POST", "/api/wg-s2s/pairing/import"},
 		{"POST", "/api/wg-s2s/generate-keypair"},
+		{"POST", "/api/wg-s2s/generate-psk"},
 		{"GET", "/api/wg-s2s/tunnels/{id}/config"},
 		{"GET", "/api/wg-s2s/wan-ip"},
 		{"GET", "/api/wg-s2s/local-subnets"},
 		{"GET", "/api/wg-s2s/zones"},
+		{"GET", "/api/metrics/history"},
 		{"GET", "/api/update-check"},
 	}
 
 	for _, r := range routes {
 		t.Run(r.method+" "+r.path, func(t *testing.T) {
 			path := strings.ReplaceAll(r.path, "{id}", "test-id")
+			path = strings.ReplaceAll(path, "{check}", "rp_filter")
+			path = strings.ReplaceAll(path, "{zone}", "Tailscale")
 			body := strings.NewReader("{}")
 			req, err := http.NewRequest(r.method, h.URL+path, body)
 			require.NoError(t, err)
@@ -48,6 +48,10 @@ type DiagnosticsResponse struct {
 	PreferredDERP int               `json:"preferredDERP"`
 	DERPRegions   []DERPRegionInfo  `json:"derpRegions"`
 	WgS2s         *WgS2sDiagnostics `json:"wgS2s,omitempty"`
+	PathMTU       []PathMTUResult   `json:"pathMTU,omitempty"`
+	// PathMTUPending is set while a path MTU probe runs in the background;
+	// PathMTU is then the previous run's, if any.
+	PathMTUPending bool `json:"pathMTUPending,omitempty"`
 }
 
 type DERPRegionInfo struct {
@@ -63,15 +67,19 @@ type WgS2sDiagnostics struct {
 	Tunnels         []WgS2sTunnelDiag `json:"tunnels"`
 }
 
+// WgS2sTunnelDiag is one enabled tunnel's health. Reachable and Probes come
+// from the tunnel's reachability probes and are empty if it has none.
 type WgS2sTunnelDiag struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	InterfaceName string `json:"interfaceName"`
-	InterfaceUp   bool   `json:"interfaceUp"`
-	RoutesOk      bool   `json:"routesOk"`
-	ForwardINOk   bool   `json:"forwardINOk"`
-	Connected     bool   `json:"connected"`
-	Endpoint      string `json:"endpoint,omitempty"`
+	ID            string                `json:"id"`
+	Name          string                `json:"name"`
+	InterfaceName string                `json:"interfaceName"`
+	InterfaceUp   bool                  `json:"interfaceUp"`
+	RoutesOk      bool                  `json:"routesOk"`
+	ForwardINOk   bool                  `json:"forwardINOk"`
+	Connected     bool                  `json:"connected"`
+	Endpoint      string                `json:"endpoint,omitempty"`
+	Reachable     *bool                 `json:"reachable,omitempty"`
+	Probes        []wgs2s.WgProbeResult `json:"probes,omitempty"`
 }
 
 type NetcheckResult struct {
@@ -90,6 +98,9 @@ type DiagnosticsService struct {
 	netcheckMu      sync.Mutex
 	netcheckCache   *NetcheckResult
 	netcheckCacheAt time.Time
+
+	probeMTU pmtuProbe // nil = ping
+	pmtu     pathMTUCache
 }
 
 func NewDiagnosticsService(ts DiagnosticsTailscale, fw DiagnosticsFirewall, wg DiagnosticsWgS2s) *DiagnosticsService {
@@ -158,14 +169,20 @@ func (svc *DiagnosticsService) GetDiagnostics(ctx context.Context) (*Diagnostics
 		regionLatencyNs = nc.RegionLatency
 	}
 	regions := BuildDERPRegions(derpMap, derpErr, regionLatencyNs, preferredDERP)
+	if derpErr != nil {
+		derpMap = nil
+	}
+	pathMTU, pathMTUPending := svc.pathMTU(derpMap, preferredDERP)
 
 	return &DiagnosticsResponse{
-		IPForwarding:  ipFwd,
-		FwmarkPatched: true,
-		FwmarkValue:   "0x800000",
-		PreferredDERP: preferredDERP,
-		DERPRegions:   regions,
-		WgS2s:         wgDiag,
+		IPForwarding:   ipFwd,
+		FwmarkPatched:  true,
+		FwmarkValue:    "0x800000",
+		PreferredDERP:  preferredDERP,
+		DERPRegions:    regions,
+		WgS2s:          wgDiag,
+		PathMTU:        pathMTU,
+		PathMTUPending: pathMTUPending,
 	}, nil
 }
 
@@ -273,6 +290,8 @@ func (svc *DiagnosticsService) gatherWgS2sDiagnostics(ctx context.Context, wgSvc
 		if idx, ok := statusMap[t.ID]; ok {
 			d.Connected = statuses[idx].Connected
 			d.Endpoint = statuses[idx].Endpoint
+			d.Reachable = statuses[idx].Reachable
+			d.Probes = statuses[idx].Probes
 		}
 
 		diags = append(diags, d)
@@ -132,6 +132,7 @@ func TestGetDiagnostics_NilWgManager(t *testing.T) {
 }
 
 func TestGetDiagnostics_WithWgManager(t *testing.T) {
+	unreachable := false
 	svc := newTestDiagnosticsService(func(s *DiagnosticsService) {
 		s.wg = &mockDiagnosticsWgS2s{
 			getTunnelsFn: func() []wgs2s.TunnelConfig {
@@ -142,7 +143,8 @@ func TestGetDiagnostics_WithWgManager(t *testing.T) {
 			},
 			getStatusesFn: func() []wgs2s.WgS2sStatus {
 				return []wgs2s.WgS2sStatus{
-					{ID: "t1", Connected: true, Endpoint: "1.2.3.4:51820"},
+					{ID: "t1", Connected: true, Endpoint: "1.2.3.4:51820", Reachable: &unreachable,
+						Probes: []wgs2s.WgProbeResult{{Kind: wgs2s.HealthProbeICMP, Target: "10.0.0.1", Loss: 1}}},
 				}
 			},
 		}
@@ -161,6 +163,9 @@ func TestGetDiagnostics_WithWgManager(t *testing.T) {
 	assert.True(t, resp.WgS2s.Tunnels[0].ForwardINOk)
 	assert.True(t, resp.WgS2s.Tunnels[0].Connected)
 	assert.Equal(t, "1.2.3.4:51820", resp.WgS2s.Tunnels[0].Endpoint)
+	require.NotNil(t, resp.WgS2s.Tunnels[0].Reachable)
+	assert.False(t, *resp.WgS2s.Tunnels[0].Reachable, "a handshaking tunnel can still have an unreachable LAN")
+	assert.Len(t, resp.WgS2s.Tunnels[0].Probes, 1)
 }
 
 func TestGetDiagnostics_DERPMapError(t *testing.T) {
@@ -1,7 +1,6 @@
 package service
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log/slog"
@@ -10,10 +9,11 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"unifi-tailscale/manager/config"
 	"unifi-tailscale/manager/domain"
 	"unifi-tailscale/manager/ops"
 )
@@ -35,22 +35,81 @@ const (
 type ExitNodeManifest interface {
 	GetExitNodePolicy() domain.ExitNodePolicy
 	SetExitNodePolicy(p domain.ExitNodePolicy) error
+	GetExitSchedules() []domain.ExitSchedule
+	SetExitSchedules(s []domain.ExitSchedule) error
 }
 
 type CmdRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
 
+// exitKernel is the routing state the exit node owns: its policy rules, the
+// kill switch routes in ExitRouteTable and the conntrack table it flushes
+// after a change, plus the neighbour table MAC clients are looked up in.
+// netlinkExitKernel talks to the kernel directly; iprouteExitKernel drives
+// the same state through ip(8) and conntrack(8).
+type exitKernel interface {
+	addRule(ctx context.Context, r exitRule) error
+	delRule(ctx context.Context, family string, prio int) error
+	listRules(ctx context.Context, family string) ([]exitRule, error)
+	setKillSwitch(ctx context.Context, family string, on bool) error
+	hasKillSwitch(ctx context.Context, family string) (bool, error)
+	neighbours(ctx context.Context) (map[string][]netip.Addr, error)
+	flushConntrack(ctx context.Context) error
+}
+
+// exitMasq manages the MASQUERADE rules for traffic leaving through
+// tailscale0. Errors carry the tool's output, so isIP6Unavailable can be
+// applied to them as they are.
+type exitMasq interface {
+	add(ctx context.Context, r masqRule) error
+	del(ctx context.Context, r masqRule) error
+	check(ctx context.Context, r masqRule) error
+}
+
 type ExitNodeService struct {
 	manifest        ExitNodeManifest
 	run             CmdRunner
+	kernel          exitKernel
+	masq            exitMasq
 	discoverBridges func() ([]string, error)
-	mu              sync.Mutex
-}
-
+	lookup          func(ctx context.Context, host string) ([]netip.Addr, error)
+	subnets         SubnetProvider
+	leasesPath      string
+	now             func() time.Time
+	// v6KillSwitchSkipped records that the last install found IPv6
+	// unavailable, so the v6 route is not expected back. Over netlink a
+	// missing IPv6 stack reads as an absent route rather than an error.
+	v6KillSwitchSkipped bool
+	mu                  sync.Mutex
+}
+
+// NewExitNodeService manages rules, routes and conntrack over netlink. A
+// non-nil runner is handed every operation instead, rules included, so tests
+// can run against a fake ip(8).
 func NewExitNodeService(manifest ExitNodeManifest, runner CmdRunner) *ExitNodeService {
+	var kernel exitKernel = netlinkExitKernel{}
 	if runner == nil {
 		runner = defaultCmdRunner
+	} else {
+		kernel = iprouteExitKernel{run: runner}
+	}
+	return &ExitNodeService{
+		manifest:        manifest,
+		run:             runner,
+		kernel:          kernel,
+		masq:            iptablesMasq{run: runner},
+		discoverBridges: defaultDiscoverBridges,
+		lookup:          lookupNetIP,
+		leasesPath:      config.DHCPLeasesPath,
+		now:             time.Now,
 	}
-	return &ExitNodeService{manifest: manifest, run: runner, discoverBridges: defaultDiscoverBridges}
+}
+
+// SetSubnetProvider sets the source of the UniFi network subnets that
+// networks mode resolves interface names against.
+func (s *ExitNodeService) SetSubnetProvider(p SubnetProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subnets = p
 }
 
 func defaultCmdRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
@@ -62,6 +121,8 @@ type exitRule struct {
 	Family   string // "-4" or "-6"
 	Src      string // client IP/CIDR for selective mode
 	Iif      string // input interface for mode=all (e.g. "br0")
+	Dst      string // destination IP/CIDR for destinations mode
+	Fwmark   string // packet mark for destinations mode domains
 }
 
 func (s *ExitNodeService) Apply(ctx context.Context, policy domain.ExitNodePolicy) error {
@@ -80,7 +141,12 @@ func (s *ExitNodeService) applyLocked(ctx context.Context, policy domain.ExitNod
 		return s.manifest.SetExitNodePolicy(domain.ExitNodePolicy{Mode: domain.ExitNodeOff})
 	}
 
-	steps, err := s.buildApplyOps(policy)
+	active, clients := s.scheduled(policy, s.now())
+	if !active {
+		slog.Info("exit node policy outside its schedule", "schedule", policy.Schedule)
+		return s.manifest.SetExitNodePolicy(policy)
+	}
+	steps, err := s.buildApplyOps(policy, s.expandClients(ctx, clients))
 	if err != nil {
 		return err
 	}
@@ -97,7 +163,10 @@ func isCatchAllPrefix(s string) bool {
 	return false
 }
 
-func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy) ([]ops.Op, error) {
+// buildApplyOps builds the saga for policy. clients is policy.Clients with
+// MAC entries already expanded to their current addresses; the policy is
+// persisted as given.
+func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy, clients []domain.ExitNodeClient) ([]ops.Op, error) {
 	var out []ops.Op
 	switch policy.Mode {
 	case domain.ExitNodeAll:
@@ -114,7 +183,7 @@ func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy) ([]ops.Op,
 				fam, br, prio := fam, br, prio
 				out = append(out, ops.Op{
 					Name: fmt.Sprintf("add rule %s iif %s prio %d", fam, br, prio),
-					Do:   func(ctx context.Context) error { return s.addRule(ctx, fam, "", prio, br) },
+					Do:   func(ctx context.Context) error { return s.addRule(ctx, exitRule{Priority: prio, Family: fam, Iif: br}) },
 					Undo: func(ctx context.Context) error { return s.delRule(ctx, fam, prio) },
 				})
 			}
@@ -126,13 +195,13 @@ func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy) ([]ops.Op,
 		}
 
 	case domain.ExitNodeSelective:
-		if len(policy.Clients) == 0 {
+		if len(clients) == 0 {
 			return []ops.Op{ops.Noop("persist empty selective", func(_ context.Context) error {
 				return s.manifest.SetExitNodePolicy(policy)
 			})}, nil
 		}
 		prio := ExitRuleBasePrio + 1
-		for _, c := range policy.Clients {
+		for _, c := range clients {
 			if isCatchAllPrefix(c.IP) {
 				return nil, validationError(fmt.Sprintf(
 					"selective client %q is a catch-all prefix; use mode=all explicitly", c.IP))
@@ -145,7 +214,9 @@ func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy) ([]ops.Op,
 			famCap, srcCap, prioCap := fam, c.IP, prio
 			out = append(out, ops.Op{
 				Name: fmt.Sprintf("add rule %s from %s prio %d", famCap, srcCap, prioCap),
-				Do:   func(ctx context.Context) error { return s.addRule(ctx, famCap, srcCap, prioCap, "") },
+				Do: func(ctx context.Context) error {
+					return s.addRule(ctx, exitRule{Priority: prioCap, Family: famCap, Src: srcCap})
+				},
 				Undo: func(ctx context.Context) error { return s.delRule(ctx, famCap, prioCap) },
 			})
 			prio++
@@ -155,9 +226,35 @@ func (s *ExitNodeService) buildApplyOps(policy domain.ExitNodePolicy) ([]ops.Op,
 			}
 		}
 
+	case domain.ExitNodeNetworks:
+		rules := networkRules(policy.Networks, s.localSubnets())
+		if len(rules) == 0 {
+			slog.Warn("no subnets found for exit networks", "networks", policy.Networks)
+			return []ops.Op{ops.Noop("persist networks without subnets", func(_ context.Context) error {
+				return s.manifest.SetExitNodePolicy(policy)
+			})}, nil
+		}
+		for _, r := range rules {
+			out = append(out, ops.Op{
+				Name: fmt.Sprintf("add rule %s from %s iif %s prio %d", r.Family, r.Src, r.Iif, r.Priority),
+				Do:   func(ctx context.Context) error { return s.addRule(ctx, r) },
+				Undo: func(ctx context.Context) error { return s.delRule(ctx, r.Family, r.Priority) },
+			})
+		}
+
+	case domain.ExitNodeDestinations:
+		dstOps, err := s.buildDestinationOps(policy)
+		if err != nil {
+			return nil, err
+		}
+		out = dstOps
+
 	default:
 		return nil, validationError(fmt.Sprintf("unknown exit node mode: %s", policy.Mode))
 	}
+	if policy.KillSwitch {
+		out = append(s.buildKillSwitchOps(), out...)
+	}
 
 	// MASQUERADE is split into per-family ops so a non-tolerated IPv6 failure
 	// triggers proper rollback of the already-installed IPv4 rule. The v6 op
@@ -199,6 +296,8 @@ func (s *ExitNodeService) Cleanup(ctx context.Context) error {
 
 func (s *ExitNodeService) cleanupLocked(ctx context.Context) error {
 	s.delMasquerade(ctx)
+	s.delDestinationMatch(ctx)
+	s.delKillSwitch(ctx)
 	var errs []string
 	for _, fam := range []string{"-4", "-6"} {
 		rules, err := s.listRules(ctx, fam)
@@ -231,14 +330,35 @@ func (s *ExitNodeService) Reconcile(ctx context.Context, policy domain.ExitNodeP
 		}
 	}
 
-	desired := buildDesiredRules(policy, bridges)
+	// Networks mode is resolved against the subnets on every pass, so a
+	// network renumbered in udapi-net-cfg.json shows up here as drift.
+	// Likewise MAC clients are looked up again, so a new DHCP lease or
+	// neighbour entry re-points the client's rules. Schedules are evaluated
+	// here too, so a window opening or closing is just more drift.
+	active, clients := s.scheduled(policy, s.now())
+	var desired []exitRule
+	switch {
+	case !active:
+	case policy.Mode == domain.ExitNodeNetworks:
+		desired = networkRules(policy.Networks, s.localSubnets())
+	case policy.Mode == domain.ExitNodeSelective:
+		resolved := policy
+		resolved.Clients = s.expandClients(ctx, clients)
+		desired = buildDesiredRules(resolved, bridges)
+	default:
+		desired = buildDesiredRules(policy, bridges)
+	}
 	current, err := s.allCurrentRules(ctx)
 	if err != nil {
 		return fmt.Errorf("list current exit rules: %w", err)
 	}
 
 	needsMasq := len(desired) > 0
-	if rulesMatch(current, desired) && needsMasq == s.hasMasquerade(ctx) {
+	needsDstMatch := active && policy.Mode == domain.ExitNodeDestinations && len(policy.Domains) > 0
+	needsKillSwitch := needsMasq && policy.KillSwitch
+	if rulesMatch(current, desired) && needsMasq == s.hasMasquerade(ctx) &&
+		(!needsDstMatch || s.hasDestinationMatch(ctx)) &&
+		(!needsKillSwitch || s.hasKillSwitch(ctx)) {
 		return nil
 	}
 
@@ -246,55 +366,29 @@ func (s *ExitNodeService) Reconcile(ctx context.Context, policy domain.ExitNodeP
 	return s.applyLocked(ctx, policy)
 }
 
-func (s *ExitNodeService) addRule(ctx context.Context, family, src string, prio int, iif string) error {
-	args := []string{family, "rule", "add"}
-	if iif != "" {
-		args = append(args, "iif", iif)
-	} else if src != "" {
-		args = append(args, "from", src)
-	}
-	args = append(args, "lookup", strconv.Itoa(ExitRouteTable), "prio", strconv.Itoa(prio))
-
-	out, err := s.run(ctx, "ip", args...)
-	if err != nil {
-		return fmt.Errorf("ip %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
-	}
-	return nil
+func (s *ExitNodeService) addRule(ctx context.Context, r exitRule) error {
+	return s.kernel.addRule(ctx, r)
 }
 
 func (s *ExitNodeService) flushConntrack(ctx context.Context) {
-	out, err := s.run(ctx, "conntrack", "-F")
-	if err != nil {
-		slog.Warn("conntrack flush", "err", err, "out", strings.TrimSpace(string(out)))
+	if err := s.kernel.flushConntrack(ctx); err != nil {
+		slog.Warn("conntrack flush", "err", err)
 		return
 	}
 	slog.Info("conntrack flushed after exit node routing change")
 }
 
-func (s *ExitNodeService) masqArgs(action string) [][]string {
-	return [][]string{
-		{"-t", "nat", action, "POSTROUTING",
-			"-o", tsInterface, "!", "-s", tsCGNATv4,
-			"-j", "MASQUERADE", "-m", "comment", "--comment", ExitMasqComment},
-		{"-t", "nat", action, "POSTROUTING",
-			"-o", tsInterface, "!", "-s", tsCGNATv6,
-			"-j", "MASQUERADE", "-m", "comment", "--comment", ExitMasqComment},
-	}
-}
-
 // addV4Masquerade installs the IPv4 MASQUERADE rule. Failure is always fatal.
 func (s *ExitNodeService) addV4Masquerade(ctx context.Context) error {
-	args := s.masqArgs("-A")[0]
-	if out, err := s.run(ctx, "iptables", args...); err != nil {
-		return fmt.Errorf("iptables masquerade add: %w (%s)", err, strings.TrimSpace(string(out)))
+	if err := s.masq.add(ctx, exitMasqRules[0]); err != nil {
+		return fmt.Errorf("iptables masquerade add: %w", err)
 	}
 	return nil
 }
 
 // delV4Masquerade removes the IPv4 MASQUERADE rule, ignoring "rule absent" errors.
 func (s *ExitNodeService) delV4Masquerade(ctx context.Context) {
-	args := s.masqArgs("-D")[0]
-	_, _ = s.run(ctx, "iptables", args...)
+	_ = s.masq.del(ctx, exitMasqRules[0])
 }
 
 // addV6Masquerade attempts the IPv6 MASQUERADE install. Returns (installed,
@@ -303,23 +397,20 @@ func (s *ExitNodeService) delV4Masquerade(ctx context.Context) {
 // unavailable (tolerated — no rule landed, nothing to roll back).
 // A non-tolerated error returns (false, err) so the saga can abort.
 func (s *ExitNodeService) addV6Masquerade(ctx context.Context) (bool, error) {
-	args := s.masqArgs("-A")[1]
-	out, err := s.run(ctx, "ip6tables", args...)
+	err := s.masq.add(ctx, exitMasqRules[1])
 	if err == nil {
 		return true, nil
 	}
-	if isIP6Unavailable(err, out) {
-		slog.Warn("ip6tables masquerade add (IPv6 unavailable, tolerated)",
-			"err", err, "out", strings.TrimSpace(string(out)))
+	if isIP6Unavailable(err, nil) {
+		slog.Warn("ip6tables masquerade add (IPv6 unavailable, tolerated)", "err", err)
 		return false, nil
 	}
-	return false, fmt.Errorf("ip6tables masquerade add: %w (%s)", err, strings.TrimSpace(string(out)))
+	return false, fmt.Errorf("ip6tables masquerade add: %w", err)
 }
 
 // delV6Masquerade removes the IPv6 MASQUERADE rule, ignoring errors.
 func (s *ExitNodeService) delV6Masquerade(ctx context.Context) {
-	args := s.masqArgs("-D")[1]
-	_, _ = s.run(ctx, "ip6tables", args...)
+	_ = s.masq.del(ctx, exitMasqRules[1])
 }
 
 // isIP6Unavailable returns true when the ip6tables error indicates the
@@ -349,9 +440,8 @@ func isIP6Unavailable(err error, out []byte) bool {
 }
 
 func (s *ExitNodeService) delMasquerade(ctx context.Context) {
-	cmds := []string{"iptables", "ip6tables"}
-	for i, args := range s.masqArgs("-D") {
-		_, _ = s.run(ctx, cmds[i], args...)
+	for _, r := range exitMasqRules {
+		_ = s.masq.del(ctx, r)
 	}
 }
 
@@ -362,32 +452,21 @@ func (s *ExitNodeService) delMasquerade(ctx context.Context) {
 // systems. A v6 failure on a healthy stack (e.g. "no chain by that
 // name") is real drift and must trigger reapply.
 func (s *ExitNodeService) hasMasquerade(ctx context.Context) bool {
-	all := s.masqArgs("-C")
-	if _, err := s.run(ctx, "iptables", all[0]...); err != nil {
+	if err := s.masq.check(ctx, exitMasqRules[0]); err != nil {
 		return false
 	}
-	out, err := s.run(ctx, "ip6tables", all[1]...)
-	if err != nil {
-		return isIP6Unavailable(err, out)
+	if err := s.masq.check(ctx, exitMasqRules[1]); err != nil {
+		return isIP6Unavailable(err, nil)
 	}
 	return true
 }
 
 func (s *ExitNodeService) delRule(ctx context.Context, family string, prio int) error {
-	args := []string{family, "rule", "del", "prio", strconv.Itoa(prio)}
-	out, err := s.run(ctx, "ip", args...)
-	if err != nil {
-		return fmt.Errorf("ip %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
-	}
-	return nil
+	return s.kernel.delRule(ctx, family, prio)
 }
 
 func (s *ExitNodeService) listRules(ctx context.Context, family string) ([]exitRule, error) {
-	out, err := s.run(ctx, "ip", family, "rule", "show")
-	if err != nil {
-		return nil, fmt.Errorf("ip %s rule show: %w", family, err)
-	}
-	return parseRules(string(out), family), nil
+	return s.kernel.listRules(ctx, family)
 }
 
 func (s *ExitNodeService) allCurrentRules(ctx context.Context) ([]exitRule, error) {
@@ -402,70 +481,6 @@ func (s *ExitNodeService) allCurrentRules(ctx context.Context) ([]exitRule, erro
 	return all, nil
 }
 
-func parseRules(output, family string) []exitRule {
-	var rules []exitRule
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	lookupStr := fmt.Sprintf("lookup %d", ExitRouteTable)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.Contains(line, lookupStr) {
-			continue
-		}
-		prio, ok := parseRulePriority(line)
-		if !ok || prio < ExitRuleBasePrio || prio > ExitRuleMaxPrio {
-			continue
-		}
-		src := parseRuleFrom(line)
-		iif := parseRuleIif(line)
-		rules = append(rules, exitRule{Priority: prio, Family: family, Src: src, Iif: iif})
-	}
-	return rules
-}
-
-func parseRulePriority(line string) (int, bool) {
-	idx := strings.IndexByte(line, ':')
-	if idx <= 0 {
-		return 0, false
-	}
-	n, err := strconv.Atoi(strings.TrimSpace(line[:idx]))
-	if err != nil {
-		return 0, false
-	}
-	return n, true
-}
-
-func parseRuleFrom(line string) string {
-	const fromPrefix = "from "
-	idx := strings.Index(line, fromPrefix)
-	if idx < 0 {
-		return ""
-	}
-	rest := line[idx+len(fromPrefix):]
-	end := strings.IndexByte(rest, ' ')
-	if end < 0 {
-		return rest
-	}
-	src := rest[:end]
-	if src == "all" {
-		return ""
-	}
-	return src
-}
-
-func parseRuleIif(line string) string {
-	const prefix = "iif "
-	idx := strings.Index(line, prefix)
-	if idx < 0 {
-		return ""
-	}
-	rest := line[idx+len(prefix):]
-	end := strings.IndexByte(rest, ' ')
-	if end < 0 {
-		return rest
-	}
-	return rest[:end]
-}
-
 func buildDesiredRules(policy domain.ExitNodePolicy, bridges []string) []exitRule {
 	switch policy.Mode {
 	case domain.ExitNodeAll:
@@ -496,6 +511,26 @@ func buildDesiredRules(policy domain.ExitNodePolicy, bridges []string) []exitRul
 			}
 		}
 		return rules
+	case domain.ExitNodeDestinations:
+		var rules []exitRule
+		prio := ExitRuleBasePrio + 1
+		for _, d := range policy.Destinations {
+			fam := familyForAddr(d)
+			if fam == "" {
+				continue
+			}
+			rules = append(rules, exitRule{Priority: prio, Family: fam, Dst: normalizeRuleSrc(d)})
+			prio++
+			if prio > ExitRuleMaxPrio {
+				break
+			}
+		}
+		if len(policy.Domains) > 0 {
+			for _, fam := range []string{"-4", "-6"} {
+				rules = append(rules, exitRule{Priority: ExitRuleBasePrio, Family: fam, Fwmark: exitDstMark})
+			}
+		}
+		return rules
 	default:
 		return nil
 	}
@@ -518,7 +553,7 @@ func rulesMatch(current, desired []exitRule) bool {
 }
 
 func ruleKey(r exitRule) string {
-	return fmt.Sprintf("%d/%s/%s/%s", r.Priority, r.Family, r.Src, r.Iif)
+	return fmt.Sprintf("%d/%s/%s/%s/%s/%s", r.Priority, r.Family, r.Src, r.Iif, r.Dst, r.Fwmark)
 }
 
 func normalizeRuleSrc(s string) string {
@@ -571,6 +606,12 @@ func ValidateExitNodePolicy(policy domain.ExitNodePolicy) error {
 			return validationError(fmt.Sprintf("too many exit clients: %d (max %d)", len(policy.Clients), maxExitClients))
 		}
 		for _, c := range policy.Clients {
+			if c.MAC != "" {
+				if err := validateClientMAC(c); err != nil {
+					return err
+				}
+				continue
+			}
 			if familyForAddr(c.IP) == "" {
 				return validationError(fmt.Sprintf("invalid client IP/CIDR: %s", c.IP))
 			}
@@ -580,6 +621,10 @@ func ValidateExitNodePolicy(policy domain.ExitNodePolicy) error {
 			}
 		}
 		return nil
+	case domain.ExitNodeNetworks:
+		return validateExitNetworks(policy)
+	case domain.ExitNodeDestinations:
+		return validateExitDestinations(policy)
 	default:
 		return validationError(fmt.Sprintf("unknown exit node mode: %s", policy.Mode))
 	}
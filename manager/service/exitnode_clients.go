@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/domain"
+)
+
+// maxAddrsPerMAC bounds how many rules one MAC client can take: a host with
+// IPv6 privacy addresses can show a handful in the neighbour table at once.
+const maxAddrsPerMAC = 4
+
+func validateClientMAC(c domain.ExitNodeClient) error {
+	if c.IP != "" {
+		return validationError(fmt.Sprintf("client %s: set either ip or mac, not both", c.MAC))
+	}
+	hw, err := net.ParseMAC(c.MAC)
+	if err != nil || len(hw) != 6 {
+		return validationError(fmt.Sprintf("invalid client MAC address: %s", c.MAC))
+	}
+	return nil
+}
+
+// expandClients replaces every MAC client with one IP client per address the
+// device currently holds, keeping its label. IP clients pass through. A MAC
+// with no known address contributes nothing until it shows up in a lease or
+// the neighbour table.
+func (s *ExitNodeService) expandClients(ctx context.Context, clients []domain.ExitNodeClient) []domain.ExitNodeClient {
+	if !slices.ContainsFunc(clients, func(c domain.ExitNodeClient) bool { return c.MAC != "" }) {
+		return clients
+	}
+	addrs := s.macAddrs(ctx, s.now())
+	out := make([]domain.ExitNodeClient, 0, len(clients))
+	for _, c := range clients {
+		if c.MAC == "" {
+			out = append(out, c)
+			continue
+		}
+		hw, err := net.ParseMAC(c.MAC)
+		if err != nil {
+			continue
+		}
+		found := addrs[hw.String()]
+		if len(found) == 0 {
+			slog.Debug("exit client MAC has no address", "mac", c.MAC)
+		}
+		for _, a := range found {
+			out = append(out, domain.ExitNodeClient{IP: a.String(), Label: c.Label})
+		}
+	}
+	return out
+}
+
+// macAddrs maps lowercase MAC addresses to the addresses the gateway knows
+// them by, from unexpired DHCP leases and the neighbour table. Each list is
+// sorted (IPv4 first) before it is capped, so the same neighbour state always
+// yields the same rules however the kernel orders its table. Link-local IPv6
+// addresses are left out; they never source routed traffic.
+func (s *ExitNodeService) macAddrs(ctx context.Context, now time.Time) map[string][]netip.Addr {
+	out := make(map[string][]netip.Addr)
+	add := func(mac string, a netip.Addr) {
+		hw, err := net.ParseMAC(mac)
+		if err != nil || a.IsLinkLocalUnicast() || a.IsUnspecified() {
+			return
+		}
+		key := hw.String()
+		if !slices.Contains(out[key], a) {
+			out[key] = append(out[key], a)
+		}
+	}
+	defer func() {
+		for mac, addrs := range out {
+			slices.SortFunc(addrs, netip.Addr.Compare)
+			out[mac] = addrs[:min(len(addrs), maxAddrsPerMAC)]
+		}
+	}()
+
+	if data, err := os.ReadFile(s.leasesPath); err == nil {
+		for mac, addrs := range parseDHCPLeases(string(data), now) {
+			for _, a := range addrs {
+				add(mac, a)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		slog.Warn("read DHCP leases", "path", s.leasesPath, "err", err)
+	}
+
+	neigh, err := s.kernel.neighbours(ctx)
+	if err != nil {
+		slog.Warn("list neighbours", "err", err)
+		return out
+	}
+	for mac, addrs := range neigh {
+		for _, a := range addrs {
+			add(mac, a)
+		}
+	}
+	return out
+}
+
+// parseDHCPLeases reads a dnsmasq lease file ("<expiry> <mac> <ip> <host>
+// <client-id>" per line) and returns every unexpired IPv4 lease by MAC: a
+// device on several VLANs, or one whose old lease has not run out yet, holds
+// more than one. An expiry of 0 is an infinite lease. DHCPv6 lines carry no
+// MAC and are skipped.
+func parseDHCPLeases(data string, now time.Time) map[string][]netip.Addr {
+	out := make(map[string][]netip.Addr)
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 3 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(f[0], 10, 64)
+		if err != nil || (expiry != 0 && expiry < now.Unix()) {
+			continue
+		}
+		a, err := netip.ParseAddr(f[2])
+		if err != nil || !a.Is4() {
+			continue
+		}
+		hw, err := net.ParseMAC(f[1])
+		if err != nil {
+			continue
+		}
+		if key := hw.String(); !slices.Contains(out[key], a) {
+			out[key] = append(out[key], a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/ops"
+)
+
+// Destinations mode steers traffic by where it is going instead of where it
+// comes from. Destination CIDRs get one "to" rule each into ExitRouteTable.
+// Domains are resolved into a pair of ipsets; a mangle PREROUTING rule marks
+// LAN packets to a set member and a single fwmark rule at ExitRuleBasePrio
+// sends marked packets to the same table. Set entries expire after
+// exitDstEntryTTL unless RefreshDestinations sees the name resolve to them
+// again, so an address a CDN stopped handing out drops off on its own.
+//
+// Clients resolve names themselves, so a domain is only steered as far as
+// the router's resolver returns the same addresses the client got.
+const (
+	exitDstSet4    = "vpn-pack-exit-dst4"
+	exitDstSet6    = "vpn-pack-exit-dst6"
+	exitDstComment = "vpn-pack-exit-dst"
+
+	// exitDstMark stays clear of the 0xff0000 bits Tailscale owns.
+	exitDstMark = "0x1000000/0x1000000"
+
+	maxExitDomains  = 32
+	exitDstEntryTTL = 3 * config.ExitDestinationRefresh
+	exitDstResolve  = 5 * time.Second
+)
+
+var exitDomainRe = regexp.MustCompile(`^(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)(?:\.(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?))+$`)
+
+func lookupNetIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// exitDstFamily pairs an ip rule family with its ipset and iptables binary.
+type exitDstFamily struct {
+	ip       string
+	set      string
+	inet     string
+	iptables string
+}
+
+var exitDstFamilies = []exitDstFamily{
+	{ip: "-4", set: exitDstSet4, inet: "inet", iptables: "iptables"},
+	{ip: "-6", set: exitDstSet6, inet: "inet6", iptables: "ip6tables"},
+}
+
+func (f exitDstFamily) markArgs(action string) []string {
+	return []string{"-t", "mangle", action, "PREROUTING",
+		"!", "-i", tsInterface,
+		"-m", "set", "--match-set", f.set, "dst",
+		"-j", "MARK", "--set-xmark", exitDstMark,
+		"-m", "comment", "--comment", exitDstComment}
+}
+
+func (s *ExitNodeService) buildDestinationOps(policy domain.ExitNodePolicy) ([]ops.Op, error) {
+	var out []ops.Op
+	prio := ExitRuleBasePrio + 1
+	for _, d := range policy.Destinations {
+		if isCatchAllPrefix(d) {
+			return nil, validationError(fmt.Sprintf(
+				"destination %q is a catch-all prefix; use mode=all explicitly", d))
+		}
+		fam := familyForAddr(d)
+		if fam == "" {
+			slog.Warn("skip invalid exit destination", "dst", d)
+			continue
+		}
+		famCap, dstCap, prioCap := fam, d, prio
+		out = append(out, ops.Op{
+			Name: fmt.Sprintf("add rule %s to %s prio %d", famCap, dstCap, prioCap),
+			Do: func(ctx context.Context) error {
+				return s.addRule(ctx, exitRule{Priority: prioCap, Family: famCap, Dst: dstCap})
+			},
+			Undo: func(ctx context.Context) error { return s.delRule(ctx, famCap, prioCap) },
+		})
+		prio++
+		if prio > ExitRuleMaxPrio {
+			slog.Warn("exit node destination limit reached", "max", maxExitClients)
+			break
+		}
+	}
+	if len(policy.Domains) == 0 {
+		return out, nil
+	}
+
+	for _, f := range exitDstFamilies {
+		out = append(out, ops.Op{
+			Name: "create ipset " + f.set,
+			Do: func(ctx context.Context) error {
+				args := []string{"create", f.set, "hash:ip", "family", f.inet,
+					"timeout", strconv.Itoa(int(exitDstEntryTTL / time.Second)), "-exist"}
+				if out, err := s.run(ctx, "ipset", args...); err != nil {
+					return fmt.Errorf("ipset %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				_, _ = s.run(ctx, "ipset", "destroy", f.set)
+				return nil
+			},
+		})
+	}
+	out = append(out, ops.Op{
+		Name: "add v4 destination mark",
+		Do: func(ctx context.Context) error {
+			if out, err := s.run(ctx, "iptables", exitDstFamilies[0].markArgs("-A")...); err != nil {
+				return fmt.Errorf("iptables destination mark add: %w (%s)", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		},
+		Undo: func(ctx context.Context) error {
+			_, _ = s.run(ctx, "iptables", exitDstFamilies[0].markArgs("-D")...)
+			return nil
+		},
+	})
+	v6Marked := false
+	out = append(out, ops.Op{
+		Name: "add v6 destination mark (best-effort)",
+		Do: func(ctx context.Context) error {
+			out, err := s.run(ctx, "ip6tables", exitDstFamilies[1].markArgs("-A")...)
+			if err == nil {
+				v6Marked = true
+				return nil
+			}
+			if isIP6Unavailable(err, out) {
+				slog.Warn("ip6tables destination mark add (IPv6 unavailable, tolerated)",
+					"err", err, "out", strings.TrimSpace(string(out)))
+				return nil
+			}
+			return fmt.Errorf("ip6tables destination mark add: %w (%s)", err, strings.TrimSpace(string(out)))
+		},
+		Undo: func(ctx context.Context) error {
+			if v6Marked {
+				_, _ = s.run(ctx, "ip6tables", exitDstFamilies[1].markArgs("-D")...)
+			}
+			return nil
+		},
+	})
+	for _, f := range exitDstFamilies {
+		out = append(out, ops.Op{
+			Name: fmt.Sprintf("add rule %s fwmark prio %d", f.ip, ExitRuleBasePrio),
+			Do: func(ctx context.Context) error {
+				return s.addRule(ctx, exitRule{Priority: ExitRuleBasePrio, Family: f.ip, Fwmark: exitDstMark})
+			},
+			Undo: func(ctx context.Context) error { return s.delRule(ctx, f.ip, ExitRuleBasePrio) },
+		})
+	}
+	out = append(out, ops.Noop("resolve exit domains", func(ctx context.Context) error {
+		s.fillDestinationSets(ctx, s.resolveDomains(ctx, policy.Domains))
+		return nil
+	}))
+	return out, nil
+}
+
+// delDestinationMatch removes the mark rules and the ipsets, ignoring
+// "absent" errors. The rules go first: a set still referenced by iptables
+// cannot be destroyed.
+func (s *ExitNodeService) delDestinationMatch(ctx context.Context) {
+	for _, f := range exitDstFamilies {
+		_, _ = s.run(ctx, f.iptables, f.markArgs("-D")...)
+	}
+	for _, f := range exitDstFamilies {
+		_, _ = s.run(ctx, "ipset", "destroy", f.set)
+	}
+}
+
+// hasDestinationMatch reports whether the domain match is installed. Like
+// hasMasquerade, a v6 check failure on a host without IPv6 is not drift.
+func (s *ExitNodeService) hasDestinationMatch(ctx context.Context) bool {
+	for _, f := range exitDstFamilies {
+		if _, err := s.run(ctx, "ipset", "list", "-n", f.set); err != nil {
+			return false
+		}
+	}
+	if _, err := s.run(ctx, "iptables", exitDstFamilies[0].markArgs("-C")...); err != nil {
+		return false
+	}
+	out, err := s.run(ctx, "ip6tables", exitDstFamilies[1].markArgs("-C")...)
+	if err != nil {
+		return isIP6Unavailable(err, out)
+	}
+	return true
+}
+
+// resolveDomains looks up every domain, logging and skipping the ones that
+// fail. Lookups run without s.mu.
+func (s *ExitNodeService) resolveDomains(ctx context.Context, domains []string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, d := range domains {
+		lookupCtx, cancel := context.WithTimeout(ctx, exitDstResolve)
+		got, err := s.lookup(lookupCtx, d)
+		cancel()
+		if err != nil {
+			slog.Warn("exit destination domain lookup failed", "domain", d, "err", err)
+			continue
+		}
+		for _, a := range got {
+			addrs = append(addrs, a.Unmap())
+		}
+	}
+	return addrs
+}
+
+// fillDestinationSets adds addrs to their family's set, refreshing the
+// timeout of the ones already in it.
+func (s *ExitNodeService) fillDestinationSets(ctx context.Context, addrs []netip.Addr) {
+	ttl := strconv.Itoa(int(exitDstEntryTTL / time.Second))
+	for _, a := range addrs {
+		set := exitDstSet4
+		if a.Is6() {
+			set = exitDstSet6
+		}
+		if out, err := s.run(ctx, "ipset", "add", set, a.String(), "timeout", ttl, "-exist"); err != nil {
+			slog.Warn("ipset add exit destination", "addr", a, "err", err, "out", strings.TrimSpace(string(out)))
+		}
+	}
+}
+
+// RefreshDestinations re-resolves the domains of a destinations policy and
+// tops up the ipsets. Other policies are left alone.
+func (s *ExitNodeService) RefreshDestinations(ctx context.Context, policy domain.ExitNodePolicy) {
+	if policy.Mode != domain.ExitNodeDestinations || len(policy.Domains) == 0 {
+		return
+	}
+	addrs := s.resolveDomains(ctx, policy.Domains)
+	if len(addrs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fillDestinationSets(ctx, addrs)
+}
+
+func validateExitDestinations(policy domain.ExitNodePolicy) error {
+	if len(policy.Destinations) == 0 && len(policy.Domains) == 0 {
+		return validationError("destinations mode needs at least one destination or domain")
+	}
+	if len(policy.Destinations) > maxExitClients {
+		return validationError(fmt.Sprintf("too many exit destinations: %d (max %d)", len(policy.Destinations), maxExitClients))
+	}
+	if len(policy.Domains) > maxExitDomains {
+		return validationError(fmt.Sprintf("too many exit domains: %d (max %d)", len(policy.Domains), maxExitDomains))
+	}
+	for _, d := range policy.Destinations {
+		if familyForAddr(d) == "" {
+			return validationError(fmt.Sprintf("invalid destination IP/CIDR: %s", d))
+		}
+		if isCatchAllPrefix(d) {
+			return validationError(fmt.Sprintf(
+				"destination %q is a catch-all prefix; use mode=all explicitly", d))
+		}
+	}
+	for _, d := range policy.Domains {
+		if len(d) > 253 || !exitDomainRe.MatchString(d) {
+			return validationError(fmt.Sprintf("invalid domain name: %s", d))
+		}
+	}
+	return nil
+}
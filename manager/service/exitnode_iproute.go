@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// iprouteExitKernel is the exitKernel behind ip(8) and conntrack(8). It
+// parses their text output, so it depends on the iproute2 version the
+// firmware ships; production uses netlinkExitKernel.
+type iprouteExitKernel struct {
+	run CmdRunner
+}
+
+func (k iprouteExitKernel) ip(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := k.run(ctx, "ip", args...)
+	if err != nil {
+		return out, fmt.Errorf("ip %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+func (k iprouteExitKernel) addRule(ctx context.Context, r exitRule) error {
+	args := []string{r.Family, "rule", "add"}
+	if r.Src != "" {
+		args = append(args, "from", r.Src)
+	}
+	if r.Iif != "" {
+		args = append(args, "iif", r.Iif)
+	}
+	if r.Dst != "" {
+		args = append(args, "to", r.Dst)
+	}
+	if r.Fwmark != "" {
+		args = append(args, "fwmark", r.Fwmark)
+	}
+	args = append(args, "lookup", strconv.Itoa(ExitRouteTable), "prio", strconv.Itoa(r.Priority))
+	_, err := k.ip(ctx, args...)
+	return err
+}
+
+func (k iprouteExitKernel) delRule(ctx context.Context, family string, prio int) error {
+	_, err := k.ip(ctx, family, "rule", "del", "prio", strconv.Itoa(prio))
+	return err
+}
+
+func (k iprouteExitKernel) listRules(ctx context.Context, family string) ([]exitRule, error) {
+	out, err := k.ip(ctx, family, "rule", "show")
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(string(out), family), nil
+}
+
+func killSwitchArgs(family, action string) []string {
+	return []string{family, "route", action, "unreachable", "default",
+		"table", strconv.Itoa(ExitRouteTable), "metric", strconv.Itoa(ExitKillSwitchMetric)}
+}
+
+func (k iprouteExitKernel) setKillSwitch(ctx context.Context, family string, on bool) error {
+	action := "del"
+	if on {
+		action = "replace"
+	}
+	_, err := k.ip(ctx, killSwitchArgs(family, action)...)
+	return err
+}
+
+func (k iprouteExitKernel) hasKillSwitch(ctx context.Context, family string) (bool, error) {
+	out, err := k.ip(ctx, family, "route", "show", "table", strconv.Itoa(ExitRouteTable))
+	if err != nil {
+		return false, err
+	}
+	return hasKillSwitchRoute(string(out)), nil
+}
+
+func (k iprouteExitKernel) neighbours(ctx context.Context) (map[string][]netip.Addr, error) {
+	out, err := k.ip(ctx, "neigh", "show")
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbours(string(out)), nil
+}
+
+func (k iprouteExitKernel) flushConntrack(ctx context.Context) error {
+	if out, err := k.run(ctx, "conntrack", "-F"); err != nil {
+		return fmt.Errorf("conntrack -F: %w (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func parseRules(output, family string) []exitRule {
+	var rules []exitRule
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	lookupStr := fmt.Sprintf("lookup %d", ExitRouteTable)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, lookupStr) {
+			continue
+		}
+		prio, ok := parseRulePriority(line)
+		if !ok || prio < ExitRuleBasePrio || prio > ExitRuleMaxPrio {
+			continue
+		}
+		rules = append(rules, exitRule{
+			Priority: prio,
+			Family:   family,
+			Src:      parseRuleFrom(line),
+			Iif:      parseRuleIif(line),
+			Dst:      parseRuleSelector(line, "to "),
+			Fwmark:   parseRuleSelector(line, "fwmark "),
+		})
+	}
+	return rules
+}
+
+func parseRulePriority(line string) (int, bool) {
+	idx := strings.IndexByte(line, ':')
+	if idx <= 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[:idx]))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseRuleFrom(line string) string {
+	const fromPrefix = "from "
+	idx := strings.Index(line, fromPrefix)
+	if idx < 0 {
+		return ""
+	}
+	rest := line[idx+len(fromPrefix):]
+	end := strings.IndexByte(rest, ' ')
+	if end < 0 {
+		return rest
+	}
+	src := rest[:end]
+	if src == "all" {
+		return ""
+	}
+	return src
+}
+
+func parseRuleIif(line string) string {
+	return parseRuleSelector(line, "iif ")
+}
+
+// parseRuleSelector returns the value following prefix (e.g. "to ") in an
+// `ip rule show` line, or "" when the line has no such selector.
+func parseRuleSelector(line, prefix string) string {
+	idx := strings.Index(line, prefix)
+	if idx < 0 {
+		return ""
+	}
+	rest := line[idx+len(prefix):]
+	end := strings.IndexByte(rest, ' ')
+	if end < 0 {
+		return rest
+	}
+	return rest[:end]
+}
+
+// hasKillSwitchRoute looks for the kill switch in `ip route show table`
+// output, e.g. "unreachable default metric 65535". The metric is matched
+// too, so an unreachable default someone else put there does not count.
+func hasKillSwitchRoute(output string) bool {
+	metric := strconv.Itoa(ExitKillSwitchMetric)
+	sc := bufio.NewScanner(strings.NewReader(output))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || f[0] != "unreachable" || f[1] != "default" {
+			continue
+		}
+		if i := slices.Index(f, "metric"); i > 0 && i+1 < len(f) && f[i+1] == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNeighbours reads `ip neigh show` output and returns the addresses of
+// every entry with a link-layer address, by MAC. FAILED and INCOMPLETE
+// entries have none and drop out on their own.
+func parseNeighbours(data string) map[string][]netip.Addr {
+	out := make(map[string][]netip.Addr)
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || slices.Contains(f, "FAILED") {
+			continue
+		}
+		a, err := netip.ParseAddr(f[0])
+		if err != nil {
+			continue
+		}
+		i := slices.Index(f, "lladdr")
+		if i < 0 || i+1 >= len(f) {
+			continue
+		}
+		mac := strings.ToLower(f[i+1])
+		out[mac] = append(out[mac], a)
+	}
+	return out
+}
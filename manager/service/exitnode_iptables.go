@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// masqRule is a MASQUERADE rule in nat POSTROUTING: traffic leaving through
+// OutIface whose source is outside NotSrc, tagged with Comment.
+type masqRule struct {
+	Family   string // "-4" or "-6"
+	OutIface string
+	NotSrc   string
+	Comment  string
+}
+
+// exitMasqRules are the masquerade rules of the exit node, IPv4 first.
+var exitMasqRules = []masqRule{
+	{Family: "-4", OutIface: tsInterface, NotSrc: tsCGNATv4, Comment: ExitMasqComment},
+	{Family: "-6", OutIface: tsInterface, NotSrc: tsCGNATv6, Comment: ExitMasqComment},
+}
+
+// iptablesMasq is the exitMasq behind iptables(8) and ip6tables(8). The
+// rules stay in iptables rather than a native nftables table so that they
+// sit in the same POSTROUTING chain as the UniFi firewall on firmware still
+// running the legacy backend.
+type iptablesMasq struct {
+	run CmdRunner
+}
+
+func (r masqRule) iptables() string {
+	if r.Family == "-6" {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+func (r masqRule) args(action string) []string {
+	return []string{"-t", "nat", action, "POSTROUTING",
+		"-o", r.OutIface, "!", "-s", r.NotSrc,
+		"-j", "MASQUERADE", "-m", "comment", "--comment", r.Comment}
+}
+
+func (m iptablesMasq) exec(ctx context.Context, r masqRule, action string) error {
+	if out, err := m.run(ctx, r.iptables(), r.args(action)...); err != nil {
+		return fmt.Errorf("%w (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m iptablesMasq) add(ctx context.Context, r masqRule) error   { return m.exec(ctx, r, "-A") }
+func (m iptablesMasq) del(ctx context.Context, r masqRule) error   { return m.exec(ctx, r, "-D") }
+func (m iptablesMasq) check(ctx context.Context, r masqRule) error { return m.exec(ctx, r, "-C") }
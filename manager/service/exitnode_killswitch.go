@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"unifi-tailscale/manager/ops"
+)
+
+// The kill switch is an unreachable default route per family in
+// ExitRouteTable. tailscaled installs its exit route there without a metric,
+// so while an exit node is set the kill switch route is never used. When
+// tailscaled drops the exit route (exit node cleared, daemon restarting),
+// steered traffic hits the unreachable route instead of falling through to
+// the main table and leaving by the WAN. LAN destinations are unaffected:
+// the throw routes tailscaled duplicates into the table match first.
+const ExitKillSwitchMetric = 0xffff
+
+func (s *ExitNodeService) buildKillSwitchOps() []ops.Op {
+	out := []ops.Op{{
+		Name: "add v4 kill switch route",
+		Do: func(ctx context.Context) error {
+			if err := s.kernel.setKillSwitch(ctx, "-4", true); err != nil {
+				return fmt.Errorf("add v4 kill switch route: %w", err)
+			}
+			return nil
+		},
+		Undo: func(ctx context.Context) error {
+			_ = s.kernel.setKillSwitch(ctx, "-4", false)
+			return nil
+		},
+	}}
+	v6Installed := false
+	out = append(out, ops.Op{
+		Name: "add v6 kill switch route (best-effort)",
+		Do: func(ctx context.Context) error {
+			err := s.kernel.setKillSwitch(ctx, "-6", true)
+			if err == nil {
+				v6Installed, s.v6KillSwitchSkipped = true, false
+				return nil
+			}
+			if isIP6Unavailable(err, nil) {
+				slog.Warn("v6 kill switch route (IPv6 unavailable, tolerated)", "err", err)
+				s.v6KillSwitchSkipped = true
+				return nil
+			}
+			return fmt.Errorf("add v6 kill switch route: %w", err)
+		},
+		Undo: func(ctx context.Context) error {
+			if v6Installed {
+				_ = s.kernel.setKillSwitch(ctx, "-6", false)
+			}
+			return nil
+		},
+	})
+	return out
+}
+
+// delKillSwitch removes both kill switch routes, ignoring "absent" errors.
+func (s *ExitNodeService) delKillSwitch(ctx context.Context) {
+	for _, fam := range []string{"-4", "-6"} {
+		_ = s.kernel.setKillSwitch(ctx, fam, false)
+	}
+}
+
+// hasKillSwitch reports whether the kill switch routes are installed. Like
+// hasMasquerade, a v6 failure on a host without IPv6 is not drift, and
+// neither is a v6 route the last install had to skip.
+func (s *ExitNodeService) hasKillSwitch(ctx context.Context) bool {
+	if ok, err := s.kernel.hasKillSwitch(ctx, "-4"); err != nil || !ok {
+		return false
+	}
+	if s.v6KillSwitchSkipped {
+		return true
+	}
+	ok, err := s.kernel.hasKillSwitch(ctx, "-6")
+	if err != nil {
+		return isIP6Unavailable(err, nil)
+	}
+	return ok
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ipctnlMsgCtDelete is IPCTNL_MSG_CT_DELETE from linux/netfilter/nfnetlink_conntrack.h.
+// Sent without a tuple it flushes the conntrack table, as `conntrack -F` does.
+const ipctnlMsgCtDelete = 2
+
+// netlinkExitKernel is the exitKernel over rtnetlink, with conntrack flushed
+// over ctnetlink. Every call dials its own socket, like the other netlink
+// readers in this package; the calls are rare and the sockets cheap.
+type netlinkExitKernel struct{}
+
+func withRtnetlink(fn func(conn *rtnetlink.Conn) error) error {
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return fmt.Errorf("rtnetlink dial: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	return fn(conn)
+}
+
+func netlinkFamily(family string) uint8 {
+	if family == "-6" {
+		return unix.AF_INET6
+	}
+	return unix.AF_INET
+}
+
+func (netlinkExitKernel) addRule(_ context.Context, r exitRule) error {
+	m, err := exitRuleMessage(r)
+	if err != nil {
+		return err
+	}
+	return withRtnetlink(func(conn *rtnetlink.Conn) error {
+		if err := conn.Rule.Add(m); err != nil {
+			return fmt.Errorf("add rule %s prio %d: %w", r.Family, r.Priority, err)
+		}
+		return nil
+	})
+}
+
+// delRule deletes the ExitRouteTable rule at prio. The table is part of the
+// match, so a foreign rule that happens to share the priority is left alone.
+func (netlinkExitKernel) delRule(_ context.Context, family string, prio int) error {
+	table, pref := uint32(ExitRouteTable), uint32(prio)
+	return withRtnetlink(func(conn *rtnetlink.Conn) error {
+		err := conn.Rule.Delete(&rtnetlink.RuleMessage{
+			Family:     netlinkFamily(family),
+			Table:      ExitRouteTable,
+			Attributes: &rtnetlink.RuleAttributes{Table: &table, Priority: &pref},
+		})
+		if err != nil {
+			return fmt.Errorf("delete rule %s prio %d: %w", family, prio, err)
+		}
+		return nil
+	})
+}
+
+func (netlinkExitKernel) listRules(_ context.Context, family string) ([]exitRule, error) {
+	var out []exitRule
+	err := withRtnetlink(func(conn *rtnetlink.Conn) error {
+		msgs, err := conn.Rule.List()
+		if err != nil {
+			return fmt.Errorf("list rules: %w", err)
+		}
+		for _, m := range msgs {
+			if m.Family != netlinkFamily(family) {
+				continue
+			}
+			if r, ok := exitRuleFromMessage(m); ok {
+				out = append(out, r)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// exitRuleMessage is the netlink form of `ip rule add ... lookup
+// ExitRouteTable prio r.Priority`.
+func exitRuleMessage(r exitRule) (*rtnetlink.RuleMessage, error) {
+	table, prio := uint32(ExitRouteTable), uint32(r.Priority)
+	m := &rtnetlink.RuleMessage{
+		Family:     netlinkFamily(r.Family),
+		Table:      ExitRouteTable,
+		Action:     unix.FR_ACT_TO_TBL,
+		Attributes: &rtnetlink.RuleAttributes{Table: &table, Priority: &prio},
+	}
+	if r.Src != "" {
+		ip, bits, err := rulePrefix(r.Src)
+		if err != nil {
+			return nil, err
+		}
+		m.Attributes.Src, m.SrcLength = &ip, bits
+	}
+	if r.Dst != "" {
+		ip, bits, err := rulePrefix(r.Dst)
+		if err != nil {
+			return nil, err
+		}
+		m.Attributes.Dst, m.DstLength = &ip, bits
+	}
+	if r.Iif != "" {
+		iif := r.Iif
+		m.Attributes.IIFName = &iif
+	}
+	if r.Fwmark != "" {
+		mark, mask, err := parseFwmark(r.Fwmark)
+		if err != nil {
+			return nil, err
+		}
+		m.Attributes.FwMark, m.Attributes.FwMask = &mark, &mask
+	}
+	return m, nil
+}
+
+// exitRuleFromMessage reads back a rule of ours, in the form parseRules
+// gives for the same rule in `ip rule show`.
+func exitRuleFromMessage(m rtnetlink.RuleMessage) (exitRule, bool) {
+	prio := int(rulePriority(m))
+	if ruleTable(m) != ExitRouteTable || prio < ExitRuleBasePrio || prio > ExitRuleMaxPrio {
+		return exitRule{}, false
+	}
+	r := exitRule{Priority: prio, Family: "-4"}
+	if m.Family == unix.AF_INET6 {
+		r.Family = "-6"
+	}
+	a := m.Attributes
+	if a.Src != nil && m.SrcLength > 0 {
+		r.Src = rulePrefixString(*a.Src, m.SrcLength)
+	}
+	if a.Dst != nil && m.DstLength > 0 {
+		r.Dst = rulePrefixString(*a.Dst, m.DstLength)
+	}
+	if a.IIFName != nil {
+		r.Iif = *a.IIFName
+	}
+	if a.FwMark != nil {
+		r.Fwmark = formatFwmark(*a.FwMark, derefUint32(a.FwMask))
+	}
+	return r, true
+}
+
+// rulePrefix parses an address or CIDR as given in a policy. The address is
+// kept as written, host bits included, like ip(8) does.
+func rulePrefix(s string) (net.IP, uint8, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return net.IP(p.Addr().AsSlice()), uint8(p.Bits()), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid rule address %q", s)
+	}
+	return net.IP(a.AsSlice()), uint8(a.BitLen()), nil
+}
+
+func rulePrefixString(ip net.IP, bits uint8) string {
+	a, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return ""
+	}
+	return normalizeRuleSrc(netip.PrefixFrom(a.Unmap(), int(bits)).String())
+}
+
+// parseFwmark parses "mark[/mask]" as ip(8) takes it.
+func parseFwmark(s string) (mark, mask uint32, err error) {
+	markStr, maskStr, hasMask := strings.Cut(s, "/")
+	m, err := strconv.ParseUint(markStr, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid fwmark %q", s)
+	}
+	if !hasMask {
+		return uint32(m), 0xffffffff, nil
+	}
+	k, err := strconv.ParseUint(maskStr, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid fwmark mask %q", s)
+	}
+	return uint32(m), uint32(k), nil
+}
+
+// formatFwmark prints a mark the way `ip rule show` does.
+func formatFwmark(mark, mask uint32) string {
+	if mask == 0 || mask == 0xffffffff {
+		return fmt.Sprintf("0x%x", mark)
+	}
+	return fmt.Sprintf("0x%x/0x%x", mark, mask)
+}
+
+// killSwitchRoute is `unreachable default table ExitRouteTable metric
+// ExitKillSwitchMetric`. For a delete the protocol is left open and the
+// scope set to "nowhere", as ip(8) sends them, so a route installed by an
+// older release through ip(8) still matches.
+func killSwitchRoute(family string, del bool) *rtnetlink.RouteMessage {
+	m := &rtnetlink.RouteMessage{
+		Family:   netlinkFamily(family),
+		Table:    ExitRouteTable,
+		Protocol: unix.RTPROT_STATIC,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNREACHABLE,
+		Attributes: rtnetlink.RouteAttributes{
+			Table:    ExitRouteTable,
+			Priority: ExitKillSwitchMetric,
+		},
+	}
+	if del {
+		m.Protocol, m.Scope = unix.RTPROT_UNSPEC, unix.RT_SCOPE_NOWHERE
+	}
+	return m
+}
+
+func isKillSwitchRoute(m rtnetlink.RouteMessage, family string) bool {
+	table := m.Attributes.Table
+	if table == 0 {
+		table = uint32(m.Table)
+	}
+	return m.Family == netlinkFamily(family) && table == ExitRouteTable &&
+		m.Type == unix.RTN_UNREACHABLE && m.DstLength == 0 &&
+		m.Attributes.Priority == ExitKillSwitchMetric
+}
+
+func (netlinkExitKernel) setKillSwitch(_ context.Context, family string, on bool) error {
+	return withRtnetlink(func(conn *rtnetlink.Conn) error {
+		if on {
+			return conn.Route.Replace(killSwitchRoute(family, false))
+		}
+		return conn.Route.Delete(killSwitchRoute(family, true))
+	})
+}
+
+// ipv6ProcPath only exists while the kernel has an IPv6 stack.
+var ipv6ProcPath = "/proc/net/if_inet6"
+
+// hasKillSwitch lists routes of every family, which succeeds without IPv6
+// too. A v6 query on such a host fails with EAFNOSUPPORT instead, as `ip -6
+// route show` does, so isIP6Unavailable can tell it from a missing route.
+func (netlinkExitKernel) hasKillSwitch(_ context.Context, family string) (bool, error) {
+	if family == "-6" {
+		if _, err := os.Stat(ipv6ProcPath); errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("list v6 routes: %w", unix.EAFNOSUPPORT)
+		}
+	}
+	found := false
+	err := withRtnetlink(func(conn *rtnetlink.Conn) error {
+		routes, err := conn.Route.List()
+		if err != nil {
+			return fmt.Errorf("list routes: %w", err)
+		}
+		for _, rt := range routes {
+			if isKillSwitchRoute(rt, family) {
+				found = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// neighbours returns the neighbour table by lowercase MAC. Entries without a
+// link-layer address, and FAILED or INCOMPLETE ones, are left out.
+func (netlinkExitKernel) neighbours(_ context.Context) (map[string][]netip.Addr, error) {
+	var msgs []rtnetlink.NeighMessage
+	err := withRtnetlink(func(conn *rtnetlink.Conn) error {
+		var err error
+		msgs, err = conn.Neigh.List()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list neighbours: %w", err)
+	}
+	return neighboursFromMessages(msgs), nil
+}
+
+func neighboursFromMessages(msgs []rtnetlink.NeighMessage) map[string][]netip.Addr {
+	out := make(map[string][]netip.Addr)
+	for _, m := range msgs {
+		if m.Attributes == nil || len(m.Attributes.LLAddress) == 0 ||
+			m.State&(unix.NUD_FAILED|unix.NUD_INCOMPLETE) != 0 {
+			continue
+		}
+		a, ok := netip.AddrFromSlice(m.Attributes.Address)
+		if !ok {
+			continue
+		}
+		mac := strings.ToLower(m.Attributes.LLAddress.String())
+		out[mac] = append(out[mac], a.Unmap())
+	}
+	return out
+}
+
+func (netlinkExitKernel) flushConntrack(_ context.Context) error {
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return fmt.Errorf("ctnetlink dial: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(unix.NFNL_SUBSYS_CTNETLINK<<8 | ipctnlMsgCtDelete),
+			Flags: netlink.Request | netlink.Acknowledge,
+		},
+		// struct nfgenmsg: AF_UNSPEC covers both families.
+		Data: []byte{unix.AF_UNSPEC, unix.NFNETLINK_V0, 0, 0},
+	})
+	if err != nil {
+		return fmt.Errorf("ctnetlink flush: %w", err)
+	}
+	return nil
+}
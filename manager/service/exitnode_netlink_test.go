@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"unifi-tailscale/manager/domain"
+)
+
+func TestExitRuleMessageRoundTrip(t *testing.T) {
+	for _, r := range []exitRule{
+		{Priority: 5290, Family: "-4", Iif: "br0"},
+		{Priority: 5291, Family: "-4", Src: "192.168.1.10"},
+		{Priority: 5292, Family: "-4", Src: "192.168.20.0/24"},
+		{Priority: 5293, Family: "-6", Src: "fd00:1::/64"},
+		{Priority: 5294, Family: "-4", Dst: "203.0.113.0/24"},
+		{Priority: ExitRuleBasePrio, Family: "-6", Fwmark: "0x1000000/0x1000000"},
+		{Priority: 5295, Family: "-4", Fwmark: "0x10"},
+	} {
+		m, err := exitRuleMessage(r)
+		require.NoError(t, err, "%+v", r)
+		got, ok := exitRuleFromMessage(*m)
+		require.True(t, ok, "%+v", r)
+		assert.Equal(t, r, got)
+	}
+}
+
+func TestExitRuleFromMessageIgnoresForeignRules(t *testing.T) {
+	r, err := exitRuleMessage(exitRule{Priority: 5290, Family: "-4", Iif: "br0"})
+	require.NoError(t, err)
+
+	foreign := *r
+	table := uint32(201)
+	foreign.Table, foreign.Attributes = 201, &rtnetlink.RuleAttributes{
+		Table: &table, Priority: r.Attributes.Priority,
+	}
+	_, ok := exitRuleFromMessage(foreign)
+	assert.False(t, ok, "rule in another table")
+
+	low := *r
+	prio := uint32(ExitRuleBasePrio - 1)
+	low.Attributes = &rtnetlink.RuleAttributes{Table: r.Attributes.Table, Priority: &prio}
+	_, ok = exitRuleFromMessage(low)
+	assert.False(t, ok, "rule below the exit node range")
+}
+
+func TestExitRuleMessageRejectsBadInput(t *testing.T) {
+	_, err := exitRuleMessage(exitRule{Priority: 5290, Family: "-4", Src: "not-an-ip"})
+	assert.Error(t, err)
+	_, err = exitRuleMessage(exitRule{Priority: 5290, Family: "-4", Fwmark: "0x10/zz"})
+	assert.Error(t, err)
+}
+
+func TestIsKillSwitchRoute(t *testing.T) {
+	rt := *killSwitchRoute("-6", false)
+	assert.True(t, isKillSwitchRoute(rt, "-6"))
+	assert.False(t, isKillSwitchRoute(rt, "-4"))
+
+	other := rt
+	other.Attributes.Priority = 100
+	assert.False(t, isKillSwitchRoute(other, "-6"), "different metric")
+
+	del := killSwitchRoute("-4", true)
+	assert.Equal(t, uint8(unix.RTPROT_UNSPEC), del.Protocol)
+	assert.Equal(t, uint8(unix.RT_SCOPE_NOWHERE), del.Scope)
+}
+
+func TestNeighboursFromMessages(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22}
+	got := neighboursFromMessages([]rtnetlink.NeighMessage{
+		{State: unix.NUD_REACHABLE, Attributes: &rtnetlink.NeighAttributes{Address: net.ParseIP("192.168.1.10"), LLAddress: mac}},
+		{State: unix.NUD_STALE, Attributes: &rtnetlink.NeighAttributes{Address: net.ParseIP("fd00::10"), LLAddress: mac}},
+		{State: unix.NUD_FAILED, Attributes: &rtnetlink.NeighAttributes{Address: net.ParseIP("192.168.1.11"), LLAddress: mac}},
+		{State: unix.NUD_INCOMPLETE, Attributes: &rtnetlink.NeighAttributes{Address: net.ParseIP("192.168.1.12")}},
+	})
+	assert.Equal(t, map[string][]netip.Addr{
+		"aa:bb:cc:00:11:22": {netip.MustParseAddr("192.168.1.10"), netip.MustParseAddr("fd00::10")},
+	}, got)
+}
+
+// fakeExitKernel is an in-memory exitKernel. With noIPv6 it refuses v6
+// routes but, like a route dump across all families, still lists none.
+type fakeExitKernel struct {
+	rules      []exitRule
+	killSwitch map[string]bool
+	flushes    int
+	noIPv6     bool
+}
+
+func (k *fakeExitKernel) addRule(_ context.Context, r exitRule) error {
+	if slices.ContainsFunc(k.rules, func(x exitRule) bool { return x.Family == r.Family && x.Priority == r.Priority }) {
+		return errors.New("file exists")
+	}
+	k.rules = append(k.rules, r)
+	return nil
+}
+
+func (k *fakeExitKernel) delRule(_ context.Context, family string, prio int) error {
+	n := len(k.rules)
+	k.rules = slices.DeleteFunc(k.rules, func(x exitRule) bool { return x.Family == family && x.Priority == prio })
+	if len(k.rules) == n {
+		return errors.New("no such file or directory")
+	}
+	return nil
+}
+
+func (k *fakeExitKernel) listRules(_ context.Context, family string) ([]exitRule, error) {
+	var out []exitRule
+	for _, r := range k.rules {
+		if r.Family == family {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (k *fakeExitKernel) setKillSwitch(_ context.Context, family string, on bool) error {
+	if k.noIPv6 && family == "-6" {
+		return unix.EAFNOSUPPORT
+	}
+	k.killSwitch[family] = on
+	return nil
+}
+
+func (k *fakeExitKernel) hasKillSwitch(_ context.Context, family string) (bool, error) {
+	return k.killSwitch[family], nil
+}
+
+func (k *fakeExitKernel) neighbours(context.Context) (map[string][]netip.Addr, error) {
+	return nil, nil
+}
+
+func (k *fakeExitKernel) flushConntrack(context.Context) error {
+	k.flushes++
+	return nil
+}
+
+// fakeMasq is an in-memory exitMasq.
+type fakeMasq map[masqRule]bool
+
+func (m fakeMasq) add(_ context.Context, r masqRule) error { m[r] = true; return nil }
+
+func (m fakeMasq) del(_ context.Context, r masqRule) error {
+	if !m[r] {
+		return errors.New("bad rule")
+	}
+	delete(m, r)
+	return nil
+}
+
+func (m fakeMasq) check(_ context.Context, r masqRule) error {
+	if !m[r] {
+		return errors.New("bad rule")
+	}
+	return nil
+}
+
+func TestExitNodeOverFakeKernel(t *testing.T) {
+	// Only the domain match, which stays on ipset and the mangle table, may
+	// still reach for a command; its teardown runs on every cleanup.
+	svc := NewExitNodeService(&mockExitManifest{}, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if name == "ipset" || slices.Contains(args, "mangle") {
+			return nil, errors.New("does not exist")
+		}
+		t.Fatalf("unexpected command: %s %v", name, args)
+		return nil, nil
+	})
+	kernel := &fakeExitKernel{killSwitch: map[string]bool{}}
+	masq := fakeMasq{}
+	svc.kernel, svc.masq = kernel, masq
+
+	policy := domain.ExitNodePolicy{
+		Mode:       domain.ExitNodeSelective,
+		Clients:    []domain.ExitNodeClient{{IP: "192.168.1.10"}, {IP: "fd00:1::/64"}},
+		KillSwitch: true,
+	}
+	ctx := context.Background()
+	require.NoError(t, svc.Apply(ctx, policy))
+	assert.Equal(t, []exitRule{
+		{Priority: ExitRuleBasePrio + 1, Family: "-4", Src: "192.168.1.10"},
+		{Priority: ExitRuleBasePrio + 2, Family: "-6", Src: "fd00:1::/64"},
+	}, kernel.rules)
+	assert.Len(t, masq, 2)
+	assert.Equal(t, map[string]bool{"-4": true, "-6": true}, kernel.killSwitch)
+
+	// Drift: a rule vanishes behind our back.
+	kernel.rules = kernel.rules[:1]
+	require.NoError(t, svc.Reconcile(ctx, policy))
+	assert.Len(t, kernel.rules, 2)
+
+	require.NoError(t, svc.Cleanup(ctx))
+	assert.Empty(t, kernel.rules)
+	assert.Empty(t, masq)
+	assert.Equal(t, map[string]bool{"-4": false, "-6": false}, kernel.killSwitch)
+	assert.Positive(t, kernel.flushes)
+}
+
+func TestExitNodeKillSwitchWithoutIPv6IsNotDrift(t *testing.T) {
+	svc := NewExitNodeService(&mockExitManifest{}, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		return nil, errors.New("does not exist")
+	})
+	kernel := &fakeExitKernel{killSwitch: map[string]bool{}, noIPv6: true}
+	svc.kernel, svc.masq = kernel, fakeMasq{}
+
+	policy := domain.ExitNodePolicy{
+		Mode:       domain.ExitNodeSelective,
+		Clients:    []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+		KillSwitch: true,
+	}
+	ctx := context.Background()
+	require.NoError(t, svc.Apply(ctx, policy))
+	assert.Equal(t, map[string]bool{"-4": true}, kernel.killSwitch)
+
+	flushes := kernel.flushes
+	require.NoError(t, svc.Reconcile(ctx, policy))
+	assert.Equal(t, flushes, kernel.flushes, "a skipped v6 route must not be re-applied")
+
+	kernel.killSwitch["-4"] = false
+	require.NoError(t, svc.Reconcile(ctx, policy))
+	assert.True(t, kernel.killSwitch["-4"], "a missing v4 route is still drift")
+}
+
+func TestNetlinkHasKillSwitchWithoutIPv6(t *testing.T) {
+	old := ipv6ProcPath
+	ipv6ProcPath = filepath.Join(t.TempDir(), "if_inet6")
+	t.Cleanup(func() { ipv6ProcPath = old })
+
+	_, err := netlinkExitKernel{}.hasKillSwitch(context.Background(), "-6")
+	require.ErrorIs(t, err, unix.EAFNOSUPPORT)
+	assert.True(t, isIP6Unavailable(err, nil))
+}
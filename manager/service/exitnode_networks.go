@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"slices"
+
+	"unifi-tailscale/manager/domain"
+)
+
+// Networks mode sends whole UniFi Networks through the remote exit node.
+// Each selected network interface (e.g. "br20" for a Guest VLAN) gets one
+// rule per subnet the controller assigned it, matching both the source
+// subnet and the input interface: the subnet keeps the rule as narrow as
+// the network, and iif keeps the router's own traffic from that subnet's
+// gateway address on the local WAN. The rules are derived from the subnet
+// list on every Reconcile, so a renumbered network is picked up on the
+// next udapi-net-cfg.json change or poll.
+
+var exitNetworkRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,14}$`)
+
+func (s *ExitNodeService) localSubnets() []SubnetEntry {
+	if s.subnets == nil {
+		return nil
+	}
+	return s.subnets()
+}
+
+// networkRules returns the rules for the subnets of the listed network
+// interfaces, in the order the networks are listed. Networks without a
+// subnet are logged and skipped.
+func networkRules(networks []string, subnets []SubnetEntry) []exitRule {
+	var rules []exitRule
+	prio := ExitRuleBasePrio + 1
+	for _, iface := range networks {
+		found := false
+		for _, sn := range subnets {
+			if sn.Iface != iface {
+				continue
+			}
+			p, err := netip.ParsePrefix(sn.CIDR)
+			if err != nil {
+				continue
+			}
+			found = true
+			if prio > ExitRuleMaxPrio {
+				slog.Warn("exit node network subnet limit reached", "max", ExitRuleMaxPrio-ExitRuleBasePrio)
+				return rules
+			}
+			rules = append(rules, exitRule{
+				Priority: prio,
+				Family:   familyForAddr(sn.CIDR),
+				Src:      normalizeRuleSrc(p.Masked().String()),
+				Iif:      iface,
+			})
+			prio++
+		}
+		if !found {
+			slog.Warn("exit network has no subnet", "network", iface)
+		}
+	}
+	return rules
+}
+
+func validateExitNetworks(policy domain.ExitNodePolicy) error {
+	if len(policy.Networks) == 0 {
+		return validationError("networks mode needs at least one network")
+	}
+	if len(policy.Networks) > maxExitClients {
+		return validationError(fmt.Sprintf("too many exit networks: %d (max %d)", len(policy.Networks), maxExitClients))
+	}
+	for i, n := range policy.Networks {
+		if !exitNetworkRe.MatchString(n) {
+			return validationError(fmt.Sprintf("invalid network interface: %q", n))
+		}
+		if slices.Contains(policy.Networks[:i], n) {
+			return validationError(fmt.Sprintf("duplicate network: %s", n))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/domain"
+)
+
+const (
+	maxExitSchedules    = 16
+	maxExitScheduleCron = 8
+	maxExitScheduleName = 64
+)
+
+// cronField is the set of values one cron field matches, as a bitmask.
+type cronField uint64
+
+func (f cronField) has(v int) bool { return f&(1<<uint(v)) != 0 }
+
+// cronSpec is a parsed five-field cron expression. As in Vixie cron, when
+// neither day of month nor day of week starts with "*" a day matching either
+// counts; otherwise a day must match both, so "*/2" still restricts.
+type cronSpec struct {
+	minute, hour, dom, month, dow cronField
+	domAny, dowAny                bool
+}
+
+var (
+	cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+func parseCron(expr string) (cronSpec, error) {
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return cronSpec{}, fmt.Errorf("want 5 fields, got %d", len(f))
+	}
+	var c cronSpec
+	var err error
+	if c.minute, err = parseCronField(f[0], 0, 59, nil); err != nil {
+		return cronSpec{}, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23, nil); err != nil {
+		return cronSpec{}, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31, nil); err != nil {
+		return cronSpec{}, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(f[3], 1, 12, cronMonths); err != nil {
+		return cronSpec{}, fmt.Errorf("month: %w", err)
+	}
+	// 7 is Sunday too.
+	if c.dow, err = parseCronField(f[4], 0, 7, cronDays); err != nil {
+		return cronSpec{}, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow.has(7) {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = strings.HasPrefix(f[2], "*"), strings.HasPrefix(f[4], "*")
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "n", "a-b", each
+// optionally followed by "/step". names, when given, are accepted for the
+// values starting at lo ("jan" is 1, "sun" is 0).
+func parseCronField(s string, lo, hi int, names []string) (cronField, error) {
+	value := func(v string) (int, error) {
+		if i := slices.Index(names, strings.ToLower(v)); i >= 0 {
+			return lo + i, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", v, lo, hi)
+		}
+		return n, nil
+	}
+	var out cronField
+	for part := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = value(a); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = value(b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = hi
+			}
+			if end < start {
+				return 0, fmt.Errorf("range %q runs backwards", rng)
+			}
+		}
+		for v := start; v <= end; v += step {
+			out |= 1 << uint(v)
+		}
+	}
+	return out, nil
+}
+
+func (c cronSpec) matches(t time.Time) bool {
+	if !c.minute.has(t.Minute()) || !c.hour.has(t.Hour()) || !c.month.has(int(t.Month())) {
+		return false
+	}
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// scheduleActive reports whether sch covers now, in local time. Expressions
+// that do not parse never match; they are rejected on save.
+func scheduleActive(sch domain.ExitSchedule, now time.Time) bool {
+	now = now.Local()
+	for _, expr := range sch.Cron {
+		if c, err := parseCron(expr); err == nil && c.matches(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduled applies the schedules to policy at now. It reports whether the
+// policy routes anything at all, and returns the clients whose own schedule
+// is active. A schedule that no longer exists is never active.
+func (s *ExitNodeService) scheduled(policy domain.ExitNodePolicy, now time.Time) (bool, []domain.ExitNodeClient) {
+	hasClientSchedule := slices.ContainsFunc(policy.Clients, func(c domain.ExitNodeClient) bool { return c.Schedule != "" })
+	if policy.Schedule == "" && !hasClientSchedule {
+		return true, policy.Clients
+	}
+	schedules := s.manifest.GetExitSchedules()
+	active := func(id string) bool {
+		i := slices.IndexFunc(schedules, func(sch domain.ExitSchedule) bool { return sch.ID == id })
+		if i < 0 {
+			slog.Warn("exit node schedule not found", "schedule", id)
+			return false
+		}
+		return scheduleActive(schedules[i], now)
+	}
+	if policy.Schedule != "" && !active(policy.Schedule) {
+		return false, nil
+	}
+	if !hasClientSchedule {
+		return true, policy.Clients
+	}
+	var clients []domain.ExitNodeClient
+	for _, c := range policy.Clients {
+		if c.Schedule == "" || active(c.Schedule) {
+			clients = append(clients, c)
+		}
+	}
+	return true, clients
+}
+
+// ExitScheduleStatus is a schedule with whether it is active right now.
+type ExitScheduleStatus struct {
+	domain.ExitSchedule
+	Active bool `json:"active"`
+}
+
+func (s *ExitNodeService) ListSchedules(now time.Time) []ExitScheduleStatus {
+	schedules := s.manifest.GetExitSchedules()
+	out := make([]ExitScheduleStatus, 0, len(schedules))
+	for _, sch := range schedules {
+		out = append(out, ExitScheduleStatus{ExitSchedule: sch, Active: scheduleActive(sch, now)})
+	}
+	return out
+}
+
+func (s *ExitNodeService) CreateSchedule(sch domain.ExitSchedule) (domain.ExitSchedule, error) {
+	sch.Name = strings.TrimSpace(sch.Name)
+	if err := validateExitSchedule(sch); err != nil {
+		return domain.ExitSchedule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := s.manifest.GetExitSchedules()
+	if len(schedules) >= maxExitSchedules {
+		return domain.ExitSchedule{}, validationError(fmt.Sprintf("too many exit schedules (max %d)", maxExitSchedules))
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return domain.ExitSchedule{}, fmt.Errorf("crypto/rand failed: %w", err)
+	}
+	sch.ID = fmt.Sprintf("%x", b)
+	if err := s.manifest.SetExitSchedules(append(schedules, sch)); err != nil {
+		return domain.ExitSchedule{}, err
+	}
+	return sch, nil
+}
+
+func (s *ExitNodeService) UpdateSchedule(id string, sch domain.ExitSchedule) (domain.ExitSchedule, error) {
+	sch.Name = strings.TrimSpace(sch.Name)
+	if err := validateExitSchedule(sch); err != nil {
+		return domain.ExitSchedule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := s.manifest.GetExitSchedules()
+	i := slices.IndexFunc(schedules, func(x domain.ExitSchedule) bool { return x.ID == id })
+	if i < 0 {
+		return domain.ExitSchedule{}, notFoundError(fmt.Sprintf("exit schedule %s not found", id))
+	}
+	sch.ID = id
+	schedules[i] = sch
+	if err := s.manifest.SetExitSchedules(schedules); err != nil {
+		return domain.ExitSchedule{}, err
+	}
+	return sch, nil
+}
+
+// DeleteSchedule removes a schedule the exit node policy does not use.
+func (s *ExitNodeService) DeleteSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := s.manifest.GetExitSchedules()
+	i := slices.IndexFunc(schedules, func(x domain.ExitSchedule) bool { return x.ID == id })
+	if i < 0 {
+		return notFoundError(fmt.Sprintf("exit schedule %s not found", id))
+	}
+	if usesSchedule(s.manifest.GetExitNodePolicy(), id) {
+		return conflictError(fmt.Sprintf("exit schedule %q is in use by the exit node policy", schedules[i].Name))
+	}
+	return s.manifest.SetExitSchedules(slices.Delete(schedules, i, i+1))
+}
+
+func usesSchedule(policy domain.ExitNodePolicy, id string) bool {
+	return policy.Schedule == id ||
+		slices.ContainsFunc(policy.Clients, func(c domain.ExitNodeClient) bool { return c.Schedule == id })
+}
+
+// ValidateScheduleRefs checks that every schedule policy names exists.
+func (s *ExitNodeService) ValidateScheduleRefs(policy domain.ExitNodePolicy) error {
+	schedules := s.manifest.GetExitSchedules()
+	known := func(id string) bool {
+		return slices.ContainsFunc(schedules, func(sch domain.ExitSchedule) bool { return sch.ID == id })
+	}
+	if policy.Schedule != "" && !known(policy.Schedule) {
+		return validationError(fmt.Sprintf("unknown exit schedule: %s", policy.Schedule))
+	}
+	for _, c := range policy.Clients {
+		if c.Schedule != "" && !known(c.Schedule) {
+			return validationError(fmt.Sprintf("unknown exit schedule: %s", c.Schedule))
+		}
+	}
+	return nil
+}
+
+func validateExitSchedule(sch domain.ExitSchedule) error {
+	if sch.Name == "" || len(sch.Name) > maxExitScheduleName {
+		return validationError(fmt.Sprintf("schedule name must be 1-%d characters", maxExitScheduleName))
+	}
+	if len(sch.Cron) == 0 || len(sch.Cron) > maxExitScheduleCron {
+		return validationError(fmt.Sprintf("schedule needs 1-%d cron expressions", maxExitScheduleCron))
+	}
+	for _, expr := range sch.Cron {
+		if _, err := parseCron(expr); err != nil {
+			return validationError(fmt.Sprintf("invalid cron expression %q: %v", expr, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/domain"
+)
+
+// at returns a local time in the week of Monday 2026-03-02.
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 3, 2+day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", at(0, 3, 17), true},
+		{"* 8-14 * * mon-fri", at(0, 8, 0), true},
+		{"* 8-14 * * mon-fri", at(0, 14, 59), true},
+		{"* 8-14 * * mon-fri", at(0, 15, 0), false},
+		{"* 8-14 * * mon-fri", at(5, 10, 0), false}, // Saturday
+		{"*/15 * * * *", at(0, 9, 30), true},
+		{"*/15 * * * *", at(0, 9, 31), false},
+		{"5/20 * * * *", at(0, 9, 45), true},
+		{"0,30 22 * * *", at(0, 22, 30), true},
+		{"* * * mar *", at(0, 0, 0), true},
+		{"* * * 4 *", at(0, 0, 0), false},
+		{"* * * * 7", at(6, 12, 0), true}, // 7 is Sunday
+		{"* * * * SUN", at(6, 12, 0), true},
+		// dom and dow both restricted: either one matches.
+		{"* * 15 * mon", at(0, 12, 0), true},
+		{"* * 2 * fri", at(0, 12, 0), true},
+		{"* * 15 * fri", at(0, 12, 0), false},
+		// A field starting with "*" is unrestricted for that rule, so a
+		// stepped day of month is ANDed with the day of week.
+		{"0 8 */2 * 1-5", at(1, 8, 0), true},  // Tuesday the 3rd
+		{"0 8 */2 * 1-5", at(0, 8, 0), false}, // Monday the 2nd
+		{"0 8 */2 * 1-5", at(5, 8, 0), false}, // Saturday the 7th
+		{"0 8 * * */2", at(6, 8, 0), true},    // Sunday
+		{"0 8 * * */2", at(0, 8, 0), false},   // Monday
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c.matches(tt.t), "%s at %s", tt.expr, tt.t)
+		})
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "10-5 * * * *", "* * * * funday",
+	} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func newScheduledService(t *testing.T, now time.Time, schedules ...domain.ExitSchedule) (*ExitNodeService, *fakeIPRuleState, *mockExitManifest) {
+	t.Helper()
+	state := newFakeIPRuleState()
+	manifest := &mockExitManifest{schedules: schedules}
+	svc := NewExitNodeService(manifest, state.runner())
+	svc.now = func() time.Time { return now }
+	return svc, state, manifest
+}
+
+var workHours = domain.ExitSchedule{ID: "work", Name: "Work hours", Cron: []string{"* 8-16 * * mon-fri"}}
+
+func TestApplyOutsideScheduleInstallsNothing(t *testing.T) {
+	svc, state, manifest := newScheduledService(t, at(5, 10, 0), workHours)
+	policy := domain.ExitNodePolicy{
+		Mode:     domain.ExitNodeSelective,
+		Clients:  []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+		Schedule: "work",
+	}
+
+	require.NoError(t, svc.Apply(context.Background(), policy))
+	assert.Equal(t, 0, state.ruleCount())
+	assert.Equal(t, 0, state.masqCount())
+	assert.Equal(t, policy, manifest.policy, "the policy must be kept for when the schedule opens")
+}
+
+func TestReconcileFollowsSchedule(t *testing.T) {
+	svc, state, _ := newScheduledService(t, at(0, 7, 59), workHours)
+	policy := domain.ExitNodePolicy{
+		Mode:     domain.ExitNodeSelective,
+		Clients:  []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+		Schedule: "work",
+	}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+	require.Equal(t, 0, state.ruleCount())
+
+	svc.now = func() time.Time { return at(0, 8, 0) }
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, 1, state.ruleCount(), "rules must go in when the schedule opens")
+	assert.Equal(t, 2, state.masqCount())
+
+	svc.now = func() time.Time { return at(0, 17, 0) }
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, 0, state.ruleCount(), "rules must come out when the schedule closes")
+	assert.Equal(t, 0, state.masqCount())
+}
+
+func TestScheduledPerClient(t *testing.T) {
+	svc, _, _ := newScheduledService(t, time.Time{}, workHours)
+	policy := domain.ExitNodePolicy{
+		Mode: domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{
+			{IP: "192.168.1.10", Label: "always"},
+			{IP: "192.168.1.11", Label: "work", Schedule: "work"},
+			{IP: "192.168.1.12", Label: "gone", Schedule: "deleted"},
+		},
+	}
+
+	active, clients := svc.scheduled(policy, at(1, 9, 0))
+	assert.True(t, active)
+	assert.Equal(t, policy.Clients[:2], clients)
+
+	active, clients = svc.scheduled(policy, at(1, 20, 0))
+	assert.True(t, active)
+	assert.Equal(t, policy.Clients[:1], clients)
+}
+
+func TestExitScheduleCRUD(t *testing.T) {
+	svc, _, manifest := newScheduledService(t, at(0, 9, 0))
+
+	_, err := svc.CreateSchedule(domain.ExitSchedule{Name: "bad", Cron: []string{"* * *"}})
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrValidation, se.Kind)
+
+	sch, err := svc.CreateSchedule(domain.ExitSchedule{Name: " Evenings ", Cron: []string{"* 18-22 * * *"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, sch.ID)
+	assert.Equal(t, "Evenings", sch.Name)
+
+	list := svc.ListSchedules(at(0, 19, 0))
+	require.Len(t, list, 1)
+	assert.True(t, list[0].Active)
+
+	_, err = svc.UpdateSchedule(sch.ID, domain.ExitSchedule{Name: "Evenings", Cron: []string{"* 17-23 * * *"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"* 17-23 * * *"}, manifest.schedules[0].Cron)
+	_, err = svc.UpdateSchedule("missing", sch)
+	assert.Error(t, err)
+
+	manifest.policy = domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{{IP: "192.168.1.10", Schedule: sch.ID}},
+	}
+	require.True(t, errors.As(svc.DeleteSchedule(sch.ID), &se))
+	assert.Equal(t, ErrConflict, se.Kind, "a schedule in use must not be deleted")
+
+	manifest.policy = domain.ExitNodePolicy{}
+	require.NoError(t, svc.DeleteSchedule(sch.ID))
+	assert.Empty(t, manifest.schedules)
+}
+
+func TestValidateScheduleRefs(t *testing.T) {
+	svc, _, _ := newScheduledService(t, time.Time{}, workHours)
+
+	assert.NoError(t, svc.ValidateScheduleRefs(domain.ExitNodePolicy{Schedule: "work"}))
+	assert.Error(t, svc.ValidateScheduleRefs(domain.ExitNodePolicy{Schedule: "nope"}))
+	assert.Error(t, svc.ValidateScheduleRefs(domain.ExitNodePolicy{
+		Clients: []domain.ExitNodeClient{{IP: "192.168.1.10", Schedule: "nope"}},
+	}))
+}
@@ -3,9 +3,14 @@ package service
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,8 +19,9 @@ import (
 )
 
 type mockExitManifest struct {
-	mu     sync.Mutex
-	policy domain.ExitNodePolicy
+	mu        sync.Mutex
+	policy    domain.ExitNodePolicy
+	schedules []domain.ExitSchedule
 }
 
 func (m *mockExitManifest) GetExitNodePolicy() domain.ExitNodePolicy {
@@ -31,11 +37,28 @@ func (m *mockExitManifest) SetExitNodePolicy(p domain.ExitNodePolicy) error {
 	return nil
 }
 
+func (m *mockExitManifest) GetExitSchedules() []domain.ExitSchedule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.schedules)
+}
+
+func (m *mockExitManifest) SetExitSchedules(s []domain.ExitSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedules = slices.Clone(s)
+	return nil
+}
+
 type fakeIPRuleState struct {
 	mu        sync.Mutex
 	rules     map[string][]string // family -> list of rule lines
 	cmds      []string
 	masqRules map[string]bool // "iptables" / "ip6tables" -> exists
+	markRules map[string]bool // mangle rules, keyed like masqRules
+	ipsets    map[string][]string
+	neigh     string          // `ip neigh show` output
+	routes    map[string]bool // family -> kill switch route present
 
 	// failOnNthAdd: if > 0, the Nth "add" call (ip rule add or iptables -A)
 	// returns an error. The state mutation is NOT applied for the failing call.
@@ -49,6 +72,9 @@ func newFakeIPRuleState() *fakeIPRuleState {
 	return &fakeIPRuleState{
 		rules:     map[string][]string{"-4": {}, "-6": {}},
 		masqRules: make(map[string]bool),
+		markRules: make(map[string]bool),
+		ipsets:    make(map[string][]string),
+		routes:    make(map[string]bool),
 	}
 }
 
@@ -66,6 +92,15 @@ func (f *fakeIPRuleState) runner() CmdRunner {
 		if name == "iptables" || name == "ip6tables" {
 			return f.handleIptablesLocked(name, args)
 		}
+		if name == "ipset" {
+			return f.handleIpsetLocked(args)
+		}
+		if len(args) > 0 && args[0] == "neigh" {
+			return []byte(f.neigh), nil
+		}
+		if len(args) > 2 && args[1] == "route" {
+			return f.handleRouteLocked(args[0], args[2])
+		}
 
 		if len(args) < 3 {
 			return nil, fmt.Errorf("too few args")
@@ -112,8 +147,20 @@ func buildFakeRuleLine(args []string) string {
 	src := "all"
 	lookup := ""
 	iif := ""
+	to := ""
+	fwmark := ""
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "to":
+			if i+1 < len(args) {
+				to = args[i+1]
+				i++
+			}
+		case "fwmark":
+			if i+1 < len(args) {
+				fwmark = args[i+1]
+				i++
+			}
 		case "prio":
 			if i+1 < len(args) {
 				prio = args[i+1]
@@ -137,6 +184,12 @@ func buildFakeRuleLine(args []string) string {
 		}
 	}
 	line := fmt.Sprintf("%s:\tfrom %s", prio, src)
+	if to != "" {
+		line += fmt.Sprintf(" to %s", normalizeRuleSrc(to))
+	}
+	if fwmark != "" {
+		line += fmt.Sprintf(" fwmark %s", fwmark)
+	}
 	if iif != "" {
 		line += fmt.Sprintf(" iif %s", iif)
 	}
@@ -155,12 +208,18 @@ func extractPrio(args []string) string {
 
 func (f *fakeIPRuleState) handleIptablesLocked(cmd string, args []string) ([]byte, error) {
 	action := ""
+	mangle := false
 	for _, a := range args {
 		switch a {
 		case "-A", "-D", "-C":
 			action = a
+		case "mangle":
+			mangle = true
 		}
 	}
+	if mangle {
+		return f.handleMarkLocked(cmd, action)
+	}
 	switch action {
 	case "-A":
 		if cmd == "ip6tables" && f.failIP6Add {
@@ -189,6 +248,64 @@ func (f *fakeIPRuleState) handleIptablesLocked(cmd string, args []string) ([]byt
 	}
 }
 
+func (f *fakeIPRuleState) handleMarkLocked(cmd, action string) ([]byte, error) {
+	switch action {
+	case "-A":
+		f.markRules[cmd] = true
+	case "-D":
+		if !f.markRules[cmd] {
+			return nil, fmt.Errorf("rule not found")
+		}
+		delete(f.markRules, cmd)
+	case "-C":
+		if !f.markRules[cmd] {
+			return nil, fmt.Errorf("rule not found")
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeIPRuleState) handleIpsetLocked(args []string) ([]byte, error) {
+	switch args[0] {
+	case "create":
+		if _, ok := f.ipsets[args[1]]; !ok {
+			f.ipsets[args[1]] = []string{}
+		}
+	case "destroy":
+		if _, ok := f.ipsets[args[1]]; !ok {
+			return nil, fmt.Errorf("set does not exist")
+		}
+		delete(f.ipsets, args[1])
+	case "add":
+		if _, ok := f.ipsets[args[1]]; !ok {
+			return nil, fmt.Errorf("set does not exist")
+		}
+		f.ipsets[args[1]] = append(f.ipsets[args[1]], args[2])
+	case "list":
+		if _, ok := f.ipsets[args[len(args)-1]]; !ok {
+			return nil, fmt.Errorf("set does not exist")
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeIPRuleState) handleRouteLocked(family, action string) ([]byte, error) {
+	switch action {
+	case "replace":
+		f.routes[family] = true
+	case "del":
+		if !f.routes[family] {
+			return []byte("RTNETLINK answers: No such process"), fmt.Errorf("exit status 2")
+		}
+		delete(f.routes, family)
+	case "show":
+		if f.routes[family] {
+			return []byte(fmt.Sprintf("unreachable default metric %d \n", ExitKillSwitchMetric)), nil
+		}
+	}
+	return nil, nil
+}
+
 func (f *fakeIPRuleState) masqCount() int {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -408,12 +525,55 @@ func TestValidateExitNodePolicy(t *testing.T) {
 			Mode:    domain.ExitNodeSelective,
 			Clients: []domain.ExitNodeClient{{IP: "::/0"}},
 		}, true},
+		{"selective MAC", domain.ExitNodePolicy{
+			Mode:    domain.ExitNodeSelective,
+			Clients: []domain.ExitNodeClient{{MAC: "AA:BB:CC:DD:EE:01", Label: "laptop"}},
+		}, false},
+		{"selective invalid MAC", domain.ExitNodePolicy{
+			Mode:    domain.ExitNodeSelective,
+			Clients: []domain.ExitNodeClient{{MAC: "aa:bb:cc"}},
+		}, true},
+		{"selective MAC and IP", domain.ExitNodePolicy{
+			Mode:    domain.ExitNodeSelective,
+			Clients: []domain.ExitNodeClient{{MAC: "aa:bb:cc:dd:ee:01", IP: "10.0.0.1"}},
+		}, true},
+		{"networks valid", domain.ExitNodePolicy{
+			Mode:     domain.ExitNodeNetworks,
+			Networks: []string{"br20", "br30"},
+		}, false},
+		{"networks empty", domain.ExitNodePolicy{Mode: domain.ExitNodeNetworks}, true},
+		{"networks invalid name", domain.ExitNodePolicy{
+			Mode:     domain.ExitNodeNetworks,
+			Networks: []string{"br20; reboot"},
+		}, true},
+		{"networks duplicate", domain.ExitNodePolicy{
+			Mode:     domain.ExitNodeNetworks,
+			Networks: []string{"br20", "br20"},
+		}, true},
+		{"destinations valid", domain.ExitNodePolicy{
+			Mode:         domain.ExitNodeDestinations,
+			Destinations: []string{"203.0.113.0/24", "2001:db8::1"},
+			Domains:      []string{"intranet.example.com"},
+		}, false},
+		{"destinations empty", domain.ExitNodePolicy{Mode: domain.ExitNodeDestinations}, true},
+		{"destinations catch-all", domain.ExitNodePolicy{
+			Mode:         domain.ExitNodeDestinations,
+			Destinations: []string{"0.0.0.0/0"},
+		}, true},
+		{"destinations invalid CIDR", domain.ExitNodePolicy{
+			Mode:         domain.ExitNodeDestinations,
+			Destinations: []string{"10.0.0.0/33"},
+		}, true},
+		{"destinations invalid domain", domain.ExitNodePolicy{
+			Mode:    domain.ExitNodeDestinations,
+			Domains: []string{"-bad-.example.com"},
+		}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Fill IPs for too-many-clients test
 			for i := range tt.policy.Clients {
-				if tt.policy.Clients[i].IP == "" {
+				if tt.policy.Clients[i].IP == "" && tt.policy.Clients[i].MAC == "" {
 					tt.policy.Clients[i].IP = fmt.Sprintf("10.0.0.%d", i+1)
 				}
 			}
@@ -457,6 +617,19 @@ func TestParseRules(t *testing.T) {
 		assert.Equal(t, "", rules[0].Iif)
 		assert.Equal(t, "10.0.0.0/24", rules[1].Src)
 	})
+
+	t.Run("destination rules", func(t *testing.T) {
+		output := `0:	from all lookup local
+5280:	from all fwmark 0x1000000/0x1000000 lookup 53
+5281:	from all to 203.0.113.0/24 lookup 53
+32766:	from all lookup main
+`
+		rules := parseRules(output, "-4")
+		require.Len(t, rules, 2)
+		assert.Equal(t, "0x1000000/0x1000000", rules[0].Fwmark)
+		assert.Equal(t, "", rules[0].Src)
+		assert.Equal(t, "203.0.113.0/24", rules[1].Dst)
+	})
 }
 
 func TestConntrackFlush(t *testing.T) {
@@ -843,3 +1016,289 @@ func TestApplySelectiveRejectsCatchAllPrefix(t *testing.T) {
 		})
 	}
 }
+
+func newDestinationsService(t *testing.T) (*ExitNodeService, *fakeIPRuleState) {
+	t.Helper()
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+	svc.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("198.51.100.7"), netip.MustParseAddr("2001:db8::7")}, nil
+	}
+	return svc, state
+}
+
+func TestApplyDestinations(t *testing.T) {
+	svc, state := newDestinationsService(t)
+	policy := domain.ExitNodePolicy{
+		Mode:         domain.ExitNodeDestinations,
+		Destinations: []string{"203.0.113.0/24"},
+		Domains:      []string{"intranet.example.com"},
+	}
+
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	require.Len(t, state.rules["-4"], 2)
+	assert.Contains(t, state.rules["-4"][0], "5281:\tfrom all to 203.0.113.0/24 lookup 53")
+	assert.Contains(t, state.rules["-4"][1], "5280:\tfrom all fwmark "+exitDstMark+" lookup 53")
+	require.Len(t, state.rules["-6"], 1, "the v6 fwmark rule catches AAAA answers")
+	assert.True(t, state.markRules["iptables"])
+	assert.True(t, state.markRules["ip6tables"])
+	assert.Equal(t, []string{"198.51.100.7"}, state.ipsets[exitDstSet4])
+	assert.Equal(t, []string{"2001:db8::7"}, state.ipsets[exitDstSet6])
+	assert.Len(t, state.masqRules, 2)
+}
+
+func TestCleanupRemovesDestinationMatch(t *testing.T) {
+	svc, state := newDestinationsService(t)
+	require.NoError(t, svc.Apply(context.Background(), domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeDestinations,
+		Domains: []string{"intranet.example.com"},
+	}))
+
+	require.NoError(t, svc.Cleanup(context.Background()))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	assert.Empty(t, state.markRules)
+	assert.Empty(t, state.ipsets)
+}
+
+func TestReconcileDestinations(t *testing.T) {
+	svc, state := newDestinationsService(t)
+	policy := domain.ExitNodePolicy{
+		Mode:         domain.ExitNodeDestinations,
+		Destinations: []string{"203.0.113.5"},
+		Domains:      []string{"intranet.example.com"},
+	}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	flushes := state.conntrackFlushCount()
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, flushes, state.conntrackFlushCount(), "no drift must not re-apply")
+
+	state.mu.Lock()
+	delete(state.markRules, "iptables")
+	state.mu.Unlock()
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	assert.True(t, state.markRules["iptables"], "a missing mark rule is drift")
+}
+
+func TestRefreshDestinations(t *testing.T) {
+	svc, state := newDestinationsService(t)
+	policy := domain.ExitNodePolicy{Mode: domain.ExitNodeDestinations, Domains: []string{"intranet.example.com"}}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	svc.lookup = func(context.Context, string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("198.51.100.8")}, nil
+	}
+	svc.RefreshDestinations(context.Background(), policy)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	assert.Equal(t, []string{"198.51.100.7", "198.51.100.8"}, state.ipsets[exitDstSet4])
+}
+
+func TestApplyNetworks(t *testing.T) {
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+	svc.SetSubnetProvider(func() []SubnetEntry {
+		return []SubnetEntry{
+			{CIDR: "192.168.1.0/24", Iface: "br0"},
+			{CIDR: "192.168.20.0/24", Iface: "br20"},
+		}
+	})
+
+	err := svc.Apply(context.Background(), domain.ExitNodePolicy{Mode: domain.ExitNodeNetworks, Networks: []string{"br20"}})
+	require.NoError(t, err)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	require.Len(t, state.rules["-4"], 1)
+	assert.Equal(t, "5281:\tfrom 192.168.20.0/24 iif br20 lookup 53", state.rules["-4"][0])
+	assert.Empty(t, state.rules["-6"])
+	assert.Len(t, state.masqRules, 2)
+}
+
+func TestReconcileNetworksFollowsSubnetChange(t *testing.T) {
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+	cidr := "192.168.20.0/24"
+	svc.SetSubnetProvider(func() []SubnetEntry { return []SubnetEntry{{CIDR: cidr, Iface: "br20"}} })
+	policy := domain.ExitNodePolicy{Mode: domain.ExitNodeNetworks, Networks: []string{"br20"}}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	flushes := state.conntrackFlushCount()
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, flushes, state.conntrackFlushCount(), "unchanged subnets must not re-apply")
+
+	cidr = "10.20.0.0/16"
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	require.Len(t, state.rules["-4"], 1)
+	assert.Contains(t, state.rules["-4"][0], "from 10.20.0.0/16 iif br20")
+}
+
+func TestApplyNetworksWithoutSubnetsInstallsNothing(t *testing.T) {
+	state := newFakeIPRuleState()
+	manifest := &mockExitManifest{}
+	svc := NewExitNodeService(manifest, state.runner())
+	svc.SetSubnetProvider(func() []SubnetEntry { return nil })
+	policy := domain.ExitNodePolicy{Mode: domain.ExitNodeNetworks, Networks: []string{"br20"}}
+
+	require.NoError(t, svc.Apply(context.Background(), policy))
+	assert.Equal(t, 0, state.ruleCount())
+	assert.Equal(t, 0, state.masqCount())
+	assert.Equal(t, domain.ExitNodeNetworks, manifest.policy.Mode)
+
+	flushes := state.conntrackFlushCount()
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, flushes, state.conntrackFlushCount(), "a network without subnets must not churn")
+}
+
+func newMACClientService(t *testing.T, leases string) (*ExitNodeService, *fakeIPRuleState) {
+	t.Helper()
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+	svc.leasesPath = filepath.Join(t.TempDir(), "dnsmasq.lease")
+	require.NoError(t, os.WriteFile(svc.leasesPath, []byte(leases), 0644))
+	return svc, state
+}
+
+func TestApplySelectiveByMAC(t *testing.T) {
+	svc, state := newMACClientService(t, "0 aa:bb:cc:dd:ee:01 192.168.1.50 laptop 01:aa:bb:cc:dd:ee:01\n")
+	state.neigh = "2001:db8::50 dev br0 lladdr aa:bb:cc:dd:ee:01 REACHABLE\n" +
+		"fe80::1 dev br0 lladdr aa:bb:cc:dd:ee:01 STALE\n" +
+		"192.168.1.60 dev br0 FAILED\n"
+	policy := domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{{MAC: "AA:BB:CC:DD:EE:01", Label: "laptop"}},
+	}
+
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	state.mu.Lock()
+	require.Len(t, state.rules["-4"], 1)
+	assert.Contains(t, state.rules["-4"][0], "from 192.168.1.50 lookup 53")
+	require.Len(t, state.rules["-6"], 1, "link-local addresses must not get a rule")
+	assert.Contains(t, state.rules["-6"][0], "from 2001:db8::50 lookup 53")
+	state.mu.Unlock()
+}
+
+func TestReconcileFollowsNewLease(t *testing.T) {
+	svc, state := newMACClientService(t, "0 aa:bb:cc:dd:ee:01 192.168.1.50 laptop *\n")
+	policy := domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{{MAC: "aa:bb:cc:dd:ee:01"}},
+	}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	flushes := state.conntrackFlushCount()
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.Equal(t, flushes, state.conntrackFlushCount(), "an unchanged lease must not re-apply")
+
+	require.NoError(t, os.WriteFile(svc.leasesPath, []byte("0 aa:bb:cc:dd:ee:01 192.168.1.77 laptop *\n"), 0644))
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	require.Len(t, state.rules["-4"], 1)
+	assert.Contains(t, state.rules["-4"][0], "from 192.168.1.77 lookup 53")
+}
+
+func TestParseDHCPLeases(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	leases := "999999 aa:bb:cc:dd:ee:01 192.168.1.10 old *\n" +
+		"1000100 AA:BB:CC:DD:EE:02 192.168.1.11 current *\n" +
+		"0 aa:bb:cc:dd:ee:02 192.168.20.11 current *\n" +
+		"duid 00:01:00:01:2c:aa:bb:cc\n" +
+		"1000100 1234 2001:db8::11 current 00:01\n"
+
+	got := parseDHCPLeases(leases, now)
+
+	assert.Equal(t, map[string][]netip.Addr{
+		"aa:bb:cc:dd:ee:02": {netip.MustParseAddr("192.168.1.11"), netip.MustParseAddr("192.168.20.11")},
+	}, got, "every unexpired lease of a MAC is kept")
+}
+
+func TestReconcileDropsExpiredLease(t *testing.T) {
+	svc, state := newMACClientService(t, "1000100 aa:bb:cc:dd:ee:01 192.168.1.50 laptop *\n"+
+		"1000500 aa:bb:cc:dd:ee:01 192.168.20.50 laptop *\n")
+	now := time.Unix(1_000_000, 0)
+	svc.now = func() time.Time { return now }
+	policy := domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{{MAC: "aa:bb:cc:dd:ee:01"}},
+	}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	state.mu.Lock()
+	assert.Len(t, state.rules["-4"], 2, "both leases get a rule")
+	state.mu.Unlock()
+
+	now = now.Add(200 * time.Second)
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	require.Len(t, state.rules["-4"], 1)
+	assert.Contains(t, state.rules["-4"][0], "from 192.168.20.50 lookup 53")
+}
+
+func TestApplyKillSwitch(t *testing.T) {
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+
+	err := svc.Apply(context.Background(), domain.ExitNodePolicy{
+		Mode:       domain.ExitNodeSelective,
+		Clients:    []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+		KillSwitch: true,
+	})
+	require.NoError(t, err)
+	assert.True(t, state.routes["-4"])
+	assert.True(t, state.routes["-6"])
+
+	require.NoError(t, svc.Cleanup(context.Background()))
+	assert.Empty(t, state.routes, "cleanup must remove the kill switch routes")
+}
+
+func TestApplyWithoutKillSwitchInstallsNoRoutes(t *testing.T) {
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+
+	err := svc.Apply(context.Background(), domain.ExitNodePolicy{
+		Mode:    domain.ExitNodeSelective,
+		Clients: []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, state.routes)
+}
+
+func TestReconcileKillSwitch(t *testing.T) {
+	state := newFakeIPRuleState()
+	svc := NewExitNodeService(&mockExitManifest{}, state.runner())
+	policy := domain.ExitNodePolicy{
+		Mode:       domain.ExitNodeSelective,
+		Clients:    []domain.ExitNodeClient{{IP: "192.168.1.10"}},
+		KillSwitch: true,
+	}
+	require.NoError(t, svc.Apply(context.Background(), policy))
+
+	// tailscaled flushing the table takes the kill switch with it.
+	delete(state.routes, "-4")
+	require.NoError(t, svc.Reconcile(context.Background(), policy))
+	assert.True(t, state.routes["-4"], "reconcile must restore a missing kill switch route")
+}
+
+func TestHasKillSwitchRoute(t *testing.T) {
+	own := fmt.Sprintf("default dev tailscale0\nunreachable default metric %d \nthrow 192.168.1.0/24\n", ExitKillSwitchMetric)
+	assert.True(t, hasKillSwitchRoute(own))
+	assert.False(t, hasKillSwitchRoute("default dev tailscale0\nunreachable default metric 100\n"))
+	assert.False(t, hasKillSwitchRoute(""))
+}
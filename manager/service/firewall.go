@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 	"unifi-tailscale/manager/config"
 	"unifi-tailscale/manager/domain"
 )
@@ -15,9 +16,18 @@ import (
 type FirewallIntegration interface {
 	HasAPIKey() bool
 	EnsureZone(ctx context.Context, siteID, name string) (ZoneInfo, error)
-	EnsurePolicies(ctx context.Context, siteID, name, zoneID string) ([]string, error)
+	EnsurePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
+	ReplacePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
 	DeletePolicy(ctx context.Context, siteID, policyID string) error
 	DeleteZone(ctx context.Context, siteID, zoneID string) error
+	ListZones(ctx context.Context, siteID string) ([]domain.Zone, error)
+	ListPolicies(ctx context.Context, siteID string) ([]domain.Policy, error)
+	FindInternalZoneID(ctx context.Context, siteID string) (string, error)
+	FindSystemZoneIDs(ctx context.Context, siteID string) (string, string, error)
+	EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	ListDNSPolicies(ctx context.Context, siteID string) ([]domain.DNSPolicy, error)
+	DeleteDNSPolicy(ctx context.Context, siteID, policyID string) error
 }
 
 type FirewallManifest interface {
@@ -30,6 +40,12 @@ type FirewallManifest interface {
 	GetWgS2sZone(tunnelID string) (domain.ZoneManifest, bool)
 	SetWgS2sZone(tunnelID string, zs domain.ZoneManifest) error
 	RemoveWgS2sTunnel(tunnelID string) error
+	GetPolicyTemplates() []domain.PolicyTemplate
+	SetPolicyTemplates(t []domain.PolicyTemplate) error
+	GetWanPortsSnapshot() map[string]domain.WanPortEntry
+	SetWanPort(marker, policyID, policyName string, port int) error
+	GetSystemZoneIDs() (string, string)
+	GetDNSPolicy(marker string) (domain.DNSPolicyEntry, bool)
 }
 
 type FirewallOps interface {
@@ -90,6 +106,9 @@ type FirewallOrchestrator struct {
 	ic       FirewallIntegration
 	manifest FirewallManifest
 	ops      FirewallOps
+	tplMu    sync.Mutex // serialises policy template edits
+
+	activeNames ActiveNames
 }
 
 func NewFirewallOrchestrator(ic FirewallIntegration, manifest FirewallManifest, ops FirewallOps) *FirewallOrchestrator {
@@ -130,7 +149,7 @@ func (o *FirewallOrchestrator) SetupTailscaleFirewall(ctx context.Context) *Setu
 		return result
 	}
 
-	policyIDs, err := o.ic.EnsurePolicies(ctx, siteID, "Tailscale", zone.ZoneID)
+	policyIDs, err := o.ic.EnsurePolicies(ctx, siteID, tailscalePolicyZone, zone.ZoneID, o.templateRules(tailscalePolicyZone))
 	if err != nil {
 		result.addError("policies", err)
 		o.rollbackZone(ctx, siteID, zone.ZoneID, "tailscale policy setup failed")
@@ -186,6 +205,11 @@ func (o *FirewallOrchestrator) SetupTailscaleFirewall(ctx context.Context) *Setu
 	}
 	result.UDAPIApplied = true
 
+	// Policies a template change left behind; the zone itself is the same.
+	if oldZone.ZoneID == zone.ZoneID {
+		o.deleteStalePolicies(ctx, siteID, oldZone.PolicyIDs, policyIDs)
+	}
+
 	slog.Info("tailscale firewall setup complete", "chainPrefix", result.ChainPrefix)
 	return result
 }
@@ -248,7 +272,7 @@ func (o *FirewallOrchestrator) SetupWgS2sZone(ctx context.Context, tunnelID, zon
 	result.ZoneName = zone.ZoneName
 	slog.Info("wg-s2s integration zone ready", "zoneId", zone.ZoneID, "name", zone.ZoneName)
 
-	policyIDs, err := o.ic.EnsurePolicies(ctx, siteID, zoneName, zone.ZoneID)
+	policyIDs, err := o.ic.EnsurePolicies(ctx, siteID, zoneName, zone.ZoneID, o.templateRules(zoneName))
 	if err != nil {
 		result.addError("policies", err)
 		o.rollbackZone(ctx, siteID, zone.ZoneID, "wg-s2s policy setup failed")
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/ops"
+)
+
+const (
+	DriftZoneMissing    = "zone_missing"
+	DriftPolicyMissing  = "policy_missing"
+	DriftPolicyModified = "policy_modified"
+	DriftPolicyStale    = "policy_stale"
+)
+
+// FirewallDrift is one difference between the VPN Pack zones and policies
+// the manifest and templates call for and what the Integration API reports.
+// Zone is the template key ("Tailscale" or an S2S zone name); a WAN port
+// policy carries its manifest marker instead. Fields lists what was edited
+// on a modified policy. A stale policy is one of ours nothing wants any
+// more: a duplicate, or one a template change left behind.
+type FirewallDrift struct {
+	Kind     string   `json:"kind"`
+	Zone     string   `json:"zone,omitempty"`
+	ZoneID   string   `json:"zoneId,omitempty"`
+	WanPort  string   `json:"wanPort,omitempty"`
+	Policy   string   `json:"policy,omitempty"`
+	PolicyID string   `json:"policyId,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+}
+
+type DriftReport struct {
+	CheckedAt time.Time       `json:"checkedAt"`
+	Drift     []FirewallDrift `json:"drift"`
+}
+
+// managedZone is a zone in the manifest, with the policy IDs recorded for
+// it across the tunnels sharing it.
+type managedZone struct {
+	key       string
+	zoneID    string
+	policyIDs []string
+}
+
+func (o *FirewallOrchestrator) managedZones() []managedZone {
+	var out []managedZone
+	if ts := o.manifest.GetTailscaleZone(); ts.ZoneID != "" {
+		out = append(out, managedZone{key: tailscalePolicyZone, zoneID: ts.ZoneID, policyIDs: ts.PolicyIDs})
+	}
+	byID := make(map[string]*managedZone)
+	snap := o.manifest.GetWgS2sSnapshot()
+	for _, tunnelID := range slices.Sorted(maps.Keys(snap)) {
+		zm := snap[tunnelID]
+		if zm.ZoneID == "" {
+			continue
+		}
+		z, ok := byID[zm.ZoneID]
+		if !ok {
+			z = &managedZone{key: strings.TrimPrefix(zm.ZoneName, "VPN Pack: "), zoneID: zm.ZoneID}
+			byID[zm.ZoneID] = z
+		}
+		for _, id := range zm.PolicyIDs {
+			if !slices.Contains(z.policyIDs, id) {
+				z.policyIDs = append(z.policyIDs, id)
+			}
+		}
+	}
+	s2s := make([]managedZone, 0, len(byID))
+	for _, z := range byID {
+		s2s = append(s2s, *z)
+	}
+	slices.SortFunc(s2s, func(a, b managedZone) int {
+		return cmp.Or(cmp.Compare(a.key, b.key), cmp.Compare(a.zoneID, b.zoneID))
+	})
+	return append(out, s2s...)
+}
+
+// DetectDrift compares the live zones and policies against the desired
+// state. It only reads.
+func (o *FirewallOrchestrator) DetectDrift(ctx context.Context) (*DriftReport, error) {
+	if err := o.requireIntegration(); err != nil {
+		return nil, preconditionError("integration API not configured")
+	}
+	drift, err := o.detectDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DriftReport{CheckedAt: time.Now(), Drift: drift}, nil
+}
+
+func (o *FirewallOrchestrator) detectDrift(ctx context.Context) ([]FirewallDrift, error) {
+	siteID := o.manifest.GetSiteID()
+	zones, err := o.ic.ListZones(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to list firewall zones", err)
+	}
+	live, err := o.ic.ListPolicies(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to list firewall policies", err)
+	}
+
+	drift := []FirewallDrift{}
+	if managed := o.managedZones(); len(managed) > 0 {
+		internalZoneID, err := o.ic.FindInternalZoneID(ctx, siteID)
+		if err != nil {
+			return nil, upstreamError("failed to find internal zone", err)
+		}
+		for _, z := range managed {
+			if !slices.ContainsFunc(zones, func(lz domain.Zone) bool { return lz.ID == z.zoneID }) {
+				// Recreating the zone sets its policies up again.
+				drift = append(drift, FirewallDrift{Kind: DriftZoneMissing, Zone: z.key, ZoneID: z.zoneID})
+				continue
+			}
+			var owned []string
+			for _, want := range domain.ZonePolicies(z.key, z.zoneID, internalZoneID, o.templateRules(z.key)) {
+				d, ids := policyDrift(live, want)
+				for i := range d {
+					d[i].Zone, d[i].ZoneID = z.key, z.zoneID
+				}
+				drift = append(drift, d...)
+				owned = append(owned, ids...)
+			}
+			for _, id := range z.policyIDs {
+				i := slices.IndexFunc(live, func(p domain.Policy) bool { return p.ID == id })
+				if i < 0 || slices.Contains(owned, id) {
+					continue
+				}
+				drift = append(drift, FirewallDrift{Kind: DriftPolicyStale, Zone: z.key, ZoneID: z.zoneID, Policy: live[i].Name, PolicyID: id})
+			}
+		}
+	}
+
+	wan := o.manifest.GetWanPortsSnapshot()
+	if len(wan) == 0 {
+		return drift, nil
+	}
+	extID, gwID, err := o.systemZoneIDs(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to find system zones", err)
+	}
+	for _, marker := range slices.Sorted(maps.Keys(wan)) {
+		e := wan[marker]
+		d, _ := policyDrift(live, domain.WanPortPolicy(e.PolicyName, e.Port, extID, gwID))
+		for i := range d {
+			d[i].WanPort = marker
+		}
+		drift = append(drift, d...)
+	}
+	return drift, nil
+}
+
+// policyDrift reports how the live copies of want differ from it, along
+// with the IDs of all its copies.
+func policyDrift(live []domain.Policy, want domain.Policy) ([]FirewallDrift, []string) {
+	id, others := domain.MatchPolicy(live, want)
+	var drift []FirewallDrift
+	if id == "" {
+		if len(others) == 0 {
+			return []FirewallDrift{{Kind: DriftPolicyMissing, Policy: want.Name}}, nil
+		}
+		i := slices.IndexFunc(live, func(p domain.Policy) bool { return p.ID == others[0] })
+		drift = append(drift, FirewallDrift{
+			Kind: DriftPolicyModified, Policy: want.Name, PolicyID: others[0],
+			Fields: domain.PolicyDrift(live[i], want),
+		})
+		id, others = others[0], others[1:]
+	}
+	for _, dup := range others {
+		drift = append(drift, FirewallDrift{Kind: DriftPolicyStale, Policy: want.Name, PolicyID: dup})
+	}
+	return drift, append([]string{id}, others...)
+}
+
+func (o *FirewallOrchestrator) systemZoneIDs(ctx context.Context, siteID string) (string, string, error) {
+	if extID, gwID := o.manifest.GetSystemZoneIDs(); extID != "" && gwID != "" {
+		return extID, gwID, nil
+	}
+	return o.ic.FindSystemZoneIDs(ctx, siteID)
+}
+
+// ReconcileDrift restores the desired state and returns a fresh report.
+// It is the only path that replaces a drifted policy; setup adopts what it
+// finds by name. Missing zones are set up again, drifted zone and WAN port
+// policies are replaced, then the result is re-checked; stale policies are
+// deleted only once nothing else is left to fix, so a failed run never
+// removes a policy that still carries traffic.
+//
+// The steps are forward-only: each one moves the controller towards the
+// desired state, and undoing it would only restore the drift.
+func (o *FirewallOrchestrator) ReconcileDrift(ctx context.Context) (*DriftReport, error) {
+	if err := o.requireIntegration(); err != nil {
+		return nil, preconditionError("integration API not configured")
+	}
+	drift, err := o.detectDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+	siteID := o.manifest.GetSiteID()
+
+	var steps []ops.Op
+	var ensured, wanPorts, stale, keep []string
+	for _, d := range drift {
+		if d.Kind == DriftPolicyStale {
+			stale = append(stale, d.PolicyID)
+		}
+		if d.Kind == DriftZoneMissing {
+			steps = append(steps, o.recreateZoneOp(d.Zone, d.ZoneID))
+		}
+		switch {
+		case d.WanPort != "":
+			if !slices.Contains(wanPorts, d.WanPort) {
+				wanPorts = append(wanPorts, d.WanPort)
+			}
+		case !slices.Contains(ensured, d.Zone):
+			// Also for a zone with only stale policies, so the manifest
+			// ends up listing exactly the ones that are wanted, and for a
+			// recreated one, whose setup adopted its policies by name.
+			ensured = append(ensured, d.Zone)
+			zone := d.Zone
+			steps = append(steps, ops.Noop("ensure policies of "+zone, func(ctx context.Context) error {
+				old, ids, err := o.ensureZonePolicies(ctx, zone)
+				stale, keep = append(stale, old...), append(keep, ids...)
+				return err
+			}))
+		}
+	}
+	for _, marker := range wanPorts {
+		steps = append(steps, o.ensureWanPortOp(siteID, marker))
+	}
+
+	steps = append(steps,
+		ops.Noop("verify", func(ctx context.Context) error {
+			left, err := o.detectDrift(ctx)
+			if err != nil {
+				return err
+			}
+			for _, d := range left {
+				if d.Kind != DriftPolicyStale {
+					return fmt.Errorf("still drifted: %s %s%s", d.Kind, d.Zone, d.WanPort)
+				}
+				stale = append(stale, d.PolicyID)
+			}
+			return nil
+		}),
+		ops.Noop("delete stale policies", func(ctx context.Context) error {
+			o.deleteStalePolicies(ctx, siteID, stale, keep)
+			return nil
+		}),
+	)
+	if err := ops.Run(ctx, steps); err != nil {
+		return nil, internalError(fmt.Sprintf("reconcile firewall drift: %v", err), err)
+	}
+	slog.Info("firewall drift reconciled", "fixed", len(drift))
+	return o.DetectDrift(ctx)
+}
+
+// recreateZoneOp sets a deleted zone up again. A recreated S2S zone gets a
+// new chain prefix; its tunnels' interface rules pick it up at their next
+// firewall setup.
+func (o *FirewallOrchestrator) recreateZoneOp(zone, oldZoneID string) ops.Op {
+	return ops.Noop("recreate zone "+zone, func(ctx context.Context) error {
+		if zone == tailscalePolicyZone {
+			return o.SetupTailscaleFirewall(ctx).Err()
+		}
+		var tunnels []string
+		for tunnelID, zm := range o.manifest.GetWgS2sSnapshot() {
+			if zm.ZoneID == oldZoneID {
+				tunnels = append(tunnels, tunnelID)
+			}
+		}
+		slices.Sort(tunnels)
+		var zoneID string
+		for _, tunnelID := range tunnels {
+			r := o.SetupWgS2sZone(ctx, tunnelID, zoneID, zone)
+			if err := r.Err(); err != nil {
+				return err
+			}
+			zoneID = r.ZoneID
+		}
+		return nil
+	})
+}
+
+func (o *FirewallOrchestrator) ensureWanPortOp(siteID, marker string) ops.Op {
+	return ops.Noop("ensure WAN port "+marker, func(ctx context.Context) error {
+		e := o.manifest.GetWanPortsSnapshot()[marker]
+		extID, gwID, err := o.systemZoneIDs(ctx, siteID)
+		if err != nil {
+			return err
+		}
+		id, err := o.ic.ReplaceWanPortPolicy(ctx, siteID, e.Port, e.PolicyName, extID, gwID)
+		if err != nil || id == e.PolicyID {
+			return err
+		}
+		return o.manifest.SetWanPort(marker, id, e.PolicyName, e.Port)
+	})
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"unifi-tailscale/manager/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// livePolicies gives want the IDs ids, as the API would list them.
+func livePolicies(want []domain.Policy, ids ...string) []domain.Policy {
+	out := make([]domain.Policy, len(want))
+	for i, p := range want {
+		p.ID = ids[i]
+		out[i] = p
+	}
+	return out
+}
+
+// driftFixture is a Tailscale zone with the default pair, one of them
+// disabled and a leftover template policy next to them, a deleted S2S zone
+// and a WAN port policy that is gone.
+func driftFixture() (*mockFWIntegration, *mockFWManifest) {
+	ts := livePolicies(domain.ZonePolicies("Tailscale", "zone-ts", "zone-int", nil), "pol-in", "pol-out")
+	ts[1].Enabled = false
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		zones:     []domain.Zone{{ID: "zone-ts", Name: "VPN Pack: Tailscale"}, {ID: "zone-int", Name: "Internal"}},
+		policies:  append(ts, domain.Policy{ID: "pol-rdp", Name: "VPN Pack: Tailscale: RDP", Enabled: true}),
+	}
+	mf := &mockFWManifest{
+		siteID:        "site-1",
+		tailscaleZone: domain.ZoneManifest{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale", PolicyIDs: []string{"pol-in", "pol-out", "pol-rdp"}},
+		wgS2sZones: map[string]domain.ZoneManifest{
+			"t1": {ZoneID: "zone-br", ZoneName: "VPN Pack: Branch", PolicyIDs: []string{"pol-br"}},
+		},
+		wanPorts: map[string]domain.WanPortEntry{
+			"tailscale-wg": {PolicyID: "pol-wan", PolicyName: "VPN Pack: Tailscale WG UDP 41641", Port: 41641},
+		},
+	}
+	return ic, mf
+}
+
+func TestDetectFirewallDrift(t *testing.T) {
+	ic, mf := driftFixture()
+	report, err := newTestOrch(ic, mf, &mockFWOps{}).DetectDrift(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []FirewallDrift{
+		{Kind: DriftPolicyModified, Zone: "Tailscale", ZoneID: "zone-ts", Policy: "VPN Pack: Allow Internal to Tailscale", PolicyID: "pol-out", Fields: []string{"enabled"}},
+		{Kind: DriftPolicyStale, Zone: "Tailscale", ZoneID: "zone-ts", Policy: "VPN Pack: Tailscale: RDP", PolicyID: "pol-rdp"},
+		{Kind: DriftZoneMissing, Zone: "Branch", ZoneID: "zone-br"},
+		{Kind: DriftPolicyMissing, WanPort: "tailscale-wg", Policy: "VPN Pack: Tailscale WG UDP 41641"},
+	}, report.Drift)
+}
+
+func TestDetectFirewallDrift_InSync(t *testing.T) {
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		zones:     []domain.Zone{{ID: "zone-ts"}},
+		policies:  livePolicies(domain.ZonePolicies("Tailscale", "zone-ts", "zone-int", nil), "pol-in", "pol-out"),
+	}
+	mf := &mockFWManifest{siteID: "site-1", tailscaleZone: domain.ZoneManifest{ZoneID: "zone-ts", PolicyIDs: []string{"pol-in", "pol-out"}}}
+	report, err := newTestOrch(ic, mf, &mockFWOps{}).DetectDrift(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Drift)
+	assert.NotNil(t, report.Drift, "an empty report lists no drift rather than null")
+
+	_, err = newTestOrch(&mockFWIntegration{}, mf, &mockFWOps{}).DetectDrift(context.Background())
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrPrecondition, se.Kind)
+}
+
+// fixingIntegration makes ic behave like the API: EnsureZone and the
+// policy calls leave the wanted objects in the live lists. Ensure adopts a
+// policy by name, Replace swaps a drifted copy.
+func fixingIntegration(ic *mockFWIntegration) {
+	next := 0
+	newID := func() string { next++; return fmt.Sprintf("new-%d", next) }
+	ic.ensureZoneFn = func(_ context.Context, _, name string) (ZoneInfo, error) {
+		z := domain.Zone{ID: newID(), Name: name}
+		ic.zones = append(ic.zones, z)
+		return ZoneInfo{ZoneID: z.ID, ZoneName: z.Name}, nil
+	}
+	ensure := func(want domain.Policy, replace bool) string {
+		id, drifted := domain.MatchPolicy(ic.policies, want)
+		if !replace && id == "" && len(drifted) > 0 {
+			return drifted[0]
+		}
+		if id == "" {
+			want.ID = newID()
+			ic.policies = append(ic.policies, want)
+			id = want.ID
+		}
+		if replace {
+			for _, old := range drifted {
+				ic.removePolicy(old)
+			}
+		}
+		return id
+	}
+	zonePolicies := func(replace bool) func(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+		return func(_ context.Context, _, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+			var ids []string
+			for _, want := range domain.ZonePolicies(name, zoneID, "zone-int", rules) {
+				ids = append(ids, ensure(want, replace))
+			}
+			return ids, nil
+		}
+	}
+	ic.ensurePolicies, ic.replacePolicies = zonePolicies(false), zonePolicies(true)
+	ic.replaceWanPort = func(_ context.Context, _ string, port int, name, extID, gwID string) (string, error) {
+		return ensure(domain.WanPortPolicy(name, port, extID, gwID), true), nil
+	}
+	ic.deletePolicy = func(_ context.Context, _, id string) error {
+		ic.removePolicy(id)
+		return nil
+	}
+}
+
+func (m *mockFWIntegration) removePolicy(id string) {
+	for i, p := range m.policies {
+		if p.ID == id {
+			m.policies = append(m.policies[:i], m.policies[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestReconcileFirewallDrift(t *testing.T) {
+	ic, mf := driftFixture()
+	fixingIntegration(ic)
+
+	report, err := newTestOrch(ic, mf, &mockFWOps{}).ReconcileDrift(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Drift)
+
+	assert.Equal(t, []string{"pol-in", "new-1"}, mf.tailscaleZone.PolicyIDs, "the disabled policy is replaced")
+	assert.Equal(t, "VPN Pack: Branch", mf.wgS2sZones["t1"].ZoneName)
+	assert.NotEqual(t, "zone-br", mf.wgS2sZones["t1"].ZoneID, "the deleted zone is set up again")
+	assert.NotEqual(t, "pol-wan", mf.wanPorts["tailscale-wg"].PolicyID)
+	for _, p := range ic.policies {
+		assert.NotEqual(t, "pol-rdp", p.ID, "the stale policy is deleted")
+	}
+}
+
+func TestReconcileFirewallDrift_StillDriftedKeepsStale(t *testing.T) {
+	ic, mf := driftFixture()
+	mf.wgS2sZones, mf.wanPorts = nil, nil
+	var deleted []string
+	ic.replacePolicies = func(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+		return []string{"pol-in", "pol-out"}, nil // an API that ignores us
+	}
+	ic.deletePolicy = func(_ context.Context, _, id string) error {
+		deleted = append(deleted, id)
+		return nil
+	}
+
+	_, err := newTestOrch(ic, mf, &mockFWOps{}).ReconcileDrift(context.Background())
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrInternal, se.Kind)
+	assert.Contains(t, se.Message, "still drifted")
+	assert.Empty(t, deleted, "nothing is deleted while drift remains")
+}
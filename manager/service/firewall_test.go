@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"maps"
+	"slices"
 	"testing"
 	"unifi-tailscale/manager/domain"
 
@@ -12,19 +14,29 @@ import (
 // --- Mocks ---
 
 type mockFWIntegration struct {
-	hasAPIKey      bool
-	ensureZoneFn   func(ctx context.Context, siteID, name string) (ZoneInfo, error)
-	ensurePolicies func(ctx context.Context, siteID, name, zoneID string) ([]string, error)
-	deletePolicy   func(ctx context.Context, siteID, policyID string) error
-	deleteZone     func(ctx context.Context, siteID, zoneID string) error
+	hasAPIKey       bool
+	ensureZoneFn    func(ctx context.Context, siteID, name string) (ZoneInfo, error)
+	ensurePolicies  func(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
+	replacePolicies func(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error)
+	deletePolicy    func(ctx context.Context, siteID, policyID string) error
+	deleteZone      func(ctx context.Context, siteID, zoneID string) error
+	zones           []domain.Zone
+	policies        []domain.Policy
+	ensureWanPort   func(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	replaceWanPort  func(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error)
+	dnsPolicies     []domain.DNSPolicy
+	deleteDNS       func(ctx context.Context, siteID, policyID string) error
 }
 
 func (m *mockFWIntegration) HasAPIKey() bool { return m.hasAPIKey }
 func (m *mockFWIntegration) EnsureZone(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 	return m.ensureZoneFn(ctx, siteID, name)
 }
-func (m *mockFWIntegration) EnsurePolicies(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
-	return m.ensurePolicies(ctx, siteID, name, zoneID)
+func (m *mockFWIntegration) EnsurePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return m.ensurePolicies(ctx, siteID, name, zoneID, rules)
+}
+func (m *mockFWIntegration) ReplacePolicies(ctx context.Context, siteID, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+	return m.replacePolicies(ctx, siteID, name, zoneID, rules)
 }
 func (m *mockFWIntegration) DeletePolicy(ctx context.Context, siteID, policyID string) error {
 	if m.deletePolicy != nil {
@@ -38,6 +50,39 @@ func (m *mockFWIntegration) DeleteZone(ctx context.Context, siteID, zoneID strin
 	}
 	return nil
 }
+func (m *mockFWIntegration) ListZones(context.Context, string) ([]domain.Zone, error) {
+	return m.zones, nil
+}
+func (m *mockFWIntegration) ListPolicies(context.Context, string) ([]domain.Policy, error) {
+	return m.policies, nil
+}
+func (m *mockFWIntegration) FindInternalZoneID(context.Context, string) (string, error) {
+	return "zone-int", nil
+}
+func (m *mockFWIntegration) FindSystemZoneIDs(context.Context, string) (string, string, error) {
+	return "zone-ext", "zone-gw", nil
+}
+func (m *mockFWIntegration) EnsureWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	if m.ensureWanPort != nil {
+		return m.ensureWanPort(ctx, siteID, port, name, extID, gwID)
+	}
+	return "", nil
+}
+func (m *mockFWIntegration) ReplaceWanPortPolicy(ctx context.Context, siteID string, port int, name, extID, gwID string) (string, error) {
+	if m.replaceWanPort != nil {
+		return m.replaceWanPort(ctx, siteID, port, name, extID, gwID)
+	}
+	return "", nil
+}
+func (m *mockFWIntegration) ListDNSPolicies(context.Context, string) ([]domain.DNSPolicy, error) {
+	return m.dnsPolicies, nil
+}
+func (m *mockFWIntegration) DeleteDNSPolicy(ctx context.Context, siteID, policyID string) error {
+	if m.deleteDNS != nil {
+		return m.deleteDNS(ctx, siteID, policyID)
+	}
+	return nil
+}
 
 type mockFWManifest struct {
 	siteID              string
@@ -47,6 +92,9 @@ type mockFWManifest struct {
 	setTailscaleZoneFn  func(zoneID, zoneName string, policyIDs []string, chainPrefix string) error
 	setWgS2sZoneFn      func(tunnelID string, zs domain.ZoneManifest) error
 	removeWgS2sTunnelFn func(tunnelID string) error
+	policyTemplates     []domain.PolicyTemplate
+	wanPorts            map[string]domain.WanPortEntry
+	dnsPolicies         map[string]domain.DNSPolicyEntry
 }
 
 func (m *mockFWManifest) GetSiteID() string                  { return m.siteID }
@@ -97,6 +145,29 @@ func (m *mockFWManifest) RemoveWgS2sTunnel(tunnelID string) error {
 	return nil
 }
 
+func (m *mockFWManifest) GetPolicyTemplates() []domain.PolicyTemplate {
+	return slices.Clone(m.policyTemplates)
+}
+func (m *mockFWManifest) SetPolicyTemplates(t []domain.PolicyTemplate) error {
+	m.policyTemplates = slices.Clone(t)
+	return nil
+}
+func (m *mockFWManifest) GetWanPortsSnapshot() map[string]domain.WanPortEntry {
+	return maps.Clone(m.wanPorts)
+}
+func (m *mockFWManifest) SetWanPort(marker, policyID, policyName string, port int) error {
+	if m.wanPorts == nil {
+		m.wanPorts = make(map[string]domain.WanPortEntry)
+	}
+	m.wanPorts[marker] = domain.WanPortEntry{PolicyID: policyID, PolicyName: policyName, Port: port}
+	return nil
+}
+func (m *mockFWManifest) GetSystemZoneIDs() (string, string) { return "", "" }
+func (m *mockFWManifest) GetDNSPolicy(marker string) (domain.DNSPolicyEntry, bool) {
+	e, ok := m.dnsPolicies[marker]
+	return e, ok
+}
+
 type mockFWOps struct {
 	discoverChainPrefix       func(ctx context.Context, zoneID string) string
 	ensureTailscaleRules      func(ctx context.Context, chainPrefix string) error
@@ -188,7 +259,7 @@ func TestSetupTailscaleFirewall_PolicyFail_RollbackZone(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return nil, errors.New("policy error")
 		},
 		deleteZone: func(ctx context.Context, siteID, zoneID string) error {
@@ -219,7 +290,7 @@ func TestSetupTailscaleFirewall_RestoresChainPrefixOnUDAPIFailure(t *testing.T)
 		ensureZoneFn: func(_ context.Context, _, _ string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(_ context.Context, _, _, _ string) ([]string, error) {
+		ensurePolicies: func(_ context.Context, _, _, _ string, _ []domain.PolicyRule) ([]string, error) {
 			return []string{"pol-1"}, nil
 		},
 	}
@@ -253,7 +324,7 @@ func TestSetupTailscaleFirewall_UDAPIFail(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return []string{"pol-1", "pol-2"}, nil
 		},
 	}
@@ -281,7 +352,7 @@ func TestSetupTailscaleFirewall_Success(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return []string{"pol-1", "pol-2"}, nil
 		},
 	}
@@ -308,7 +379,7 @@ func TestSetupTailscaleFirewall_ManifestFail_RollbackZoneAndPolicies(t *testing.
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return []string{"pol-1", "pol-2"}, nil
 		},
 		deletePolicy: func(ctx context.Context, siteID, policyID string) error {
@@ -346,7 +417,7 @@ func TestSetupTailscaleFirewall_RollbackFails_BestEffort(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return nil, errors.New("policy error")
 		},
 		deleteZone: func(ctx context.Context, siteID, zoneID string) error {
@@ -399,7 +470,7 @@ func TestSetupWgS2sZone_PolicyFail_RollbackZone(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-created", ZoneName: name}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return nil, errors.New("policy error")
 		},
 		deleteZone: func(ctx context.Context, siteID, zoneID string) error {
@@ -430,7 +501,7 @@ func TestSetupWgS2sZone_ManifestFail_RollbackZoneAndPolicies(t *testing.T) {
 		ensureZoneFn: func(ctx context.Context, siteID, name string) (ZoneInfo, error) {
 			return ZoneInfo{ZoneID: "zone-created", ZoneName: name}, nil
 		},
-		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string) ([]string, error) {
+		ensurePolicies: func(ctx context.Context, siteID, name, zoneID string, _ []domain.PolicyRule) ([]string, error) {
 			return []string{"pol-1", "pol-2"}, nil
 		},
 		deletePolicy: func(ctx context.Context, siteID, policyID string) error {
@@ -44,7 +44,7 @@ type KeyStore interface {
 	Delete() error
 }
 
-// MemKeyStore is a no-op KeyStore for use in tests.
+// MemKeyStore is a no-op KeyStore, for tests and dry runs.
 type MemKeyStore struct{}
 
 func (MemKeyStore) Save(string) error { return nil }
@@ -179,6 +179,20 @@ func (svc *IntegrationService) DeleteKey(ctx context.Context) error {
 	return nil
 }
 
+// PlanKey is SetKey against ic, manifest and notify instead of the
+// service's own, with the key left unsaved, for a dry run.
+func (svc *IntegrationService) PlanKey(ctx context.Context, key string, ic IntegrationServiceIC, manifest IntegrationServiceManifest, notify IntegrationNotifier) (*IntegrationStatus, error) {
+	plan := &IntegrationService{ic: ic, manifest: manifest, notify: notify, keyStore: MemKeyStore{}}
+	return plan.SetKey(ctx, key)
+}
+
+// PlanDeleteKey is DeleteKey against ic and notify, with the saved key left
+// in place, for a dry run.
+func (svc *IntegrationService) PlanDeleteKey(ctx context.Context, ic IntegrationServiceIC, notify IntegrationNotifier) error {
+	plan := &IntegrationService{ic: ic, manifest: svc.manifest, notify: notify, keyStore: MemKeyStore{}}
+	return plan.DeleteKey(ctx)
+}
+
 func (svc *IntegrationService) TestKey(ctx context.Context) *TestKeyResult {
 	if svc.ic == nil || !svc.ic.HasAPIKey() {
 		return &TestKeyResult{OK: false, Error: "no API key configured"}
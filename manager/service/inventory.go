@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+)
+
+const (
+	InventoryZone      = "zone"
+	InventoryPolicy    = "policy"
+	InventoryDNSPolicy = "dns_policy"
+)
+
+// resourceNamePrefix starts the name of every zone and policy we create.
+const resourceNamePrefix = "VPN Pack: "
+
+// IntegrationObject is a zone, policy or DNS policy of ours on the
+// controller. Owner is the manifest entry that records it: "tailscale",
+// "wg-s2s:<tunnel>", "wan:<marker>" or "dns:<marker>". An object with no
+// owner whose name the config does not call for either is an orphan.
+type IntegrationObject struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Owner  string `json:"owner,omitempty"`
+	Orphan bool   `json:"orphan"`
+}
+
+type IntegrationInventory struct {
+	CheckedAt time.Time           `json:"checkedAt"`
+	Objects   []IntegrationObject `json:"objects"`
+	Orphans   int                 `json:"orphans"`
+}
+
+type OrphanGCFailure struct {
+	IntegrationObject
+	Error string `json:"error"`
+}
+
+type OrphanGCResult struct {
+	Deleted []IntegrationObject `json:"deleted"`
+	Failed  []OrphanGCFailure   `json:"failed,omitempty"`
+}
+
+// ActiveNames lists the names of objects the running config calls for that
+// may not be in the manifest yet, such as the WAN port policies of the
+// ports currently open.
+type ActiveNames func(ctx context.Context) []string
+
+func (o *FirewallOrchestrator) SetActiveNames(fn ActiveNames) {
+	o.activeNames = fn
+}
+
+// Inventory lists every zone, policy and DNS policy we own: by manifest ID,
+// by the "VPN Pack: " name prefix, and for DNS policies by the Tailscale
+// resolver they forward to. It only reads.
+//
+// A duplicate of a wanted policy is not an orphan; drift detection reports
+// it as stale.
+func (o *FirewallOrchestrator) Inventory(ctx context.Context) (*IntegrationInventory, error) {
+	if err := o.requireIntegration(); err != nil {
+		return nil, preconditionError("integration API not configured")
+	}
+	siteID := o.manifest.GetSiteID()
+	zones, err := o.ic.ListZones(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to list firewall zones", err)
+	}
+	policies, err := o.ic.ListPolicies(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to list firewall policies", err)
+	}
+	dnsPolicies, err := o.ic.ListDNSPolicies(ctx, siteID)
+	if err != nil {
+		return nil, upstreamError("failed to list DNS policies", err)
+	}
+
+	owners := o.manifestOwners()
+	wanted := o.wantedNames(ctx)
+	inv := &IntegrationInventory{CheckedAt: time.Now(), Objects: []IntegrationObject{}}
+	add := func(kind, id, name string, ours bool) {
+		owner := owners[id]
+		if owner == "" && !ours {
+			return
+		}
+		obj := IntegrationObject{Kind: kind, ID: id, Name: name, Owner: owner, Orphan: owner == "" && !wanted[name]}
+		if obj.Orphan {
+			inv.Orphans++
+		}
+		inv.Objects = append(inv.Objects, obj)
+	}
+	for _, z := range zones {
+		add(InventoryZone, z.ID, z.Name, strings.HasPrefix(z.Name, resourceNamePrefix))
+	}
+	for _, p := range policies {
+		if p.Metadata != nil && p.Metadata.Origin == domain.PolicyOriginDerived {
+			continue // the controller removes it with its parent
+		}
+		add(InventoryPolicy, p.ID, p.Name, strings.HasPrefix(p.Name, resourceNamePrefix))
+	}
+	for _, p := range dnsPolicies {
+		add(InventoryDNSPolicy, p.ID, p.Domain, p.Type == "FORWARD_DOMAIN" && p.IPAddress == config.TailscaleDNSResolverIP)
+	}
+	return inv, nil
+}
+
+// manifestOwners maps the ID of every object in the manifest to its owner.
+func (o *FirewallOrchestrator) manifestOwners() map[string]string {
+	owners := make(map[string]string)
+	own := func(owner string, ids ...string) {
+		for _, id := range ids {
+			if id != "" {
+				owners[id] = owner
+			}
+		}
+	}
+	ts := o.manifest.GetTailscaleZone()
+	own("tailscale", ts.ZoneID)
+	own("tailscale", ts.PolicyIDs...)
+	for tunnelID, zm := range o.manifest.GetWgS2sSnapshot() {
+		own("wg-s2s:"+tunnelID, zm.ZoneID)
+		own("wg-s2s:"+tunnelID, zm.PolicyIDs...)
+	}
+	for marker, e := range o.manifest.GetWanPortsSnapshot() {
+		own("wan:"+marker, e.PolicyID)
+	}
+	if e, ok := o.manifest.GetDNSPolicy(config.DNSMarkerTailscale); ok {
+		own("dns:"+config.DNSMarkerTailscale, e.PolicyID)
+	}
+	return owners
+}
+
+// wantedNames is every name the config calls for, recorded or not: the
+// Tailscale zone, which setup always ensures, the managed zones, their
+// policies per template, and whatever the active names hook adds.
+func (o *FirewallOrchestrator) wantedNames(ctx context.Context) map[string]bool {
+	wanted := make(map[string]bool)
+	keys := []string{tailscalePolicyZone}
+	for _, z := range o.managedZones() {
+		if !slices.Contains(keys, z.key) {
+			keys = append(keys, z.key)
+		}
+	}
+	for _, key := range keys {
+		wanted[resourceNamePrefix+key] = true
+		for _, p := range domain.ZonePolicies(key, "", "", o.templateRules(key)) {
+			wanted[p.Name] = true
+		}
+	}
+	for _, e := range o.manifest.GetWanPortsSnapshot() {
+		wanted[e.PolicyName] = true
+	}
+	if e, ok := o.manifest.GetDNSPolicy(config.DNSMarkerTailscale); ok {
+		wanted[e.Domain] = true
+	}
+	if o.activeNames != nil {
+		for _, name := range o.activeNames(ctx) {
+			wanted[name] = true
+		}
+	}
+	return wanted
+}
+
+// CollectOrphans deletes the orphans of a fresh inventory, limited to ids
+// when any are given, so an object adopted since the caller's inventory is
+// left alone. Policies go before DNS policies and zones, which the
+// controller will not delete while a policy still refers to them. A failed
+// delete does not stop the rest.
+func (o *FirewallOrchestrator) CollectOrphans(ctx context.Context, ids []string) (*OrphanGCResult, error) {
+	inv, err := o.Inventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	siteID := o.manifest.GetSiteID()
+	result := &OrphanGCResult{Deleted: []IntegrationObject{}}
+	for _, kind := range []string{InventoryPolicy, InventoryDNSPolicy, InventoryZone} {
+		for _, obj := range inv.Objects {
+			if obj.Kind != kind || !obj.Orphan || (len(ids) > 0 && !slices.Contains(ids, obj.ID)) {
+				continue
+			}
+			if err := o.deleteObject(ctx, siteID, obj); err != nil {
+				slog.Warn("orphan delete failed", "kind", obj.Kind, "name", obj.Name, "id", obj.ID, "err", err)
+				result.Failed = append(result.Failed, OrphanGCFailure{IntegrationObject: obj, Error: err.Error()})
+				continue
+			}
+			slog.Info("orphan deleted", "kind", obj.Kind, "name", obj.Name, "id", obj.ID)
+			result.Deleted = append(result.Deleted, obj)
+		}
+	}
+	return result, nil
+}
+
+func (o *FirewallOrchestrator) deleteObject(ctx context.Context, siteID string, obj IntegrationObject) error {
+	switch obj.Kind {
+	case InventoryPolicy:
+		return o.ic.DeletePolicy(ctx, siteID, obj.ID)
+	case InventoryDNSPolicy:
+		return o.ic.DeleteDNSPolicy(ctx, siteID, obj.ID)
+	case InventoryZone:
+		return o.ic.DeleteZone(ctx, siteID, obj.ID)
+	}
+	return fmt.Errorf("unknown object kind %q", obj.Kind)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inventoryFixture is a recorded Tailscale zone and DNS policy next to the
+// leftovers of a deleted S2S zone, a WAN port policy not recorded yet and
+// objects that are not ours.
+func inventoryFixture() (*mockFWIntegration, *mockFWManifest, *FirewallOrchestrator) {
+	ts := livePolicies(domain.ZonePolicies("Tailscale", "zone-ts", "zone-int", nil), "pol-in", "pol-out")
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		zones: []domain.Zone{
+			{ID: "zone-ts", Name: "VPN Pack: Tailscale"},
+			{ID: "zone-int", Name: "Internal"},
+			{ID: "zone-old", Name: "VPN Pack: Old Branch"},
+		},
+		policies: append(ts,
+			domain.Policy{ID: "pol-old", Name: "VPN Pack: Allow Old Branch to Internal"},
+			domain.Policy{ID: "pol-ret", Name: "VPN Pack: Allow Old Branch to Internal (Return)", Metadata: &domain.PolicyMetadata{Origin: domain.PolicyOriginDerived}},
+			domain.Policy{ID: "pol-wan", Name: "VPN Pack: Tailscale WireGuard UDP 41641"},
+			domain.Policy{ID: "pol-user", Name: "Block IoT"},
+		),
+		dnsPolicies: []domain.DNSPolicy{
+			{ID: "dns-ts", Type: "FORWARD_DOMAIN", Domain: "tail1.ts.net", IPAddress: config.TailscaleDNSResolverIP},
+			{ID: "dns-old", Type: "FORWARD_DOMAIN", Domain: "old.ts.net", IPAddress: config.TailscaleDNSResolverIP},
+			{ID: "dns-user", Type: "FORWARD_DOMAIN", Domain: "corp.example", IPAddress: "10.0.0.53"},
+		},
+	}
+	mf := &mockFWManifest{
+		siteID:        "site-1",
+		tailscaleZone: domain.ZoneManifest{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale", PolicyIDs: []string{"pol-in", "pol-out"}},
+		dnsPolicies: map[string]domain.DNSPolicyEntry{
+			config.DNSMarkerTailscale: {PolicyID: "dns-ts", Domain: "tail1.ts.net"},
+		},
+	}
+	o := newTestOrch(ic, mf, &mockFWOps{})
+	o.SetActiveNames(func(context.Context) []string {
+		return []string{"VPN Pack: Tailscale WireGuard UDP 41641"}
+	})
+	return ic, mf, o
+}
+
+func TestIntegrationInventory(t *testing.T) {
+	_, _, o := inventoryFixture()
+	inv, err := o.Inventory(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []IntegrationObject{
+		{Kind: InventoryZone, ID: "zone-ts", Name: "VPN Pack: Tailscale", Owner: "tailscale"},
+		{Kind: InventoryZone, ID: "zone-old", Name: "VPN Pack: Old Branch", Orphan: true},
+		{Kind: InventoryPolicy, ID: "pol-in", Name: "VPN Pack: Allow Tailscale to Internal", Owner: "tailscale"},
+		{Kind: InventoryPolicy, ID: "pol-out", Name: "VPN Pack: Allow Internal to Tailscale", Owner: "tailscale"},
+		{Kind: InventoryPolicy, ID: "pol-old", Name: "VPN Pack: Allow Old Branch to Internal", Orphan: true},
+		{Kind: InventoryPolicy, ID: "pol-wan", Name: "VPN Pack: Tailscale WireGuard UDP 41641"},
+		{Kind: InventoryDNSPolicy, ID: "dns-ts", Name: "tail1.ts.net", Owner: "dns:" + config.DNSMarkerTailscale},
+		{Kind: InventoryDNSPolicy, ID: "dns-old", Name: "old.ts.net", Orphan: true},
+	}, inv.Objects)
+	assert.Equal(t, 3, inv.Orphans)
+
+	_, err = newTestOrch(&mockFWIntegration{}, &mockFWManifest{siteID: "site-1"}, &mockFWOps{}).Inventory(context.Background())
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrPrecondition, se.Kind)
+}
+
+func TestIntegrationInventory_WantedNameIsNotOrphan(t *testing.T) {
+	_, mf, o := inventoryFixture()
+	// The zone was set up again under a new ID that is not live yet.
+	mf.wgS2sZones = map[string]domain.ZoneManifest{"t1": {ZoneID: "zone-new", ZoneName: "VPN Pack: Old Branch"}}
+
+	inv, err := o.Inventory(context.Background())
+	require.NoError(t, err)
+	for _, obj := range inv.Objects {
+		if obj.ID == "zone-old" || obj.ID == "pol-old" {
+			assert.False(t, obj.Orphan, obj.ID)
+		}
+	}
+	assert.Equal(t, 1, inv.Orphans, "only the old DNS policy is left")
+}
+
+func TestCollectOrphans(t *testing.T) {
+	ic, _, o := inventoryFixture()
+	var deleted []string
+	ic.deletePolicy = func(_ context.Context, _, id string) error {
+		deleted = append(deleted, id)
+		return nil
+	}
+	ic.deleteDNS = func(_ context.Context, _, id string) error {
+		deleted = append(deleted, id)
+		return errors.New("boom")
+	}
+	ic.deleteZone = func(_ context.Context, _, id string) error {
+		deleted = append(deleted, id)
+		return nil
+	}
+
+	result, err := o.CollectOrphans(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pol-old", "dns-old", "zone-old"}, deleted, "policies before zones; a failure does not stop the rest")
+	assert.Len(t, result.Deleted, 2)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, "dns-old", result.Failed[0].ID)
+	assert.Equal(t, "boom", result.Failed[0].Error)
+
+	deleted = nil
+	_, err = o.CollectOrphans(context.Background(), []string{"zone-old", "pol-in"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zone-old"}, deleted, "only listed orphans are deleted")
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/state"
+)
+
+const (
+	pairingKeyFile    = "pairing.key"
+	pairingUsedFile   = "pairing-used.json"
+	pairingOffersFile = "pairing-offers.json"
+)
+
+// FilePairingStore keeps the pairing signing key, the used-nonce list and the
+// issued offers in dir, next to the tunnel keys. The key is created on first
+// use. Offers of completed pairings hold the previous preshared key, so the
+// file gets the same permissions as the keys.
+type FilePairingStore struct {
+	dir string
+
+	mu  sync.Mutex
+	key ed25519.PrivateKey
+}
+
+func NewFilePairingStore(dir string) *FilePairingStore {
+	return &FilePairingStore{dir: dir}
+}
+
+func (s *FilePairingStore) SigningKey() (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	path := filepath.Join(s.dir, pairingKeyFile)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("pairing key %s is corrupt", path)
+		}
+		s.key = ed25519.NewKeyFromSeed(seed)
+		return s.key, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("read pairing key: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate pairing key: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, config.SecretDirPerm); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Seed()) + "\n"
+	if err := state.WriteFile(path, []byte(encoded), config.SecretPerm); err != nil {
+		return nil, fmt.Errorf("save pairing key: %w", err)
+	}
+	s.key = key
+	return s.key, nil
+}
+
+func (s *FilePairingStore) Used(nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, err := s.loadUsed()
+	if err != nil {
+		return false, err
+	}
+	_, ok := used[nonce]
+	return ok, nil
+}
+
+// MarkUsed records nonce until expiresAt; past that the bundle is refused
+// for being expired, so the entry is pruned.
+func (s *FilePairingStore) MarkUsed(nonce string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, err := s.loadUsed()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for n, exp := range used {
+		if now.After(exp) {
+			delete(used, n)
+		}
+	}
+	used[nonce] = expiresAt
+	data, err := json.Marshal(used)
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(filepath.Join(s.dir, pairingUsedFile), data, config.SecretPerm)
+}
+
+func (s *FilePairingStore) loadUsed() (map[string]time.Time, error) {
+	used, _, err := state.LoadJSON(filepath.Join(s.dir, pairingUsedFile), map[string]time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("read pairing state: %w", err)
+	}
+	if used == nil {
+		used = map[string]time.Time{}
+	}
+	return used, nil
+}
+
+func (s *FilePairingStore) Offers() ([]PairingOffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadOffers()
+}
+
+// SaveOffer adds o or replaces the offer with the same nonce.
+func (s *FilePairingStore) SaveOffer(o PairingOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offers, err := s.loadOffers()
+	if err != nil {
+		return err
+	}
+	offers = slices.DeleteFunc(offers, func(x PairingOffer) bool { return x.Nonce == o.Nonce })
+	return s.saveOffers(append(offers, o))
+}
+
+func (s *FilePairingStore) DeleteOffer(nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offers, err := s.loadOffers()
+	if err != nil {
+		return err
+	}
+	return s.saveOffers(slices.DeleteFunc(offers, func(x PairingOffer) bool { return x.Nonce == nonce }))
+}
+
+func (s *FilePairingStore) loadOffers() ([]PairingOffer, error) {
+	offers, _, err := state.LoadJSON(filepath.Join(s.dir, pairingOffersFile), []PairingOffer{})
+	if err != nil {
+		return nil, fmt.Errorf("read pairing offers: %w", err)
+	}
+	return offers, nil
+}
+
+func (s *FilePairingStore) saveOffers(offers []PairingOffer) error {
+	if err := os.MkdirAll(s.dir, config.SecretDirPerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(offers)
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(filepath.Join(s.dir, pairingOffersFile), data, config.SecretPerm)
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+
+	"tailscale.com/tailcfg"
+)
+
+// PathMTUResult is the path MTU towards one S2S tunnel's peers or the
+// preferred DERP region. PathMTU is the largest packet that made it with DF
+// set, 0 if the host never answered. For a tunnel, RecommendedMTU is set
+// when the tunnel MTU plus WireGuard overhead does not fit the path; for
+// DERP, TunnelMTU is tailscaled's and there is nothing to apply.
+type PathMTUResult struct {
+	Kind           string   `json:"kind"` // "wgs2s" or "derp"
+	TunnelID       string   `json:"tunnelID,omitempty"`
+	Name           string   `json:"name"`
+	Hosts          []string `json:"hosts"`
+	PathMTU        int      `json:"pathMTU,omitempty"`
+	TunnelMTU      int      `json:"tunnelMTU"`
+	Fragments      bool     `json:"fragments,omitempty"`
+	RecommendedMTU int      `json:"recommendedMTU,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+const (
+	pmtuMin = 576
+	pmtuMax = 1500
+	// wgOverhead is WireGuard's per-packet cost over an IPv6 outer header
+	// (40 IP + 8 UDP + 32 WG). DefaultMTU = 1500 - wgOverhead; using the
+	// IPv6 figure for every peer keeps one MTU valid if the endpoint flips
+	// family.
+	wgOverhead    = 80
+	pmtuCacheTTL  = 10 * time.Minute
+	pmtuTimeout   = 20 * time.Second
+	pmtuProbeWait = "1" // ping -W, seconds
+)
+
+// pmtuProbe reports whether an ICMP echo of mtu bytes, DF set, is answered by
+// host. A lost or too-big probe is (false, nil); err means the host cannot be
+// probed at all.
+type pmtuProbe func(ctx context.Context, host string, mtu int) (bool, error)
+
+// pingProbe sends one `ping -M do` sized to mtu. iputils exits 1 when no reply
+// came back, which covers both a black hole and an ICMP "frag needed".
+func pingProbe(ctx context.Context, host string, mtu int) (bool, error) {
+	family, headers := "-4", 28 // IPv4 + ICMP
+	if a, err := netip.ParseAddr(host); err == nil && a.Unmap().Is6() {
+		family, headers = "-6", 48
+	}
+	err := exec.CommandContext(ctx, "ping", family, "-M", "do", "-c", "1", "-W", pmtuProbeWait,
+		"-s", strconv.Itoa(mtu-headers), host).Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("ping %s: %w", host, err)
+}
+
+// findPathMTU binary-searches [pmtuMin, pmtuMax] for the largest packet that
+// gets through to host.
+func findPathMTU(ctx context.Context, probe pmtuProbe, host string) (int, error) {
+	ok, err := probe(ctx, host, pmtuMin)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%s does not answer ping", host)
+	}
+	if ok, err := probe(ctx, host, pmtuMax); err != nil {
+		return 0, err
+	} else if ok {
+		return pmtuMax, nil
+	}
+	lo, hi := pmtuMin, pmtuMax // lo gets through, hi does not
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := probe(ctx, host, mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// probeTarget fills in r from the smallest path MTU over r.Hosts.
+func probeTarget(ctx context.Context, probe pmtuProbe, r *PathMTUResult) {
+	for _, host := range r.Hosts {
+		mtu, err := findPathMTU(ctx, probe, host)
+		if err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		if r.PathMTU == 0 || mtu < r.PathMTU {
+			r.PathMTU = mtu
+		}
+	}
+	if r.PathMTU == 0 {
+		return
+	}
+	r.Fragments = r.TunnelMTU+wgOverhead > r.PathMTU
+	if r.Kind == "wgs2s" && r.Fragments && r.PathMTU-wgOverhead >= wgMinMTU {
+		r.RecommendedMTU = r.PathMTU - wgOverhead
+	}
+}
+
+// tunnelPMTUTarget is the probe target of a tunnel, or false if no peer has
+// an endpoint (the passive side of a tunnel).
+func tunnelPMTUTarget(t wgs2s.TunnelConfig) (PathMTUResult, bool) {
+	r := PathMTUResult{Kind: "wgs2s", TunnelID: t.ID, Name: t.Name, TunnelMTU: t.MTU}
+	if r.TunnelMTU == 0 {
+		r.TunnelMTU = wgs2s.DefaultMTU
+	}
+	endpoints := []string{t.PeerEndpoint}
+	for _, p := range t.Peers {
+		endpoints = append(endpoints, p.Endpoint)
+	}
+	for _, ep := range endpoints {
+		host, _, err := net.SplitHostPort(ep)
+		if err != nil || host == "" || slices.Contains(r.Hosts, host) {
+			continue
+		}
+		r.Hosts = append(r.Hosts, host)
+	}
+	return r, len(r.Hosts) > 0
+}
+
+// derpPMTUTarget is the probe target for the preferred DERP region. DERP
+// itself runs over TCP, but its path is the one direct UDP to peers takes
+// out of the WAN, which is what a Tailscale MTU problem shows up on.
+func derpPMTUTarget(derpMap *tailcfg.DERPMap, preferred int) (PathMTUResult, bool) {
+	if derpMap == nil {
+		return PathMTUResult{}, false
+	}
+	reg := derpMap.Regions[preferred]
+	if reg == nil || len(reg.Nodes) == 0 {
+		return PathMTUResult{}, false
+	}
+	host := reg.Nodes[0].IPv4
+	if host == "" {
+		host = reg.Nodes[0].HostName
+	}
+	return PathMTUResult{Kind: "derp", Name: reg.RegionCode, Hosts: []string{host}, TunnelMTU: tailscaleMTU}, true
+}
+
+// pathMTUCache holds the last probe run. A full run can take several
+// seconds per black-holed host, so it runs in the background, one at a
+// time, and callers are served what the last one found.
+type pathMTUCache struct {
+	mu      sync.Mutex
+	results []PathMTUResult
+	at      time.Time
+	running bool
+	gen     int            // bumped to discard the run in flight
+	wg      sync.WaitGroup // the run in flight
+}
+
+func (svc *DiagnosticsService) pmtuProber() pmtuProbe {
+	if svc.probeMTU != nil {
+		return svc.probeMTU
+	}
+	return pingProbe
+}
+
+// pathMTU returns the last probe run and whether a newer one is pending.
+// With no run younger than pmtuCacheTTL it starts one in the background,
+// unless one is already going, so concurrent callers share it; until it
+// lands they get the older results, or none.
+func (svc *DiagnosticsService) pathMTU(derpMap *tailcfg.DERPMap, preferredDERP int) ([]PathMTUResult, bool) {
+	c := &svc.pmtu
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results != nil && time.Since(c.at) < pmtuCacheTTL {
+		return slices.Clone(c.results), false
+	}
+	if !c.running {
+		c.running = true
+		targets, gen := svc.pmtuTargets(derpMap, preferredDERP), c.gen
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			svc.probePathMTU(targets)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.running = false
+			if c.gen == gen {
+				c.results, c.at = targets, time.Now()
+			}
+		}()
+	}
+	return slices.Clone(c.results), true
+}
+
+// pmtuTargets lists every enabled tunnel with a peer endpoint and the
+// preferred DERP region.
+func (svc *DiagnosticsService) pmtuTargets(derpMap *tailcfg.DERPMap, preferredDERP int) []PathMTUResult {
+	targets := []PathMTUResult{}
+	if wgSvc := svc.loadWgS2s(); wgSvc != nil {
+		for _, t := range wgSvc.GetTunnels() {
+			if !t.Enabled {
+				continue
+			}
+			if r, ok := tunnelPMTUTarget(t); ok {
+				targets = append(targets, r)
+			}
+		}
+	}
+	if r, ok := derpPMTUTarget(derpMap, preferredDERP); ok {
+		targets = append(targets, r)
+	}
+	return targets
+}
+
+// probePathMTU probes targets concurrently, within pmtuTimeout.
+func (svc *DiagnosticsService) probePathMTU(targets []PathMTUResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), pmtuTimeout)
+	defer cancel()
+	probe := svc.pmtuProber()
+	var wg sync.WaitGroup
+	wg.Add(len(targets))
+	for i := range targets {
+		go func() {
+			defer wg.Done()
+			probeTarget(ctx, probe, &targets[i])
+		}()
+	}
+	wg.Wait()
+}
+
+// TunnelPathMTU probes one tunnel's peers afresh, for applying its
+// recommendation. It drops the cached run, and any run in flight, which
+// would otherwise keep recommending against the MTU the caller is about to
+// change.
+func (svc *DiagnosticsService) TunnelPathMTU(ctx context.Context, id string) (*PathMTUResult, error) {
+	wgSvc := svc.loadWgS2s()
+	if wgSvc == nil {
+		return nil, &Error{Kind: ErrUnavailable, Message: "WG S2S manager not initialized"}
+	}
+	tunnels := wgSvc.GetTunnels()
+	idx := slices.IndexFunc(tunnels, func(t wgs2s.TunnelConfig) bool { return t.ID == id })
+	if idx < 0 {
+		return nil, notFoundError(fmt.Sprintf("tunnel %s not found", id))
+	}
+	svc.pmtu.mu.Lock()
+	svc.pmtu.results = nil
+	svc.pmtu.gen++
+	svc.pmtu.mu.Unlock()
+
+	r, ok := tunnelPMTUTarget(tunnels[idx])
+	if !ok {
+		return nil, preconditionError("tunnel has no peer endpoint to probe")
+	}
+	pctx, cancel := context.WithTimeout(ctx, pmtuTimeout)
+	defer cancel()
+	probeTarget(pctx, svc.pmtuProber(), &r)
+	return &r, nil
+}
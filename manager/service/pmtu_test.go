@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+// pathWithMTU is a probe for hosts whose path carries up to mtus[host].
+func pathWithMTU(mtus map[string]int) pmtuProbe {
+	return func(_ context.Context, host string, mtu int) (bool, error) {
+		limit, ok := mtus[host]
+		if !ok {
+			return false, errors.New("unknown host")
+		}
+		return mtu <= limit, nil
+	}
+}
+
+func TestFindPathMTU(t *testing.T) {
+	probe := pathWithMTU(map[string]int{"pppoe": 1492, "lte": 1428, "full": 1500, "tiny": 600, "silent": 0})
+
+	for host, want := range map[string]int{"pppoe": 1492, "lte": 1428, "full": 1500, "tiny": 600} {
+		got, err := findPathMTU(context.Background(), probe, host)
+		require.NoError(t, err, host)
+		assert.Equal(t, want, got, host)
+	}
+
+	_, err := findPathMTU(context.Background(), probe, "silent")
+	assert.ErrorContains(t, err, "does not answer ping")
+	_, err = findPathMTU(context.Background(), probe, "nowhere")
+	assert.Error(t, err)
+}
+
+func TestTunnelPMTUTarget(t *testing.T) {
+	r, ok := tunnelPMTUTarget(wgs2s.TunnelConfig{
+		ID: "t1", Name: "office",
+		PeerEndpoint: "203.0.113.1:51820",
+		Peers: []wgs2s.Peer{
+			{Endpoint: "203.0.113.1:51820"},
+			{Endpoint: "[2001:db8::1]:51820"},
+			{},
+		},
+	})
+	require.True(t, ok)
+	assert.Equal(t, []string{"203.0.113.1", "2001:db8::1"}, r.Hosts)
+	assert.Equal(t, wgs2s.DefaultMTU, r.TunnelMTU, "MTU 0 means the default")
+
+	_, ok = tunnelPMTUTarget(wgs2s.TunnelConfig{ID: "t2"})
+	assert.False(t, ok, "a tunnel without endpoints is not probed")
+}
+
+func TestProbeTargetRecommendation(t *testing.T) {
+	probe := pathWithMTU(map[string]int{"a": 1500, "b": 1492})
+
+	r := PathMTUResult{Kind: "wgs2s", Hosts: []string{"a", "b"}, TunnelMTU: 1420}
+	probeTarget(context.Background(), probe, &r)
+	assert.Equal(t, 1492, r.PathMTU, "the narrowest peer path wins")
+	assert.True(t, r.Fragments)
+	assert.Equal(t, 1412, r.RecommendedMTU)
+
+	r = PathMTUResult{Kind: "wgs2s", Hosts: []string{"a"}, TunnelMTU: 1420}
+	probeTarget(context.Background(), probe, &r)
+	assert.False(t, r.Fragments)
+	assert.Zero(t, r.RecommendedMTU)
+
+	r = PathMTUResult{Kind: "derp", Hosts: []string{"b"}, TunnelMTU: tailscaleMTU}
+	probeTarget(context.Background(), probe, &r)
+	assert.False(t, r.Fragments)
+	assert.Zero(t, r.RecommendedMTU, "nothing to apply for DERP")
+}
+
+func TestGetDiagnostics_PathMTU(t *testing.T) {
+	var probes atomic.Int32
+	svc := newTestDiagnosticsService(func(s *DiagnosticsService) {
+		s.ts = &mockDiagnosticsTailscale{
+			currentDERPMapFn: func(ctx context.Context) (*tailcfg.DERPMap, error) {
+				return &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+					1: {RegionID: 1, RegionCode: "fra", Nodes: []*tailcfg.DERPNode{{HostName: "derp1.example", IPv4: "198.51.100.1"}}},
+				}}, nil
+			},
+		}
+		s.netcheckCache, s.netcheckCacheAt = &NetcheckResult{PreferredDERP: 1}, time.Now()
+		s.wg = &mockDiagnosticsWgS2s{getTunnelsFn: func() []wgs2s.TunnelConfig {
+			return []wgs2s.TunnelConfig{
+				{ID: "t1", Name: "office", Enabled: true, PeerEndpoint: "203.0.113.1:51820"},
+				{ID: "t2", Name: "off", Enabled: false, PeerEndpoint: "203.0.113.2:51820"},
+			}
+		}}
+		probe := pathWithMTU(map[string]int{"203.0.113.1": 1492, "198.51.100.1": 1500})
+		s.probeMTU = func(ctx context.Context, host string, mtu int) (bool, error) {
+			probes.Add(1)
+			return probe(ctx, host, mtu)
+		}
+	})
+
+	resp, err := svc.GetDiagnostics(context.Background())
+	require.NoError(t, err)
+	assert.True(t, resp.PathMTUPending, "a cold cache must not hold up diagnostics")
+	assert.Empty(t, resp.PathMTU)
+	svc.pmtu.wg.Wait()
+
+	resp, err = svc.GetDiagnostics(context.Background())
+	require.NoError(t, err)
+	assert.False(t, resp.PathMTUPending)
+	require.Len(t, resp.PathMTU, 2)
+	assert.Equal(t, "t1", resp.PathMTU[0].TunnelID)
+	assert.Equal(t, 1412, resp.PathMTU[0].RecommendedMTU)
+	assert.Equal(t, "fra", resp.PathMTU[1].Name)
+	assert.Equal(t, 1500, resp.PathMTU[1].PathMTU)
+
+	n := probes.Load()
+	_, err = svc.GetDiagnostics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, n, probes.Load(), "a second run within the TTL must be served from cache")
+
+	r, err := svc.TunnelPathMTU(context.Background(), "t1")
+	require.NoError(t, err)
+	assert.Equal(t, 1412, r.RecommendedMTU)
+	assert.Nil(t, svc.pmtu.results, "a fresh tunnel probe drops the cached run")
+
+	_, err = svc.TunnelPathMTU(context.Background(), "missing")
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrNotFound, se.Kind)
+}
+
+func TestPathMTU_ConcurrentCallersShareOneRun(t *testing.T) {
+	release := make(chan struct{})
+	var runs atomic.Int32
+	svc := newTestDiagnosticsService(func(s *DiagnosticsService) {
+		s.wg = &mockDiagnosticsWgS2s{getTunnelsFn: func() []wgs2s.TunnelConfig {
+			return []wgs2s.TunnelConfig{{ID: "t1", Enabled: true, PeerEndpoint: "203.0.113.1:51820"}}
+		}}
+		s.probeMTU = func(_ context.Context, _ string, mtu int) (bool, error) {
+			if mtu == pmtuMin {
+				runs.Add(1)
+				<-release
+			}
+			return true, nil
+		}
+	})
+
+	for range 3 {
+		results, pending := svc.pathMTU(nil, 0)
+		assert.True(t, pending)
+		assert.Empty(t, results)
+	}
+	close(release)
+	svc.pmtu.wg.Wait()
+	assert.Equal(t, int32(1), runs.Load(), "callers during a run must share it")
+
+	results, pending := svc.pathMTU(nil, 0)
+	assert.False(t, pending)
+	require.Len(t, results, 1)
+	assert.Equal(t, pmtuMax, results[0].PathMTU)
+}
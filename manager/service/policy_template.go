@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"unifi-tailscale/manager/domain"
+)
+
+// tailscalePolicyZone is the template key of the Tailscale zone; WireGuard
+// S2S zones are keyed by the zone name their tunnels were set up with.
+const tailscalePolicyZone = "Tailscale"
+
+const (
+	maxPolicyTemplates     = 32
+	maxPolicyTemplateRules = 32
+	maxPolicyRuleItems     = 32
+	maxPolicyName          = 64
+)
+
+func (o *FirewallOrchestrator) PolicyTemplates() []domain.PolicyTemplate {
+	t := o.manifest.GetPolicyTemplates()
+	if t == nil {
+		return []domain.PolicyTemplate{}
+	}
+	return t
+}
+
+// SetPolicyTemplate creates or replaces the template of tpl.Zone. It only
+// stores it; ApplyPolicyTemplate brings the zone's policies in line.
+func (o *FirewallOrchestrator) SetPolicyTemplate(tpl domain.PolicyTemplate) (domain.PolicyTemplate, error) {
+	if err := normalizePolicyTemplate(&tpl); err != nil {
+		return domain.PolicyTemplate{}, err
+	}
+	o.tplMu.Lock()
+	defer o.tplMu.Unlock()
+	templates := o.manifest.GetPolicyTemplates()
+	if i := slices.IndexFunc(templates, func(x domain.PolicyTemplate) bool { return x.Zone == tpl.Zone }); i >= 0 {
+		templates[i] = tpl
+	} else if len(templates) >= maxPolicyTemplates {
+		return domain.PolicyTemplate{}, validationError(fmt.Sprintf("too many policy templates (max %d)", maxPolicyTemplates))
+	} else {
+		templates = append(templates, tpl)
+	}
+	if err := o.manifest.SetPolicyTemplates(templates); err != nil {
+		return domain.PolicyTemplate{}, internalError("failed to save policy template", err)
+	}
+	return tpl, nil
+}
+
+// DeletePolicyTemplate drops the template of zone; once applied, the zone is
+// back to the default allow-all pair.
+func (o *FirewallOrchestrator) DeletePolicyTemplate(zone string) error {
+	o.tplMu.Lock()
+	defer o.tplMu.Unlock()
+	templates := o.manifest.GetPolicyTemplates()
+	i := slices.IndexFunc(templates, func(x domain.PolicyTemplate) bool { return x.Zone == zone })
+	if i < 0 {
+		return notFoundError(fmt.Sprintf("no policy template for zone %q", zone))
+	}
+	if err := o.manifest.SetPolicyTemplates(slices.Delete(templates, i, i+1)); err != nil {
+		return internalError("failed to save policy templates", err)
+	}
+	return nil
+}
+
+// templateRules returns the rules of zone's template, nil for the defaults.
+func (o *FirewallOrchestrator) templateRules(zone string) []domain.PolicyRule {
+	for _, t := range o.manifest.GetPolicyTemplates() {
+		if t.Zone == zone {
+			return t.Rules
+		}
+	}
+	return nil
+}
+
+// ApplyPolicyTemplate brings the policies of zone in line with its template
+// and deletes the ones no longer wanted. A zone that is not set up yet, or
+// an integration that is not configured, picks the template up at setup.
+func (o *FirewallOrchestrator) ApplyPolicyTemplate(ctx context.Context, zone string) error {
+	if err := o.requireIntegration(); err != nil {
+		return nil
+	}
+	stale, keep, err := o.ensureZonePolicies(ctx, zone)
+	if err != nil {
+		return err
+	}
+	o.deleteStalePolicies(ctx, o.manifest.GetSiteID(), stale, keep)
+	return nil
+}
+
+// ensureZonePolicies replaces the policies of zone that differ from its
+// template and records them in the manifest. It returns the policy IDs the
+// zone used before and the ones it uses now; deleting the difference is
+// left to the caller.
+func (o *FirewallOrchestrator) ensureZonePolicies(ctx context.Context, zone string) (stale, keep []string, err error) {
+	siteID := o.manifest.GetSiteID()
+	rules := o.templateRules(zone)
+
+	if zone == tailscalePolicyZone {
+		ts := o.manifest.GetTailscaleZone()
+		if ts.ZoneID == "" {
+			return nil, nil, nil
+		}
+		ids, err := o.ic.ReplacePolicies(ctx, siteID, zone, ts.ZoneID, rules)
+		if err != nil {
+			return nil, nil, upstreamError("failed to apply policy template", err)
+		}
+		if err := o.manifest.SetTailscaleZone(ts.ZoneID, ts.ZoneName, ids, ts.ChainPrefix); err != nil {
+			return nil, nil, internalError("failed to save manifest", err)
+		}
+		return ts.PolicyIDs, ids, nil
+	}
+
+	// Tunnels sharing a zone share its policies: ensure them once per zone.
+	applied := make(map[string][]string)
+	for tunnelID, zm := range o.manifest.GetWgS2sSnapshot() {
+		if zm.ZoneID == "" || zm.ZoneName != "VPN Pack: "+zone {
+			continue
+		}
+		ids, ok := applied[zm.ZoneID]
+		if !ok {
+			ids, err = o.ic.ReplacePolicies(ctx, siteID, zone, zm.ZoneID, rules)
+			if err != nil {
+				return nil, nil, upstreamError("failed to apply policy template", err)
+			}
+			applied[zm.ZoneID] = ids
+			keep = append(keep, ids...)
+		}
+		stale = append(stale, zm.PolicyIDs...)
+		zm.PolicyIDs = ids
+		if err := o.manifest.SetWgS2sZone(tunnelID, zm); err != nil {
+			return nil, nil, internalError("failed to save manifest", err)
+		}
+	}
+	return stale, keep, nil
+}
+
+// deleteStalePolicies deletes the policies in old that are not in keep.
+// Failures are logged: a leftover policy is harmless next to the new set.
+func (o *FirewallOrchestrator) deleteStalePolicies(ctx context.Context, siteID string, old, keep []string) {
+	var done []string
+	for _, id := range old {
+		if slices.Contains(keep, id) || slices.Contains(done, id) {
+			continue
+		}
+		done = append(done, id)
+		if err := o.ic.DeletePolicy(ctx, siteID, id); err != nil {
+			slog.Warn("stale policy delete failed", "policyId", id, "err", err)
+			continue
+		}
+		slog.Info("stale policy deleted", "policyId", id)
+	}
+}
+
+func normalizePolicyTemplate(tpl *domain.PolicyTemplate) error {
+	tpl.Zone = strings.TrimSpace(tpl.Zone)
+	if tpl.Zone == "" || len(tpl.Zone) > maxPolicyName {
+		return validationError(fmt.Sprintf("zone must be 1-%d characters", maxPolicyName))
+	}
+	if len(tpl.Rules) == 0 || len(tpl.Rules) > maxPolicyTemplateRules {
+		return validationError(fmt.Sprintf("template needs 1-%d rules; delete it to restore the defaults", maxPolicyTemplateRules))
+	}
+	seen := make(map[string]bool, len(tpl.Rules))
+	for i := range tpl.Rules {
+		r := &tpl.Rules[i]
+		if err := normalizePolicyRule(r); err != nil {
+			return err
+		}
+		if seen[r.Name] {
+			return validationError(fmt.Sprintf("duplicate rule name %q", r.Name))
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+func normalizePolicyRule(r *domain.PolicyRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > maxPolicyName {
+		return validationError(fmt.Sprintf("rule name must be 1-%d characters", maxPolicyName))
+	}
+	if r.Direction != domain.PolicyInbound && r.Direction != domain.PolicyOutbound {
+		return validationError(fmt.Sprintf("rule %q: direction must be %q or %q", r.Name, domain.PolicyInbound, domain.PolicyOutbound))
+	}
+	r.Action = strings.ToUpper(r.Action)
+	if r.Action != "ALLOW" && r.Action != "BLOCK" {
+		return validationError(fmt.Sprintf("rule %q: action must be ALLOW or BLOCK", r.Name))
+	}
+	r.Protocol = strings.ToUpper(r.Protocol)
+	if r.Protocol != "" && r.Protocol != "TCP" && r.Protocol != "UDP" {
+		return validationError(fmt.Sprintf("rule %q: protocol must be TCP, UDP or empty", r.Name))
+	}
+	if len(r.Ports) > maxPolicyRuleItems || len(r.Destinations) > maxPolicyRuleItems {
+		return validationError(fmt.Sprintf("rule %q: at most %d ports and %d destinations", r.Name, maxPolicyRuleItems, maxPolicyRuleItems))
+	}
+	if len(r.Ports) > 0 && r.Protocol == "" {
+		return validationError(fmt.Sprintf("rule %q: ports need a protocol", r.Name))
+	}
+	for _, p := range r.Ports {
+		if p < 1 || p > 65535 {
+			return validationError(fmt.Sprintf("rule %q: invalid port %d", r.Name, p))
+		}
+	}
+	var first6 bool
+	for i, d := range r.Destinations {
+		norm, is6, err := normalizeDestination(d)
+		if err != nil {
+			return validationError(fmt.Sprintf("rule %q: %v", r.Name, err))
+		}
+		if i == 0 {
+			first6 = is6
+		} else if is6 != first6 {
+			return validationError(fmt.Sprintf("rule %q: destinations mix IPv4 and IPv6; split them into two rules", r.Name))
+		}
+		r.Destinations[i] = norm
+	}
+	return nil
+}
+
+// normalizeDestination canonicalises an address or CIDR, masking host bits.
+func normalizeDestination(s string) (string, bool, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid destination %q", s)
+		}
+		p = p.Masked()
+		return p.String(), p.Addr().Is6(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid destination %q", s)
+	}
+	return a.String(), a.Is6(), nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"unifi-tailscale/manager/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rdpRule() domain.PolicyRule {
+	return domain.PolicyRule{
+		Name: "RDP", Direction: domain.PolicyInbound, Action: "allow",
+		Protocol: "tcp", Ports: []int{3389}, Destinations: []string{"192.168.10.7/24"},
+	}
+}
+
+func TestNormalizePolicyTemplate(t *testing.T) {
+	tpl := domain.PolicyTemplate{Zone: " Tailscale ", Rules: []domain.PolicyRule{rdpRule()}}
+	require.NoError(t, normalizePolicyTemplate(&tpl))
+	assert.Equal(t, "Tailscale", tpl.Zone)
+	assert.Equal(t, "ALLOW", tpl.Rules[0].Action)
+	assert.Equal(t, "TCP", tpl.Rules[0].Protocol)
+	assert.Equal(t, []string{"192.168.10.0/24"}, tpl.Rules[0].Destinations, "host bits are masked")
+
+	for name, mutate := range map[string]func(*domain.PolicyTemplate){
+		"no zone":         func(t *domain.PolicyTemplate) { t.Zone = "" },
+		"no rules":        func(t *domain.PolicyTemplate) { t.Rules = nil },
+		"duplicate name":  func(t *domain.PolicyTemplate) { t.Rules = append(t.Rules, rdpRule()) },
+		"bad direction":   func(t *domain.PolicyTemplate) { t.Rules[0].Direction = "sideways" },
+		"bad action":      func(t *domain.PolicyTemplate) { t.Rules[0].Action = "REJECT" },
+		"bad protocol":    func(t *domain.PolicyTemplate) { t.Rules[0].Protocol = "ICMP" },
+		"port range":      func(t *domain.PolicyTemplate) { t.Rules[0].Ports = []int{70000} },
+		"ports, no proto": func(t *domain.PolicyTemplate) { t.Rules[0].Protocol = "" },
+		"bad dest":        func(t *domain.PolicyTemplate) { t.Rules[0].Destinations = []string{"erp.local"} },
+		"mixed families":  func(t *domain.PolicyTemplate) { t.Rules[0].Destinations = []string{"10.0.0.1", "fd00::1"} },
+	} {
+		tpl := domain.PolicyTemplate{Zone: "Tailscale", Rules: []domain.PolicyRule{rdpRule()}}
+		mutate(&tpl)
+		err := normalizePolicyTemplate(&tpl)
+		var se *Error
+		require.True(t, errors.As(err, &se), name)
+		assert.Equal(t, ErrValidation, se.Kind, name)
+	}
+}
+
+func TestPolicyTemplateStore(t *testing.T) {
+	o := newTestOrch(&mockFWIntegration{}, &mockFWManifest{}, &mockFWOps{})
+	assert.Empty(t, o.PolicyTemplates())
+
+	_, err := o.SetPolicyTemplate(domain.PolicyTemplate{Zone: "Branch", Rules: []domain.PolicyRule{rdpRule()}})
+	require.NoError(t, err)
+	erp := domain.PolicyRule{Name: "ERP", Direction: domain.PolicyInbound, Action: "ALLOW", Destinations: []string{"192.168.1.20"}}
+	_, err = o.SetPolicyTemplate(domain.PolicyTemplate{Zone: "Branch", Rules: []domain.PolicyRule{erp}})
+	require.NoError(t, err)
+
+	got := o.PolicyTemplates()
+	require.Len(t, got, 1, "a second set replaces the zone's template")
+	assert.Equal(t, []domain.PolicyRule{erp}, o.templateRules("Branch"))
+	assert.Nil(t, o.templateRules("Tailscale"))
+
+	require.NoError(t, o.DeletePolicyTemplate("Branch"))
+	var se *Error
+	require.True(t, errors.As(o.DeletePolicyTemplate("Branch"), &se))
+	assert.Equal(t, ErrNotFound, se.Kind)
+}
+
+func TestApplyPolicyTemplate_Tailscale(t *testing.T) {
+	var gotRules []domain.PolicyRule
+	var deleted []string
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		replacePolicies: func(_ context.Context, _, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+			assert.Equal(t, "Tailscale", name)
+			assert.Equal(t, "zone-ts", zoneID)
+			gotRules = rules
+			return []string{"pol-rdp"}, nil
+		},
+		deletePolicy: func(_ context.Context, _, id string) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	mf := &mockFWManifest{
+		siteID:        "site-1",
+		tailscaleZone: domain.ZoneManifest{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale", PolicyIDs: []string{"pol-a", "pol-b"}, ChainPrefix: "VPN"},
+	}
+	o := newTestOrch(ic, mf, &mockFWOps{})
+	_, err := o.SetPolicyTemplate(domain.PolicyTemplate{Zone: "Tailscale", Rules: []domain.PolicyRule{rdpRule()}})
+	require.NoError(t, err)
+
+	require.NoError(t, o.ApplyPolicyTemplate(context.Background(), "Tailscale"))
+	require.Len(t, gotRules, 1)
+	assert.Equal(t, "RDP", gotRules[0].Name)
+	assert.Equal(t, []string{"pol-rdp"}, mf.tailscaleZone.PolicyIDs)
+	assert.Equal(t, "VPN", mf.tailscaleZone.ChainPrefix)
+	assert.Equal(t, []string{"pol-a", "pol-b"}, deleted, "the default pair is dropped")
+}
+
+func TestApplyPolicyTemplate_SharedS2sZone(t *testing.T) {
+	calls := 0
+	var deleted []string
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		replacePolicies: func(_ context.Context, _, name, zoneID string, rules []domain.PolicyRule) ([]string, error) {
+			calls++
+			assert.Equal(t, "Branch", name)
+			assert.Nil(t, rules, "no template means the defaults")
+			return []string{"pol-in", "pol-out"}, nil
+		},
+		deletePolicy: func(_ context.Context, _, id string) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	branch := domain.ZoneManifest{ZoneID: "zone-br", ZoneName: "VPN Pack: Branch", PolicyIDs: []string{"pol-rdp"}}
+	mf := &mockFWManifest{
+		siteID: "site-1",
+		wgS2sZones: map[string]domain.ZoneManifest{
+			"t1": branch,
+			"t2": branch,
+			"t3": {ZoneID: "zone-hq", ZoneName: "VPN Pack: HQ", PolicyIDs: []string{"pol-hq"}},
+		},
+	}
+	o := newTestOrch(ic, mf, &mockFWOps{})
+
+	require.NoError(t, o.ApplyPolicyTemplate(context.Background(), "Branch"))
+	assert.Equal(t, 1, calls, "tunnels sharing a zone ensure its policies once")
+	assert.Equal(t, []string{"pol-in", "pol-out"}, mf.wgS2sZones["t1"].PolicyIDs)
+	assert.Equal(t, []string{"pol-in", "pol-out"}, mf.wgS2sZones["t2"].PolicyIDs)
+	assert.Equal(t, []string{"pol-hq"}, mf.wgS2sZones["t3"].PolicyIDs)
+	assert.Equal(t, []string{"pol-rdp"}, deleted)
+}
+
+func TestApplyPolicyTemplate_UpstreamError(t *testing.T) {
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		replacePolicies: func(context.Context, string, string, string, []domain.PolicyRule) ([]string, error) {
+			return nil, errors.New("502")
+		},
+	}
+	mf := &mockFWManifest{siteID: "site-1", tailscaleZone: domain.ZoneManifest{ZoneID: "zone-ts", PolicyIDs: []string{"pol-a"}}}
+	err := newTestOrch(ic, mf, &mockFWOps{}).ApplyPolicyTemplate(context.Background(), "Tailscale")
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrUpstream, se.Kind)
+	assert.Equal(t, []string{"pol-a"}, mf.tailscaleZone.PolicyIDs, "the manifest keeps the policies that exist")
+}
+
+func TestSetupTailscaleFirewall_UsesTemplate(t *testing.T) {
+	var deleted []string
+	ic := &mockFWIntegration{
+		hasAPIKey: true,
+		ensureZoneFn: func(context.Context, string, string) (ZoneInfo, error) {
+			return ZoneInfo{ZoneID: "zone-ts", ZoneName: "VPN Pack: Tailscale"}, nil
+		},
+		ensurePolicies: func(_ context.Context, _, _, _ string, rules []domain.PolicyRule) ([]string, error) {
+			require.Len(t, rules, 1)
+			return []string{"pol-rdp"}, nil
+		},
+		deletePolicy: func(_ context.Context, _, id string) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	mf := &mockFWManifest{
+		siteID:          "site-1",
+		tailscaleZone:   domain.ZoneManifest{ZoneID: "zone-ts", PolicyIDs: []string{"pol-a", "pol-rdp"}},
+		policyTemplates: []domain.PolicyTemplate{{Zone: "Tailscale", Rules: []domain.PolicyRule{rdpRule()}}},
+	}
+
+	result := newTestOrch(ic, mf, &mockFWOps{}).SetupTailscaleFirewall(context.Background())
+	require.True(t, result.OK(), "%v", result.Errors)
+	assert.Equal(t, []string{"pol-a"}, deleted)
+}
@@ -45,6 +45,9 @@ type RemoteExitService struct {
 	// Distinct from sagaMu: the reconciler is a separate goroutine gated only
 	// by this flag, not by the saga lock.
 	applying atomic.Bool
+
+	// failover is the state of the failover monitor. Guarded by sagaMu.
+	failover exitFailoverState
 }
 
 // ErrExitNodeBusy is returned when an Enable/Disable saga is already running.
@@ -70,10 +73,19 @@ type RemoteExitResponse struct {
 }
 
 type EnableRemoteExitRequest struct {
-	PeerID  string               `json:"peerId"`
-	Mode    domain.ExitNodeMode  `json:"mode"`
-	Clients []domain.ExitNodeClient `json:"clients,omitempty"`
-	Confirm bool                 `json:"confirm"`
+	PeerID       string               `json:"peerId"`
+	Mode         domain.ExitNodeMode  `json:"mode"`
+	Clients      []domain.ExitNodeClient `json:"clients,omitempty"`
+	Networks     []string             `json:"networks,omitempty"`
+	Destinations []string             `json:"destinations,omitempty"`
+	Domains      []string             `json:"domains,omitempty"`
+	KillSwitch   bool                 `json:"killSwitch,omitempty"`
+	Schedule     string               `json:"schedule,omitempty"`
+	// Backups are the peers to fail over to, in order, when PeerID goes
+	// offline.
+	Backups          []string `json:"backups,omitempty"`
+	FailoverGraceSec int      `json:"failoverGraceSec,omitempty"`
+	Confirm          bool     `json:"confirm"`
 }
 
 type EnableRemoteExitResult struct {
@@ -121,6 +133,14 @@ func (svc *RemoteExitService) Enable(ctx context.Context, req *EnableRemoteExitR
 		return nil, validationError(fmt.Sprintf("peer %s is not an exit node option", peer.HostName))
 	}
 
+	candidates, err := exitCandidates(st, req.PeerID, req.Backups)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFailoverGrace(req.FailoverGraceSec); err != nil {
+		return nil, err
+	}
+
 	mode := req.Mode
 	if mode == "" {
 		mode = domain.ExitNodeAll
@@ -134,11 +154,16 @@ func (svc *RemoteExitService) Enable(ctx context.Context, req *EnableRemoteExitR
 
 	if wasAdvertising && !req.Confirm {
 		msg := "Advertise as Exit Node will be disabled. "
-		if mode == domain.ExitNodeAll {
+		switch mode {
+		case domain.ExitNodeAll:
 			msg += fmt.Sprintf(
 				"All internet traffic from ALL clients behind this router will be routed through %s. "+
 					"Direct internet access will be lost.", peer.HostName)
-		} else {
+		case domain.ExitNodeDestinations:
+			msg += fmt.Sprintf("Traffic to the selected destinations will be routed through %s.", peer.HostName)
+		case domain.ExitNodeNetworks:
+			msg += fmt.Sprintf("Clients on the selected networks will be routed through %s.", peer.HostName)
+		default:
 			msg += fmt.Sprintf("Selected clients will be routed through %s.", peer.HostName)
 		}
 		return &EnableRemoteExitResult{ConfirmRequired: true, Message: msg}, nil
@@ -153,22 +178,35 @@ func (svc *RemoteExitService) Enable(ctx context.Context, req *EnableRemoteExitR
 		}, nil
 	}
 
-	policy := domain.ExitNodePolicy{Mode: mode, Clients: req.Clients}
-	if mode == domain.ExitNodeSelective {
+	newRemote := &domain.RemoteExitNode{
+		PeerID:       req.PeerID,
+		Mode:         mode,
+		Clients:      req.Clients,
+		Networks:     req.Networks,
+		Destinations: req.Destinations,
+		Domains:      req.Domains,
+		KillSwitch:   req.KillSwitch,
+		Schedule:     req.Schedule,
+
+		Candidates:       candidates,
+		FailoverGraceSec: req.FailoverGraceSec,
+	}
+	policy := newRemote.Policy()
+	if mode != domain.ExitNodeAll {
 		if err := ValidateExitNodePolicy(policy); err != nil {
 			return nil, err
 		}
 	}
+	if svc.exitSvc != nil {
+		if err := svc.exitSvc.ValidateScheduleRefs(policy); err != nil {
+			return nil, err
+		}
+	}
 
 	svc.applying.Store(true)
 	defer svc.applying.Store(false)
 
 	prevRemote := svc.manifest.GetRemoteExitNode()
-	newRemote := &domain.RemoteExitNode{
-		PeerID:  req.PeerID,
-		Mode:    mode,
-		Clients: req.Clients,
-	}
 
 	mp := &ipn.MaskedPrefs{
 		Prefs: ipn.Prefs{
@@ -238,6 +276,7 @@ func (svc *RemoteExitService) Enable(ctx context.Context, req *EnableRemoteExitR
 	if err := ops.Run(ctx, steps); err != nil {
 		return nil, upstreamError(humanizeLocalAPIError(err), err)
 	}
+	svc.failover = exitFailoverState{}
 
 	return &EnableRemoteExitResult{
 		OK:      true,
@@ -328,11 +367,56 @@ func (svc *RemoteExitService) SyncManifestFromTailscale(ctx context.Context) err
 
 	slog.Info("exit node peer changed externally, updating manifest",
 		"from", rem.PeerID, "to", tsExitNode)
-	return svc.manifest.SetRemoteExitNode(&domain.RemoteExitNode{
-		PeerID:  tsExitNode,
-		Mode:    rem.Mode,
-		Clients: rem.Clients,
-	})
+	moved := *rem
+	moved.PeerID = tsExitNode
+	return svc.manifest.SetRemoteExitNode(&moved)
+}
+
+// PushManifestToTailscale points Tailscale's exit node at the manifest's,
+// or clears it when the manifest has none. It is SyncManifestFromTailscale
+// the other way round, for a manifest restore, whose exit node would
+// otherwise be overwritten by the peer Tailscale still uses.
+func (svc *RemoteExitService) PushManifestToTailscale(ctx context.Context) error {
+	if !svc.sagaMu.TryLock() {
+		return ErrExitNodeBusy
+	}
+	defer svc.sagaMu.Unlock()
+
+	svc.applying.Store(true)
+	defer svc.applying.Store(false)
+
+	prefs, err := svc.ts.GetPrefs(ctx)
+	if err != nil {
+		return fmt.Errorf("get prefs: %w", err)
+	}
+	var want tailcfg.StableNodeID
+	if rem := svc.manifest.GetRemoteExitNode(); rem != nil {
+		want = tailcfg.StableNodeID(rem.PeerID)
+	}
+	if prefs.ExitNodeID == want {
+		return nil
+	}
+
+	mp := &ipn.MaskedPrefs{
+		Prefs: ipn.Prefs{
+			ExitNodeID:             want,
+			ExitNodeAllowLANAccess: want != "",
+		},
+		ExitNodeIDSet:             true,
+		ExitNodeAllowLANAccessSet: true,
+	}
+	if want != "" && prefs.AdvertisesExitNode() {
+		mp.AdvertiseRoutes = filterNonExitRoutes(prefs.AdvertiseRoutes)
+		mp.AdvertiseRoutesSet = true
+	}
+	cctx, cancel := config.WithTimeout(ctx, config.TailscaleLocalAPITimeout)
+	defer cancel()
+	if _, err := svc.ts.EditPrefs(cctx, mp); err != nil {
+		return upstreamError(humanizeLocalAPIError(err), err)
+	}
+	svc.failover = exitFailoverState{}
+	slog.Info("exit node set from manifest", "from", prefs.ExitNodeID, "to", want)
+	return nil
 }
 
 func filterExitNodePeers(st *ipnstate.Status) []ExitNodePeer {
@@ -412,8 +496,17 @@ func BuildRemoteExitNodeStatus(st *ipnstate.Status, rem *domain.RemoteExitNode)
 		PeerID:   exitID,
 		HostName: hostName,
 		Online:   online,
-		Mode:     mode,
-		Clients:  rem.Clients,
+		Mode:         mode,
+		Clients:      rem.Clients,
+		Networks:     rem.Networks,
+		Destinations: rem.Destinations,
+		Domains:      rem.Domains,
+		KillSwitch:   rem.KillSwitch,
+		Schedule:     rem.Schedule,
+
+		Candidates:       candidateStatuses(st, rem.Candidates),
+		FailoverGraceSec: rem.FailoverGraceSec,
+		FailedOver:       len(rem.Candidates) > 0 && exitID != rem.Candidates[0],
 	}
 }
 
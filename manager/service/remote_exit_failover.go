@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+)
+
+const (
+	maxExitBackups = 4
+
+	minExitFailoverGrace = 10
+	maxExitFailoverGrace = 3600
+)
+
+// exitFailoverState tracks, across monitor rounds, since when the active
+// peer has been offline and since when the primary has been back online.
+// A zero time means the condition does not hold.
+type exitFailoverState struct {
+	activeDown time.Time
+	primaryUp  time.Time
+}
+
+// exitCandidates validates the backups of an Enable request and returns the
+// failover order, primary first. Without backups there is no failover and
+// the result is nil.
+func exitCandidates(st *ipnstate.Status, primary string, backups []string) ([]string, error) {
+	if len(backups) == 0 {
+		return nil, nil
+	}
+	if len(backups) > maxExitBackups {
+		return nil, validationError(fmt.Sprintf("too many backup exit nodes: %d (max %d)", len(backups), maxExitBackups))
+	}
+	out := []string{primary}
+	for _, id := range backups {
+		if slices.Contains(out, id) {
+			return nil, validationError(fmt.Sprintf("backup exit node %s is listed twice", id))
+		}
+		peer := findPeerByID(st, id)
+		if peer == nil {
+			return nil, notFoundError(fmt.Sprintf("peer %s not found", id))
+		}
+		if !peer.ExitNodeOption {
+			return nil, validationError(fmt.Sprintf("peer %s is not an exit node option", peer.HostName))
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func validateFailoverGrace(sec int) error {
+	if sec != 0 && (sec < minExitFailoverGrace || sec > maxExitFailoverGrace) {
+		return validationError(fmt.Sprintf("failover grace must be between %d and %d seconds", minExitFailoverGrace, maxExitFailoverGrace))
+	}
+	return nil
+}
+
+func failoverGrace(rem *domain.RemoteExitNode) time.Duration {
+	if rem.FailoverGraceSec > 0 {
+		return time.Duration(rem.FailoverGraceSec) * time.Second
+	}
+	return config.ExitFailoverGrace
+}
+
+func candidateStatuses(st *ipnstate.Status, candidates []string) []domain.RemoteExitCandidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	out := make([]domain.RemoteExitCandidate, 0, len(candidates))
+	for _, id := range candidates {
+		c := domain.RemoteExitCandidate{PeerID: id, HostName: id}
+		if p := findPeerByID(st, id); p != nil {
+			c.HostName, c.Online = p.HostName, p.Online
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// CheckFailover runs one round of the remote exit node failover monitor.
+// Once the active candidate has been offline for the grace period the exit
+// node moves to the first online candidate in order; once the primary has
+// been back online for the grace period it moves back. The result is the
+// switch made this round, or nil.
+//
+// A peer picked outside the candidate list (in the UI, or with `tailscale
+// set --exit-node`) is taken as a manual override and left alone until a
+// candidate is active again. A round that finds a saga in flight is skipped.
+func (svc *RemoteExitService) CheckFailover(ctx context.Context, now time.Time) *domain.RemoteExitFailoverEvent {
+	if !svc.sagaMu.TryLock() {
+		return nil
+	}
+	defer svc.sagaMu.Unlock()
+
+	rem := svc.manifest.GetRemoteExitNode()
+	if rem == nil || len(rem.Candidates) < 2 || !slices.Contains(rem.Candidates, rem.PeerID) {
+		svc.failover = exitFailoverState{}
+		return nil
+	}
+	st, err := svc.ts.Status(ctx)
+	if err != nil {
+		slog.Debug("exit failover: status unavailable", "err", err)
+		return nil
+	}
+	online := func(id string) bool {
+		p := findPeerByID(st, id)
+		return p != nil && p.Online
+	}
+
+	fo := &svc.failover
+	primary := rem.Candidates[0]
+	switch {
+	case online(rem.PeerID):
+		fo.activeDown = time.Time{}
+	case fo.activeDown.IsZero():
+		fo.activeDown = now
+	}
+	switch {
+	case rem.PeerID == primary || !online(primary):
+		fo.primaryUp = time.Time{}
+	case fo.primaryUp.IsZero():
+		fo.primaryUp = now
+	}
+
+	grace := failoverGrace(rem)
+	var to, reason string
+	switch {
+	case !fo.activeDown.IsZero() && now.Sub(fo.activeDown) >= grace:
+		i := slices.IndexFunc(rem.Candidates, func(id string) bool { return id != rem.PeerID && online(id) })
+		if i < 0 {
+			return nil
+		}
+		to = rem.Candidates[i]
+		reason = fmt.Sprintf("offline for %s", now.Sub(fo.activeDown).Round(time.Second))
+	case !fo.primaryUp.IsZero() && now.Sub(fo.primaryUp) >= grace:
+		to = primary
+		reason = "primary back online"
+	default:
+		return nil
+	}
+
+	if err := svc.switchExitPeer(ctx, rem, to); err != nil {
+		slog.Warn("exit failover: switch failed", "from", rem.PeerID, "to", to, "err", err)
+		return nil
+	}
+	svc.failover = exitFailoverState{}
+	ev := &domain.RemoteExitFailoverEvent{
+		From: rem.PeerID, FromName: peerHostName(st, rem.PeerID),
+		To: to, ToName: peerHostName(st, to),
+		Reason: reason,
+	}
+	slog.Info("exit node failed over", "from", ev.FromName, "to", ev.ToName, "reason", reason)
+	return ev
+}
+
+// switchExitPeer points the exit node at another candidate. The local rules
+// do not name the peer, so only the prefs and the manifest change. A failed
+// manifest write is left to SyncManifestFromTailscale, which adopts the peer
+// from the prefs on its next pass.
+func (svc *RemoteExitService) switchExitPeer(ctx context.Context, rem *domain.RemoteExitNode, to string) error {
+	svc.applying.Store(true)
+	defer svc.applying.Store(false)
+
+	cctx, cancel := config.WithTimeout(ctx, config.TailscaleLocalAPITimeout)
+	defer cancel()
+	if _, err := svc.ts.EditPrefs(cctx, &ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: tailcfg.StableNodeID(to)},
+		ExitNodeIDSet: true,
+	}); err != nil {
+		return err
+	}
+	moved := *rem
+	moved.PeerID = to
+	if err := svc.manifest.SetRemoteExitNode(&moved); err != nil {
+		slog.Warn("exit failover: persist manifest", "err", err)
+	}
+	return nil
+}
+
+func peerHostName(st *ipnstate.Status, id string) string {
+	if p := findPeerByID(st, id); p != nil {
+		return p.HostName
+	}
+	return id
+}
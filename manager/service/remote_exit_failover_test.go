@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+
+	"unifi-tailscale/manager/domain"
+)
+
+type failoverTailnet struct {
+	online map[string]bool
+	edits  []tailcfg.StableNodeID
+}
+
+func (f *failoverTailnet) routing() *mockRoutingTailscale {
+	return &mockRoutingTailscale{
+		statusFn: func(ctx context.Context) (*ipnstate.Status, error) {
+			var peers []*ipnstate.PeerStatus
+			for id, up := range f.online {
+				peers = append(peers, testPeerStatus(id, "host-"+id, up, true, false))
+			}
+			return testStatusWithPeers(peers...), nil
+		},
+		editPrefsFn: func(ctx context.Context, mp *ipn.MaskedPrefs) (*ipn.Prefs, error) {
+			if mp.ExitNodeIDSet {
+				f.edits = append(f.edits, mp.ExitNodeID)
+			}
+			return &ipn.Prefs{}, nil
+		},
+	}
+}
+
+func TestCheckFailover_SwitchesAfterGraceAndBack(t *testing.T) {
+	tn := &failoverTailnet{online: map[string]bool{"p": false, "b1": false, "b2": true}}
+	manifest := &mockRemoteExitManifest{remoteExitNode: &domain.RemoteExitNode{
+		PeerID: "p", Mode: domain.ExitNodeAll,
+		Candidates: []string{"p", "b1", "b2"}, FailoverGraceSec: 30,
+	}}
+	svc := newTestRemoteExitService(tn.routing(), manifest)
+	ctx := context.Background()
+	t0 := time.Now()
+
+	assert.Nil(t, svc.CheckFailover(ctx, t0))
+	assert.Nil(t, svc.CheckFailover(ctx, t0.Add(29*time.Second)), "must wait out the grace period")
+	assert.Empty(t, tn.edits)
+
+	ev := svc.CheckFailover(ctx, t0.Add(30*time.Second))
+	require.NotNil(t, ev)
+	assert.Equal(t, "p", ev.From)
+	assert.Equal(t, "b2", ev.To, "offline b1 must be skipped")
+	assert.Equal(t, "host-b2", ev.ToName)
+	assert.Equal(t, []tailcfg.StableNodeID{"b2"}, tn.edits)
+	assert.Equal(t, "b2", manifest.remoteExitNode.PeerID)
+	assert.Equal(t, []string{"p", "b1", "b2"}, manifest.remoteExitNode.Candidates)
+
+	tn.online["p"] = true
+	t1 := t0.Add(time.Minute)
+	assert.Nil(t, svc.CheckFailover(ctx, t1))
+	ev = svc.CheckFailover(ctx, t1.Add(30*time.Second))
+	require.NotNil(t, ev)
+	assert.Equal(t, "b2", ev.From)
+	assert.Equal(t, "p", ev.To)
+	assert.Equal(t, "primary back online", ev.Reason)
+	assert.Equal(t, "p", manifest.remoteExitNode.PeerID)
+}
+
+func TestCheckFailover_PrimaryFlapRestartsGrace(t *testing.T) {
+	tn := &failoverTailnet{online: map[string]bool{"p": true, "b": true}}
+	manifest := &mockRemoteExitManifest{remoteExitNode: &domain.RemoteExitNode{
+		PeerID: "b", Mode: domain.ExitNodeAll, Candidates: []string{"p", "b"},
+	}}
+	svc := newTestRemoteExitService(tn.routing(), manifest)
+	ctx := context.Background()
+	t0 := time.Now()
+
+	assert.Nil(t, svc.CheckFailover(ctx, t0))
+	tn.online["p"] = false
+	assert.Nil(t, svc.CheckFailover(ctx, t0.Add(30*time.Second)))
+	tn.online["p"] = true
+	assert.Nil(t, svc.CheckFailover(ctx, t0.Add(40*time.Second)))
+	assert.Nil(t, svc.CheckFailover(ctx, t0.Add(90*time.Second)), "grace must restart after the primary dropped again")
+	require.NotNil(t, svc.CheckFailover(ctx, t0.Add(100*time.Second)))
+}
+
+func TestCheckFailover_ManualOverrideLeftAlone(t *testing.T) {
+	tn := &failoverTailnet{online: map[string]bool{"p": true, "b": true, "other": false}}
+	manifest := &mockRemoteExitManifest{remoteExitNode: &domain.RemoteExitNode{
+		PeerID: "other", Mode: domain.ExitNodeAll, Candidates: []string{"p", "b"},
+	}}
+	svc := newTestRemoteExitService(tn.routing(), manifest)
+	t0 := time.Now()
+
+	assert.Nil(t, svc.CheckFailover(context.Background(), t0))
+	assert.Nil(t, svc.CheckFailover(context.Background(), t0.Add(time.Hour)))
+	assert.Empty(t, tn.edits)
+}
+
+func TestCheckFailover_NoOnlineCandidateKeepsPeer(t *testing.T) {
+	tn := &failoverTailnet{online: map[string]bool{"p": false, "b": false}}
+	manifest := &mockRemoteExitManifest{remoteExitNode: &domain.RemoteExitNode{
+		PeerID: "p", Mode: domain.ExitNodeAll, Candidates: []string{"p", "b"},
+	}}
+	svc := newTestRemoteExitService(tn.routing(), manifest)
+	t0 := time.Now()
+
+	svc.CheckFailover(context.Background(), t0)
+	assert.Nil(t, svc.CheckFailover(context.Background(), t0.Add(time.Hour)))
+	assert.Empty(t, tn.edits)
+
+	tn.online["b"] = true
+	ev := svc.CheckFailover(context.Background(), t0.Add(time.Hour+time.Second))
+	require.NotNil(t, ev, "a backup coming up after the grace must be taken at once")
+	assert.Equal(t, "b", ev.To)
+}
+
+func TestEnable_StoresFailoverOrder(t *testing.T) {
+	tn := &failoverTailnet{online: map[string]bool{"p": true, "b": false}}
+	manifest := &mockRemoteExitManifest{}
+	svc := newTestRemoteExitService(tn.routing(), manifest)
+
+	_, err := svc.Enable(context.Background(), &EnableRemoteExitRequest{
+		PeerID: "p", Mode: domain.ExitNodeAll, Backups: []string{"b"}, FailoverGraceSec: 45, Confirm: true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, manifest.remoteExitNode)
+	assert.Equal(t, []string{"p", "b"}, manifest.remoteExitNode.Candidates)
+	assert.Equal(t, 45, manifest.remoteExitNode.FailoverGraceSec)
+}
+
+func TestEnable_InvalidBackups(t *testing.T) {
+	tests := []struct {
+		name string
+		req  EnableRemoteExitRequest
+	}{
+		{"primary as backup", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"p"}}},
+		{"duplicate backup", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"b", "b"}}},
+		{"unknown backup", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"nope"}}},
+		{"not an exit node", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"plain"}}},
+		{"too many", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"b", "c", "d", "e", "f"}}},
+		{"grace too short", EnableRemoteExitRequest{PeerID: "p", Backups: []string{"b"}, FailoverGraceSec: 5}},
+	}
+	ts := &mockRoutingTailscale{
+		statusFn: func(ctx context.Context) (*ipnstate.Status, error) {
+			return testStatusWithPeers(
+				testPeerStatus("p", "primary", true, true, false),
+				testPeerStatus("b", "backup", true, true, false),
+				testPeerStatus("c", "c", true, true, false),
+				testPeerStatus("d", "d", true, true, false),
+				testPeerStatus("e", "e", true, true, false),
+				testPeerStatus("f", "f", true, true, false),
+				testPeerStatus("plain", "plain", true, false, false),
+			), nil
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &mockRemoteExitManifest{}
+			svc := newTestRemoteExitService(ts, manifest)
+			tt.req.Confirm = true
+			_, err := svc.Enable(context.Background(), &tt.req)
+			require.Error(t, err)
+			assert.Nil(t, manifest.remoteExitNode)
+		})
+	}
+}
+
+func TestBuildRemoteExitNodeStatus_Candidates(t *testing.T) {
+	st := testStatusWithPeers(
+		testPeerStatus("p", "primary", false, true, false),
+		testPeerStatus("b", "backup", true, true, true),
+	)
+	st.ExitNodeStatus = &ipnstate.ExitNodeStatus{ID: "b", Online: true}
+	rem := &domain.RemoteExitNode{PeerID: "b", Mode: domain.ExitNodeAll, Candidates: []string{"p", "b"}}
+
+	got := BuildRemoteExitNodeStatus(st, rem)
+	require.NotNil(t, got)
+	assert.True(t, got.FailedOver)
+	assert.Equal(t, []domain.RemoteExitCandidate{
+		{PeerID: "p", HostName: "primary", Online: false},
+		{PeerID: "b", HostName: "backup", Online: true},
+	}, got.Candidates)
+}
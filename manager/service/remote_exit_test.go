@@ -532,6 +532,70 @@ func TestSyncManifestFromTailscale_TsSet_DifferentPeer(t *testing.T) {
 	assert.Len(t, manifest.remoteExitNode.Clients, 1)
 }
 
+func TestPushManifestToTailscale_SetsManifestPeer(t *testing.T) {
+	var sent *ipn.MaskedPrefs
+	prefs := &ipn.Prefs{ExitNodeID: tailcfg.StableNodeID("peer-xyz")}
+	ts := &mockRoutingTailscale{
+		getPrefsFn: func(ctx context.Context) (*ipn.Prefs, error) {
+			return prefs, nil
+		},
+		editPrefsFn: func(ctx context.Context, mp *ipn.MaskedPrefs) (*ipn.Prefs, error) {
+			sent = mp
+			prefs = &mp.Prefs
+			return prefs, nil
+		},
+	}
+	manifest := &mockRemoteExitManifest{
+		remoteExitNode: &domain.RemoteExitNode{PeerID: "peer-abc", Mode: domain.ExitNodeAll},
+	}
+	svc := newTestRemoteExitService(ts, manifest)
+
+	require.NoError(t, svc.PushManifestToTailscale(context.Background()))
+	require.NotNil(t, sent)
+	assert.Equal(t, tailcfg.StableNodeID("peer-abc"), sent.ExitNodeID)
+	assert.True(t, sent.ExitNodeAllowLANAccess)
+
+	require.NoError(t, svc.SyncManifestFromTailscale(context.Background()))
+	assert.Equal(t, "peer-abc", manifest.remoteExitNode.PeerID, "the restored peer is not adopted back")
+}
+
+func TestPushManifestToTailscale_ClearsWithoutManifestPeer(t *testing.T) {
+	var sent *ipn.MaskedPrefs
+	ts := &mockRoutingTailscale{
+		getPrefsFn: func(ctx context.Context) (*ipn.Prefs, error) {
+			return &ipn.Prefs{ExitNodeID: tailcfg.StableNodeID("peer-xyz")}, nil
+		},
+		editPrefsFn: func(ctx context.Context, mp *ipn.MaskedPrefs) (*ipn.Prefs, error) {
+			sent = mp
+			return &mp.Prefs, nil
+		},
+	}
+	svc := newTestRemoteExitService(ts, &mockRemoteExitManifest{})
+
+	require.NoError(t, svc.PushManifestToTailscale(context.Background()))
+	require.NotNil(t, sent)
+	assert.True(t, sent.ExitNodeIDSet)
+	assert.Empty(t, sent.ExitNodeID)
+}
+
+func TestPushManifestToTailscale_InSync(t *testing.T) {
+	ts := &mockRoutingTailscale{
+		getPrefsFn: func(ctx context.Context) (*ipn.Prefs, error) {
+			return &ipn.Prefs{ExitNodeID: tailcfg.StableNodeID("peer-abc")}, nil
+		},
+		editPrefsFn: func(ctx context.Context, mp *ipn.MaskedPrefs) (*ipn.Prefs, error) {
+			t.Error("prefs already match the manifest")
+			return &mp.Prefs, nil
+		},
+	}
+	manifest := &mockRemoteExitManifest{
+		remoteExitNode: &domain.RemoteExitNode{PeerID: "peer-abc", Mode: domain.ExitNodeAll},
+	}
+	svc := newTestRemoteExitService(ts, manifest)
+
+	require.NoError(t, svc.PushManifestToTailscale(context.Background()))
+}
+
 func TestSyncManifestFromTailscale_ApplyingFlag(t *testing.T) {
 	getPrefsCalled := false
 	ts := &mockRoutingTailscale{
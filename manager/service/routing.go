@@ -59,9 +59,10 @@ type SetRoutesResult struct {
 }
 
 type SubnetEntry struct {
-	CIDR string `json:"cidr"`
-	Name string `json:"name"`
-	Type string `json:"type"`
+	CIDR  string `json:"cidr"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Iface string `json:"iface,omitempty"`
 }
 
 type FirewallState struct {
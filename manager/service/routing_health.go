@@ -4,30 +4,54 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/jsimonetti/rtnetlink"
+	"golang.org/x/sys/unix"
 
 	"unifi-tailscale/manager/config"
 	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/ops"
 )
 
 const (
 	routingHealthTTL     = 60 * time.Second
 	tailscalePriorityMin = 5210
 	tailscalePriorityMax = 5310
+	// tailscaleMTU is tailscaled's default TUN MTU. Peers assume it too, so a
+	// larger local MTU sends packets the far end cannot take.
+	tailscaleMTU = 1280
 )
 
+// routingCheck is one entry of the routing-health registry. detect returns
+// nil when healthy. fix, when set, returns the remediation as a saga; it
+// only ever runs on request through Fix, never from Check.
+type routingCheck struct {
+	id       string
+	severity string
+	detect   func(ctx context.Context) *domain.RoutingWarning
+	fix      func(ctx context.Context) []ops.Op
+}
+
 type RoutingHealthChecker struct {
-	readRPFilter  func(iface string) (int, error)
-	listFwRules   func() ([]PBRInfo, error)
-	checkIP6Chain func(ctx context.Context, chain string) bool
-	ifaceExists   func(name string) bool
+	readRPFilter     func(iface string) (int, error)
+	listFwRules      func() ([]PBRInfo, error)
+	checkIP6Chain    func(ctx context.Context, chain string) bool
+	ifaceExists      func(name string) bool
+	readSysctl       func(path string) (string, error)
+	writeSysctl      func(path, value string) error
+	ifaceMTU         func(name string) (int, error)
+	setIfaceMTU      func(name string, mtu int) error
+	tailscaledMTU    func() int
+	countTableRoutes func(table uint32) (int, error)
 
 	mu       sync.Mutex
 	cached   *domain.RoutingHealth
@@ -37,10 +61,27 @@ type RoutingHealthChecker struct {
 
 func NewRoutingHealthChecker() *RoutingHealthChecker {
 	return &RoutingHealthChecker{
-		readRPFilter:  defaultReadRPFilter,
-		listFwRules:   defaultListFwRules,
-		checkIP6Chain: defaultCheckIP6Chain,
-		ifaceExists:   defaultIfaceExists,
+		readRPFilter:     defaultReadRPFilter,
+		listFwRules:      defaultListFwRules,
+		checkIP6Chain:    defaultCheckIP6Chain,
+		ifaceExists:      defaultIfaceExists,
+		readSysctl:       defaultReadSysctl,
+		writeSysctl:      defaultWriteSysctl,
+		ifaceMTU:         defaultIfaceMTU,
+		setIfaceMTU:      defaultSetIfaceMTU,
+		tailscaledMTU:    defaultTailscaledMTU,
+		countTableRoutes: defaultCountTableRoutes,
+	}
+}
+
+func (c *RoutingHealthChecker) checks() []routingCheck {
+	return []routingCheck{
+		{id: "rp_filter", severity: "warning", detect: c.checkRPFilter, fix: c.fixRPFilter},
+		{id: "bypass_mark", severity: "critical", detect: c.checkBypassMarkConflict},
+		{id: "ipv6_ts_forward", severity: "warning", detect: c.checkIPv6TsForward},
+		{id: "ip_forward", severity: "critical", detect: c.checkIPForward, fix: c.fixIPForward},
+		{id: "tailscale_mtu", severity: "warning", detect: c.checkMTU, fix: c.fixMTU},
+		{id: "table52_routes", severity: "critical", detect: c.checkTable52Routes},
 	}
 }
 
@@ -67,19 +108,15 @@ func (c *RoutingHealthChecker) Check(ctx context.Context) *domain.RoutingHealth
 	}
 
 	var warnings []domain.RoutingWarning
-
-	if w := c.checkRPFilter(); w != nil {
-		slog.Warn("routing health: "+w.Message, "check", w.Check, "value", w.Value)
-		warnings = append(warnings, *w)
-	}
-	if w := c.checkBypassMarkConflict(); w != nil {
+	for _, chk := range c.checks() {
+		w := chk.detect(ctx)
+		if w == nil {
+			continue
+		}
+		w.Check, w.Severity, w.Fixable = chk.id, chk.severity, chk.fix != nil
 		slog.Warn("routing health: "+w.Message, "check", w.Check, "value", w.Value)
 		warnings = append(warnings, *w)
 	}
-	if w := c.checkIPv6TsForward(ctx); w != nil {
-		slog.Warn("routing health: "+w.Message, "check", w.Check)
-		warnings = append(warnings, *w)
-	}
 
 	var result *domain.RoutingHealth
 	if len(warnings) > 0 {
@@ -91,15 +128,52 @@ func (c *RoutingHealthChecker) Check(ctx context.Context) *domain.RoutingHealth
 	return result
 }
 
-func (c *RoutingHealthChecker) checkRPFilter() *domain.RoutingWarning {
+// Fix applies the remediation of check id. The fix steps and a final
+// re-check run as one saga, so a fix that does not clear the warning is
+// undone. A check that is already healthy is left alone. The returned
+// health is freshly computed.
+func (c *RoutingHealthChecker) Fix(ctx context.Context, id string) (*domain.RoutingHealth, error) {
+	if c == nil {
+		return nil, &Error{Kind: ErrUnavailable, Message: "routing health checker not initialized"}
+	}
+	idx := slices.IndexFunc(c.checks(), func(chk routingCheck) bool { return chk.id == id })
+	if idx < 0 {
+		return nil, notFoundError(fmt.Sprintf("unknown routing health check %q", id))
+	}
+	chk := c.checks()[idx]
+	if chk.fix == nil {
+		return nil, validationError(fmt.Sprintf("routing health check %q has no automatic fix", id))
+	}
+	if !c.ifaceExists(config.TailscaleInterface) {
+		return nil, preconditionError(config.TailscaleInterface + " is not up")
+	}
+
+	c.mu.Lock()
+	if chk.detect(ctx) != nil {
+		steps := append(chk.fix(ctx), ops.Noop("verify "+id, func(ctx context.Context) error {
+			if w := chk.detect(ctx); w != nil {
+				return fmt.Errorf("still failing: %s", w.Message)
+			}
+			return nil
+		}))
+		if err := ops.Run(ctx, steps); err != nil {
+			c.mu.Unlock()
+			return nil, internalError(fmt.Sprintf("fix %s: %v", id, err), err)
+		}
+		slog.Info("routing health: fixed", "check", id)
+	}
+	c.hasCache = false
+	c.mu.Unlock()
+	return c.Check(ctx), nil
+}
+
+func (c *RoutingHealthChecker) checkRPFilter(context.Context) *domain.RoutingWarning {
 	val, err := c.readRPFilter(config.TailscaleInterface)
 	if err != nil {
 		return nil
 	}
 	if val == 1 {
 		return &domain.RoutingWarning{
-			Check:    "rp_filter",
-			Severity: "warning",
 			Message: fmt.Sprintf(
 				"rp_filter=1 (strict) on %s: CGNAT return traffic (100.64.x.x) may be silently dropped by kernel reverse path filtering. Expected rp_filter=2 (loose).",
 				config.TailscaleInterface,
@@ -110,7 +184,14 @@ func (c *RoutingHealthChecker) checkRPFilter() *domain.RoutingWarning {
 	return nil
 }
 
-func (c *RoutingHealthChecker) checkBypassMarkConflict() *domain.RoutingWarning {
+// fixRPFilter sets loose mode on tailscale0 only. The kernel uses the higher
+// of conf/all and the interface value, so this wins over a strict "all".
+func (c *RoutingHealthChecker) fixRPFilter(context.Context) []ops.Op {
+	path := fmt.Sprintf("net/ipv4/conf/%s/rp_filter", config.TailscaleInterface)
+	return []ops.Op{c.sysctlOp(path, "2")}
+}
+
+func (c *RoutingHealthChecker) checkBypassMarkConflict(context.Context) *domain.RoutingWarning {
 	rules, err := c.listFwRules()
 	if err != nil {
 		return nil
@@ -121,8 +202,6 @@ func (c *RoutingHealthChecker) checkBypassMarkConflict() *domain.RoutingWarning
 		}
 		if r.FwMark != 0 && (r.FwMark&bypassMask) == bypassMark {
 			return &domain.RoutingWarning{
-				Check:    "bypass_mark",
-				Severity: "critical",
 				Message: fmt.Sprintf(
 					"PBR rule at priority %d uses fwmark 0x%x which collides with Tailscale BypassMark 0x%x/0x%x. "+
 						"Traffic with this mark will bypass Tailscale routing table 52.",
@@ -138,14 +217,137 @@ func (c *RoutingHealthChecker) checkBypassMarkConflict() *domain.RoutingWarning
 func (c *RoutingHealthChecker) checkIPv6TsForward(ctx context.Context) *domain.RoutingWarning {
 	if !c.checkIP6Chain(ctx, "ts-forward") {
 		return &domain.RoutingWarning{
-			Check:    "ipv6_ts_forward",
-			Severity: "warning",
-			Message:  "ip6tables ts-forward chain not found. IPv6 traffic through tailscale0 may not be forwarded correctly.",
+			Message: "ip6tables ts-forward chain not found. IPv6 traffic through tailscale0 may not be forwarded correctly.",
 		}
 	}
 	return nil
 }
 
+// forwardingSysctls are the switches subnet routing and the exit node need.
+// The IPv6 one is absent on hosts without IPv6 and then skipped.
+var forwardingSysctls = []string{"net/ipv4/ip_forward", "net/ipv6/conf/all/forwarding"}
+
+func (c *RoutingHealthChecker) disabledForwarding() []string {
+	var off []string
+	for _, path := range forwardingSysctls {
+		if val, err := c.readSysctl(path); err == nil && val == "0" {
+			off = append(off, path)
+		}
+	}
+	return off
+}
+
+func (c *RoutingHealthChecker) checkIPForward(context.Context) *domain.RoutingWarning {
+	off := c.disabledForwarding()
+	if len(off) == 0 {
+		return nil
+	}
+	names := make([]string, len(off))
+	for i, path := range off {
+		names[i] = strings.ReplaceAll(path, "/", ".")
+	}
+	return &domain.RoutingWarning{
+		Message: fmt.Sprintf(
+			"IP forwarding is disabled (%s=0). Subnet routes and the exit node cannot forward traffic.",
+			strings.Join(names, "=0, "),
+		),
+		Value: strings.Join(names, ","),
+	}
+}
+
+func (c *RoutingHealthChecker) fixIPForward(context.Context) []ops.Op {
+	var steps []ops.Op
+	for _, path := range c.disabledForwarding() {
+		steps = append(steps, c.sysctlOp(path, "1"))
+	}
+	return steps
+}
+
+// expectedMTU is the tailscale0 MTU tailscaled sets: TS_DEBUG_MTU from its
+// defaults file when someone chose one, tailscaleMTU otherwise.
+func (c *RoutingHealthChecker) expectedMTU() (mtu int, configured bool) {
+	if c.tailscaledMTU != nil {
+		if mtu := c.tailscaledMTU(); mtu > 0 {
+			return mtu, true
+		}
+	}
+	return tailscaleMTU, false
+}
+
+// checkMTU flags a tailscale0 MTU other than the one tailscaled is
+// configured with, so its fix only ever restores that configured value.
+func (c *RoutingHealthChecker) checkMTU(context.Context) *domain.RoutingWarning {
+	mtu, err := c.ifaceMTU(config.TailscaleInterface)
+	want, configured := c.expectedMTU()
+	if err != nil || mtu == want {
+		return nil
+	}
+	msg := fmt.Sprintf(
+		"%s MTU is %d, expected %d. Peers assume %d; larger packets may be dropped on the way and smaller ones break IPv6. Set TS_DEBUG_MTU in %s if a different MTU is intended.",
+		config.TailscaleInterface, mtu, want, want, config.TailscaledDefaultsPath,
+	)
+	if configured {
+		msg = fmt.Sprintf(
+			"%s MTU is %d, but TS_DEBUG_MTU in %s sets %d. Restart tailscaled or apply the fix to use it.",
+			config.TailscaleInterface, mtu, config.TailscaledDefaultsPath, want,
+		)
+	}
+	return &domain.RoutingWarning{Message: msg, Value: strconv.Itoa(mtu)}
+}
+
+func (c *RoutingHealthChecker) fixMTU(context.Context) []ops.Op {
+	want, _ := c.expectedMTU()
+	var prev int
+	return []ops.Op{{
+		Name: fmt.Sprintf("set %s mtu %d", config.TailscaleInterface, want),
+		Do: func(context.Context) error {
+			var err error
+			if prev, err = c.ifaceMTU(config.TailscaleInterface); err != nil {
+				return err
+			}
+			return c.setIfaceMTU(config.TailscaleInterface, want)
+		},
+		Undo: func(context.Context) error {
+			return c.setIfaceMTU(config.TailscaleInterface, prev)
+		},
+	}}
+}
+
+// checkTable52Routes flags an empty table 52. tailscaled fills it whenever
+// it is up, so with tailscale0 present an empty table means its router
+// failed and tailnet traffic falls through to the main table.
+func (c *RoutingHealthChecker) checkTable52Routes(context.Context) *domain.RoutingWarning {
+	n, err := c.countTableRoutes(tailscaleRouteTable)
+	if err != nil || n > 0 {
+		return nil
+	}
+	return &domain.RoutingWarning{
+		Message: fmt.Sprintf(
+			"Routing table %d has no routes although %s is up. Traffic to the tailnet will not use Tailscale; restarting tailscaled usually restores them.",
+			tailscaleRouteTable, config.TailscaleInterface,
+		),
+	}
+}
+
+// sysctlOp writes value to /proc/sys/<path> and restores the previous value
+// on rollback.
+func (c *RoutingHealthChecker) sysctlOp(path, value string) ops.Op {
+	var prev string
+	return ops.Op{
+		Name: fmt.Sprintf("set %s=%s", strings.ReplaceAll(path, "/", "."), value),
+		Do: func(context.Context) error {
+			var err error
+			if prev, err = c.readSysctl(path); err != nil {
+				return err
+			}
+			return c.writeSysctl(path, value)
+		},
+		Undo: func(context.Context) error {
+			return c.writeSysctl(path, prev)
+		},
+	}
+}
+
 // --- default implementations ---
 
 func defaultReadRPFilter(iface string) (int, error) {
@@ -191,6 +393,84 @@ func defaultCheckIP6Chain(ctx context.Context, chain string) bool {
 	return exec.CommandContext(cctx, "ip6tables", "-w", "2", "-L", chain, "-n").Run() == nil
 }
 
+func defaultReadSysctl(path string) (string, error) {
+	data, err := os.ReadFile("/proc/sys/" + path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func defaultWriteSysctl(path, value string) error {
+	return os.WriteFile("/proc/sys/"+path, []byte(value), 0o644)
+}
+
+func defaultIfaceMTU(name string) (int, error) {
+	data, err := os.ReadFile("/sys/class/net/" + name + "/mtu")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+var tsDebugMTURe = regexp.MustCompile(`(?m)^TS_DEBUG_MTU="?(\d+)"?`)
+
+// defaultTailscaledMTU reads TS_DEBUG_MTU from tailscaled's defaults file,
+// its EnvironmentFile, or 0 when it is not set.
+func defaultTailscaledMTU() int {
+	data, err := os.ReadFile(config.TailscaledDefaultsPath)
+	if err != nil {
+		return 0
+	}
+	m := tsDebugMTURe.FindSubmatch(data)
+	if m == nil {
+		return 0
+	}
+	mtu, _ := strconv.Atoi(string(m[1]))
+	return mtu
+}
+
+func defaultSetIfaceMTU(name string, mtu int) error {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	return conn.Link.Set(&rtnetlink.LinkMessage{
+		Family:     unix.AF_UNSPEC,
+		Index:      uint32(ifi.Index),
+		Attributes: &rtnetlink.LinkAttributes{MTU: uint32(mtu)},
+	})
+}
+
+func defaultCountTableRoutes(table uint32) (int, error) {
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	routes, err := conn.Route.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, rt := range routes {
+		t := rt.Attributes.Table
+		if t == 0 {
+			t = uint32(rt.Table)
+		}
+		if t == table {
+			n++
+		}
+	}
+	return n, nil
+}
+
 func defaultIfaceExists(name string) bool {
 	_, err := os.Stat("/sys/class/net/" + name)
 	return err == nil
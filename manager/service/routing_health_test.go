@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,10 +13,15 @@ import (
 
 func newTestChecker(opts ...func(*RoutingHealthChecker)) *RoutingHealthChecker {
 	c := &RoutingHealthChecker{
-		ifaceExists:   func(string) bool { return true },
-		readRPFilter:  func(string) (int, error) { return 0, nil },
-		listFwRules:   func() ([]PBRInfo, error) { return nil, nil },
-		checkIP6Chain: func(context.Context, string) bool { return true },
+		ifaceExists:      func(string) bool { return true },
+		readRPFilter:     func(string) (int, error) { return 0, nil },
+		listFwRules:      func() ([]PBRInfo, error) { return nil, nil },
+		checkIP6Chain:    func(context.Context, string) bool { return true },
+		readSysctl:       func(string) (string, error) { return "1", nil },
+		writeSysctl:      func(string, string) error { return nil },
+		ifaceMTU:         func(string) (int, error) { return tailscaleMTU, nil },
+		setIfaceMTU:      func(string, int) error { return nil },
+		countTableRoutes: func(uint32) (int, error) { return 3, nil },
 	}
 	for _, o := range opts {
 		o(c)
@@ -241,3 +247,153 @@ func TestRoutingHealth_CacheClearedOnInterfaceFlap(t *testing.T) {
 	second := c.Check(context.Background())
 	require.NotNil(t, second, "Check() after re-appearance must recompute, not return stale nil")
 }
+
+func TestRoutingHealth_IPForwardDisabled(t *testing.T) {
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		c.readSysctl = func(path string) (string, error) {
+			if path == "net/ipv6/conf/all/forwarding" {
+				return "", errors.New("no such file") // no IPv6
+			}
+			return "0", nil
+		}
+	})
+	rh := c.Check(context.Background())
+	require.NotNil(t, rh)
+	require.Len(t, rh.Warnings, 1)
+	w := rh.Warnings[0]
+	assert.Equal(t, "ip_forward", w.Check)
+	assert.Equal(t, "critical", w.Severity)
+	assert.Equal(t, "net.ipv4.ip_forward", w.Value)
+	assert.True(t, w.Fixable)
+}
+
+func TestRoutingHealth_MTUMismatch(t *testing.T) {
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		c.ifaceMTU = func(string) (int, error) { return 1500, nil }
+	})
+	rh := c.Check(context.Background())
+	require.NotNil(t, rh)
+	require.Len(t, rh.Warnings, 1)
+	assert.Equal(t, "tailscale_mtu", rh.Warnings[0].Check)
+	assert.Equal(t, "1500", rh.Warnings[0].Value)
+}
+
+func TestRoutingHealth_MTUFollowsTSDebugMTU(t *testing.T) {
+	mtu := 1420
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		c.ifaceMTU = func(string) (int, error) { return mtu, nil }
+		c.setIfaceMTU = func(_ string, v int) error { mtu = v; return nil }
+		c.tailscaledMTU = func() int { return 1420 }
+	})
+	assert.Nil(t, c.Check(context.Background()), "a configured TS_DEBUG_MTU is what tailscale0 should have")
+
+	mtu = tailscaleMTU
+	c.hasCache = false
+	rh := c.Check(context.Background())
+	require.NotNil(t, rh)
+	require.Len(t, rh.Warnings, 1)
+	assert.Contains(t, rh.Warnings[0].Message, "TS_DEBUG_MTU")
+
+	_, err := c.Fix(context.Background(), "tailscale_mtu")
+	require.NoError(t, err)
+	assert.Equal(t, 1420, mtu, "the fix restores the configured MTU, not the default")
+}
+
+func TestRoutingHealth_Table52Empty(t *testing.T) {
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		c.countTableRoutes = func(table uint32) (int, error) {
+			assert.Equal(t, uint32(52), table)
+			return 0, nil
+		}
+	})
+	rh := c.Check(context.Background())
+	require.NotNil(t, rh)
+	require.Len(t, rh.Warnings, 1)
+	w := rh.Warnings[0]
+	assert.Equal(t, "table52_routes", w.Check)
+	assert.Equal(t, "critical", w.Severity)
+	assert.False(t, w.Fixable)
+}
+
+// fakeSysctl is an in-memory /proc/sys for the checker.
+func fakeSysctl(c *RoutingHealthChecker, values map[string]string) {
+	c.readSysctl = func(path string) (string, error) {
+		v, ok := values[path]
+		if !ok {
+			return "", errors.New("no such file")
+		}
+		return v, nil
+	}
+	c.writeSysctl = func(path, value string) error {
+		values[path] = value
+		return nil
+	}
+	c.readRPFilter = func(iface string) (int, error) {
+		if values["net/ipv4/conf/"+iface+"/rp_filter"] == "1" {
+			return 1, nil
+		}
+		return 2, nil
+	}
+}
+
+func TestRoutingHealth_FixRPFilter(t *testing.T) {
+	values := map[string]string{"net/ipv4/ip_forward": "1", "net/ipv4/conf/tailscale0/rp_filter": "1"}
+	c := newTestChecker(func(c *RoutingHealthChecker) { fakeSysctl(c, values) })
+
+	require.NotNil(t, c.Check(context.Background()))
+	rh, err := c.Fix(context.Background(), "rp_filter")
+	require.NoError(t, err)
+	assert.Nil(t, rh, "the fresh check must not serve the cached warning")
+	assert.Equal(t, "2", values["net/ipv4/conf/tailscale0/rp_filter"])
+}
+
+func TestRoutingHealth_FixRolledBackWhenStillFailing(t *testing.T) {
+	values := map[string]string{"net/ipv4/ip_forward": "0", "net/ipv6/conf/all/forwarding": "0"}
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		fakeSysctl(c, values)
+		// The v6 write "succeeds" but the kernel keeps forwarding off.
+		c.writeSysctl = func(path, value string) error {
+			if !strings.HasPrefix(path, "net/ipv6") {
+				values[path] = value
+			}
+			return nil
+		}
+	})
+
+	_, err := c.Fix(context.Background(), "ip_forward")
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrInternal, se.Kind)
+	assert.Contains(t, se.Message, "still failing")
+	assert.Equal(t, "0", values["net/ipv4/ip_forward"], "the v4 write must be undone")
+}
+
+func TestRoutingHealth_FixMTU(t *testing.T) {
+	mtu := 1500
+	c := newTestChecker(func(c *RoutingHealthChecker) {
+		c.ifaceMTU = func(string) (int, error) { return mtu, nil }
+		c.setIfaceMTU = func(_ string, v int) error { mtu = v; return nil }
+	})
+	rh, err := c.Fix(context.Background(), "tailscale_mtu")
+	require.NoError(t, err)
+	assert.Nil(t, rh)
+	assert.Equal(t, tailscaleMTU, mtu)
+}
+
+func TestRoutingHealth_FixRejects(t *testing.T) {
+	c := newTestChecker()
+	var se *Error
+
+	_, err := c.Fix(context.Background(), "nope")
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrNotFound, se.Kind)
+
+	_, err = c.Fix(context.Background(), "bypass_mark")
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrValidation, se.Kind, "a check without a fix must be rejected")
+
+	var nilChecker *RoutingHealthChecker
+	_, err = nilChecker.Fix(context.Background(), "rp_filter")
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrUnavailable, se.Kind)
+}
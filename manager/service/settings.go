@@ -211,6 +211,29 @@ func (svc *SettingsService) SetSettings(ctx context.Context, req *SettingsReques
 	}, nil
 }
 
+// PlanSettings runs the firewall side of SetSettings against fw and
+// manifest, for a dry run: DNS forwarding and the WAN port swaps. Tailscale
+// prefs and the port file are left alone.
+func (svc *SettingsService) PlanSettings(ctx context.Context, req *SettingsRequest, fw SettingsFirewall, manifest SettingsManifest) error {
+	if _, err := svc.validate(ctx, req); err != nil {
+		return err
+	}
+	plan := *svc
+	plan.fw, plan.manifest = fw, manifest
+	if req.AcceptDNS != nil {
+		if err := plan.applyDNSForwarding(ctx, *req.AcceptDNS); err != nil {
+			return err
+		}
+	}
+	old, err := plan.fetchPreEditPrefs(ctx, req)
+	if err != nil {
+		return err
+	}
+	plan.updateRelayPortRules(ctx, req.RelayServerPort, old.relayPort)
+	plan.updateTailscaleWgPortRules(ctx, req.UDPPort)
+	return nil
+}
+
 // --- Private helpers ---
 
 func (svc *SettingsService) validate(ctx context.Context, req *SettingsRequest) ([]netip.AddrPort, error) {
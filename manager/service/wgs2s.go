@@ -3,11 +3,14 @@ package service
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -37,6 +40,11 @@ const (
 	// wgMaxNameLen bounds the tunnel display name. Without it a multi-KB name
 	// is persisted and echoed back on every list call (self-DoS).
 	wgMaxNameLen = 128
+
+	// wgMaxPeers bounds the peer list of one hub tunnel. Every peer costs a
+	// wgctrl entry plus its routes; 64 spokes per interface is well past any
+	// branch-office layout we support.
+	wgMaxPeers = 64
 )
 
 // --- Interfaces ---
@@ -50,6 +58,13 @@ type WgS2sWireGuard interface {
 	GetTunnels() []wgs2s.TunnelConfig
 	GetStatuses() []wgs2s.WgS2sStatus
 	GetPublicKey(id string) (string, error)
+	GetPresharedKey(id, peerPublicKey string) (string, error)
+	PrepareKeyRotation(id string, scheduledAt time.Time) (*wgs2s.WgKeyRotation, error)
+	CommitKeyRotation(id string) error
+	CancelKeyRotation(id string) error
+	ReResolveEndpoints(ctx context.Context, now time.Time) []wgs2s.WgS2sEndpointChange
+	CheckFailover(ctx context.Context, now time.Time) []wgs2s.WgS2sFailoverEvent
+	RunReachabilityProbes(ctx context.Context, now time.Time) []wgs2s.WgS2sReachabilityEvent
 }
 
 type WgS2sFirewall interface {
@@ -160,6 +175,10 @@ type Keypair struct {
 	PrivateKey string `json:"privateKey"`
 }
 
+type PresharedKey struct {
+	PresharedKey string `json:"presharedKey"`
+}
+
 // --- Service ---
 
 type WgS2sService struct {
@@ -171,6 +190,12 @@ type WgS2sService struct {
 	validateSubnets SubnetValidator
 	wanIP           WanIPProvider
 	localSubnets    LocalSubnetsProvider
+	pairing         PairingStore
+
+	rotationMu     sync.Mutex
+	rotationWarned map[string]bool
+
+	pairingMu sync.Mutex
 }
 
 type WgS2sConfig struct {
@@ -181,6 +206,7 @@ type WgS2sConfig struct {
 	ValidateSubnets SubnetValidator
 	WanIP           WanIPProvider
 	LocalSubnets    LocalSubnetsProvider
+	Pairing         PairingStore
 }
 
 func NewWgS2sService(cfg WgS2sConfig) *WgS2sService {
@@ -192,6 +218,7 @@ func NewWgS2sService(cfg WgS2sConfig) *WgS2sService {
 		validateSubnets: cfg.ValidateSubnets,
 		wanIP:           cfg.WanIP,
 		localSubnets:    cfg.LocalSubnets,
+		pairing:         cfg.Pairing,
 	}
 }
 
@@ -238,6 +265,14 @@ func (svc *WgS2sService) CreateTunnel(ctx context.Context, req *WgS2sCreateReque
 	if err := validateCreateRequest(req); err != nil {
 		return nil, validationError(err.Error())
 	}
+	wgs2s.NormalizePeers(&req.TunnelConfig)
+	wgs2s.NormalizeAddresses(&req.TunnelConfig)
+	if err := validateProbeTarget(req.Failover, req.AllowedIPs); err != nil {
+		return nil, validationError(err.Error())
+	}
+	if err := validateProbeTargets(req.Probes, req.AllowedIPs); err != nil {
+		return nil, validationError(err.Error())
+	}
 
 	var warnings []SubnetConflict
 	if svc.validateSubnets != nil {
@@ -291,12 +326,44 @@ func (svc *WgS2sService) UpdateTunnel(ctx context.Context, id string, updates wg
 	oldPort := 0
 	if existing != nil {
 		oldPort = existing.ListenPort
+		if updates.Peers == nil && len(existing.Peers) > 1 &&
+			(updates.PeerPublicKey != "" || updates.PeerEndpoint != "" || updates.AllowedIPs != nil || updates.PresharedKey != "" || updates.ClearPresharedKey) {
+			return nil, validationError("tunnel has multiple peers; send the full peers list instead of peerPublicKey/peerEndpoint/allowedIPs")
+		}
+	}
+
+	// Peers replaces the whole list, so its union is the new remote side.
+	remoteSubnets := updates.AllowedIPs
+	if updates.Peers != nil {
+		normalized := wgs2s.TunnelConfig{Peers: updates.Peers}
+		wgs2s.NormalizePeers(&normalized)
+		remoteSubnets = normalized.AllowedIPs
+	}
+	subnetsChanged := updates.AllowedIPs != nil || updates.Peers != nil
+
+	if existing != nil {
+		failover, probes, subnets := existing.Failover, existing.Probes, existing.AllowedIPs
+		if updates.Failover != nil {
+			failover = updates.Failover
+		}
+		if updates.Probes != nil {
+			probes = updates.Probes
+		}
+		if subnetsChanged {
+			subnets = remoteSubnets
+		}
+		if err := validateProbeTarget(failover, subnets); err != nil {
+			return nil, validationError(err.Error())
+		}
+		if err := validateProbeTargets(probes, subnets); err != nil {
+			return nil, validationError(err.Error())
+		}
 	}
 
 	var warnings []SubnetConflict
-	if updates.AllowedIPs != nil && existing != nil && svc.validateSubnets != nil {
+	if subnetsChanged && existing != nil && svc.validateSubnets != nil {
 		var blocks []SubnetConflict
-		warnings, blocks = svc.validateSubnets(updates.AllowedIPs, existing.InterfaceName)
+		warnings, blocks = svc.validateSubnets(remoteSubnets, existing.InterfaceName)
 		if len(blocks) > 0 {
 			return nil, &SubnetConflictError{
 				Msg:       fmt.Sprintf("Subnet conflict: %s", blocks[0].Message),
@@ -312,7 +379,7 @@ func (svc *WgS2sService) UpdateTunnel(ctx context.Context, id string, updates wg
 	}
 
 	var fwErr error
-	if updates.AllowedIPs != nil && tunnel.Enabled && existing != nil && svc.fw != nil {
+	if subnetsChanged && tunnel.Enabled && existing != nil && svc.fw != nil {
 		svc.fw.RemoveIPSetEntries(ctx, id, existing.AllowedIPs)
 		fwErr = svc.fw.SetupFirewall(ctx, tunnel.ID, tunnel.InterfaceName, tunnel.AllowedIPs)
 		if fwErr != nil {
@@ -440,7 +507,19 @@ func (svc *WgS2sService) GenerateKeypair() (*Keypair, error) {
 	}, nil
 }
 
-func (svc *WgS2sService) GetConfig(_ context.Context, id string) (string, error) {
+func (svc *WgS2sService) GeneratePresharedKey() (*PresharedKey, error) {
+	psk, err := wgtypes.GenerateKey()
+	if err != nil {
+		return nil, internalError("failed to generate preshared key")
+	}
+	return &PresharedKey{PresharedKey: psk.String()}, nil
+}
+
+// GetConfig renders the wg-quick config the remote side needs. peer selects
+// which peer the export is for; it may be empty on single-peer tunnels. The
+// preshared key, if that peer has one, is included because the remote side
+// cannot complete a handshake without it.
+func (svc *WgS2sService) GetConfig(_ context.Context, id, peer string) (string, error) {
 	tunnel := svc.findTunnelByID(id)
 	if tunnel == nil {
 		return "", notFoundError("tunnel not found")
@@ -451,25 +530,26 @@ func (svc *WgS2sService) GetConfig(_ context.Context, id string) (string, error)
 		return "", internalError("failed to read public key")
 	}
 
+	if peer == "" && len(tunnel.Peers) == 1 {
+		peer = tunnel.Peers[0].PublicKey
+	}
+	psk := ""
+	if peer != "" {
+		if !slices.ContainsFunc(tunnel.Peers, func(p wgs2s.Peer) bool { return p.PublicKey == peer }) {
+			return "", validationError("peer not found on tunnel")
+		}
+		psk, err = svc.loadWG().GetPresharedKey(id, peer)
+		if err != nil {
+			return "", internalError("failed to read preshared key")
+		}
+	}
+
 	wanIP := ""
 	if svc.wanIP != nil {
 		wanIP = svc.wanIP()
 	}
 
-	var allowedIPs []string
-	if len(tunnel.LocalSubnets) > 0 {
-		allowedIPs = append(allowedIPs, tunnel.LocalSubnets...)
-	} else if svc.localSubnets != nil {
-		for _, sub := range svc.localSubnets() {
-			allowedIPs = append(allowedIPs, sub.CIDR)
-		}
-	}
-	if tunnel.TunnelAddress != "" {
-		ip, _, err := net.ParseCIDR(tunnel.TunnelAddress)
-		if err == nil {
-			allowedIPs = append(allowedIPs, ip.String()+"/32")
-		}
-	}
+	allowedIPs := svc.exportedAllowedIPs(*tunnel)
 
 	var b strings.Builder
 	b.WriteString("[Interface]\n")
@@ -478,6 +558,9 @@ func (svc *WgS2sService) GetConfig(_ context.Context, id string) (string, error)
 	fmt.Fprintf(&b, "ListenPort = %d\n", tunnel.ListenPort)
 	b.WriteString("\n[Peer]\n")
 	fmt.Fprintf(&b, "PublicKey = %s\n", pubKey)
+	if psk != "" {
+		fmt.Fprintf(&b, "PresharedKey = %s\n", psk)
+	}
 	if wanIP != "" {
 		fmt.Fprintf(&b, "Endpoint = %s:%d\n", wanIP, tunnel.ListenPort)
 	}
@@ -491,6 +574,21 @@ func (svc *WgS2sService) GetConfig(_ context.Context, id string) (string, error)
 	return b.String(), nil
 }
 
+// exportedAllowedIPs is what the remote side should route into the tunnel:
+// our local subnets (the tunnel's own list, else every LAN) plus a host
+// route for each of our tunnel addresses.
+func (svc *WgS2sService) exportedAllowedIPs(tunnel wgs2s.TunnelConfig) []string {
+	var allowedIPs []string
+	if len(tunnel.LocalSubnets) > 0 {
+		allowedIPs = append(allowedIPs, tunnel.LocalSubnets...)
+	} else if svc.localSubnets != nil {
+		for _, sub := range svc.localSubnets() {
+			allowedIPs = append(allowedIPs, sub.CIDR)
+		}
+	}
+	return append(allowedIPs, tunnelHostRoutes(tunnel)...)
+}
+
 func (svc *WgS2sService) GetWanIP() string {
 	if svc.wanIP != nil {
 		return svc.wanIP()
@@ -646,6 +744,94 @@ func (svc *WgS2sService) SetupZoneForTunnel(ctx context.Context, tunnelID string
 	return result, nil
 }
 
+// PlanZoneForTunnel is SetupZoneForTunnel against fw and manifest instead
+// of the service's own, for a dry run whose firewall only records.
+func (svc *WgS2sService) PlanZoneForTunnel(ctx context.Context, tunnelID string, fw WgS2sFirewall, manifest WgS2sManifest) (*ZoneSetupResult, error) {
+	plan := &WgS2sService{wg: svc.loadWG(), fw: fw, manifest: manifest, logger: svc.logger}
+	return plan.SetupZoneForTunnel(ctx, tunnelID)
+}
+
+// PlanCreateTunnel is CreateTunnel against fw and manifest, for a dry run.
+// The tunnel itself is only described: it gets a placeholder ID and the
+// interface name it would have been given.
+func (svc *WgS2sService) PlanCreateTunnel(ctx context.Context, req *WgS2sCreateRequest, fw WgS2sFirewall, manifest WgS2sManifest) (*TunnelCreateResponse, error) {
+	plan := &WgS2sService{wg: plannedWireGuard{live: svc.loadWG()}, fw: fw, manifest: manifest, logger: svc.logger, validateSubnets: svc.validateSubnets}
+	return plan.CreateTunnel(ctx, req)
+}
+
+// PlanDeleteTunnel is DeleteTunnel against fw and manifest, for a dry run.
+// The tunnel is left in place.
+func (svc *WgS2sService) PlanDeleteTunnel(ctx context.Context, id string, fw WgS2sFirewall, manifest WgS2sManifest) error {
+	plan := &WgS2sService{wg: plannedWireGuard{live: svc.loadWG()}, fw: fw, manifest: manifest, logger: svc.logger}
+	return plan.DeleteTunnel(ctx, id)
+}
+
+// plannedTunnelID stands in for the ID a planned tunnel would be given.
+const plannedTunnelID = "planned-tunnel"
+
+// errNotPlanned is what a dry run's tunnel manager returns for a write it
+// has no plan for, rather than making it.
+var errNotPlanned = errors.New("not supported in a dry run")
+
+// plannedWireGuard reads through to the tunnel manager but only describes
+// the tunnels it would create or delete. It implements every method itself
+// so that no write reaches the manager.
+type plannedWireGuard struct {
+	live WgS2sWireGuard
+}
+
+// CreateTunnel checks cfg as the manager would, port included, and returns
+// the tunnel it would have created.
+func (w plannedWireGuard) CreateTunnel(cfg wgs2s.TunnelConfig, privateKey string) (*wgs2s.TunnelConfig, error) {
+	if err := wgs2s.PrepareNewTunnel(&cfg, privateKey); err != nil {
+		return nil, err
+	}
+	cfg.ID = plannedTunnelID
+	cfg.InterfaceName = wgs2s.NextInterfaceName(w.live.GetTunnels())
+	cfg.Enabled = true
+	return &cfg, nil
+}
+
+func (plannedWireGuard) DeleteTunnel(string) error { return nil }
+
+func (w plannedWireGuard) GetTunnels() []wgs2s.TunnelConfig { return w.live.GetTunnels() }
+
+func (w plannedWireGuard) GetStatuses() []wgs2s.WgS2sStatus { return w.live.GetStatuses() }
+
+func (w plannedWireGuard) GetPublicKey(id string) (string, error) { return w.live.GetPublicKey(id) }
+
+func (w plannedWireGuard) GetPresharedKey(id, peerPublicKey string) (string, error) {
+	return w.live.GetPresharedKey(id, peerPublicKey)
+}
+
+func (plannedWireGuard) EnableTunnel(string) error  { return errNotPlanned }
+func (plannedWireGuard) DisableTunnel(string) error { return errNotPlanned }
+
+func (plannedWireGuard) UpdateTunnel(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+	return nil, errNotPlanned
+}
+
+func (plannedWireGuard) PrepareKeyRotation(string, time.Time) (*wgs2s.WgKeyRotation, error) {
+	return nil, errNotPlanned
+}
+
+func (plannedWireGuard) CommitKeyRotation(string) error { return errNotPlanned }
+func (plannedWireGuard) CancelKeyRotation(string) error { return errNotPlanned }
+
+// The periodic checks act on what they find, so a dry run finds nothing.
+
+func (plannedWireGuard) ReResolveEndpoints(context.Context, time.Time) []wgs2s.WgS2sEndpointChange {
+	return nil
+}
+
+func (plannedWireGuard) CheckFailover(context.Context, time.Time) []wgs2s.WgS2sFailoverEvent {
+	return nil
+}
+
+func (plannedWireGuard) RunReachabilityProbes(context.Context, time.Time) []wgs2s.WgS2sReachabilityEvent {
+	return nil
+}
+
 func firewallResultStatus(zoneResult *ZoneSetupResult, fwErr error) string {
 	if !zoneResult.hasErrors() && fwErr == nil {
 		return "ok"
@@ -697,18 +883,38 @@ func validateCreateRequest(req *WgS2sCreateRequest) error {
 	if err := validateKeepalive(cfg.PersistentKeepalive); err != nil {
 		return err
 	}
-	if err := validateCIDR(cfg.TunnelAddress); err != nil {
+	if len(cfg.TunnelAddresses) > 0 {
+		if err := validateTunnelAddresses(cfg.TunnelAddresses); err != nil {
+			return err
+		}
+	} else if err := validateCIDR(cfg.TunnelAddress); err != nil {
 		return fmt.Errorf("invalid tunnelAddress: %s", err)
 	}
-	if err := validateBase64Key(cfg.PeerPublicKey); err != nil {
+	if len(cfg.Peers) > 0 {
+		if err := validatePeers(cfg.Peers); err != nil {
+			return err
+		}
+	} else if err := validateBase64Key(cfg.PeerPublicKey); err != nil {
 		return fmt.Errorf("invalid peerPublicKey: %s", err)
 	}
+	if err := validatePresharedKey(cfg.PresharedKey, "presharedKey"); err != nil {
+		return err
+	}
+	if cfg.PresharedKey != "" && len(cfg.Peers) > 1 {
+		return fmt.Errorf("presharedKey is ambiguous with multiple peers; set it per peer")
+	}
 	if err := validateCIDRList(cfg.AllowedIPs, "allowedIP"); err != nil {
 		return err
 	}
 	if err := validateCIDRList(cfg.LocalSubnets, "localSubnet"); err != nil {
 		return err
 	}
+	if err := validateFailover(cfg.Failover, true); err != nil {
+		return err
+	}
+	if err := validateProbes(cfg.Probes); err != nil {
+		return err
+	}
 	return validateRouteMetric(cfg.RouteMetric)
 }
 
@@ -731,20 +937,138 @@ func validateUpdateRequest(updates *wgs2s.TunnelConfig) error {
 			return fmt.Errorf("invalid tunnelAddress: %s", err)
 		}
 	}
+	if updates.TunnelAddresses != nil {
+		if len(updates.TunnelAddresses) == 0 {
+			return fmt.Errorf("tunnelAddresses must not be empty")
+		}
+		if err := validateTunnelAddresses(updates.TunnelAddresses); err != nil {
+			return err
+		}
+	}
 	if updates.PeerPublicKey != "" {
 		if err := validateBase64Key(updates.PeerPublicKey); err != nil {
 			return fmt.Errorf("invalid peerPublicKey: %s", err)
 		}
 	}
+	if err := validatePresharedKey(updates.PresharedKey, "presharedKey"); err != nil {
+		return err
+	}
+	if updates.PresharedKey != "" && updates.ClearPresharedKey {
+		return fmt.Errorf("presharedKey and clearPresharedKey are mutually exclusive")
+	}
+	if updates.Peers != nil {
+		if len(updates.Peers) == 0 {
+			return fmt.Errorf("peers must not be empty")
+		}
+		if err := validatePeers(updates.Peers); err != nil {
+			return err
+		}
+	}
 	if err := validateCIDRList(updates.AllowedIPs, "allowedIP"); err != nil {
 		return err
 	}
 	if err := validateCIDRList(updates.LocalSubnets, "localSubnet"); err != nil {
 		return err
 	}
+	if err := validateFailover(updates.Failover, false); err != nil {
+		return err
+	}
+	if err := validateProbes(updates.Probes); err != nil {
+		return err
+	}
 	return validateRouteMetric(updates.RouteMetric)
 }
 
+// validateTunnelAddresses allows one address per family: the exported
+// config and a flat tunnelAddress update both pick "the" address of a family.
+func validateTunnelAddresses(addrs []string) error {
+	var seenV4, seenV6 bool
+	for i, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil {
+			return fmt.Errorf("invalid tunnelAddresses[%d]: not a valid CIDR notation", i)
+		}
+		seen := &seenV4
+		if ip.To4() == nil {
+			seen = &seenV6
+		}
+		if *seen {
+			return fmt.Errorf("tunnelAddresses may hold at most one IPv4 and one IPv6 address")
+		}
+		*seen = true
+	}
+	return nil
+}
+
+// tunnelHostRoutes returns a host route (/32 or /128) for each of the
+// tunnel's addresses, so the remote side routes our end of the tunnel back
+// through it.
+func tunnelHostRoutes(t wgs2s.TunnelConfig) []string {
+	addrs := t.TunnelAddresses
+	if len(addrs) == 0 && t.TunnelAddress != "" {
+		addrs = []string{t.TunnelAddress}
+	}
+	var out []string
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil {
+			continue
+		}
+		if ip.To4() != nil {
+			out = append(out, ip.String()+"/32")
+		} else {
+			out = append(out, ip.String()+"/128")
+		}
+	}
+	return out
+}
+
+// validatePeers checks a multi-peer list. Keys must be unique, and the same
+// CIDR may not be routed to two peers: WireGuard's cryptokey routing would
+// silently hand it to whichever peer was programmed last.
+func validatePeers(peers []wgs2s.Peer) error {
+	if len(peers) > wgMaxPeers {
+		return fmt.Errorf("at most %d peers per tunnel", wgMaxPeers)
+	}
+	keys := make(map[string]bool, len(peers))
+	owner := make(map[string]int)
+	for i, p := range peers {
+		if err := validateName(p.Name); err != nil {
+			return fmt.Errorf("invalid peers[%d]: %s", i, err)
+		}
+		if err := validateBase64Key(p.PublicKey); err != nil {
+			return fmt.Errorf("invalid peers[%d].publicKey: %s", i, err)
+		}
+		if keys[p.PublicKey] {
+			return fmt.Errorf("peers[%d].publicKey duplicates another peer", i)
+		}
+		keys[p.PublicKey] = true
+		if p.PersistentKeepalive != domain.WgKeepaliveOff {
+			if err := validateKeepalive(p.PersistentKeepalive); err != nil {
+				return fmt.Errorf("invalid peers[%d]: %s", i, err)
+			}
+		}
+		if err := validatePresharedKey(p.PresharedKey, fmt.Sprintf("peers[%d].presharedKey", i)); err != nil {
+			return err
+		}
+		if p.PresharedKey != "" && p.ClearPresharedKey {
+			return fmt.Errorf("peers[%d]: presharedKey and clearPresharedKey are mutually exclusive", i)
+		}
+		if err := validateCIDRList(p.AllowedIPs, fmt.Sprintf("peers[%d].allowedIP", i)); err != nil {
+			return err
+		}
+		for _, cidr := range p.AllowedIPs {
+			_, ipNet, _ := net.ParseCIDR(cidr)
+			key := ipNet.String()
+			if prev, dup := owner[key]; dup {
+				return fmt.Errorf("allowedIP %s is assigned to both peers[%d] and peers[%d]", cidr, prev, i)
+			}
+			owner[key] = i
+		}
+	}
+	return nil
+}
+
 func validateCIDRList(cidrs []string, fieldName string) error {
 	for _, cidr := range cidrs {
 		if err := validateCIDR(cidr); err != nil {
@@ -816,6 +1140,18 @@ func validateBase64Key(s string) error {
 	return nil
 }
 
+// validatePresharedKey accepts "" (no PSK, or keep the stored one on update).
+// The error never echoes the value.
+func validatePresharedKey(s, fieldName string) error {
+	if s == "" {
+		return nil
+	}
+	if err := validateBase64Key(s); err != nil {
+		return fmt.Errorf("invalid %s: %s", fieldName, err)
+	}
+	return nil
+}
+
 func humanizeWgS2sError(err error) string {
 	if err == nil {
 		return ""
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+// ReResolveEndpoints re-points stale peers whose DDNS hostname now resolves
+// elsewhere (see TunnelManager.ReResolveEndpoints) and returns what moved so
+// the caller can announce it. Each move is also written to the activity log:
+// a remote site changing address is worth a line even when nobody is
+// watching the dashboard.
+func (svc *WgS2sService) ReResolveEndpoints(ctx context.Context, now time.Time) []wgs2s.WgS2sEndpointChange {
+	wg := svc.loadWG()
+	if wg == nil {
+		return nil
+	}
+	changes := wg.ReResolveEndpoints(ctx, now)
+	if svc.logger != nil {
+		for _, c := range changes {
+			svc.logger.LogWarn(fmt.Sprintf("peer endpoint re-resolved tunnel=%s endpoint=%s old=%s new=%s",
+				c.TunnelName, c.Endpoint, c.OldAddress, c.NewAddress))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+func TestReResolveEndpoints_LogsEachChange(t *testing.T) {
+	logger := &mockWgS2sLogger{}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		reResolveFn: func(time.Time) []wgs2s.WgS2sEndpointChange {
+			return []wgs2s.WgS2sEndpointChange{{
+				TunnelID: "t1", TunnelName: "branch", Endpoint: "hq.example.net:51820",
+				OldAddress: "198.51.100.1:51820", NewAddress: "203.0.113.7:51820",
+			}}
+		},
+	}, func(s *WgS2sService) { s.logger = logger })
+
+	changes := svc.ReResolveEndpoints(context.Background(), time.Now())
+
+	assert.Len(t, changes, 1)
+	if assert.Len(t, logger.warnings, 1) {
+		assert.Contains(t, logger.warnings[0], "new=203.0.113.7:51820")
+	}
+}
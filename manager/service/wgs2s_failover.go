@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+// wgMaxFailoverGroupLen bounds a failover group name; it is only a label
+// shared by the member tunnels.
+const wgMaxFailoverGroupLen = 64
+
+// CheckFailover runs one round of the failover monitor and returns the role
+// changes for the caller to announce. A member failing or coming back is
+// written to the activity log: it moves traffic between sites.
+func (svc *WgS2sService) CheckFailover(ctx context.Context, now time.Time) []wgs2s.WgS2sFailoverEvent {
+	wg := svc.loadWG()
+	if wg == nil {
+		return nil
+	}
+	events := wg.CheckFailover(ctx, now)
+	for _, e := range events {
+		slog.Info("wg-s2s failover", "id", e.TunnelID, "group", e.Group, "from", e.From, "to", e.To, "reason", e.Reason)
+		if svc.logger != nil && (e.From == wgs2s.FailoverFailed || e.To == wgs2s.FailoverFailed) {
+			svc.logger.LogWarn(fmt.Sprintf("failover group=%s tunnel=%s %s -> %s %s",
+				e.Group, e.TunnelName, e.From, e.To, e.Reason))
+		}
+	}
+	return events
+}
+
+// validateFailover checks the failover setting of a create (group required)
+// or an update (empty group clears the setting).
+func validateFailover(f *wgs2s.WgFailover, create bool) error {
+	if f == nil {
+		return nil
+	}
+	if f.Group == "" {
+		if create {
+			return fmt.Errorf("failover.group is required")
+		}
+		if f.Probe != nil {
+			return fmt.Errorf("failover.probe requires failover.group")
+		}
+		return nil
+	}
+	if len(f.Group) > wgMaxFailoverGroupLen {
+		return fmt.Errorf("failover.group must be at most %d characters", wgMaxFailoverGroupLen)
+	}
+	for _, r := range f.Group {
+		isAlnum := (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isAlnum && r != '-' && r != '_' && r != '.' {
+			return fmt.Errorf("failover.group may only contain letters, digits, '-', '_' and '.'")
+		}
+	}
+	if f.Probe == nil {
+		return nil
+	}
+	return validateHealthProbe(*f.Probe, "failover.probe")
+}
+
+// validateHealthProbe checks one probe; field prefixes the error messages.
+func validateHealthProbe(p wgs2s.WgHealthProbe, field string) error {
+	if _, err := netip.ParseAddr(p.Target); err != nil {
+		return fmt.Errorf("%s.target must be an IP address", field)
+	}
+	switch p.Kind {
+	case wgs2s.HealthProbeICMP:
+		if p.Port != 0 {
+			return fmt.Errorf("%s.port is only valid for tcp probes", field)
+		}
+	case wgs2s.HealthProbeTCP:
+		if p.Port < 1 || p.Port > wgMaxPort {
+			return fmt.Errorf("%s.port must be between 1 and 65535", field)
+		}
+	default:
+		return fmt.Errorf("%s.kind must be %q or %q", field, wgs2s.HealthProbeICMP, wgs2s.HealthProbeTCP)
+	}
+	return nil
+}
+
+// validateProbeTarget requires the probe target to sit inside the tunnel's
+// remote subnets. WireGuard drops anything the peers' AllowedIPs do not
+// cover, so a probe to any other address would fail the member forever.
+func validateProbeTarget(f *wgs2s.WgFailover, remoteSubnets []string) error {
+	if f == nil || f.Probe == nil {
+		return nil
+	}
+	if !insideSubnets(f.Probe.Target, remoteSubnets) {
+		return fmt.Errorf("failover.probe.target must be inside the tunnel's allowedIPs")
+	}
+	return nil
+}
+
+func insideSubnets(target string, subnets []string) bool {
+	ip := net.ParseIP(target)
+	for _, cidr := range subnets {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
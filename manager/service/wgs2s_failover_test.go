@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+func TestUpdateTunnel_ProbeTargetOutsideAllowedIPsRejected(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig {
+			return []wgs2s.TunnelConfig{{ID: "t1", AllowedIPs: []string{"10.50.0.0/24"}}}
+		},
+		updateTunnelFn: func(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+			t.Fatal("an unreachable probe target must be rejected before the manager is touched")
+			return nil, nil
+		},
+	})
+	probe := &wgs2s.WgHealthProbe{Kind: wgs2s.HealthProbeICMP, Target: "192.168.1.1"}
+	_, err := svc.UpdateTunnel(context.Background(), "t1", wgs2s.TunnelConfig{
+		Failover: &wgs2s.WgFailover{Group: "hq", Probe: probe},
+	})
+
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrValidation, se.Kind)
+	assert.Contains(t, se.Message, "allowedIPs")
+}
+
+func TestCheckFailover_LogsOnlyFailures(t *testing.T) {
+	logger := &mockWgS2sLogger{}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		checkFailoverFn: func(time.Time) []wgs2s.WgS2sFailoverEvent {
+			return []wgs2s.WgS2sFailoverEvent{
+				{TunnelID: "p", Group: "hq", From: wgs2s.FailoverActive, To: wgs2s.FailoverFailed, Reason: "no handshake"},
+				{TunnelID: "b", Group: "hq", From: wgs2s.FailoverStandby, To: wgs2s.FailoverActive},
+			}
+		},
+	}, func(s *WgS2sService) { s.logger = logger })
+
+	events := svc.CheckFailover(context.Background(), time.Now())
+
+	assert.Len(t, events, 2)
+	assert.Len(t, logger.warnings, 1, "a standby taking over is not a warning on its own")
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+const wgQuickMaxConfigLen = 64 << 10
+
+// WgS2sImportRequest carries a wg-quick config file plus the settings a
+// wg-quick file has no place for. ListenPort is only used when the file does
+// not set one.
+type WgS2sImportRequest struct {
+	Name         string   `json:"name"`
+	Config       string   `json:"config"`
+	ListenPort   int      `json:"listenPort,omitempty"`
+	LocalSubnets []string `json:"localSubnets,omitempty"`
+	RouteMetric  int      `json:"routeMetric,omitempty"`
+	ZoneID       string   `json:"zoneId,omitempty"`
+	ZoneName     string   `json:"zoneName,omitempty"`
+	CreateZone   bool     `json:"createZone,omitempty"`
+}
+
+// TunnelImportResponse is a create response plus the wg-quick keys that were
+// recognised but have no equivalent here (PostUp scripts, DNS, ...).
+type TunnelImportResponse struct {
+	TunnelCreateResponse
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// wg-quick settings that only make sense to the wg-quick script itself. The
+// manager owns routing, firewall and DNS for its tunnels, so these are
+// dropped and reported rather than rejected.
+var wgQuickIgnoredKeys = map[string]bool{
+	"dns": true, "table": true, "fwmark": true, "saveconfig": true,
+	"preup": true, "postup": true, "predown": true, "postdown": true,
+}
+
+// ImportTunnel creates a tunnel from a wg-quick config file, keeping its
+// private key so the remote side needs no change. The parsed tunnel goes
+// through exactly the checks of CreateTunnel.
+func (svc *WgS2sService) ImportTunnel(ctx context.Context, req *WgS2sImportRequest) (*TunnelImportResponse, error) {
+	create, ignored, err := ParseWgQuickConfig(req.Config)
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+	if create.PrivateKey == "" {
+		return nil, validationError("config has no PrivateKey in [Interface]")
+	}
+	if err := validateBase64Key(create.PrivateKey); err != nil {
+		return nil, validationError(fmt.Sprintf("invalid PrivateKey: %s", err))
+	}
+	if len(create.Peers) == 0 {
+		return nil, validationError("config has no [Peer] section")
+	}
+
+	create.Name = strings.TrimSpace(req.Name)
+	if create.ListenPort == 0 {
+		create.ListenPort = req.ListenPort
+	}
+	create.LocalSubnets = req.LocalSubnets
+	create.RouteMetric = req.RouteMetric
+	create.ZoneID = req.ZoneID
+	create.ZoneName = req.ZoneName
+	create.CreateZone = req.CreateZone
+
+	resp, err := svc.CreateTunnel(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+	return &TunnelImportResponse{TunnelCreateResponse: *resp, Ignored: ignored}, nil
+}
+
+// ParseWgQuickConfig reads a wg-quick .conf into a create request. Keys are
+// matched case-insensitively, Address and AllowedIPs may repeat and
+// accumulate, and # starts a comment anywhere on a line, as in wg-quick.
+// The second return value lists the ignored wg-quick-only keys. Errors name
+// the line and key but never echo a value, since values include keys.
+func ParseWgQuickConfig(text string) (*WgS2sCreateRequest, []string, error) {
+	if len(text) > wgQuickMaxConfigLen {
+		return nil, nil, fmt.Errorf("config exceeds %d bytes", wgQuickMaxConfigLen)
+	}
+
+	req := &WgS2sCreateRequest{}
+	var ignored []string
+	var section string
+	var sawInterface bool
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			switch section {
+			case "interface":
+				if sawInterface {
+					return nil, nil, fmt.Errorf("line %d: duplicate [Interface] section", lineNo)
+				}
+				sawInterface = true
+			case "peer":
+				req.Peers = append(req.Peers, wgs2s.Peer{})
+			default:
+				return nil, nil, fmt.Errorf("line %d: unknown section %s", lineNo, line)
+			}
+			continue
+		}
+
+		rawKey, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.ToLower(strings.TrimSpace(rawKey))
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch section {
+		case "interface":
+			err = applyWgQuickInterfaceKey(req, key, value)
+		case "peer":
+			err = applyWgQuickPeerKey(&req.Peers[len(req.Peers)-1], key, value)
+		default:
+			return nil, nil, fmt.Errorf("line %d: %s outside of a section", lineNo, strings.TrimSpace(rawKey))
+		}
+		if errors.Is(err, errWgQuickIgnoredKey) {
+			name := strings.TrimSpace(rawKey)
+			if !slices.Contains(ignored, name) {
+				ignored = append(ignored, name)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read config: %w", err)
+	}
+	if !sawInterface {
+		return nil, nil, fmt.Errorf("config has no [Interface] section")
+	}
+	return req, ignored, nil
+}
+
+var errWgQuickIgnoredKey = errors.New("ignored wg-quick key")
+
+func applyWgQuickInterfaceKey(req *WgS2sCreateRequest, key, value string) error {
+	switch key {
+	case "privatekey":
+		req.PrivateKey = value
+	case "address":
+		req.TunnelAddresses = append(req.TunnelAddresses, splitWgQuickList(value)...)
+	case "listenport":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("ListenPort is not a number")
+		}
+		req.ListenPort = port
+	case "mtu":
+		mtu, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MTU is not a number")
+		}
+		req.MTU = mtu
+	default:
+		if wgQuickIgnoredKeys[key] {
+			return errWgQuickIgnoredKey
+		}
+		return fmt.Errorf("unknown [Interface] key %s", key)
+	}
+	return nil
+}
+
+func applyWgQuickPeerKey(p *wgs2s.Peer, key, value string) error {
+	switch key {
+	case "publickey":
+		p.PublicKey = value
+	case "presharedkey":
+		p.PresharedKey = value
+	case "endpoint":
+		p.Endpoint = value
+	case "allowedips":
+		p.AllowedIPs = append(p.AllowedIPs, splitWgQuickList(value)...)
+	case "persistentkeepalive":
+		// wg-quick's "off" and 0 both disable keepalives; a plain 0 here
+		// would inherit the tunnel default instead.
+		if strings.EqualFold(value, "off") {
+			p.PersistentKeepalive = domain.WgKeepaliveOff
+			return nil
+		}
+		ka, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("PersistentKeepalive is not a number")
+		}
+		if ka == 0 {
+			ka = domain.WgKeepaliveOff
+		}
+		p.PersistentKeepalive = ka
+	default:
+		return fmt.Errorf("unknown [Peer] key %s", key)
+	}
+	return nil
+}
+
+func splitWgQuickList(value string) []string {
+	var out []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+func TestParseWgQuickConfig(t *testing.T) {
+	priv, keyA, keyB, psk := testBase64Key(t), testBase64Key(t), testBase64Key(t), testBase64Key(t)
+	conf := fmt.Sprintf(`# branch office
+[Interface]
+PrivateKey = %s
+Address = 10.255.0.1/30, fd00:255::1/126
+ListenPort = 51820
+MTU = 1380
+PostUp = iptables -A FORWARD -i %%i -j ACCEPT
+DNS = 1.1.1.1
+
+[Peer]
+PublicKey = %s
+PresharedKey = %s
+Endpoint = a.example.com:51820
+AllowedIPs = 10.1.0.0/24
+AllowedIPs = fd00:1::/64 # second line accumulates
+PersistentKeepalive = 25
+
+[peer]
+publickey = %s
+allowedips = 10.2.0.0/24
+persistentkeepalive = off
+`, priv, keyA, psk, keyB)
+
+	req, ignored, err := ParseWgQuickConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, priv, req.PrivateKey)
+	assert.Equal(t, []string{"10.255.0.1/30", "fd00:255::1/126"}, req.TunnelAddresses)
+	assert.Equal(t, 51820, req.ListenPort)
+	assert.Equal(t, 1380, req.MTU)
+	assert.Equal(t, []string{"PostUp", "DNS"}, ignored)
+	require.Len(t, req.Peers, 2)
+	assert.Equal(t, wgs2s.Peer{
+		PublicKey: keyA, PresharedKey: psk, Endpoint: "a.example.com:51820",
+		AllowedIPs: []string{"10.1.0.0/24", "fd00:1::/64"}, PersistentKeepalive: 25,
+	}, req.Peers[0])
+	assert.Equal(t, keyB, req.Peers[1].PublicKey)
+	assert.Equal(t, domain.WgKeepaliveOff, req.Peers[1].PersistentKeepalive, "off must not fall back to the tunnel default")
+}
+
+func TestParseWgQuickConfig_Errors(t *testing.T) {
+	secret := testBase64Key(t)
+	tests := []struct {
+		name, conf, errMsg string
+	}{
+		{"no interface", "[Peer]\nPublicKey = x\n", "no [Interface]"},
+		{"key outside section", "PrivateKey = " + secret + "\n", "outside of a section"},
+		{"unknown section", "[Interface]\n[Wat]\n", "unknown section"},
+		{"unknown key", "[Interface]\nBogus = 1\n", "unknown [Interface] key bogus"},
+		{"bad port", "[Interface]\nListenPort = " + secret + "\n", "line 2: ListenPort"},
+		{"duplicate interface", "[Interface]\n[Interface]\n", "duplicate"},
+		{"no equals", "[Interface]\nPrivateKey\n", "expected key = value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseWgQuickConfig(tt.conf)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+			assert.NotContains(t, err.Error(), secret, "parse errors must not echo values")
+		})
+	}
+}
+
+func TestImportTunnel_CreatesWithProvidedPrivateKey(t *testing.T) {
+	priv, peer := testBase64Key(t), testBase64Key(t)
+	var gotCfg wgs2s.TunnelConfig
+	var gotKey string
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		createTunnelFn: func(cfg wgs2s.TunnelConfig, pk string) (*wgs2s.TunnelConfig, error) {
+			gotCfg, gotKey = cfg, pk
+			cfg.ID = "imp"
+			return &cfg, nil
+		},
+	})
+
+	resp, err := svc.ImportTunnel(context.Background(), &WgS2sImportRequest{
+		Name:       "branch",
+		ListenPort: 51821,
+		Config: fmt.Sprintf("[Interface]\nPrivateKey = %s\nAddress = 10.255.0.2/30\nTable = off\n"+
+			"[Peer]\nPublicKey = %s\nAllowedIPs = 10.1.0.0/24\n", priv, peer),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, priv, gotKey)
+	assert.Equal(t, "branch", gotCfg.Name)
+	assert.Equal(t, 51821, gotCfg.ListenPort, "request listenPort fills in for a file without one")
+	assert.Equal(t, "10.255.0.2/30", gotCfg.TunnelAddress)
+	assert.Equal(t, peer, gotCfg.PeerPublicKey)
+	assert.Equal(t, []string{"10.1.0.0/24"}, gotCfg.AllowedIPs)
+	assert.Equal(t, []string{"Table"}, resp.Ignored)
+	assert.Equal(t, "imp", resp.ID)
+}
+
+func TestImportTunnel_KeepsKeepaliveOff(t *testing.T) {
+	priv, peer := testBase64Key(t), testBase64Key(t)
+	var gotCfg wgs2s.TunnelConfig
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		createTunnelFn: func(cfg wgs2s.TunnelConfig, _ string) (*wgs2s.TunnelConfig, error) {
+			gotCfg = cfg
+			return &cfg, nil
+		},
+	})
+
+	_, err := svc.ImportTunnel(context.Background(), &WgS2sImportRequest{
+		Name: "branch",
+		Config: fmt.Sprintf("[Interface]\nPrivateKey = %s\nAddress = 10.255.0.2/30\nListenPort = 51820\n"+
+			"[Peer]\nPublicKey = %s\nAllowedIPs = 10.1.0.0/24\nPersistentKeepalive = 0\n", priv, peer),
+	})
+	require.NoError(t, err)
+
+	require.Len(t, gotCfg.Peers, 1)
+	assert.Equal(t, domain.WgKeepaliveOff, gotCfg.Peers[0].PersistentKeepalive)
+}
+
+func TestImportTunnel_RunsCreateChecks(t *testing.T) {
+	priv, peer := testBase64Key(t), testBase64Key(t)
+	conf := fmt.Sprintf("[Interface]\nPrivateKey = %s\nAddress = 10.255.0.2/30\nListenPort = 51820\n"+
+		"[Peer]\nPublicKey = %s\nAllowedIPs = 192.168.1.0/24\n", priv, peer)
+
+	t.Run("subnet conflict blocks", func(t *testing.T) {
+		svc := newTestWgS2sService(&mockWgS2sWireGuard{
+			createTunnelFn: func(wgs2s.TunnelConfig, string) (*wgs2s.TunnelConfig, error) {
+				t.Fatal("a blocked import must not create the tunnel")
+				return nil, nil
+			},
+		}, func(s *WgS2sService) {
+			s.validateSubnets = func(cidrs []string, _ ...string) ([]SubnetConflict, []SubnetConflict) {
+				return nil, []SubnetConflict{{CIDR: cidrs[0], Message: "overlaps br0"}}
+			}
+		})
+		_, err := svc.ImportTunnel(context.Background(), &WgS2sImportRequest{Name: "x", Config: conf})
+		var sce *SubnetConflictError
+		require.ErrorAs(t, err, &sce)
+	})
+	t.Run("missing name", func(t *testing.T) {
+		svc := newTestWgS2sService(&mockWgS2sWireGuard{})
+		_, err := svc.ImportTunnel(context.Background(), &WgS2sImportRequest{Config: conf})
+		var se *Error
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, ErrValidation, se.Kind)
+	})
+	t.Run("missing private key", func(t *testing.T) {
+		svc := newTestWgS2sService(&mockWgS2sWireGuard{})
+		_, err := svc.ImportTunnel(context.Background(), &WgS2sImportRequest{
+			Name: "x", Config: "[Interface]\nAddress = 10.0.0.1/30\n[Peer]\nPublicKey = " + peer + "\n",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "PrivateKey")
+	})
+}
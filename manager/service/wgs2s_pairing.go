@@ -0,0 +1,593 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+const (
+	pairingBundlePrefix  = "vpnpack-pair1."
+	pairingDefaultTTL    = 15 * time.Minute
+	pairingMaxTTL        = 24 * time.Hour
+	pairingMaxBundleSize = 16 << 10
+	// pairingHandshakeGrace is how long a completed pairing may wait for its
+	// first handshake when the reply came in close to the offer's expiry.
+	pairingHandshakeGrace = 5 * time.Minute
+
+	pairingKindOffer = "offer"
+	pairingKindReply = "reply"
+)
+
+// PairingStore holds this gateway's bundle signing key, the nonces of offers
+// it has already imported and the offers it has issued itself.
+type PairingStore interface {
+	SigningKey() (ed25519.PrivateKey, error)
+	Used(nonce string) (bool, error)
+	MarkUsed(nonce string, expiresAt time.Time) error
+	Offers() ([]PairingOffer, error)
+	SaveOffer(o PairingOffer) error
+	DeleteOffer(nonce string) error
+}
+
+// PairingOffer is an issued bundle as the issuer remembers it. Until the
+// reply arrives the tunnel is untouched. CompletePairing switches PeerKey's
+// slot to NewKey and keeps the old preshared key here so the switch can be
+// undone if the importer never handshakes with it.
+type PairingOffer struct {
+	Nonce            string    `json:"nonce"`
+	TunnelID         string    `json:"tunnelId"`
+	PeerKey          string    `json:"peerKey"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	NewKey           string    `json:"newKey,omitempty"`
+	PrevPresharedKey string    `json:"prevPresharedKey,omitempty"`
+	CompletedAt      time.Time `json:"completedAt,omitzero"`
+}
+
+// handshakeDeadline is when a completed offer without a handshake on NewKey
+// is rolled back.
+func (o PairingOffer) handshakeDeadline() time.Time {
+	if d := o.CompletedAt.Add(pairingHandshakeGrace); d.After(o.ExpiresAt) {
+		return d
+	}
+	return o.ExpiresAt
+}
+
+// PairingBundle is the signed payload of both pairing messages. An offer is
+// the issuing tunnel seen from the other side, so its LocalSubnets are the
+// issuer's AllowedIPs and its peer's AllowedIPs are the issuer's local
+// subnets. A reply carries the importer's public key and the preshared key it
+// picked. Neither holds a private key.
+type PairingBundle struct {
+	Version             int        `json:"v"`
+	Kind                string     `json:"kind"`
+	Nonce               string     `json:"nonce"`
+	IssuedAt            time.Time  `json:"issuedAt"`
+	ExpiresAt           time.Time  `json:"expiresAt"`
+	SignerKey           string     `json:"signer"`
+	Name                string     `json:"name,omitempty"`
+	TunnelAddresses     []string   `json:"tunnelAddresses,omitempty"`
+	ListenPort          int        `json:"listenPort,omitempty"`
+	MTU                 int        `json:"mtu,omitempty"`
+	PersistentKeepalive int        `json:"persistentKeepalive,omitempty"`
+	LocalSubnets        []string   `json:"localSubnets,omitempty"`
+	Peer                wgs2s.Peer `json:"peer"`
+}
+
+type PairingBundleRequest struct {
+	// Peer selects the peer slot being paired on hub tunnels; its key is
+	// replaced by the importer's once the pairing completes.
+	Peer       string `json:"peer,omitempty"`
+	TTLSeconds int    `json:"ttlSeconds,omitempty"`
+	// Endpoint overrides the WAN address the importer dials.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type PairingBundleResponse struct {
+	Bundle    string    `json:"bundle"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Signer    string    `json:"signer"`
+}
+
+type PairingImportRequest struct {
+	Bundle string `json:"bundle"`
+	Name   string `json:"name,omitempty"`
+	// ExpectedSigner is the issuer's fingerprint as shown on the issuing
+	// gateway. The bundle carries its own signer key, so without this pin
+	// the signature would prove nothing.
+	ExpectedSigner string `json:"expectedSigner"`
+	ListenPort     int    `json:"listenPort,omitempty"`
+	RouteMetric    int    `json:"routeMetric,omitempty"`
+	ZoneID         string `json:"zoneId,omitempty"`
+	ZoneName       string `json:"zoneName,omitempty"`
+	CreateZone     bool   `json:"createZone,omitempty"`
+}
+
+// PairingImportResponse is the created tunnel plus the reply the issuer
+// needs to finish the pairing. ReplySigner is this gateway's fingerprint,
+// for the issuer to pin.
+type PairingImportResponse struct {
+	TunnelCreateResponse
+	Signer      string `json:"signer"`
+	Reply       string `json:"reply"`
+	ReplySigner string `json:"replySigner"`
+}
+
+type PairingCompleteRequest struct {
+	Reply string `json:"reply"`
+	// ExpectedSigner is the importer's fingerprint as shown with its reply.
+	ExpectedSigner string `json:"expectedSigner"`
+}
+
+// CreatePairingBundle issues a one-time offer for the far end of tunnel id.
+// The offer has no key material beyond this gateway's public key; the
+// importer generates its own keypair and answers with a reply that
+// CompletePairing applies. The tunnel's peer is not touched until then.
+func (svc *WgS2sService) CreatePairingBundle(_ context.Context, id string, req PairingBundleRequest) (*PairingBundleResponse, error) {
+	if svc.pairing == nil {
+		return nil, preconditionError("pairing is not available")
+	}
+	tunnel := svc.findTunnelByID(id)
+	if tunnel == nil {
+		return nil, notFoundError("tunnel not found")
+	}
+	ttl := pairingDefaultTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl < time.Minute || ttl > pairingMaxTTL {
+			return nil, validationError("ttlSeconds must be between 60 and 86400")
+		}
+	}
+
+	peerIdx := 0
+	switch {
+	case req.Peer != "":
+		peerIdx = slices.IndexFunc(tunnel.Peers, func(p wgs2s.Peer) bool { return p.PublicKey == req.Peer })
+		if peerIdx < 0 {
+			return nil, validationError("peer not found on tunnel")
+		}
+	case len(tunnel.Peers) > 1:
+		return nil, validationError("tunnel has multiple peers; select one with peer")
+	case len(tunnel.Peers) == 0:
+		return nil, preconditionError("tunnel has no peer to pair")
+	}
+
+	host := req.Endpoint
+	if host == "" && svc.wanIP != nil {
+		host = svc.wanIP()
+	}
+	if host == "" {
+		return nil, preconditionError("WAN IP unknown; pass endpoint explicitly")
+	}
+
+	addrs := tunnel.TunnelAddresses
+	if len(addrs) == 0 {
+		addrs = []string{tunnel.TunnelAddress}
+	}
+	remoteAddrs := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		pa, err := pairedAddress(a)
+		if err != nil {
+			return nil, preconditionError(err.Error())
+		}
+		remoteAddrs = append(remoteAddrs, pa)
+	}
+
+	signer, err := svc.pairing.SigningKey()
+	if err != nil {
+		return nil, internalError("failed to load pairing signing key")
+	}
+	pubKey, err := svc.loadWG().GetPublicKey(id)
+	if err != nil {
+		return nil, internalError("failed to read public key")
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, internalError("failed to generate nonce")
+	}
+
+	paired := tunnel.Peers[peerIdx]
+	now := time.Now().UTC()
+	bundle := PairingBundle{
+		Version:             1,
+		Kind:                pairingKindOffer,
+		Nonce:               hex.EncodeToString(nonce),
+		IssuedAt:            now,
+		ExpiresAt:           now.Add(ttl),
+		SignerKey:           base64.StdEncoding.EncodeToString(signer.Public().(ed25519.PublicKey)),
+		Name:                tunnel.Name,
+		TunnelAddresses:     remoteAddrs,
+		ListenPort:          tunnel.ListenPort,
+		MTU:                 tunnel.MTU,
+		PersistentKeepalive: tunnel.PersistentKeepalive,
+		LocalSubnets:        slices.Clone(paired.AllowedIPs),
+		Peer: wgs2s.Peer{
+			Name:       tunnel.Name,
+			PublicKey:  pubKey,
+			Endpoint:   net.JoinHostPort(host, strconv.Itoa(tunnel.ListenPort)),
+			AllowedIPs: svc.exportedAllowedIPs(*tunnel),
+		},
+	}
+	encoded, err := encodePairingBundle(bundle, signer)
+	if err != nil {
+		return nil, internalError("failed to encode pairing bundle")
+	}
+
+	svc.pairingMu.Lock()
+	defer svc.pairingMu.Unlock()
+	if err := svc.pairing.SaveOffer(PairingOffer{
+		Nonce:     bundle.Nonce,
+		TunnelID:  id,
+		PeerKey:   paired.PublicKey,
+		ExpiresAt: bundle.ExpiresAt,
+	}); err != nil {
+		return nil, internalError("failed to save pairing state")
+	}
+
+	return &PairingBundleResponse{
+		Bundle:    encoded,
+		ExpiresAt: bundle.ExpiresAt,
+		Signer:    signerFingerprint(bundle.SignerKey),
+	}, nil
+}
+
+// ImportPairingBundle verifies an offer from another gateway, creates the
+// mirrored tunnel through CreateTunnel with a locally generated key and a
+// fresh preshared key, and returns the signed reply for the issuer. An offer
+// is accepted once: its nonce is recorded after the tunnel is created, and a
+// failed create leaves it usable for a retry (with a different listen port,
+// say).
+func (svc *WgS2sService) ImportPairingBundle(ctx context.Context, req *PairingImportRequest) (*PairingImportResponse, error) {
+	if svc.pairing == nil {
+		return nil, preconditionError("pairing is not available")
+	}
+	if strings.TrimSpace(req.ExpectedSigner) == "" {
+		return nil, validationError("expectedSigner is required")
+	}
+	bundle, err := decodePairingBundle(req.Bundle, pairingKindOffer, time.Now())
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+	fp := signerFingerprint(bundle.SignerKey)
+	if !strings.EqualFold(strings.TrimSpace(req.ExpectedSigner), fp) {
+		return nil, validationError("bundle signer does not match expectedSigner")
+	}
+	own, err := svc.pairing.SigningKey()
+	if err != nil {
+		return nil, internalError("failed to load pairing signing key")
+	}
+	ownKey := base64.StdEncoding.EncodeToString(own.Public().(ed25519.PublicKey))
+	if ownKey == bundle.SignerKey {
+		return nil, validationError("bundle was issued by this gateway")
+	}
+
+	svc.pairingMu.Lock()
+	defer svc.pairingMu.Unlock()
+
+	used, err := svc.pairing.Used(bundle.Nonce)
+	if err != nil {
+		return nil, internalError("failed to read pairing state")
+	}
+	if used {
+		return nil, conflictError("pairing bundle has already been used")
+	}
+
+	psk, err := wgtypes.GenerateKey()
+	if err != nil {
+		return nil, internalError("failed to generate preshared key")
+	}
+	peer := bundle.Peer
+	peer.PresharedKey = psk.String()
+
+	create := &WgS2sCreateRequest{
+		ZoneID:     req.ZoneID,
+		ZoneName:   req.ZoneName,
+		CreateZone: req.CreateZone,
+	}
+	create.Name = bundle.Name
+	if req.Name != "" {
+		create.Name = req.Name
+	}
+	create.ListenPort = bundle.ListenPort
+	if req.ListenPort != 0 {
+		create.ListenPort = req.ListenPort
+	}
+	create.TunnelAddresses = bundle.TunnelAddresses
+	create.MTU = bundle.MTU
+	create.PersistentKeepalive = bundle.PersistentKeepalive
+	create.RouteMetric = req.RouteMetric
+	create.LocalSubnets = bundle.LocalSubnets
+	create.Peers = []wgs2s.Peer{peer}
+
+	resp, err := svc.CreateTunnel(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.pairing.MarkUsed(bundle.Nonce, bundle.ExpiresAt); err != nil && svc.logger != nil {
+		svc.logger.LogWarn(fmt.Sprintf("pairing bundle nonce not recorded tunnel=%s err=%v", resp.Name, err))
+	}
+
+	reply, err := encodePairingBundle(PairingBundle{
+		Version:   1,
+		Kind:      pairingKindReply,
+		Nonce:     bundle.Nonce,
+		IssuedAt:  time.Now().UTC(),
+		ExpiresAt: bundle.ExpiresAt,
+		SignerKey: ownKey,
+		Peer: wgs2s.Peer{
+			PublicKey:    resp.PublicKey,
+			PresharedKey: peer.PresharedKey,
+		},
+	}, own)
+	if err != nil {
+		return nil, internalError("failed to encode pairing reply")
+	}
+	return &PairingImportResponse{
+		TunnelCreateResponse: *resp,
+		Signer:               fp,
+		Reply:                reply,
+		ReplySigner:          signerFingerprint(ownKey),
+	}, nil
+}
+
+// CompletePairing applies the importer's reply to the offer it answers: the
+// paired peer switches to the importer's public key and preshared key. Until
+// that key handshakes the switch is provisional; see ExpirePairings.
+func (svc *WgS2sService) CompletePairing(_ context.Context, id string, req *PairingCompleteRequest) error {
+	if svc.pairing == nil {
+		return preconditionError("pairing is not available")
+	}
+	if strings.TrimSpace(req.ExpectedSigner) == "" {
+		return validationError("expectedSigner is required")
+	}
+	now := time.Now()
+	reply, err := decodePairingBundle(req.Reply, pairingKindReply, now)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.ExpectedSigner), signerFingerprint(reply.SignerKey)) {
+		return validationError("reply signer does not match expectedSigner")
+	}
+	if err := validateBase64Key(reply.Peer.PublicKey); err != nil {
+		return validationError(fmt.Sprintf("invalid reply public key: %s", err))
+	}
+	if err := validatePresharedKey(reply.Peer.PresharedKey, "reply presharedKey"); err != nil {
+		return validationError(err.Error())
+	}
+
+	svc.pairingMu.Lock()
+	defer svc.pairingMu.Unlock()
+
+	offers, err := svc.pairing.Offers()
+	if err != nil {
+		return internalError("failed to read pairing state")
+	}
+	idx := slices.IndexFunc(offers, func(o PairingOffer) bool { return o.Nonce == reply.Nonce })
+	if idx < 0 || offers[idx].TunnelID != id {
+		return validationError("reply does not answer a pairing offer of this tunnel")
+	}
+	offer := offers[idx]
+	if !offer.CompletedAt.IsZero() {
+		return conflictError("pairing has already been completed")
+	}
+	if !now.Before(offer.ExpiresAt) {
+		return validationError("pairing offer has expired")
+	}
+
+	tunnel := svc.findTunnelByID(id)
+	if tunnel == nil {
+		return notFoundError("tunnel not found")
+	}
+	peerIdx := slices.IndexFunc(tunnel.Peers, func(p wgs2s.Peer) bool { return p.PublicKey == offer.PeerKey })
+	if peerIdx < 0 {
+		return conflictError("the paired peer changed since the offer was issued")
+	}
+	prevPSK, err := svc.loadWG().GetPresharedKey(id, offer.PeerKey)
+	if err != nil {
+		return internalError("failed to read preshared key")
+	}
+
+	offer.NewKey = reply.Peer.PublicKey
+	offer.PrevPresharedKey = prevPSK
+	offer.CompletedAt = now
+	if err := svc.pairing.SaveOffer(offer); err != nil {
+		return internalError("failed to save pairing state")
+	}
+
+	peers := slices.Clone(tunnel.Peers)
+	peers[peerIdx].PublicKey = reply.Peer.PublicKey
+	peers[peerIdx].PresharedKey = reply.Peer.PresharedKey
+	if _, err := svc.loadWG().UpdateTunnel(id, wgs2s.TunnelConfig{Peers: peers}); err != nil {
+		_ = svc.pairing.SaveOffer(offers[idx])
+		return upstreamError(humanizeWgS2sError(err), err)
+	}
+	return nil
+}
+
+// ExpirePairings drops offers that were never answered and settles completed
+// ones: a handshake on the new key confirms the pairing, while no handshake
+// by the deadline puts the previous peer key and preshared key back, so a
+// reply that nobody can use does not keep the link down.
+func (svc *WgS2sService) ExpirePairings(_ context.Context, now time.Time) {
+	if svc.pairing == nil {
+		return
+	}
+	svc.pairingMu.Lock()
+	defer svc.pairingMu.Unlock()
+
+	offers, err := svc.pairing.Offers()
+	if err != nil || len(offers) == 0 {
+		return
+	}
+	var handshakes map[string]time.Time
+	for _, o := range offers {
+		if o.CompletedAt.IsZero() {
+			if !now.Before(o.ExpiresAt) {
+				_ = svc.pairing.DeleteOffer(o.Nonce)
+			}
+			continue
+		}
+		if handshakes == nil {
+			handshakes = peerHandshakes(svc.loadWG().GetStatuses())
+		}
+		if hs, ok := handshakes[o.NewKey]; ok && hs.After(o.CompletedAt) {
+			slog.Info("wg-s2s pairing confirmed", "tunnel", o.TunnelID)
+			_ = svc.pairing.DeleteOffer(o.Nonce)
+			continue
+		}
+		if now.Before(o.handshakeDeadline()) {
+			continue
+		}
+		if err := svc.revertPairing(o); err != nil {
+			if svc.logger != nil {
+				svc.logger.LogWarn(fmt.Sprintf("pairing rollback failed tunnel=%s err=%v", o.TunnelID, err))
+			}
+			continue
+		}
+		if svc.logger != nil {
+			svc.logger.LogWarn(fmt.Sprintf("pairing rolled back: no handshake on the new key tunnel=%s", o.TunnelID))
+		}
+		_ = svc.pairing.DeleteOffer(o.Nonce)
+	}
+}
+
+func (svc *WgS2sService) revertPairing(o PairingOffer) error {
+	tunnel := svc.findTunnelByID(o.TunnelID)
+	if tunnel == nil {
+		return nil
+	}
+	idx := slices.IndexFunc(tunnel.Peers, func(p wgs2s.Peer) bool { return p.PublicKey == o.NewKey })
+	if idx < 0 {
+		return nil
+	}
+	peers := slices.Clone(tunnel.Peers)
+	peers[idx].PublicKey = o.PeerKey
+	peers[idx].PresharedKey = o.PrevPresharedKey
+	_, err := svc.loadWG().UpdateTunnel(o.TunnelID, wgs2s.TunnelConfig{Peers: peers})
+	return err
+}
+
+func peerHandshakes(statuses []wgs2s.WgS2sStatus) map[string]time.Time {
+	out := make(map[string]time.Time)
+	for _, st := range statuses {
+		for _, p := range st.Peers {
+			out[p.PublicKey] = p.LastHandshake
+		}
+	}
+	return out
+}
+
+func encodePairingBundle(b PairingBundle, key ed25519.PrivateKey) (string, error) {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	sig := ed25519.Sign(key, payload)
+	return pairingBundlePrefix +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// decodePairingBundle checks the signature against the signer key carried in
+// the payload and rejects expired bundles and bundles of the wrong kind. The
+// signature only proves the bundle was not altered; callers must compare the
+// signer's fingerprint with the one the operator pinned.
+func decodePairingBundle(s, kind string, now time.Time) (*PairingBundle, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > pairingMaxBundleSize {
+		return nil, fmt.Errorf("bundle is too large")
+	}
+	rest, ok := strings.CutPrefix(s, pairingBundlePrefix)
+	if !ok {
+		return nil, fmt.Errorf("not a pairing bundle")
+	}
+	payloadB64, sigB64, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed pairing bundle")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed pairing bundle")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigB64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed pairing bundle")
+	}
+
+	var b PairingBundle
+	if err := json.Unmarshal(payload, &b); err != nil {
+		return nil, fmt.Errorf("malformed pairing bundle")
+	}
+	if b.Version != 1 {
+		return nil, fmt.Errorf("unsupported pairing bundle version %d", b.Version)
+	}
+	signer, err := base64.StdEncoding.DecodeString(b.SignerKey)
+	if err != nil || len(signer) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("malformed pairing bundle signer")
+	}
+	if !ed25519.Verify(signer, payload, sig) {
+		return nil, fmt.Errorf("pairing bundle signature is invalid")
+	}
+	if b.Kind != kind {
+		return nil, fmt.Errorf("expected a pairing %s, got %q", kind, b.Kind)
+	}
+	if !now.Before(b.ExpiresAt) {
+		return nil, fmt.Errorf("pairing bundle expired at %s", b.ExpiresAt.Format(time.RFC3339))
+	}
+	if b.Nonce == "" {
+		return nil, fmt.Errorf("malformed pairing bundle")
+	}
+	return &b, nil
+}
+
+// signerFingerprint is the short form operators compare between the two
+// gateways' UIs.
+func signerFingerprint(signerKey string) string {
+	sum := sha256.Sum256([]byte(signerKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// pairedAddress returns the far end's address in the same tunnel subnet:
+// the other half of a /31 or /127, otherwise the first host address that is
+// not ours (.2 for the usual .1/30).
+func pairedAddress(cidr string) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid tunnel address %q", cidr)
+	}
+	ours := prefix.Addr()
+	bits := prefix.Bits()
+	if ours.BitLen()-bits < 1 {
+		return "", fmt.Errorf("tunnel address %s has no room for a second host", cidr)
+	}
+	if ours.BitLen()-bits == 1 {
+		b := ours.AsSlice()
+		b[len(b)-1] ^= 1
+		other, _ := netip.AddrFromSlice(b)
+		return netip.PrefixFrom(other, bits).String(), nil
+	}
+	candidate := prefix.Masked().Addr().Next()
+	if candidate == ours {
+		candidate = candidate.Next()
+	}
+	if !prefix.Contains(candidate) {
+		return "", fmt.Errorf("tunnel address %s has no room for a second host", cidr)
+	}
+	return netip.PrefixFrom(candidate, bits).String(), nil
+}
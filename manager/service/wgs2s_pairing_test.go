@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+type memPairingStore struct {
+	key    ed25519.PrivateKey
+	used   map[string]bool
+	offers []PairingOffer
+}
+
+func newMemPairingStore(t *testing.T) *memPairingStore {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return &memPairingStore{key: key, used: map[string]bool{}}
+}
+
+func (m *memPairingStore) SigningKey() (ed25519.PrivateKey, error) { return m.key, nil }
+func (m *memPairingStore) Used(n string) (bool, error)             { return m.used[n], nil }
+func (m *memPairingStore) MarkUsed(n string, _ time.Time) error {
+	m.used[n] = true
+	return nil
+}
+func (m *memPairingStore) Offers() ([]PairingOffer, error) { return slices.Clone(m.offers), nil }
+func (m *memPairingStore) SaveOffer(o PairingOffer) error {
+	_ = m.DeleteOffer(o.Nonce)
+	m.offers = append(m.offers, o)
+	return nil
+}
+func (m *memPairingStore) DeleteOffer(n string) error {
+	m.offers = slices.DeleteFunc(m.offers, func(o PairingOffer) bool { return o.Nonce == n })
+	return nil
+}
+
+func (m *memPairingStore) fingerprint() string {
+	return signerFingerprint(base64.StdEncoding.EncodeToString(m.key.Public().(ed25519.PublicKey)))
+}
+
+func TestPairedAddress(t *testing.T) {
+	tests := map[string]string{
+		"10.255.0.1/30":   "10.255.0.2/30",
+		"10.255.0.2/30":   "10.255.0.1/30",
+		"10.255.0.0/31":   "10.255.0.1/31",
+		"10.255.0.1/24":   "10.255.0.2/24",
+		"fd00:255::1/126": "fd00:255::2/126",
+		"fd00:255::1/127": "fd00:255::/127",
+	}
+	for in, want := range tests {
+		got, err := pairedAddress(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := pairedAddress("10.255.0.1/32")
+	assert.Error(t, err)
+}
+
+func TestPairing_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	issuerPub, importerPub, oldPeer := testBase64Key(t), testBase64Key(t), testBase64Key(t)
+	tunnel := wgs2s.TunnelConfig{
+		ID: "t1", Name: "hq-branch", ListenPort: 51820, MTU: 1420, PersistentKeepalive: 25,
+		TunnelAddress: "10.255.0.1/30", TunnelAddresses: []string{"10.255.0.1/30"},
+		LocalSubnets: []string{"192.168.1.0/24"},
+		Peers:        []wgs2s.Peer{{PublicKey: oldPeer, AllowedIPs: []string{"192.168.2.0/24"}}},
+	}
+	var issuerPeers []wgs2s.Peer
+	issuerStore := newMemPairingStore(t)
+	issuer := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn:   func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{tunnel} },
+		getPublicKeyFn: func(string) (string, error) { return issuerPub, nil },
+		updateTunnelFn: func(_ string, u wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+			issuerPeers = u.Peers
+			return &tunnel, nil
+		},
+	}, func(s *WgS2sService) {
+		s.pairing = issuerStore
+		s.wanIP = func() string { return "203.0.113.10" }
+	})
+	var created wgs2s.TunnelConfig
+	var createdKey string
+	importerStore := newMemPairingStore(t)
+	importer := newTestWgS2sService(&mockWgS2sWireGuard{
+		createTunnelFn: func(cfg wgs2s.TunnelConfig, pk string) (*wgs2s.TunnelConfig, error) {
+			created, createdKey = cfg, pk
+			cfg.ID = "new"
+			return &cfg, nil
+		},
+		getPublicKeyFn: func(string) (string, error) { return importerPub, nil },
+	}, func(s *WgS2sService) { s.pairing = importerStore })
+
+	offer, err := issuer.CreatePairingBundle(ctx, "t1", PairingBundleRequest{})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(pairingDefaultTTL), offer.ExpiresAt, time.Minute)
+	assert.Nil(t, issuerPeers, "issuing an offer must leave the live peer alone")
+	decoded, err := decodePairingBundle(offer.Bundle, pairingKindOffer, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, decoded.Peer.PresharedKey, "an offer carries no secrets")
+
+	resp, err := importer.ImportPairingBundle(ctx, &PairingImportRequest{Bundle: offer.Bundle, ExpectedSigner: offer.Signer})
+	require.NoError(t, err)
+	assert.Equal(t, offer.Signer, resp.Signer)
+	assert.Equal(t, importerStore.fingerprint(), resp.ReplySigner)
+	assert.Empty(t, createdKey, "the importer generates its own private key")
+	assert.Equal(t, "10.255.0.2/30", created.TunnelAddress)
+	assert.Equal(t, []string{"192.168.2.0/24"}, created.LocalSubnets, "importer's LAN is what the issuer routes to it")
+	require.Len(t, created.Peers, 1)
+	assert.Equal(t, issuerPub, created.Peers[0].PublicKey)
+	assert.Equal(t, "203.0.113.10:51820", created.Peers[0].Endpoint)
+	assert.Equal(t, []string{"192.168.1.0/24", "10.255.0.1/32"}, created.Peers[0].AllowedIPs)
+	assert.NotEmpty(t, created.Peers[0].PresharedKey)
+	assert.Equal(t, 51820, created.ListenPort)
+	assert.Equal(t, 1420, created.MTU)
+
+	_, err = importer.ImportPairingBundle(ctx, &PairingImportRequest{Bundle: offer.Bundle, ExpectedSigner: offer.Signer})
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrConflict, se.Kind, "an offer is good for one import")
+
+	require.NoError(t, issuer.CompletePairing(ctx, "t1", &PairingCompleteRequest{Reply: resp.Reply, ExpectedSigner: resp.ReplySigner}))
+	require.Len(t, issuerPeers, 1)
+	assert.Equal(t, importerPub, issuerPeers[0].PublicKey)
+	assert.Equal(t, created.Peers[0].PresharedKey, issuerPeers[0].PresharedKey)
+	assert.Equal(t, []string{"192.168.2.0/24"}, issuerPeers[0].AllowedIPs)
+	require.Len(t, issuerStore.offers, 1)
+	assert.Equal(t, oldPeer, issuerStore.offers[0].PeerKey)
+	assert.Equal(t, importerPub, issuerStore.offers[0].NewKey)
+
+	err = issuer.CompletePairing(ctx, "t1", &PairingCompleteRequest{Reply: resp.Reply, ExpectedSigner: resp.ReplySigner})
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrConflict, se.Kind, "a reply is applied once")
+}
+
+func TestImportPairingBundle_Rejections(t *testing.T) {
+	issuerStore := newMemPairingStore(t)
+	importerStore := newMemPairingStore(t)
+	now := time.Now().UTC()
+	bundle := func(kind string) string {
+		b, err := encodePairingBundle(PairingBundle{
+			Version: 1, Kind: kind, Nonce: "n1", IssuedAt: now, ExpiresAt: now.Add(time.Hour),
+			SignerKey: base64.StdEncoding.EncodeToString(issuerStore.key.Public().(ed25519.PublicKey)),
+		}, issuerStore.key)
+		require.NoError(t, err)
+		return b
+	}
+	offer := bundle(pairingKindOffer)
+	payload, sig, _ := strings.Cut(strings.TrimPrefix(offer, pairingBundlePrefix), ".")
+	tampered := pairingBundlePrefix + payload[:len(payload)-2] + "AA." + sig
+	issuerFP := issuerStore.fingerprint()
+
+	tests := []struct {
+		name   string
+		store  *memPairingStore
+		req    PairingImportRequest
+		errMsg string
+	}{
+		{"signer not pinned", importerStore, PairingImportRequest{Bundle: offer}, "expectedSigner is required"},
+		{"tampered", importerStore, PairingImportRequest{Bundle: tampered, ExpectedSigner: issuerFP}, ""},
+		{"not a bundle", importerStore, PairingImportRequest{Bundle: "hello", ExpectedSigner: issuerFP}, "not a pairing bundle"},
+		{"wrong signer", importerStore, PairingImportRequest{Bundle: offer, ExpectedSigner: "0000000000000000"}, "expectedSigner"},
+		{"reply as offer", importerStore, PairingImportRequest{Bundle: bundle(pairingKindReply), ExpectedSigner: issuerFP}, "expected a pairing offer"},
+		{"own bundle", issuerStore, PairingImportRequest{Bundle: offer, ExpectedSigner: issuerFP}, "issued by this gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestWgS2sService(&mockWgS2sWireGuard{}, func(s *WgS2sService) { s.pairing = tt.store })
+			_, err := svc.ImportPairingBundle(context.Background(), &tt.req)
+			var se *Error
+			require.ErrorAs(t, err, &se)
+			assert.Equal(t, ErrValidation, se.Kind)
+			if tt.errMsg != "" {
+				assert.Contains(t, se.Error(), tt.errMsg)
+			}
+		})
+	}
+
+	_, err := decodePairingBundle(offer, pairingKindOffer, now.Add(2*time.Hour))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expired")
+}
+
+func TestCompletePairing_Rejections(t *testing.T) {
+	importerStore := newMemPairingStore(t)
+	peerKey, replyKey := testBase64Key(t), testBase64Key(t)
+	now := time.Now().UTC()
+	reply := func(nonce string) string {
+		b, err := encodePairingBundle(PairingBundle{
+			Version: 1, Kind: pairingKindReply, Nonce: nonce, IssuedAt: now, ExpiresAt: now.Add(time.Hour),
+			SignerKey: base64.StdEncoding.EncodeToString(importerStore.key.Public().(ed25519.PublicKey)),
+			Peer:      wgs2s.Peer{PublicKey: replyKey},
+		}, importerStore.key)
+		require.NoError(t, err)
+		return b
+	}
+	fp := importerStore.fingerprint()
+
+	tests := []struct {
+		name   string
+		offer  PairingOffer
+		req    PairingCompleteRequest
+		errMsg string
+	}{
+		{"signer not pinned", PairingOffer{Nonce: "n1", TunnelID: "t1", ExpiresAt: now.Add(time.Hour)},
+			PairingCompleteRequest{Reply: reply("n1")}, "expectedSigner is required"},
+		{"wrong signer", PairingOffer{Nonce: "n1", TunnelID: "t1", ExpiresAt: now.Add(time.Hour)},
+			PairingCompleteRequest{Reply: reply("n1"), ExpectedSigner: "0000000000000000"}, "expectedSigner"},
+		{"unknown offer", PairingOffer{Nonce: "n1", TunnelID: "t1", ExpiresAt: now.Add(time.Hour)},
+			PairingCompleteRequest{Reply: reply("n2"), ExpectedSigner: fp}, "does not answer"},
+		{"other tunnel", PairingOffer{Nonce: "n1", TunnelID: "t2", ExpiresAt: now.Add(time.Hour)},
+			PairingCompleteRequest{Reply: reply("n1"), ExpectedSigner: fp}, "does not answer"},
+		{"offer expired", PairingOffer{Nonce: "n1", TunnelID: "t1", ExpiresAt: now.Add(-time.Minute)},
+			PairingCompleteRequest{Reply: reply("n1"), ExpectedSigner: fp}, "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemPairingStore(t)
+			require.NoError(t, store.SaveOffer(tt.offer))
+			svc := newTestWgS2sService(&mockWgS2sWireGuard{
+				getTunnelsFn: func() []wgs2s.TunnelConfig {
+					return []wgs2s.TunnelConfig{{ID: "t1", Peers: []wgs2s.Peer{{PublicKey: peerKey}}}}
+				},
+				updateTunnelFn: func(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+					t.Fatal("a rejected reply must not touch the tunnel")
+					return nil, nil
+				},
+			}, func(s *WgS2sService) { s.pairing = store })
+			err := svc.CompletePairing(context.Background(), "t1", &tt.req)
+			var se *Error
+			require.ErrorAs(t, err, &se)
+			assert.Contains(t, se.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestExpirePairings(t *testing.T) {
+	oldKey, newKey, oldPSK := testBase64Key(t), testBase64Key(t), testBase64Key(t)
+	now := time.Now()
+	completed := PairingOffer{
+		Nonce: "n1", TunnelID: "t1", PeerKey: oldKey, ExpiresAt: now.Add(-time.Minute),
+		NewKey: newKey, PrevPresharedKey: oldPSK, CompletedAt: now.Add(-10 * time.Minute),
+	}
+
+	tests := []struct {
+		name       string
+		offer      PairingOffer
+		handshake  time.Time
+		wantPeer   *wgs2s.Peer
+		wantOffers int
+	}{
+		{"unanswered offer expires", PairingOffer{Nonce: "n1", TunnelID: "t1", PeerKey: oldKey, ExpiresAt: now.Add(-time.Minute)},
+			time.Time{}, nil, 0},
+		{"unanswered offer still open", PairingOffer{Nonce: "n1", TunnelID: "t1", PeerKey: oldKey, ExpiresAt: now.Add(time.Minute)},
+			time.Time{}, nil, 1},
+		{"handshake confirms", completed, now.Add(-time.Minute), nil, 0},
+		{"no handshake rolls back", completed, time.Time{}, &wgs2s.Peer{PublicKey: oldKey, PresharedKey: oldPSK}, 0},
+		{"grace after a late reply", func() PairingOffer {
+			o := completed
+			o.CompletedAt = now.Add(-2 * time.Minute)
+			return o
+		}(), time.Time{}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *wgs2s.Peer
+			store := newMemPairingStore(t)
+			require.NoError(t, store.SaveOffer(tt.offer))
+			svc := newTestWgS2sService(&mockWgS2sWireGuard{
+				getTunnelsFn: func() []wgs2s.TunnelConfig {
+					return []wgs2s.TunnelConfig{{ID: "t1", Peers: []wgs2s.Peer{{PublicKey: newKey}}}}
+				},
+				getStatusesFn: func() []wgs2s.WgS2sStatus {
+					return []wgs2s.WgS2sStatus{{ID: "t1", Peers: []wgs2s.WgS2sPeerStatus{{PublicKey: newKey, LastHandshake: tt.handshake}}}}
+				},
+				updateTunnelFn: func(_ string, u wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+					updated = &u.Peers[0]
+					return &u, nil
+				},
+			}, func(s *WgS2sService) { s.pairing = store })
+
+			svc.ExpirePairings(context.Background(), now)
+
+			assert.Equal(t, tt.wantPeer, updated)
+			assert.Len(t, store.offers, tt.wantOffers)
+		})
+	}
+}
+
+func TestCreatePairingBundle_HubNeedsPeer(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig {
+			return []wgs2s.TunnelConfig{{ID: "hub", Peers: []wgs2s.Peer{{PublicKey: "a"}, {PublicKey: "b"}}}}
+		},
+	}, func(s *WgS2sService) { s.pairing = newMemPairingStore(t) })
+
+	_, err := svc.CreatePairingBundle(context.Background(), "hub", PairingBundleRequest{})
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrValidation, se.Kind)
+}
+
+func TestFilePairingStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFilePairingStore(dir)
+
+	key, err := store.SigningKey()
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, pairingKeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reloaded, err := NewFilePairingStore(dir).SigningKey()
+	require.NoError(t, err)
+	assert.True(t, key.Equal(reloaded), "the signing key must survive a restart")
+
+	require.NoError(t, store.MarkUsed("old", time.Now().Add(-time.Minute)))
+	require.NoError(t, store.MarkUsed("n1", time.Now().Add(time.Hour)))
+	used, err := NewFilePairingStore(dir).Used("n1")
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = store.Used("old")
+	require.NoError(t, err)
+	assert.False(t, used, "expired nonces are pruned")
+
+	require.NoError(t, store.SaveOffer(PairingOffer{Nonce: "o1", TunnelID: "t1"}))
+	require.NoError(t, store.SaveOffer(PairingOffer{Nonce: "o2", TunnelID: "t1"}))
+	require.NoError(t, store.SaveOffer(PairingOffer{Nonce: "o1", TunnelID: "t1", NewKey: "k"}))
+	require.NoError(t, store.DeleteOffer("o2"))
+	offers, err := NewFilePairingStore(dir).Offers()
+	require.NoError(t, err)
+	assert.Equal(t, []PairingOffer{{Nonce: "o1", TunnelID: "t1", NewKey: "k"}}, offers)
+	info, err = os.Stat(filepath.Join(dir, pairingOffersFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "offers hold the previous preshared key")
+}
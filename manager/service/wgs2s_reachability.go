@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+// wgMaxProbes bounds the reachability probes of one tunnel; every probe is
+// sent each round.
+const wgMaxProbes = 8
+
+// RunReachabilityProbes runs one round of the tunnels' reachability probes
+// and returns the targets that went down or came back. A target going down
+// behind a tunnel that still handshakes is written to the activity log,
+// since the dashboard would otherwise keep showing the tunnel as connected.
+func (svc *WgS2sService) RunReachabilityProbes(ctx context.Context, now time.Time) []wgs2s.WgS2sReachabilityEvent {
+	wg := svc.loadWG()
+	if wg == nil {
+		return nil
+	}
+	events := wg.RunReachabilityProbes(ctx, now)
+	for _, e := range events {
+		slog.Info("wg-s2s reachability", "id", e.TunnelID, "target", e.Target, "reachable", e.Reachable, "err", e.Error)
+		if svc.logger != nil && !e.Reachable {
+			svc.logger.LogWarn(fmt.Sprintf("remote unreachable tunnel=%s %s probe to %s: %s",
+				e.TunnelName, e.Kind, e.Target, e.Error))
+		}
+	}
+	return events
+}
+
+func validateProbes(probes []wgs2s.WgHealthProbe) error {
+	if len(probes) > wgMaxProbes {
+		return fmt.Errorf("at most %d probes per tunnel", wgMaxProbes)
+	}
+	seen := make(map[wgs2s.WgHealthProbe]bool, len(probes))
+	for i, p := range probes {
+		if err := validateHealthProbe(p, fmt.Sprintf("probes[%d]", i)); err != nil {
+			return err
+		}
+		if seen[p] {
+			return fmt.Errorf("probes[%d] duplicates an earlier probe", i)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// validateProbeTargets is validateProbeTarget for the reachability probes.
+func validateProbeTargets(probes []wgs2s.WgHealthProbe, remoteSubnets []string) error {
+	for i, p := range probes {
+		if !insideSubnets(p.Target, remoteSubnets) {
+			return fmt.Errorf("probes[%d].target must be inside the tunnel's allowedIPs", i)
+		}
+	}
+	return nil
+}
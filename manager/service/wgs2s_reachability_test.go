@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+func TestValidateProbes(t *testing.T) {
+	icmp := wgs2s.WgHealthProbe{Kind: wgs2s.HealthProbeICMP, Target: "10.50.0.1"}
+	tests := []struct {
+		name    string
+		probes  []wgs2s.WgHealthProbe
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"icmp and tcp", []wgs2s.WgHealthProbe{icmp, {Kind: wgs2s.HealthProbeTCP, Target: "10.50.0.2", Port: 22}}, ""},
+		{"hostname target", []wgs2s.WgHealthProbe{{Kind: wgs2s.HealthProbeICMP, Target: "nas.lan"}}, "probes[0].target"},
+		{"tcp without port", []wgs2s.WgHealthProbe{icmp, {Kind: wgs2s.HealthProbeTCP, Target: "10.50.0.2"}}, "probes[1].port"},
+		{"duplicate", []wgs2s.WgHealthProbe{icmp, icmp}, "duplicates"},
+		{"too many", make([]wgs2s.WgHealthProbe, wgMaxProbes+1), "at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProbes(tt.probes)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestUpdateTunnel_ReachabilityTargetChecksNewSubnets(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig {
+			return []wgs2s.TunnelConfig{{
+				ID: "t1", AllowedIPs: []string{"10.50.0.0/24"},
+				Probes: []wgs2s.WgHealthProbe{{Kind: wgs2s.HealthProbeICMP, Target: "10.50.0.1"}},
+			}}
+		},
+		updateTunnelFn: func(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+			t.Fatal("moving the subnets away from a probe target must be rejected")
+			return nil, nil
+		},
+	})
+	_, err := svc.UpdateTunnel(context.Background(), "t1", wgs2s.TunnelConfig{AllowedIPs: []string{"10.60.0.0/24"}})
+
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrValidation, se.Kind)
+	assert.Contains(t, se.Message, "probes[0].target")
+}
+
+func TestRunReachabilityProbes_LogsOnlyOutages(t *testing.T) {
+	logger := &mockWgS2sLogger{}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		reachabilityFn: func(time.Time) []wgs2s.WgS2sReachabilityEvent {
+			return []wgs2s.WgS2sReachabilityEvent{
+				{TunnelID: "a", Target: "10.50.0.1", Reachable: false, Error: "timeout"},
+				{TunnelID: "b", Target: "10.60.0.1", Reachable: true},
+			}
+		},
+	}, func(s *WgS2sService) { s.logger = logger })
+
+	events := svc.RunReachabilityProbes(context.Background(), time.Now())
+
+	assert.Len(t, events, 2)
+	require.Len(t, logger.warnings, 1)
+	assert.Contains(t, logger.warnings[0], "10.50.0.1")
+}
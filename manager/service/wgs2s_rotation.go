@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+type KeyRotationRequest struct {
+	// At schedules the switch. Omitted means the rotation waits for an
+	// explicit commit.
+	At *time.Time `json:"at,omitempty"`
+}
+
+// ScheduleKeyRotation prepares a new private key for the tunnel and returns
+// its public half for the remote side. The current key stays live until the
+// scheduled time passes (see CommitDueKeyRotations) or CommitKeyRotation is
+// called. Re-scheduling a pending rotation keeps its key.
+func (svc *WgS2sService) ScheduleKeyRotation(_ context.Context, id string, req KeyRotationRequest) (*wgs2s.WgKeyRotation, error) {
+	if svc.findTunnelByID(id) == nil {
+		return nil, notFoundError("tunnel not found")
+	}
+	var at time.Time
+	if req.At != nil {
+		at = *req.At
+		if !at.After(time.Now()) {
+			return nil, validationError("at must be in the future")
+		}
+	}
+
+	rot, err := svc.loadWG().PrepareKeyRotation(id, at)
+	if err != nil {
+		return nil, upstreamError(humanizeWgS2sError(err), err)
+	}
+	return rot, nil
+}
+
+func (svc *WgS2sService) CommitKeyRotation(_ context.Context, id string) error {
+	t := svc.findTunnelByID(id)
+	if t == nil {
+		return notFoundError("tunnel not found")
+	}
+	if t.KeyRotation == nil {
+		return preconditionError("no key rotation pending")
+	}
+	if err := svc.loadWG().CommitKeyRotation(id); err != nil {
+		return upstreamError(humanizeWgS2sError(err), err)
+	}
+	return nil
+}
+
+func (svc *WgS2sService) CancelKeyRotation(_ context.Context, id string) error {
+	if svc.findTunnelByID(id) == nil {
+		return notFoundError("tunnel not found")
+	}
+	if err := svc.loadWG().CancelKeyRotation(id); err != nil {
+		return upstreamError(humanizeWgS2sError(err), err)
+	}
+	return nil
+}
+
+// CommitDueKeyRotations switches every tunnel whose scheduled rotation time
+// has passed. It runs on the status refresh tick, so a rotation lands within
+// one tick of its scheduled time. A failed commit leaves the rotation pending
+// and is retried on the next tick; only the first failure of each pending
+// key is logged so a stuck rotation does not flood the log every 5s.
+func (svc *WgS2sService) CommitDueKeyRotations(_ context.Context, now time.Time) {
+	wg := svc.loadWG()
+	if wg == nil {
+		return
+	}
+	for _, t := range wg.GetTunnels() {
+		rot := t.KeyRotation
+		if rot == nil || rot.ScheduledAt.IsZero() || now.Before(rot.ScheduledAt) {
+			continue
+		}
+		if err := wg.CommitKeyRotation(t.ID); err != nil {
+			if svc.firstRotationFailure(rot.PendingPublicKey) {
+				slog.Warn("wg-s2s scheduled key rotation failed", "id", t.ID, "err", err)
+				if svc.logger != nil {
+					svc.logger.LogWarn(fmt.Sprintf("scheduled key rotation failed tunnel=%s err=%v", t.Name, err))
+				}
+			}
+			continue
+		}
+		slog.Info("wg-s2s scheduled key rotation committed", "id", t.ID, "name", t.Name)
+	}
+}
+
+func (svc *WgS2sService) firstRotationFailure(pendingKey string) bool {
+	svc.rotationMu.Lock()
+	defer svc.rotationMu.Unlock()
+	if svc.rotationWarned == nil {
+		svc.rotationWarned = make(map[string]bool)
+	}
+	if svc.rotationWarned[pendingKey] {
+		return false
+	}
+	svc.rotationWarned[pendingKey] = true
+	return true
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unifi-tailscale/manager/internal/wgs2s"
+)
+
+func TestScheduleKeyRotation_RejectsPastTime(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{{ID: "t1"}} },
+		prepareRotFn: func(string, time.Time) (*wgs2s.WgKeyRotation, error) {
+			t.Fatal("past schedule must be rejected before touching the manager")
+			return nil, nil
+		},
+	})
+	past := time.Now().Add(-time.Minute)
+	_, err := svc.ScheduleKeyRotation(context.Background(), "t1", KeyRotationRequest{At: &past})
+
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrValidation, se.Kind)
+}
+
+func TestCommitKeyRotation_NothingPending(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{{ID: "t1"}} },
+	})
+	err := svc.CommitKeyRotation(context.Background(), "t1")
+
+	var se *Error
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, ErrPrecondition, se.Kind)
+}
+
+func TestCommitDueKeyRotations(t *testing.T) {
+	now := time.Now()
+	tunnels := []wgs2s.TunnelConfig{
+		{ID: "due", KeyRotation: &wgs2s.WgKeyRotation{PendingPublicKey: "a", ScheduledAt: now.Add(-time.Second)}},
+		{ID: "later", KeyRotation: &wgs2s.WgKeyRotation{PendingPublicKey: "b", ScheduledAt: now.Add(time.Hour)}},
+		{ID: "manual", KeyRotation: &wgs2s.WgKeyRotation{PendingPublicKey: "c"}},
+		{ID: "none"},
+		{ID: "broken", KeyRotation: &wgs2s.WgKeyRotation{PendingPublicKey: "d", ScheduledAt: now.Add(-time.Second)}},
+	}
+	var committed []string
+	logger := &mockWgS2sLogger{}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig { return tunnels },
+		commitRotFn: func(id string) error {
+			committed = append(committed, id)
+			if id == "broken" {
+				return errors.New("wgctrl: no such device")
+			}
+			return nil
+		},
+	}, func(s *WgS2sService) { s.logger = logger })
+
+	svc.CommitDueKeyRotations(context.Background(), now)
+	svc.CommitDueKeyRotations(context.Background(), now)
+
+	assert.Equal(t, []string{"due", "broken", "due", "broken"}, committed)
+	assert.Len(t, logger.warnings, 1, "a stuck rotation is logged once, not every tick")
+}
@@ -6,8 +6,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -51,6 +54,9 @@ func TestValidateCreateRequest(t *testing.T) {
 		{"port exceeds 65535", func(r *WgS2sCreateRequest) { r.ListenPort = 65536 }, true, "listenPort"},
 		{"port at max", func(r *WgS2sCreateRequest) { r.ListenPort = 65535 }, false, ""},
 		{"invalid tunnelAddress", func(r *WgS2sCreateRequest) { r.TunnelAddress = "not-cidr" }, true, "tunnelAddress"},
+		{"dual-stack tunnelAddresses", func(r *WgS2sCreateRequest) { r.TunnelAddresses = []string{"10.0.0.1/30", "fd00:255::1/126"} }, false, ""},
+		{"two IPv6 tunnelAddresses", func(r *WgS2sCreateRequest) { r.TunnelAddresses = []string{"fd00::1/64", "fd01::1/64"} }, true, "at most one"},
+		{"invalid tunnelAddresses entry", func(r *WgS2sCreateRequest) { r.TunnelAddresses = []string{"10.0.0.1/30", "nope"} }, true, "tunnelAddresses[1]"},
 		{"short peerKey", func(r *WgS2sCreateRequest) { r.PeerPublicKey = "abc" }, true, "peerPublicKey"},
 		{"bad base64 peerKey", func(r *WgS2sCreateRequest) { r.PeerPublicKey = "!!!not-base64-at-all-but-is-44-chars-long!==" }, true, "peerPublicKey"},
 		{"invalid allowedIP", func(r *WgS2sCreateRequest) { r.AllowedIPs = []string{"bad"} }, true, "allowedIP"},
@@ -62,6 +68,18 @@ func TestValidateCreateRequest(t *testing.T) {
 		{"routeMetric exceeds max", func(r *WgS2sCreateRequest) { r.RouteMetric = 10000 }, true, "routeMetric"},
 		{"name at 128 chars", func(r *WgS2sCreateRequest) { r.Name = strings.Repeat("a", 128) }, false, ""},
 		{"name exceeds 128 chars", func(r *WgS2sCreateRequest) { r.Name = strings.Repeat("a", 129) }, true, "name"},
+		{"failover group", func(r *WgS2sCreateRequest) { r.Failover = &wgs2s.WgFailover{Group: "hq"} }, false, ""},
+		{"failover without group", func(r *WgS2sCreateRequest) { r.Failover = &wgs2s.WgFailover{} }, true, "failover.group"},
+		{"failover group bad chars", func(r *WgS2sCreateRequest) { r.Failover = &wgs2s.WgFailover{Group: "hq east"} }, true, "failover.group"},
+		{"failover tcp probe", func(r *WgS2sCreateRequest) {
+			r.Failover = &wgs2s.WgFailover{Group: "hq", Probe: &wgs2s.WgHealthProbe{Kind: "tcp", Target: "10.0.0.5", Port: 443}}
+		}, false, ""},
+		{"failover tcp probe without port", func(r *WgS2sCreateRequest) {
+			r.Failover = &wgs2s.WgFailover{Group: "hq", Probe: &wgs2s.WgHealthProbe{Kind: "tcp", Target: "10.0.0.5"}}
+		}, true, "failover.probe.port"},
+		{"failover probe unknown kind", func(r *WgS2sCreateRequest) {
+			r.Failover = &wgs2s.WgFailover{Group: "hq", Probe: &wgs2s.WgHealthProbe{Kind: "udp", Target: "10.0.0.5"}}
+		}, true, "failover.probe.kind"},
 		{"zero MTU (default)", func(r *WgS2sCreateRequest) { r.MTU = 0 }, false, ""},
 		{"negative MTU", func(r *WgS2sCreateRequest) { r.MTU = -1 }, true, "mtu"},
 		{"MTU below min", func(r *WgS2sCreateRequest) { r.MTU = 575 }, true, "mtu"},
@@ -126,6 +144,7 @@ func TestValidateUpdateRequest(t *testing.T) {
 		{"empty update", func(c *wgs2s.TunnelConfig) {}, false, ""},
 		{"valid tunnelAddress", func(c *wgs2s.TunnelConfig) { c.TunnelAddress = "10.0.0.1/24" }, false, ""},
 		{"invalid tunnelAddress", func(c *wgs2s.TunnelConfig) { c.TunnelAddress = "not-cidr" }, true, "tunnelAddress"},
+		{"empty tunnelAddresses", func(c *wgs2s.TunnelConfig) { c.TunnelAddresses = []string{} }, true, "tunnelAddresses"},
 		{"valid peerPublicKey", func(c *wgs2s.TunnelConfig) { c.PeerPublicKey = testBase64Key(t) }, false, ""},
 		{"invalid peerPublicKey", func(c *wgs2s.TunnelConfig) { c.PeerPublicKey = "short" }, true, "peerPublicKey"},
 		{"valid allowedIPs", func(c *wgs2s.TunnelConfig) { c.AllowedIPs = []string{"10.0.0.0/24"} }, false, ""},
@@ -151,6 +170,10 @@ func TestValidateUpdateRequest(t *testing.T) {
 		{"negative keepalive", func(c *wgs2s.TunnelConfig) { c.PersistentKeepalive = -1 }, true, "persistentKeepalive"},
 		{"keepalive at max", func(c *wgs2s.TunnelConfig) { c.PersistentKeepalive = 86400 }, false, ""},
 		{"keepalive exceeds max", func(c *wgs2s.TunnelConfig) { c.PersistentKeepalive = 86401 }, true, "persistentKeepalive"},
+		{"clear psk", func(c *wgs2s.TunnelConfig) { c.ClearPresharedKey = true }, false, ""},
+		{"psk and clear", func(c *wgs2s.TunnelConfig) {
+			c.PresharedKey, c.ClearPresharedKey = testBase64Key(t), true
+		}, true, "mutually exclusive"},
 	}
 
 	for _, tt := range tests {
@@ -170,6 +193,53 @@ func TestValidateUpdateRequest(t *testing.T) {
 	}
 }
 
+func TestValidatePeers(t *testing.T) {
+	keyA, keyB := testBase64Key(t), testBase64Key(t)
+	tests := []struct {
+		name    string
+		peers   []wgs2s.Peer
+		wantErr string
+	}{
+		{"two distinct peers", []wgs2s.Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: keyB, AllowedIPs: []string{"10.2.0.0/24"}},
+		}, ""},
+		{"bad key", []wgs2s.Peer{{PublicKey: "short"}}, "peers[0].publicKey"},
+		{"duplicate key", []wgs2s.Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: keyA, AllowedIPs: []string{"10.2.0.0/24"}},
+		}, "duplicates"},
+		{"same CIDR on two peers", []wgs2s.Peer{
+			{PublicKey: keyA, AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: keyB, AllowedIPs: []string{"10.1.0.5/24"}},
+		}, "assigned to both"},
+		{"invalid CIDR", []wgs2s.Peer{{PublicKey: keyA, AllowedIPs: []string{"bad"}}}, "peers[0].allowedIP"},
+		{"negative keepalive", []wgs2s.Peer{{PublicKey: keyA, PersistentKeepalive: -5}}, "persistentKeepalive"},
+		{"keepalive off", []wgs2s.Peer{{PublicKey: keyA, PersistentKeepalive: domain.WgKeepaliveOff}}, ""},
+		{"valid psk", []wgs2s.Peer{{PublicKey: keyA, PresharedKey: keyB}}, ""},
+		{"bad psk", []wgs2s.Peer{{PublicKey: keyA, PresharedKey: "not-a-key"}}, "peers[0].presharedKey"},
+		{"clear psk", []wgs2s.Peer{{PublicKey: keyA, ClearPresharedKey: true}}, ""},
+		{"psk and clear", []wgs2s.Peer{{PublicKey: keyA, PresharedKey: keyB, ClearPresharedKey: true}}, "mutually exclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePeers(tt.peers)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateUpdateRequest_EmptyPeersRejected(t *testing.T) {
+	err := validateUpdateRequest(&wgs2s.TunnelConfig{Peers: []wgs2s.Peer{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "peers")
+}
+
 // --- Mock types for service-level tests ---
 
 type mockWgS2sWireGuard struct {
@@ -181,6 +251,13 @@ type mockWgS2sWireGuard struct {
 	getTunnelsFn    func() []wgs2s.TunnelConfig
 	getStatusesFn   func() []wgs2s.WgS2sStatus
 	getPublicKeyFn  func(string) (string, error)
+	getPSKFn        func(string, string) (string, error)
+	prepareRotFn    func(string, time.Time) (*wgs2s.WgKeyRotation, error)
+	commitRotFn     func(string) error
+	cancelRotFn     func(string) error
+	reResolveFn     func(time.Time) []wgs2s.WgS2sEndpointChange
+	checkFailoverFn func(time.Time) []wgs2s.WgS2sFailoverEvent
+	reachabilityFn  func(time.Time) []wgs2s.WgS2sReachabilityEvent
 }
 
 func (m *mockWgS2sWireGuard) CreateTunnel(cfg wgs2s.TunnelConfig, pk string) (*wgs2s.TunnelConfig, error) {
@@ -239,6 +316,61 @@ func (m *mockWgS2sWireGuard) GetPublicKey(id string) (string, error) {
 	return "", nil
 }
 
+func (m *mockWgS2sWireGuard) GetPresharedKey(id, peerPublicKey string) (string, error) {
+	if m.getPSKFn != nil {
+		return m.getPSKFn(id, peerPublicKey)
+	}
+	return "", nil
+}
+
+func (m *mockWgS2sWireGuard) PrepareKeyRotation(id string, at time.Time) (*wgs2s.WgKeyRotation, error) {
+	if m.prepareRotFn != nil {
+		return m.prepareRotFn(id, at)
+	}
+	return &wgs2s.WgKeyRotation{ScheduledAt: at}, nil
+}
+
+func (m *mockWgS2sWireGuard) CommitKeyRotation(id string) error {
+	if m.commitRotFn != nil {
+		return m.commitRotFn(id)
+	}
+	return nil
+}
+
+func (m *mockWgS2sWireGuard) CancelKeyRotation(id string) error {
+	if m.cancelRotFn != nil {
+		return m.cancelRotFn(id)
+	}
+	return nil
+}
+
+func (m *mockWgS2sWireGuard) ReResolveEndpoints(_ context.Context, now time.Time) []wgs2s.WgS2sEndpointChange {
+	if m.reResolveFn != nil {
+		return m.reResolveFn(now)
+	}
+	return nil
+}
+
+func (m *mockWgS2sWireGuard) CheckFailover(_ context.Context, now time.Time) []wgs2s.WgS2sFailoverEvent {
+	if m.checkFailoverFn != nil {
+		return m.checkFailoverFn(now)
+	}
+	return nil
+}
+
+func (m *mockWgS2sWireGuard) RunReachabilityProbes(_ context.Context, now time.Time) []wgs2s.WgS2sReachabilityEvent {
+	if m.reachabilityFn != nil {
+		return m.reachabilityFn(now)
+	}
+	return nil
+}
+
+type mockWgS2sLogger struct {
+	warnings []string
+}
+
+func (m *mockWgS2sLogger) LogWarn(msg string) { m.warnings = append(m.warnings, msg) }
+
 type mockWgS2sFirewall struct {
 	setupZoneFn        func(context.Context, string, string, string) *ZoneSetupResult
 	setupFirewallFn    func(context.Context, string, string, []string) error
@@ -658,6 +790,69 @@ func TestUpdateTunnel_NoPortChangeLeavesWanAlone(t *testing.T) {
 	assert.Zero(t, wanCalls, "WAN policy must not be touched when port is unchanged")
 }
 
+// TestUpdateTunnel_FlatPeerEditOnHubRejected: on a multi-peer tunnel the
+// flat peer fields are ambiguous, so the service must refuse them before
+// touching the kernel.
+func TestUpdateTunnel_FlatPeerEditOnHubRejected(t *testing.T) {
+	existing := wgs2s.TunnelConfig{
+		ID: "t1", InterfaceName: "wg-s2s0", Enabled: true,
+		Peers: []wgs2s.Peer{
+			{PublicKey: testBase64Key(t), AllowedIPs: []string{"10.1.0.0/24"}},
+			{PublicKey: testBase64Key(t), AllowedIPs: []string{"10.2.0.0/24"}},
+		},
+	}
+	wg := &mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{existing} },
+		updateTunnelFn: func(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+			t.Fatal("UpdateTunnel must not reach the manager")
+			return nil, nil
+		},
+	}
+	svc := newTestWgS2sService(wg)
+
+	_, err := svc.UpdateTunnel(context.Background(), "t1", wgs2s.TunnelConfig{AllowedIPs: []string{"10.9.0.0/24"}})
+	require.Error(t, err)
+	var se *Error
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, ErrValidation, se.Kind)
+}
+
+// TestUpdateTunnel_PeersChangeRefreshesFirewall: replacing the peer list
+// changes the tunnel's remote subnets, so ipset entries must be resynced the
+// same way an allowedIPs edit does.
+func TestUpdateTunnel_PeersChangeRefreshesFirewall(t *testing.T) {
+	existing := wgs2s.TunnelConfig{
+		ID: "t1", InterfaceName: "wg-s2s0", Enabled: true, ListenPort: 51820,
+		AllowedIPs: []string{"10.1.0.0/24"},
+	}
+	updated := existing
+	updated.AllowedIPs = []string{"10.1.0.0/24", "10.2.0.0/24"}
+
+	wg := &mockWgS2sWireGuard{
+		getTunnelsFn: func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{existing} },
+		updateTunnelFn: func(string, wgs2s.TunnelConfig) (*wgs2s.TunnelConfig, error) {
+			return &updated, nil
+		},
+	}
+	var removed, installed []string
+	fw := &mockWgS2sFirewall{
+		removeIPSetFn: func(_ context.Context, _ string, cidrs []string) { removed = cidrs },
+		setupFirewallFn: func(_ context.Context, _, _ string, ips []string) error {
+			installed = ips
+			return nil
+		},
+	}
+	svc := newTestWgS2sService(wg, func(s *WgS2sService) { s.fw = fw })
+
+	_, err := svc.UpdateTunnel(context.Background(), "t1", wgs2s.TunnelConfig{Peers: []wgs2s.Peer{
+		{PublicKey: testBase64Key(t), AllowedIPs: []string{"10.1.0.0/24"}},
+		{PublicKey: testBase64Key(t), AllowedIPs: []string{"10.2.0.0/24"}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.1.0.0/24"}, removed)
+	assert.Equal(t, []string{"10.1.0.0/24", "10.2.0.0/24"}, installed)
+}
+
 func TestEnableTunnelFirewallPartial(t *testing.T) {
 	tunnel := wgs2s.TunnelConfig{
 		ID: "t1", Name: "test", InterfaceName: "wg-s2s0", Enabled: true,
@@ -693,6 +888,71 @@ func TestGenerateKeypair(t *testing.T) {
 	assert.Len(t, kp.PrivateKey, 44)
 }
 
+func TestGeneratePresharedKey(t *testing.T) {
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{})
+	psk, err := svc.GeneratePresharedKey()
+	require.NoError(t, err)
+	assert.NoError(t, validateBase64Key(psk.PresharedKey))
+}
+
+func TestGetConfig_DualStackHostRoutes(t *testing.T) {
+	tunnel := wgs2s.TunnelConfig{
+		ID: "t1", ListenPort: 51820,
+		TunnelAddress:   "10.255.0.1/30",
+		TunnelAddresses: []string{"10.255.0.1/30", "fd00:255::1/126"},
+		LocalSubnets:    []string{"192.168.1.0/24", "fd00:1::/64"},
+	}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn:   func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{tunnel} },
+		getPublicKeyFn: func(string) (string, error) { return "local-pub", nil },
+	})
+
+	cfg, err := svc.GetConfig(context.Background(), "t1", "")
+	require.NoError(t, err)
+	assert.Contains(t, cfg, "AllowedIPs = 192.168.1.0/24, fd00:1::/64, 10.255.0.1/32, fd00:255::1/128\n")
+}
+
+func TestGetConfig_PresharedKey(t *testing.T) {
+	keyA, keyB, psk := testBase64Key(t), testBase64Key(t), testBase64Key(t)
+	hub := wgs2s.TunnelConfig{ID: "t1", ListenPort: 51820, Peers: []wgs2s.Peer{
+		{PublicKey: keyA, PresharedKeySet: true},
+		{PublicKey: keyB},
+	}}
+	single := wgs2s.TunnelConfig{ID: "t2", ListenPort: 51821, Peers: []wgs2s.Peer{
+		{PublicKey: keyA, PresharedKeySet: true},
+	}}
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{
+		getTunnelsFn:   func() []wgs2s.TunnelConfig { return []wgs2s.TunnelConfig{hub, single} },
+		getPublicKeyFn: func(string) (string, error) { return "local-pub", nil },
+		getPSKFn: func(_, peer string) (string, error) {
+			if peer == keyA {
+				return psk, nil
+			}
+			return "", nil
+		},
+	})
+
+	t.Run("single peer needs no selector", func(t *testing.T) {
+		cfg, err := svc.GetConfig(context.Background(), "t2", "")
+		require.NoError(t, err)
+		assert.Contains(t, cfg, "PresharedKey = "+psk)
+	})
+	t.Run("hub export for selected peer", func(t *testing.T) {
+		cfg, err := svc.GetConfig(context.Background(), "t1", keyA)
+		require.NoError(t, err)
+		assert.Contains(t, cfg, "PresharedKey = "+psk)
+	})
+	t.Run("hub export for peer without psk", func(t *testing.T) {
+		cfg, err := svc.GetConfig(context.Background(), "t1", keyB)
+		require.NoError(t, err)
+		assert.NotContains(t, cfg, "PresharedKey")
+	})
+	t.Run("unknown peer", func(t *testing.T) {
+		_, err := svc.GetConfig(context.Background(), "t1", testBase64Key(t))
+		require.Error(t, err)
+	})
+}
+
 func TestListTunnels(t *testing.T) {
 	tunnels := []wgs2s.TunnelConfig{
 		{ID: "t1", Name: "tunnel-1", InterfaceName: "wg-s2s0"},
@@ -881,3 +1141,65 @@ func TestSetupZoneForTunnelCreatesZone(t *testing.T) {
 	assert.True(t, result.ZoneCreated)
 	assert.Equal(t, "t1", setupTunnelID)
 }
+
+// wireGuardTrap serves reads from a mock; its nil WgS2sWireGuard makes any
+// other call panic.
+type wireGuardTrap struct {
+	WgS2sWireGuard
+	reads *mockWgS2sWireGuard
+}
+
+func (w wireGuardTrap) GetTunnels() []wgs2s.TunnelConfig { return w.reads.GetTunnels() }
+func (w wireGuardTrap) GetStatuses() []wgs2s.WgS2sStatus { return w.reads.GetStatuses() }
+func (w wireGuardTrap) GetPublicKey(id string) (string, error) {
+	return w.reads.GetPublicKey(id)
+}
+func (w wireGuardTrap) GetPresharedKey(id, peer string) (string, error) {
+	return w.reads.GetPresharedKey(id, peer)
+}
+
+// TestPlannedWireGuard_NoWriteReachesManager calls every WgS2sWireGuard
+// method on the dry run's tunnel manager and fails when one that is not a
+// read gets through to the real one.
+func TestPlannedWireGuard_NoWriteReachesManager(t *testing.T) {
+	w := plannedWireGuard{live: wireGuardTrap{reads: &mockWgS2sWireGuard{}}}
+	iface := reflect.TypeOf((*WgS2sWireGuard)(nil)).Elem()
+	v := reflect.ValueOf(w)
+	ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	for i := range iface.NumMethod() {
+		m := iface.Method(i)
+		t.Run(m.Name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s reached the tunnel manager in a dry run", m.Name)
+				}
+			}()
+			args := make([]reflect.Value, m.Type.NumIn())
+			for j := range args {
+				if in := m.Type.In(j); in == ctxType {
+					args[j] = reflect.ValueOf(context.Background())
+				} else {
+					args[j] = reflect.Zero(in)
+				}
+			}
+			v.MethodByName(m.Name).Call(args)
+		})
+	}
+}
+
+func TestPlanCreateTunnel_PortInUse(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	require.NoError(t, err)
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	svc := newTestWgS2sService(&mockWgS2sWireGuard{})
+	_, err = svc.PlanCreateTunnel(context.Background(), &WgS2sCreateRequest{
+		TunnelConfig: wgs2s.TunnelConfig{
+			Name: "test", ListenPort: port, TunnelAddress: "10.0.0.1/24",
+			PeerPublicKey: testBase64Key(t), AllowedIPs: []string{"10.0.0.0/24"},
+		},
+	}, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in use")
+}
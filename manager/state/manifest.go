@@ -15,26 +15,37 @@ import (
 )
 
 type Manifest struct {
-	mu             sync.RWMutex                       `json:"-"`
-	path           string                             `json:"-"`
-	recovered      bool                               `json:"-"`
-	Version        int                                `json:"version"`
-	CreatedAt      time.Time                          `json:"createdAt"`
-	UpdatedAt      time.Time                          `json:"updatedAt"`
-	SiteID         string                             `json:"siteId,omitempty"`
-	Tailscale      domain.ZoneManifest                `json:"tailscale"`
-	WgS2s          map[string]domain.ZoneManifest     `json:"wgS2s,omitempty"`
-	WanPorts       map[string]domain.WanPortEntry     `json:"wanPorts,omitempty"`
-	ExternalZoneID string                             `json:"externalZoneId,omitempty"`
-	GatewayZoneID  string                             `json:"gatewayZoneId,omitempty"`
-	DNSPolicies    map[string]domain.DNSPolicyEntry   `json:"dnsPolicies,omitempty"`
-	ExitNodePolicy           *domain.ExitNodePolicy   `json:"exitNodePolicy,omitempty"`
-	AdvertiseExitNodeEnabled bool                     `json:"advertiseExitNode,omitempty"`
-	RemoteExitNode           *domain.RemoteExitNode   `json:"remoteExitNode,omitempty"`
-}
-
+	mu           sync.RWMutex `json:"-"`
+	path         string       `json:"-"`
+	recovered    bool         `json:"-"`
+	lastSnapshot []byte       `json:"-"` // newest snapshot without its save time
+	ManifestState
+}
+
+// ManifestState is what a manifest saves. A snapshot restore replaces it
+// whole.
+type ManifestState struct {
+	Version                  int                              `json:"version"`
+	CreatedAt                time.Time                        `json:"createdAt"`
+	UpdatedAt                time.Time                        `json:"updatedAt"`
+	SiteID                   string                           `json:"siteId,omitempty"`
+	Tailscale                domain.ZoneManifest              `json:"tailscale"`
+	WgS2s                    map[string]domain.ZoneManifest   `json:"wgS2s,omitempty"`
+	WanPorts                 map[string]domain.WanPortEntry   `json:"wanPorts,omitempty"`
+	ExternalZoneID           string                           `json:"externalZoneId,omitempty"`
+	GatewayZoneID            string                           `json:"gatewayZoneId,omitempty"`
+	DNSPolicies              map[string]domain.DNSPolicyEntry `json:"dnsPolicies,omitempty"`
+	ExitNodePolicy           *domain.ExitNodePolicy           `json:"exitNodePolicy,omitempty"`
+	AdvertiseExitNodeEnabled bool                             `json:"advertiseExitNode,omitempty"`
+	RemoteExitNode           *domain.RemoteExitNode           `json:"remoteExitNode,omitempty"`
+	ExitSchedules            []domain.ExitSchedule            `json:"exitSchedules,omitempty"`
+	PolicyTemplates          []domain.PolicyTemplate          `json:"policyTemplates,omitempty"`
+}
+
+// NewManifest returns an empty manifest saved to path. With an empty path
+// it is kept in memory only.
 func NewManifest(path string) *Manifest {
-	return &Manifest{path: path, Version: 2, CreatedAt: time.Now().UTC()}
+	return &Manifest{path: path, ManifestState: ManifestState{Version: 2, CreatedAt: time.Now().UTC()}}
 }
 
 func (m *Manifest) Path() string { return m.path }
@@ -98,6 +109,7 @@ func LoadManifest(path string) (*Manifest, error) {
 		return m2, nil
 	}
 	m.path = path
+	m.seedLastSnapshot()
 	return &m, nil
 }
 
@@ -115,15 +127,15 @@ type manifestV1 struct {
 func migrateV1(data []byte) (*Manifest, error) {
 	var v1 manifestV1
 	if err := json.Unmarshal(data, &v1); err != nil {
-		return &Manifest{Version: 2, CreatedAt: time.Now().UTC()}, nil
+		return &Manifest{ManifestState: ManifestState{Version: 2, CreatedAt: time.Now().UTC()}}, nil
 	}
 
-	m := &Manifest{
+	m := &Manifest{ManifestState: ManifestState{
 		Version:   2,
 		CreatedAt: v1.CreatedAt,
 		UpdatedAt: v1.UpdatedAt,
 		Tailscale: domain.ZoneManifest{ChainPrefix: "VPN"},
-	}
+	}}
 
 	if v1.ModeB.ZoneID != "" {
 		m.Tailscale.ZoneID = v1.ModeB.ZoneID
@@ -134,6 +146,9 @@ func migrateV1(data []byte) (*Manifest, error) {
 }
 
 func (m *Manifest) saveLocked() error {
+	if m.path == "" {
+		return nil
+	}
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return fmt.Errorf("manifest marshal: %w", err)
@@ -144,6 +159,7 @@ func (m *Manifest) saveLocked() error {
 	if err := WriteFile(m.path, data, config.SecretPerm); err != nil {
 		return fmt.Errorf("manifest save: %w", err)
 	}
+	m.snapshotLocked(data)
 	return nil
 }
 
@@ -343,17 +359,82 @@ func (m *Manifest) GetExitNodePolicy() domain.ExitNodePolicy {
 	}
 	p := *m.ExitNodePolicy
 	p.Clients = slices.Clone(p.Clients)
+	p.Networks = slices.Clone(p.Networks)
+	p.Destinations = slices.Clone(p.Destinations)
+	p.Domains = slices.Clone(p.Domains)
 	return p
 }
 
 func (m *Manifest) SetExitNodePolicy(p domain.ExitNodePolicy) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	p.Clients = slices.Clone(p.Clients)
+	p.Networks = slices.Clone(p.Networks)
+	p.Destinations = slices.Clone(p.Destinations)
+	p.Domains = slices.Clone(p.Domains)
 	m.ExitNodePolicy = &p
 	m.UpdatedAt = time.Now().UTC()
 	return m.saveLocked()
 }
 
+func (m *Manifest) GetExitSchedules() []domain.ExitSchedule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return cloneExitSchedules(m.ExitSchedules)
+}
+
+func (m *Manifest) SetExitSchedules(s []domain.ExitSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ExitSchedules = cloneExitSchedules(s)
+	m.UpdatedAt = time.Now().UTC()
+	return m.saveLocked()
+}
+
+func cloneExitSchedules(s []domain.ExitSchedule) []domain.ExitSchedule {
+	if s == nil {
+		return nil
+	}
+	out := make([]domain.ExitSchedule, len(s))
+	for i, sch := range s {
+		sch.Cron = slices.Clone(sch.Cron)
+		out[i] = sch
+	}
+	return out
+}
+
+func (m *Manifest) GetPolicyTemplates() []domain.PolicyTemplate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return clonePolicyTemplates(m.PolicyTemplates)
+}
+
+func (m *Manifest) SetPolicyTemplates(t []domain.PolicyTemplate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.PolicyTemplates = clonePolicyTemplates(t)
+	m.UpdatedAt = time.Now().UTC()
+	return m.saveLocked()
+}
+
+func clonePolicyTemplates(t []domain.PolicyTemplate) []domain.PolicyTemplate {
+	if t == nil {
+		return nil
+	}
+	out := make([]domain.PolicyTemplate, len(t))
+	for i, tpl := range t {
+		rules := make([]domain.PolicyRule, len(tpl.Rules))
+		for j, r := range tpl.Rules {
+			r.Ports = slices.Clone(r.Ports)
+			r.Destinations = slices.Clone(r.Destinations)
+			rules[j] = r
+		}
+		tpl.Rules = rules
+		out[i] = tpl
+	}
+	return out
+}
+
 func (m *Manifest) GetAdvertiseExitNodeEnabled() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -376,6 +457,10 @@ func (m *Manifest) GetRemoteExitNode() *domain.RemoteExitNode {
 	}
 	cp := *m.RemoteExitNode
 	cp.Clients = slices.Clone(cp.Clients)
+	cp.Networks = slices.Clone(cp.Networks)
+	cp.Destinations = slices.Clone(cp.Destinations)
+	cp.Domains = slices.Clone(cp.Domains)
+	cp.Candidates = slices.Clone(cp.Candidates)
 	return &cp
 }
 
@@ -385,6 +470,10 @@ func (m *Manifest) SetRemoteExitNode(r *domain.RemoteExitNode) error {
 	if r != nil {
 		cp := *r
 		cp.Clients = slices.Clone(r.Clients)
+		cp.Networks = slices.Clone(r.Networks)
+		cp.Destinations = slices.Clone(r.Destinations)
+		cp.Domains = slices.Clone(r.Domains)
+		cp.Candidates = slices.Clone(r.Candidates)
 		m.RemoteExitNode = &cp
 	} else {
 		m.RemoteExitNode = nil
@@ -124,6 +124,20 @@ func TestManifestSaveRoundtrip(t *testing.T) {
 	assert.Equal(t, "TS", m2.Tailscale.ChainPrefix)
 }
 
+func TestManifestInMemory(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	m := state.NewManifest("")
+	require.NoError(t, m.SetSiteID("my-site"))
+	require.NoError(t, m.SetWanPort("tailscale-wg", "p1", "VPN Pack: Tailscale WG", 41641))
+	assert.Equal(t, "p1", m.GetWanPortPolicyID("tailscale-wg"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing is written")
+}
+
 func TestGetWgS2sZones(t *testing.T) {
 	t.Run("empty map", func(t *testing.T) {
 		m := &state.Manifest{}
@@ -132,12 +146,12 @@ func TestGetWgS2sZones(t *testing.T) {
 	})
 
 	t.Run("2 tunnels same zone", func(t *testing.T) {
-		m := &state.Manifest{
+		m := &state.Manifest{ManifestState: state.ManifestState{
 			WgS2s: map[string]domain.ZoneManifest{
 				"t1": {ZoneID: "z1", ZoneName: "Zone One"},
 				"t2": {ZoneID: "z1", ZoneName: "Zone One"},
 			},
-		}
+		}}
 		zones := m.GetWgS2sZones()
 		require.Len(t, zones, 1)
 		assert.Equal(t, "z1", zones[0].ZoneID)
@@ -145,12 +159,12 @@ func TestGetWgS2sZones(t *testing.T) {
 	})
 
 	t.Run("2 different zones", func(t *testing.T) {
-		m := &state.Manifest{
+		m := &state.Manifest{ManifestState: state.ManifestState{
 			WgS2s: map[string]domain.ZoneManifest{
 				"t1": {ZoneID: "z1", ZoneName: "Zone One"},
 				"t2": {ZoneID: "z2", ZoneName: "Zone Two"},
 			},
-		}
+		}}
 		zones := m.GetWgS2sZones()
 		assert.Len(t, zones, 2)
 	})
@@ -163,7 +177,7 @@ func TestGetTailscaleChainPrefix(t *testing.T) {
 	})
 
 	t.Run("custom prefix", func(t *testing.T) {
-		m := &state.Manifest{Tailscale: domain.ZoneManifest{ChainPrefix: "CUSTOM"}}
+		m := &state.Manifest{ManifestState: state.ManifestState{Tailscale: domain.ZoneManifest{ChainPrefix: "CUSTOM"}}}
 		assert.Equal(t, "CUSTOM", m.GetTailscaleChainPrefix())
 	})
 }
@@ -512,3 +526,30 @@ func TestManifest_RemoteExitNodeSnapshotIsolation(t *testing.T) {
 	assert.Equal(t, "peer-1", got2.PeerID)
 	assert.Equal(t, "192.168.1.10", got2.Clients[0].IP)
 }
+
+func TestManifest_PolicyTemplatesRoundtrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	m := state.NewManifest(path)
+
+	tpl := []domain.PolicyTemplate{{
+		Zone: "Tailscale",
+		Rules: []domain.PolicyRule{{
+			Name: "RDP", Direction: domain.PolicyInbound, Action: "ALLOW",
+			Protocol: "TCP", Ports: []int{3389}, Destinations: []string{"192.168.1.0/24"},
+		}},
+	}}
+	require.NoError(t, m.SetPolicyTemplates(tpl))
+
+	tpl[0].Rules[0].Ports[0] = 22
+	got := m.GetPolicyTemplates()
+	assert.Equal(t, []int{3389}, got[0].Rules[0].Ports, "Set must copy the rules")
+	got[0].Rules[0].Destinations[0] = "mutated"
+
+	m2, err := state.LoadManifest(path)
+	require.NoError(t, err)
+	got2 := m2.GetPolicyTemplates()
+	require.Len(t, got2, 1)
+	assert.Equal(t, "192.168.1.0/24", got2[0].Rules[0].Destinations[0])
+	assert.Equal(t, domain.PolicyInbound, got2[0].Rules[0].Direction)
+}
@@ -0,0 +1,232 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+)
+
+// Every save of the manifest that changes more than its save time also
+// writes a snapshot of it, named after the time of the save, into a
+// directory next to it. The newest config.ManifestSnapshots are kept; the
+// state a restore replaces is always the newest of them.
+
+const snapshotPrefix, snapshotSuffix = "manifest-", ".json"
+
+func (m *Manifest) snapshotDir() string {
+	return filepath.Join(filepath.Dir(m.path), filepath.Base(config.ManifestSnapshotDir))
+}
+
+func (m *Manifest) snapshotPath(id string) string {
+	return filepath.Join(m.snapshotDir(), snapshotPrefix+id+snapshotSuffix)
+}
+
+// snapshotLocked writes data as the newest snapshot and drops the oldest
+// beyond the limit. Failures are logged: a missing snapshot must not fail
+// the save it records.
+func (m *Manifest) snapshotLocked(data []byte) {
+	updatedAt := m.UpdatedAt
+	m.UpdatedAt = time.Time{}
+	content, err := json.Marshal(m)
+	m.UpdatedAt = updatedAt
+	if err == nil && bytes.Equal(content, m.lastSnapshot) {
+		return
+	}
+	if err := os.MkdirAll(m.snapshotDir(), config.DirPerm); err != nil {
+		slog.Warn("manifest snapshot dir create failed", "err", err)
+		return
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := WriteFile(m.snapshotPath(id), data, config.SecretPerm); err != nil {
+		slog.Warn("manifest snapshot failed", "err", err)
+		return
+	}
+	m.lastSnapshot = content
+	snaps, err := m.ListSnapshots()
+	if err != nil {
+		slog.Warn("manifest snapshot prune failed", "err", err)
+		return
+	}
+	for _, s := range snaps[min(len(snaps), config.ManifestSnapshots):] {
+		if err := os.Remove(m.snapshotPath(s.ID)); err != nil {
+			slog.Warn("manifest snapshot prune failed", "id", s.ID, "err", err)
+		}
+	}
+}
+
+// seedLastSnapshot takes the newest stored snapshot as the last one
+// written, so a save after a restart that changes nothing does not repeat it.
+func (m *Manifest) seedLastSnapshot() {
+	snaps, err := m.ListSnapshots()
+	if err != nil || len(snaps) == 0 {
+		return
+	}
+	data, err := m.readSnapshot(snaps[0].ID)
+	if err != nil {
+		return
+	}
+	var snap ManifestState
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return
+	}
+	snap.UpdatedAt = time.Time{}
+	if content, err := json.Marshal(snap); err == nil {
+		m.lastSnapshot = content
+	}
+}
+
+// ListSnapshots returns the snapshots, newest first.
+func (m *Manifest) ListSnapshots() ([]domain.ManifestSnapshot, error) {
+	snaps := []domain.ManifestSnapshot{}
+	if m.path == "" {
+		return snaps, nil
+	}
+	entries, err := os.ReadDir(m.snapshotDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snaps, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+		ns, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, domain.ManifestSnapshot{ID: id, TakenAt: time.Unix(0, ns).UTC()})
+	}
+	slices.SortFunc(snaps, func(a, b domain.ManifestSnapshot) int { return b.TakenAt.Compare(a.TakenAt) })
+	return snaps, nil
+}
+
+// readSnapshot returns the contents of snapshot id. Only the IDs ListSnapshots
+// returns are valid, which keeps id from naming any other file.
+func (m *Manifest) readSnapshot(id string) ([]byte, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil || m.path == "" {
+		return nil, domain.ErrSnapshotNotFound
+	}
+	data, err := os.ReadFile(m.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return nil, domain.ErrSnapshotNotFound
+	}
+	return data, err
+}
+
+// DiffSnapshot lists what changed from snapshot fromID to snapshot toID, or
+// to the current manifest when toID is empty.
+func (m *Manifest) DiffSnapshot(fromID, toID string) ([]domain.ManifestChange, error) {
+	from, err := m.readSnapshot(fromID)
+	if err != nil {
+		return nil, err
+	}
+	var to []byte
+	if toID != "" {
+		to, err = m.readSnapshot(toID)
+	} else {
+		m.mu.RLock()
+		to, err = json.Marshal(m)
+		m.mu.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffJSON(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("manifest diff: %w", err)
+	}
+	return changes, nil
+}
+
+// diffJSON compares two manifest encodings, leaving out the save time.
+func diffJSON(from, to []byte) ([]domain.ManifestChange, error) {
+	before, after := make(map[string]any), make(map[string]any)
+	if err := flattenJSON(from, before); err != nil {
+		return nil, err
+	}
+	if err := flattenJSON(to, after); err != nil {
+		return nil, err
+	}
+	delete(before, "updatedAt")
+	delete(after, "updatedAt")
+
+	changes := []domain.ManifestChange{}
+	paths := slices.Collect(maps.Keys(before))
+	for p := range after {
+		if _, ok := before[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	for _, p := range paths {
+		b, a := before[p], after[p]
+		if b != a {
+			changes = append(changes, domain.ManifestChange{Path: p, From: b, To: a})
+		}
+	}
+	return changes, nil
+}
+
+// flattenJSON maps the path of every scalar in data to its value.
+func flattenJSON(data []byte, out map[string]any) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if path != "" {
+					k = path + "." + k
+				}
+				walk(k, e)
+			}
+		case []any:
+			for i, e := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), e)
+			}
+		default:
+			out[path] = v
+		}
+	}
+	walk("", v)
+	return nil
+}
+
+// RestoreSnapshot replaces the manifest with snapshot id and saves it. The
+// controller, the firewall and the exit node are left to the caller to
+// reconcile.
+func (m *Manifest) RestoreSnapshot(id string) error {
+	data, err := m.readSnapshot(id)
+	if err != nil {
+		return err
+	}
+	var snap ManifestState
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("snapshot %s: %w", id, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ManifestState = snap
+	m.UpdatedAt = time.Now().UTC()
+	return m.saveLocked()
+}
@@ -0,0 +1,98 @@
+package state_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+	"unifi-tailscale/manager/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := state.LoadManifest(path)
+	require.NoError(t, err)
+
+	require.NoError(t, m.SetSiteID("site-1"))
+	require.NoError(t, m.SetWanPort("tailscale-wg", "p1", "VPN Pack: Tailscale WG", 41641))
+	require.NoError(t, m.SetSiteID("site-1"))
+
+	snaps, err := m.ListSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snaps, 2, "a save that changes nothing is not kept")
+	assert.True(t, snaps[0].TakenAt.After(snaps[1].TakenAt), "newest first")
+
+	changes, err := m.DiffSnapshot(snaps[1].ID, snaps[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.ManifestChange{
+		{Path: "wanPorts.tailscale-wg.policyId", To: "p1"},
+		{Path: "wanPorts.tailscale-wg.policyName", To: "VPN Pack: Tailscale WG"},
+		{Path: "wanPorts.tailscale-wg.port", To: float64(41641)},
+	}, changes)
+
+	changes, err = m.DiffSnapshot(snaps[0].ID, "")
+	require.NoError(t, err)
+	assert.Empty(t, changes, "the newest snapshot is the current manifest")
+
+	require.NoError(t, m.RestoreSnapshot(snaps[1].ID))
+	assert.Empty(t, m.GetWanPortsSnapshot())
+	assert.Equal(t, "site-1", m.GetSiteID())
+	reloaded, err := state.LoadManifest(path)
+	require.NoError(t, err)
+	assert.Empty(t, reloaded.GetWanPortsSnapshot(), "the restore is saved")
+
+	for _, id := range []string{"1", "../manifest", ""} {
+		assert.ErrorIs(t, m.RestoreSnapshot(id), domain.ErrSnapshotNotFound, id)
+	}
+}
+
+func TestManifestSnapshots_SurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := state.LoadManifest(path)
+	require.NoError(t, err)
+	require.NoError(t, m.SetSiteID("site-1"))
+	require.NoError(t, m.SetWanPort("tailscale-wg", "p1", "VPN Pack: Tailscale WG", 41641))
+
+	reloaded, err := state.LoadManifest(path)
+	require.NoError(t, err)
+	require.NoError(t, reloaded.SetSiteID("site-1"))
+	snaps, err := reloaded.ListSnapshots()
+	require.NoError(t, err)
+	assert.Len(t, snaps, 2, "a save after a restart that changes nothing is not kept")
+
+	require.NoError(t, reloaded.SetSiteID("site-2"))
+	snaps, err = reloaded.ListSnapshots()
+	require.NoError(t, err)
+	assert.Len(t, snaps, 3)
+}
+
+func TestManifestSnapshots_Bounded(t *testing.T) {
+	m, err := state.LoadManifest(filepath.Join(t.TempDir(), "manifest.json"))
+	require.NoError(t, err)
+	for i := range config.ManifestSnapshots + 3 {
+		require.NoError(t, m.SetSiteID(fmt.Sprintf("site-%d", i)))
+	}
+
+	snaps, err := m.ListSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snaps, config.ManifestSnapshots)
+
+	changes, err := m.DiffSnapshot(snaps[len(snaps)-1].ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, []domain.ManifestChange{{Path: "siteId", From: "site-3", To: fmt.Sprintf("site-%d", config.ManifestSnapshots+2)}}, changes)
+}
+
+func TestManifestSnapshots_InMemory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m := state.NewManifest("")
+	require.NoError(t, m.SetSiteID("site-1"))
+
+	snaps, err := m.ListSnapshots()
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
+}
@@ -0,0 +1,268 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Traffic history windows. Each keeps a fixed number of buckets, so memory
+// per series is bounded no matter how long the manager runs.
+const (
+	TrafficRangeHour = "hour"
+	TrafficRangeDay  = "day"
+
+	trafficHourStep    = 10 * time.Second
+	trafficHourBuckets = int(time.Hour / trafficHourStep)
+	trafficDayStep     = 5 * time.Minute
+	trafficDayBuckets  = int(24 * time.Hour / trafficDayStep)
+)
+
+// TrafficPoint is the average rate over one bucket, in bytes per second.
+type TrafficPoint struct {
+	At     time.Time `json:"t"`
+	RxRate float64   `json:"rx"`
+	TxRate float64   `json:"tx"`
+}
+
+type trafficBucket struct {
+	Start int64 `json:"s"`
+	Rx    int64 `json:"rx"`
+	Tx    int64 `json:"tx"`
+}
+
+// trafficRing holds the byte deltas of the most recent buckets, oldest
+// first. The last bucket is still filling.
+type trafficRing struct {
+	step    time.Duration
+	size    int
+	buckets []trafficBucket
+}
+
+func (r *trafficRing) add(now time.Time, rx, tx int64) {
+	start := now.Truncate(r.step).Unix()
+	if n := len(r.buckets); n > 0 && r.buckets[n-1].Start == start {
+		r.buckets[n-1].Rx += rx
+		r.buckets[n-1].Tx += tx
+		return
+	}
+	if len(r.buckets) == r.size {
+		copy(r.buckets, r.buckets[1:])
+		r.buckets = r.buckets[:r.size-1]
+	}
+	r.buckets = append(r.buckets, trafficBucket{Start: start, Rx: rx, Tx: tx})
+}
+
+// points converts the completed buckets within the ring's range to rates.
+// The filling bucket is left out: its rate would be averaged over a full
+// step it has not had. Buckets older than the range are left out too; the
+// ring only drops them by count, so after downtime they would still be there.
+func (r *trafficRing) points(now time.Time) []TrafficPoint {
+	cur := now.Truncate(r.step).Unix()
+	oldest := cur - int64(r.size)*int64(r.step/time.Second)
+	secs := r.step.Seconds()
+	out := make([]TrafficPoint, 0, len(r.buckets))
+	for _, b := range r.buckets {
+		if b.Start >= cur || b.Start < oldest {
+			continue
+		}
+		out = append(out, TrafficPoint{
+			At:     time.Unix(b.Start, 0).UTC(),
+			RxRate: float64(b.Rx) / secs,
+			TxRate: float64(b.Tx) / secs,
+		})
+	}
+	return out
+}
+
+type trafficSeries struct {
+	hour, day      trafficRing
+	lastAt         time.Time
+	lastRx, lastTx int64
+	haveBaseline   bool
+	latest         TrafficPoint
+}
+
+func newTrafficSeries() *trafficSeries {
+	return &trafficSeries{
+		hour: trafficRing{step: trafficHourStep, size: trafficHourBuckets},
+		day:  trafficRing{step: trafficDayStep, size: trafficDayBuckets},
+	}
+}
+
+// TrafficHistory is an in-memory time series of rx/tx rates, fed with the
+// cumulative byte counters seen on every status refresh. Series are grouped
+// by kind (e.g. S2S tunnels, Tailscale peers) and keyed by ID within it.
+// A counter that goes backwards (interface recreated, tailscaled restarted)
+// only resets the baseline; it never yields a negative rate.
+type TrafficHistory struct {
+	mu     sync.Mutex
+	series map[string]map[string]*trafficSeries
+}
+
+func NewTrafficHistory() *TrafficHistory {
+	return &TrafficHistory{series: make(map[string]map[string]*trafficSeries)}
+}
+
+// Observe records the cumulative counters of one series at now.
+func (h *TrafficHistory) Observe(kind, id string, now time.Time, rx, tx int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	byID := h.series[kind]
+	if byID == nil {
+		byID = make(map[string]*trafficSeries)
+		h.series[kind] = byID
+	}
+	s := byID[id]
+	if s == nil {
+		s = newTrafficSeries()
+		byID[id] = s
+	}
+
+	if s.haveBaseline && rx >= s.lastRx && tx >= s.lastTx && now.After(s.lastAt) {
+		dRx, dTx := rx-s.lastRx, tx-s.lastTx
+		s.hour.add(now, dRx, dTx)
+		s.day.add(now, dRx, dTx)
+		secs := now.Sub(s.lastAt).Seconds()
+		s.latest = TrafficPoint{At: now.UTC(), RxRate: float64(dRx) / secs, TxRate: float64(dTx) / secs}
+	}
+	s.lastAt, s.lastRx, s.lastTx, s.haveBaseline = now, rx, tx, true
+}
+
+// Prune drops series that have not been observed for a whole day: their
+// tunnel or peer is gone and every bucket has aged out anyway.
+func (h *TrafficHistory) Prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for kind, byID := range h.series {
+		for id, s := range byID {
+			if now.Sub(s.lastAt) > 24*time.Hour {
+				delete(byID, id)
+			}
+		}
+		if len(byID) == 0 {
+			delete(h.series, kind)
+		}
+	}
+}
+
+// Rates returns every series' points over the named range, oldest first.
+// The second result is false for an unknown range.
+func (h *TrafficHistory) Rates(rng string, now time.Time) (map[string]map[string][]TrafficPoint, bool) {
+	if rng != TrafficRangeHour && rng != TrafficRangeDay {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make(map[string]map[string][]TrafficPoint, len(h.series))
+	for kind, byID := range h.series {
+		out[kind] = make(map[string][]TrafficPoint, len(byID))
+		for id, s := range byID {
+			ring := &s.hour
+			if rng == TrafficRangeDay {
+				ring = &s.day
+			}
+			out[kind][id] = ring.points(now)
+		}
+	}
+	return out, true
+}
+
+// Latest returns the rate between the last two observations of every series
+// that has one.
+func (h *TrafficHistory) Latest() map[string]map[string]TrafficPoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make(map[string]map[string]TrafficPoint, len(h.series))
+	for kind, byID := range h.series {
+		for id, s := range byID {
+			if s.latest.At.IsZero() {
+				continue
+			}
+			if out[kind] == nil {
+				out[kind] = make(map[string]TrafficPoint)
+			}
+			out[kind][id] = s.latest
+		}
+	}
+	return out
+}
+
+// trafficHistoryFile is the on-disk form. Only the day ring is kept: the
+// hour ring refills within the hour, and the smaller file is cheaper on the
+// flash it is written to.
+type trafficHistoryFile struct {
+	Version int                                   `json:"version"`
+	Series  map[string]map[string][]trafficBucket `json:"series"`
+}
+
+const trafficHistoryVersion = 1
+
+// Save writes the day ring of every series to path.
+func (h *TrafficHistory) Save(path string) error {
+	h.mu.Lock()
+	f := trafficHistoryFile{Version: trafficHistoryVersion, Series: make(map[string]map[string][]trafficBucket)}
+	for kind, byID := range h.series {
+		f.Series[kind] = make(map[string][]trafficBucket, len(byID))
+		for id, s := range byID {
+			f.Series[kind][id] = append([]trafficBucket(nil), s.day.buckets...)
+		}
+	}
+	h.mu.Unlock()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("marshal traffic history: %w", err)
+	}
+	return WriteFile(path, data, 0644)
+}
+
+// Load restores the day rings saved by Save, dropping buckets older than a
+// day. A missing file is not an error. The counter baselines are not saved,
+// so each series starts recording again from its second observation.
+func (h *TrafficHistory) Load(path string, now time.Time) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f trafficHistoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parse traffic history: %w", err)
+	}
+	if f.Version != trafficHistoryVersion {
+		return fmt.Errorf("traffic history version %d not supported", f.Version)
+	}
+
+	cutoff := now.Add(-24 * time.Hour).Unix()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for kind, byID := range f.Series {
+		for id, buckets := range byID {
+			s := newTrafficSeries()
+			for _, b := range buckets {
+				if b.Start > cutoff && len(s.day.buckets) < s.day.size {
+					s.day.buckets = append(s.day.buckets, b)
+				}
+			}
+			if len(s.day.buckets) == 0 {
+				continue
+			}
+			// Pruned a day after the last saved bucket unless observed again.
+			s.lastAt = time.Unix(s.day.buckets[len(s.day.buckets)-1].Start, 0)
+			if h.series[kind] == nil {
+				h.series[kind] = make(map[string]*trafficSeries)
+			}
+			h.series[kind][id] = s
+		}
+	}
+	return nil
+}
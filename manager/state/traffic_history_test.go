@@ -0,0 +1,86 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrafficHistory_RatesFromCounters(t *testing.T) {
+	h := NewTrafficHistory()
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.Observe("wgS2s", "t1", t0, 1000, 1000)
+	h.Observe("wgS2s", "t1", t0.Add(5*time.Second), 6000, 2000)
+
+	latest := h.Latest()["wgS2s"]["t1"]
+	assert.Equal(t, 1000.0, latest.RxRate, "latest is the rate since the previous observation")
+
+	rates, ok := h.Rates(TrafficRangeHour, t0.Add(20*time.Second))
+	require.True(t, ok)
+	pts := rates["wgS2s"]["t1"]
+	require.Len(t, pts, 1, "the first observation only sets the baseline")
+	assert.Equal(t, t0, pts[0].At)
+	assert.Equal(t, 500.0, pts[0].RxRate)
+	assert.Equal(t, 100.0, pts[0].TxRate)
+
+	rates, _ = h.Rates(TrafficRangeHour, t0.Add(5*time.Second))
+	assert.Empty(t, rates["wgS2s"]["t1"], "the bucket still filling is not reported")
+
+	_, ok = h.Rates("week", t0)
+	assert.False(t, ok)
+}
+
+func TestTrafficHistory_CounterResetAndRingBound(t *testing.T) {
+	h := NewTrafficHistory()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Observe("peers", "p", t0, 1<<30, 1<<30)
+	h.Observe("peers", "p", t0.Add(5*time.Second), 10, 10)
+	assert.Empty(t, h.Latest()["peers"], "a counter going backwards must not produce a rate")
+
+	at := t0.Add(5 * time.Second)
+	for range trafficHourBuckets + 10 {
+		at = at.Add(trafficHourStep)
+		h.Observe("peers", "p", at, 10, 10)
+	}
+	rates, _ := h.Rates(TrafficRangeHour, at.Add(trafficHourStep))
+	assert.Len(t, rates["peers"]["p"], trafficHourBuckets)
+}
+
+func TestTrafficHistory_RatesDropBucketsOutsideRange(t *testing.T) {
+	h := NewTrafficHistory()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Observe("wgS2s", "t1", t0, 0, 0)
+	h.Observe("wgS2s", "t1", t0.Add(time.Minute), 3000, 0)
+
+	// Nothing was observed since: the manager was down for two hours.
+	later := t0.Add(2 * time.Hour)
+	rates, _ := h.Rates(TrafficRangeHour, later)
+	assert.Empty(t, rates["wgS2s"]["t1"], "the hour graph must not show buckets from before the last hour")
+	rates, _ = h.Rates(TrafficRangeDay, later)
+	assert.Len(t, rates["wgS2s"]["t1"], 1, "the day graph still covers them")
+}
+
+func TestTrafficHistory_SaveLoadKeepsDayRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic-history.json")
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewTrafficHistory()
+	h.Observe("wgS2s", "t1", t0, 0, 0)
+	h.Observe("wgS2s", "t1", t0.Add(time.Minute), 3000, 0)
+	require.NoError(t, h.Save(path))
+
+	restored := NewTrafficHistory()
+	require.NoError(t, restored.Load(path, t0.Add(time.Hour)))
+	rates, _ := restored.Rates(TrafficRangeDay, t0.Add(time.Hour))
+	require.Len(t, rates["wgS2s"]["t1"], 1)
+	assert.Equal(t, 10.0, rates["wgS2s"]["t1"][0].RxRate)
+
+	stale := NewTrafficHistory()
+	require.NoError(t, stale.Load(path, t0.Add(48*time.Hour)))
+	rates, _ = stale.Rates(TrafficRangeDay, t0.Add(48*time.Hour))
+	assert.Empty(t, rates, "buckets older than a day are dropped on load")
+
+	require.NoError(t, NewTrafficHistory().Load(filepath.Join(t.TempDir(), "missing.json"), t0))
+}
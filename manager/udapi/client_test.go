@@ -119,6 +119,10 @@ func (f *fakeUDAPI) serve(conn net.Conn) {
 }
 
 func (f *fakeUDAPI) installSet(name string, entries []string) {
+	f.installTypedSet(ipsetTypeV4, name, entries)
+}
+
+func (f *fakeUDAPI) installTypedSet(setType, name string, entries []string) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if f.sets == nil {
@@ -126,15 +130,19 @@ func (f *fakeUDAPI) installSet(name string, entries []string) {
 	}
 	e := &ipsetEntry{}
 	e.Identification.Name = name
-	e.Identification.Type = "ipv4"
+	e.Identification.Type = setType
 	e.Entries = append([]string(nil), entries...)
-	f.sets[name] = e
+	f.sets[setType+"/"+name] = e
 }
 
 func (f *fakeUDAPI) entries(name string) []string {
+	return f.typedEntries(ipsetTypeV4, name)
+}
+
+func (f *fakeUDAPI) typedEntries(setType, name string) []string {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if e, ok := f.sets[name]; ok {
+	if e, ok := f.sets[setType+"/"+name]; ok {
 		return append([]string(nil), e.Entries...)
 	}
 	return nil
@@ -170,13 +178,14 @@ func (f *fakeUDAPI) handleStateful(env envelope) *Response {
 		b, _ := json.Marshal(env.Request)
 		var req ipsetEntry
 		_ = json.Unmarshal(b, &req)
+		key := req.Identification.Type + "/" + req.Identification.Name
 		f.mu.Lock()
-		if existing, ok := f.sets[req.Identification.Name]; ok {
+		if existing, ok := f.sets[key]; ok {
 			existing.Entries = append([]string(nil), req.Entries...)
 		} else {
 			cp := req
 			cp.Entries = append([]string(nil), req.Entries...)
-			f.sets[req.Identification.Name] = &cp
+			f.sets[key] = &cp
 		}
 		f.mu.Unlock()
 		return respOK(`{"meta":{"rc":"ok"}}`)
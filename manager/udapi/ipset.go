@@ -4,6 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
+)
+
+// A zone owns one ipset per address family under the same name; UDAPI tells
+// them apart by identification.type (the kernel sets are UBIOS4<name> and
+// UBIOS6<name>).
+const (
+	ipsetTypeV4 = "ipv4"
+	ipsetTypeV6 = "ipv6"
 )
 
 type ipsetEntry struct {
@@ -14,7 +23,32 @@ type ipsetEntry struct {
 	Entries []string `json:"entries"`
 }
 
-func findIPSet(ctx context.Context, c *UDAPIClient, ipsetName string) (*ipsetEntry, []ipsetEntry, error) {
+// ipsetType returns the set family a CIDR (or bare address) belongs in.
+// Anything unparsable is treated as IPv4, which is where it always went.
+func ipsetType(cidr string) string {
+	if p, err := netip.ParsePrefix(cidr); err == nil {
+		if p.Addr().Unmap().Is6() {
+			return ipsetTypeV6
+		}
+		return ipsetTypeV4
+	}
+	if a, err := netip.ParseAddr(cidr); err == nil && a.Unmap().Is6() {
+		return ipsetTypeV6
+	}
+	return ipsetTypeV4
+}
+
+// splitByFamily groups cidrs by ipset type, preserving order within each.
+func splitByFamily(cidrs []string) map[string][]string {
+	out := make(map[string][]string, 2)
+	for _, cidr := range cidrs {
+		t := ipsetType(cidr)
+		out[t] = append(out[t], cidr)
+	}
+	return out
+}
+
+func findIPSet(ctx context.Context, c *UDAPIClient, setType, ipsetName string) (*ipsetEntry, []ipsetEntry, error) {
 	resp, err := c.RequestCtx(ctx, "GET", "/firewall/sets", nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("get firewall sets: %w", err)
@@ -26,7 +60,12 @@ func findIPSet(ctx context.Context, c *UDAPIClient, ipsetName string) (*ipsetEnt
 	}
 
 	for i := range sets {
-		if sets[i].Identification.Name == ipsetName {
+		if sets[i].Identification.Name != ipsetName {
+			continue
+		}
+		// Older firmware omits the type on IPv4 sets.
+		t := sets[i].Identification.Type
+		if t == setType || (t == "" && setType == ipsetTypeV4) {
 			return &sets[i], sets, nil
 		}
 	}
@@ -34,66 +73,60 @@ func findIPSet(ctx context.Context, c *UDAPIClient, ipsetName string) (*ipsetEnt
 }
 
 func EnsureZoneSubnet(ctx context.Context, c *UDAPIClient, ipsetName, cidr string) error {
-	return WithIpsetRMW(ipsetName, func() error {
-		target, _, err := findIPSet(ctx, c, ipsetName)
-		if err != nil {
-			return err
-		}
-		if target == nil {
-			return fmt.Errorf("%s ipset not found", ipsetName)
-		}
-
-		for _, entry := range target.Entries {
-			if entry == cidr {
-				return nil
-			}
-		}
-
-		target.Entries = append(target.Entries, cidr)
-
-		_, err = c.RequestCtx(ctx, "PUT", "/firewall/sets/set", target)
-		if err != nil {
-			return fmt.Errorf("update %s: %w", ipsetName, err)
-		}
-		return nil
-	})
+	return EnsureZoneSubnets(ctx, c, ipsetName, []string{cidr})
 }
 
+// EnsureZoneSubnets adds cidrs to the zone's ipsets, IPv4 entries to the
+// ipv4 set and IPv6 entries to the ipv6 set of the same name.
 func EnsureZoneSubnets(ctx context.Context, c *UDAPIClient, ipsetName string, cidrs []string) error {
 	if len(cidrs) == 0 {
 		return nil
 	}
+	byFamily := splitByFamily(cidrs)
 	return WithIpsetRMW(ipsetName, func() error {
-		target, _, err := findIPSet(ctx, c, ipsetName)
-		if err != nil {
-			return err
-		}
-		if target == nil {
-			return fmt.Errorf("%s ipset not found", ipsetName)
+		for _, setType := range []string{ipsetTypeV4, ipsetTypeV6} {
+			if len(byFamily[setType]) == 0 {
+				continue
+			}
+			if err := ensureEntries(ctx, c, setType, ipsetName, byFamily[setType]); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+}
 
-		existing := make(map[string]bool, len(target.Entries))
-		for _, e := range target.Entries {
-			existing[e] = true
-		}
+func ensureEntries(ctx context.Context, c *UDAPIClient, setType, ipsetName string, cidrs []string) error {
+	target, _, err := findIPSet(ctx, c, setType, ipsetName)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return fmt.Errorf("%s %s ipset not found", ipsetName, setType)
+	}
 
-		var added bool
-		for _, cidr := range cidrs {
-			if !existing[cidr] {
-				target.Entries = append(target.Entries, cidr)
-				added = true
-			}
-		}
-		if !added {
-			return nil
-		}
+	existing := make(map[string]bool, len(target.Entries))
+	for _, e := range target.Entries {
+		existing[e] = true
+	}
 
-		_, err = c.RequestCtx(ctx, "PUT", "/firewall/sets/set", target)
-		if err != nil {
-			return fmt.Errorf("update %s: %w", ipsetName, err)
+	var added bool
+	for _, cidr := range cidrs {
+		if !existing[cidr] {
+			target.Entries = append(target.Entries, cidr)
+			existing[cidr] = true
+			added = true
 		}
+	}
+	if !added {
 		return nil
-	})
+	}
+
+	_, err = c.RequestCtx(ctx, "PUT", "/firewall/sets/set", target)
+	if err != nil {
+		return fmt.Errorf("update %s %s: %w", ipsetName, setType, err)
+	}
+	return nil
 }
 
 func EnsureVPNSubnet(ctx context.Context, c *UDAPIClient, cidr string) error {
@@ -101,8 +134,9 @@ func EnsureVPNSubnet(ctx context.Context, c *UDAPIClient, cidr string) error {
 }
 
 func RemoveZoneSubnet(ctx context.Context, c *UDAPIClient, ipsetName, cidr string) error {
+	setType := ipsetType(cidr)
 	return WithIpsetRMW(ipsetName, func() error {
-		target, _, err := findIPSet(ctx, c, ipsetName)
+		target, _, err := findIPSet(ctx, c, setType, ipsetName)
 		if err != nil {
 			return err
 		}
@@ -123,7 +157,7 @@ func RemoveZoneSubnet(ctx context.Context, c *UDAPIClient, ipsetName, cidr strin
 		target.Entries = filtered
 		_, err = c.RequestCtx(ctx, "PUT", "/firewall/sets/set", target)
 		if err != nil {
-			return fmt.Errorf("update %s: %w", ipsetName, err)
+			return fmt.Errorf("update %s %s: %w", ipsetName, setType, err)
 		}
 		return nil
 	})
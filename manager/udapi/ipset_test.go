@@ -0,0 +1,52 @@
+package udapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureZoneSubnets_SplitsByFamily(t *testing.T) {
+	fake := newFakeUDAPISocket(t)
+	fake.installTypedSet(ipsetTypeV4, "VPN_S2S_subnets", []string{"10.0.0.0/24"})
+	fake.installTypedSet(ipsetTypeV6, "VPN_S2S_subnets", nil)
+	cli := NewClient(fake.path)
+
+	err := EnsureZoneSubnets(context.Background(), cli, "VPN_S2S_subnets",
+		[]string{"10.1.0.0/24", "fd00:1::/64", "10.0.0.0/24", "fd00:255::2/128"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"10.0.0.0/24", "10.1.0.0/24"}, fake.typedEntries(ipsetTypeV4, "VPN_S2S_subnets"))
+	assert.Equal(t, []string{"fd00:1::/64", "fd00:255::2/128"}, fake.typedEntries(ipsetTypeV6, "VPN_S2S_subnets"))
+
+	require.NoError(t, RemoveZoneSubnet(context.Background(), cli, "VPN_S2S_subnets", "fd00:1::/64"))
+	assert.Equal(t, []string{"fd00:255::2/128"}, fake.typedEntries(ipsetTypeV6, "VPN_S2S_subnets"))
+	assert.Len(t, fake.typedEntries(ipsetTypeV4, "VPN_S2S_subnets"), 2, "v6 removal must not touch the v4 set")
+}
+
+func TestEnsureZoneSubnets_MissingV6SetIsAnError(t *testing.T) {
+	fake := newFakeUDAPISocket(t)
+	fake.installSet("VPN_S2S_subnets", nil)
+	cli := NewClient(fake.path)
+
+	err := EnsureZoneSubnets(context.Background(), cli, "VPN_S2S_subnets", []string{"fd00:1::/64"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ipv6")
+	assert.Empty(t, fake.entries("VPN_S2S_subnets"), "an IPv6 CIDR must never land in the IPv4 set")
+}
+
+func TestIPSetType(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.0/8":      ipsetTypeV4,
+		"192.168.1.1":     ipsetTypeV4,
+		"fd00::/64":       ipsetTypeV6,
+		"2001:db8::1":     ipsetTypeV6,
+		"::ffff:10.0.0.1": ipsetTypeV4,
+		"not-a-cidr":      ipsetTypeV4,
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, ipsetType(in), in)
+	}
+}
@@ -33,9 +33,10 @@ type netCfgAddress struct {
 }
 
 type SubnetInfo struct {
-	CIDR string `json:"cidr"`
-	Name string `json:"name"`
-	Type string `json:"type"`
+	CIDR  string `json:"cidr"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Iface string `json:"iface"`
 }
 
 func loadNetCfg() (*netCfg, error) {
@@ -139,9 +140,10 @@ func ParseLocalSubnets() []SubnetInfo {
 				name = iface.Identification.ID
 			}
 			subnets = append(subnets, SubnetInfo{
-				CIDR: ipNet.String(),
-				Name: fmt.Sprintf("%s (%s)", name, iface.Identification.ID),
-				Type: ifType,
+				CIDR:  ipNet.String(),
+				Name:  fmt.Sprintf("%s (%s)", name, iface.Identification.ID),
+				Type:  ifType,
+				Iface: iface.Identification.ID,
 			})
 		}
 	}
@@ -9,20 +9,41 @@ import type {
     SettingsResponse,
     SettingsRequest,
     DiagnosticsResponse,
+    ApplyMTUResponse,
     LogEntry,
     TunnelInfo,
     TunnelCreateResponse,
+    TunnelImportResponse,
     TunnelUpdateResponse,
     EnableTunnelResponse,
     Keypair,
     WgS2sCreateRequest,
+    WgS2sImportRequest,
+    PairingBundleResponse,
+    PairingImportRequest,
+    PairingImportResponse,
+    PairingCompleteRequest,
     WgS2sZoneEntry,
+    WgKeyRotation,
     IntegrationStatus,
     SubnetEntry,
     RemoteExitResponse,
     EnableRemoteExitRequest,
     EnableRemoteExitResult,
+    ExitSchedule,
+    ExitSchedulesResponse,
+    PolicyTemplate,
+    PolicyTemplatesResponse,
+    SetPolicyTemplateResponse,
+    DriftReport,
+    FirewallPlan,
+    IntegrationInventory,
+    OrphanGCResult,
+    ManifestSnapshot,
+    ManifestChange,
+    ManifestRestoreResult,
     UpdateInfo,
+    MetricsHistoryResponse,
 } from './types.js';
 
 const API_BASE = '/vpn-pack/api';
@@ -199,6 +220,10 @@ export function fetchLogs(): Promise<{ lines: LogEntry[] } | null> {
     return apiFetch<{ lines: LogEntry[] }>('GET', `${API_BASE}/logs`);
 }
 
+export function getMetricsHistory(range: 'hour' | 'day' = 'hour'): Promise<MetricsHistoryResponse | null> {
+    return apiFetch<MetricsHistoryResponse>('GET', `${API_BASE}/metrics/history?range=${range}`, undefined, { silent: true });
+}
+
 // WireGuard S2S
 export function wgS2sListTunnels(): Promise<TunnelInfo[] | null> {
     return apiFetch<TunnelInfo[]>('GET', `${API_BASE}/wg-s2s/tunnels`);
@@ -206,9 +231,15 @@ export function wgS2sListTunnels(): Promise<TunnelInfo[] | null> {
 export function wgS2sCreateTunnel(tunnel: WgS2sCreateRequest): Promise<TunnelCreateResponse | null> {
     return apiFetch<TunnelCreateResponse>('POST', `${API_BASE}/wg-s2s/tunnels`, tunnel);
 }
+export function wgS2sImportTunnel(req: WgS2sImportRequest): Promise<TunnelImportResponse | null> {
+    return apiFetch<TunnelImportResponse>('POST', `${API_BASE}/wg-s2s/import`, req);
+}
 export function wgS2sUpdateTunnel(id: string, updates: Partial<WgS2sCreateRequest>): Promise<TunnelUpdateResponse | null> {
     return apiFetch<TunnelUpdateResponse>('PATCH', `${API_BASE}/wg-s2s/tunnels/${id}`, updates);
 }
+export function wgS2sApplyMTU(id: string): Promise<ApplyMTUResponse | null> {
+    return apiFetch<ApplyMTUResponse>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/mtu`, undefined, { timeout: 60000 });
+}
 export function wgS2sDeleteTunnel(id: string): Promise<OperationResponse | null> {
     return apiFetch<OperationResponse>('DELETE', `${API_BASE}/wg-s2s/tunnels/${id}`);
 }
@@ -224,6 +255,15 @@ export function wgS2sGenerateKeypair(): Promise<Keypair | null> {
 export function wgS2sGetConfig(id: string): Promise<{ config: string } | null> {
     return apiFetch<{ config: string }>('GET', `${API_BASE}/wg-s2s/tunnels/${id}/config`);
 }
+export function wgS2sCreatePairing(id: string, peer?: string): Promise<PairingBundleResponse | null> {
+    return apiFetch<PairingBundleResponse>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/pairing`, peer ? { peer } : {});
+}
+export function wgS2sImportPairing(req: PairingImportRequest): Promise<PairingImportResponse | null> {
+    return apiFetch<PairingImportResponse>('POST', `${API_BASE}/wg-s2s/pairing/import`, req);
+}
+export function wgS2sCompletePairing(id: string, req: PairingCompleteRequest): Promise<OperationResponse | null> {
+    return apiFetch<OperationResponse>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/pairing/complete`, req);
+}
 export function wgS2sGetWanIP(): Promise<{ ip: string } | null> {
     return apiFetch<{ ip: string }>('GET', `${API_BASE}/wg-s2s/wan-ip`);
 }
@@ -236,6 +276,15 @@ export function wgS2sListZones(): Promise<WgS2sZoneEntry[] | null> {
 export function wgS2sSetupTunnelZone(id: string): Promise<OperationResponse | null> {
     return apiFetch<OperationResponse>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/setup-zone`);
 }
+export function wgS2sScheduleKeyRotation(id: string, at?: string): Promise<WgKeyRotation | null> {
+    return apiFetch<WgKeyRotation>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/key-rotation`, at ? { at } : {});
+}
+export function wgS2sCommitKeyRotation(id: string): Promise<OperationResponse | null> {
+    return apiFetch<OperationResponse>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/key-rotation/commit`);
+}
+export function wgS2sCancelKeyRotation(id: string): Promise<OperationResponse | null> {
+    return apiFetch<OperationResponse>('DELETE', `${API_BASE}/wg-s2s/tunnels/${id}/key-rotation`);
+}
 
 // Remote Exit Node
 export function getRemoteExitNode(): Promise<RemoteExitResponse | null> {
@@ -247,6 +296,62 @@ export function enableRemoteExitNode(req: EnableRemoteExitRequest): Promise<Enab
 export function disableRemoteExitNode(): Promise<OperationResponse | null> {
     return apiFetch<OperationResponse>('DELETE', `${API_BASE}/exit-node`);
 }
+export function getExitSchedules(): Promise<ExitSchedulesResponse | null> {
+    return apiFetch<ExitSchedulesResponse>('GET', `${API_BASE}/exit-schedules`);
+}
+export function createExitSchedule(sch: Omit<ExitSchedule, 'id'>): Promise<ExitSchedule | null> {
+    return apiFetch<ExitSchedule>('POST', `${API_BASE}/exit-schedules`, sch);
+}
+export function updateExitSchedule(id: string, sch: Omit<ExitSchedule, 'id'>): Promise<ExitSchedule | null> {
+    return apiFetch<ExitSchedule>('PATCH', `${API_BASE}/exit-schedules/${id}`, sch);
+}
+export function deleteExitSchedule(id: string): Promise<OperationResponse | null> {
+    return apiFetch<OperationResponse>('DELETE', `${API_BASE}/exit-schedules/${id}`);
+}
+export function getPolicyTemplates(): Promise<PolicyTemplatesResponse | null> {
+    return apiFetch<PolicyTemplatesResponse>('GET', `${API_BASE}/firewall/templates`);
+}
+export function setPolicyTemplate(tpl: PolicyTemplate): Promise<SetPolicyTemplateResponse | null> {
+    return apiFetch<SetPolicyTemplateResponse>('POST', `${API_BASE}/firewall/templates`, tpl);
+}
+export function deletePolicyTemplate(zone: string): Promise<{ applied: boolean } | null> {
+    return apiFetch<{ applied: boolean }>('DELETE', `${API_BASE}/firewall/templates/${encodeURIComponent(zone)}`);
+}
+export function getFirewallDrift(): Promise<DriftReport | null> {
+    return apiFetch<DriftReport>('GET', `${API_BASE}/firewall/drift`);
+}
+export function reconcileFirewallDrift(): Promise<DriftReport | null> {
+    return apiFetch<DriftReport>('POST', `${API_BASE}/firewall/drift/reconcile`);
+}
+
+// Dry runs: what the matching call would change, without changing it.
+export function planSettings(settings: SettingsRequest): Promise<FirewallPlan | null> {
+    return apiFetch<FirewallPlan>('POST', `${API_BASE}/settings?dryRun=true`, settings);
+}
+export function planWgS2sTunnelZone(id: string): Promise<FirewallPlan | null> {
+    return apiFetch<FirewallPlan>('POST', `${API_BASE}/wg-s2s/tunnels/${id}/setup-zone?dryRun=true`);
+}
+export function planWgS2sCreateTunnel(tunnel: WgS2sCreateRequest): Promise<FirewallPlan<TunnelCreateResponse> | null> {
+    return apiFetch<FirewallPlan<TunnelCreateResponse>>('POST', `${API_BASE}/wg-s2s/tunnels?dryRun=true`, tunnel);
+}
+export function planWgS2sDeleteTunnel(id: string): Promise<FirewallPlan | null> {
+    return apiFetch<FirewallPlan>('DELETE', `${API_BASE}/wg-s2s/tunnels/${id}?dryRun=true`);
+}
+export function planIntegrationApiKey(apiKey: string): Promise<FirewallPlan<IntegrationStatus> | null> {
+    return apiFetch<FirewallPlan<IntegrationStatus>>('POST', `${API_BASE}/integration/api-key?dryRun=true`, { apiKey });
+}
+export function planRemoveIntegrationApiKey(): Promise<FirewallPlan | null> {
+    return apiFetch<FirewallPlan>('DELETE', `${API_BASE}/integration/api-key?dryRun=true`);
+}
+export function planPolicyTemplate(tpl: PolicyTemplate): Promise<FirewallPlan<SetPolicyTemplateResponse> | null> {
+    return apiFetch<FirewallPlan<SetPolicyTemplateResponse>>('POST', `${API_BASE}/firewall/templates?dryRun=true`, tpl);
+}
+export function planDeletePolicyTemplate(zone: string): Promise<FirewallPlan | null> {
+    return apiFetch<FirewallPlan>('DELETE', `${API_BASE}/firewall/templates/${encodeURIComponent(zone)}?dryRun=true`);
+}
+export function planFirewallDriftReconcile(): Promise<FirewallPlan<DriftReport> | null> {
+    return apiFetch<FirewallPlan<DriftReport>>('POST', `${API_BASE}/firewall/drift/reconcile?dryRun=true`);
+}
 
 // Integration API
 export function getIntegrationStatus(): Promise<IntegrationStatus | null> {
@@ -261,6 +366,29 @@ export function removeIntegrationApiKey(): Promise<OperationResponse | null> {
 export function testIntegrationKey(): Promise<IntegrationStatus | null> {
     return apiFetch<IntegrationStatus>('POST', `${API_BASE}/integration/test`);
 }
+export function getIntegrationInventory(): Promise<IntegrationInventory | null> {
+    return apiFetch<IntegrationInventory>('GET', `${API_BASE}/integration/inventory`);
+}
+// Without ids, every orphan of a fresh inventory is deleted.
+export function collectIntegrationOrphans(ids?: string[]): Promise<OrphanGCResult | null> {
+    return apiFetch<OrphanGCResult>('POST', `${API_BASE}/integration/gc`, { ids });
+}
+export function planIntegrationOrphanCollection(ids?: string[]): Promise<FirewallPlan<OrphanGCResult> | null> {
+    return apiFetch<FirewallPlan<OrphanGCResult>>('POST', `${API_BASE}/integration/gc?dryRun=true`, { ids });
+}
+
+// Manifest snapshots
+export function getManifestSnapshots(): Promise<{ snapshots: ManifestSnapshot[] } | null> {
+    return apiFetch<{ snapshots: ManifestSnapshot[] }>('GET', `${API_BASE}/manifest/snapshots`);
+}
+// Without `to`, the snapshot is compared with the current manifest.
+export function diffManifestSnapshot(id: string, to?: string): Promise<{ changes: ManifestChange[] } | null> {
+    const query = to ? `?to=${encodeURIComponent(to)}` : '';
+    return apiFetch<{ changes: ManifestChange[] }>('GET', `${API_BASE}/manifest/snapshots/${encodeURIComponent(id)}/diff${query}`);
+}
+export function restoreManifestSnapshot(id: string): Promise<ManifestRestoreResult | null> {
+    return apiFetch<ManifestRestoreResult>('POST', `${API_BASE}/manifest/snapshots/${encodeURIComponent(id)}/restore`);
+}
 
 export function keepalive(): Promise<Status | null> {
     if (Date.now() - lastRequestTime < AUTH_KEEPALIVE_MS * 0.8) return Promise.resolve(null);
@@ -139,6 +139,20 @@ describe('RemoteExitNode', () => {
         expect(onclientschange).toHaveBeenCalledWith([{ ip: '10.0.0.2' }]);
     });
 
+    it('adds a client by MAC address', async () => {
+        renderWith({
+            enabled: true,
+            peers: [onlinePeer],
+            selectedPeerId: 'stable-1',
+            mode: 'selective',
+        });
+
+        await fireEvent.input(screen.getByPlaceholderText(/192\.168/), { target: { value: 'AA-BB-CC-DD-EE-01' } });
+        await fireEvent.click(screen.getByText('Add'));
+
+        expect(onclientschange).toHaveBeenCalledWith([{ mac: 'aa:bb:cc:dd:ee:01', label: undefined }]);
+    });
+
     it('shows validation error for invalid IP', async () => {
         renderWith({
             enabled: true,
@@ -151,7 +165,7 @@ describe('RemoteExitNode', () => {
         await fireEvent.input(ipInput, { target: { value: 'not-an-ip' } });
         await fireEvent.click(screen.getByText('Add'));
 
-        expect(screen.getByText(/Invalid IP or CIDR/)).toBeInTheDocument();
+        expect(screen.getByText(/Invalid IP, CIDR or MAC/)).toBeInTheDocument();
         expect(onclientschange).not.toHaveBeenCalled();
     });
 
@@ -187,4 +201,80 @@ describe('RemoteExitNode', () => {
         expect(screen.getByText('All traffic')).toBeInTheDocument();
         expect(screen.getByText('Selected clients')).toBeInTheDocument();
     });
+
+    it('adds a domain destination in destinations mode', async () => {
+        const ondestinationschange = vi.fn();
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', mode: 'destinations', ondestinationschange });
+        const input = screen.getByPlaceholderText(/intranet\.example\.com/);
+        await fireEvent.input(input, { target: { value: 'Intranet.Example.com' } });
+        await fireEvent.click(screen.getByText('Add'));
+        expect(ondestinationschange).toHaveBeenCalledWith(['intranet.example.com']);
+    });
+
+    it('rejects a catch-all destination', async () => {
+        const ondestinationschange = vi.fn();
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', mode: 'destinations', ondestinationschange });
+        await fireEvent.input(screen.getByPlaceholderText(/intranet\.example\.com/), { target: { value: '0.0.0.0/0' } });
+        await fireEvent.click(screen.getByText('Add'));
+        expect(ondestinationschange).not.toHaveBeenCalled();
+        expect(screen.getByText(/Use "All traffic"/)).toBeInTheDocument();
+    });
+
+    it('lists one choice per network and toggles it', async () => {
+        const onnetworkschange = vi.fn();
+        const lanNetworks = [
+            { cidr: '192.168.1.0/24', name: 'Default (br0)', type: 'bridge', iface: 'br0' },
+            { cidr: '192.168.20.0/24', name: 'Guest (br20)', type: 'bridge', iface: 'br20' },
+        ];
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', mode: 'networks', lanNetworks, networks: ['br0'], onnetworkschange });
+        const boxes = screen.getAllByRole('checkbox').filter(b => b.closest('label')?.textContent.includes('('));
+        expect(boxes).toHaveLength(2);
+        await fireEvent.click(screen.getByText('Guest (br20)'));
+        expect(onnetworkschange).toHaveBeenCalledWith(['br0', 'br20']);
+    });
+
+    it('adds a backup peer and leaves the primary out of the choices', async () => {
+        const onbackupschange = vi.fn();
+        renderWith({ enabled: true, peers: [onlinePeer, offlinePeer], selectedPeerId: 'stable-1', onbackupschange });
+        const select = screen.getByLabelText('Backup peers');
+        const values = [...select.querySelectorAll('option')].map(o => o.value);
+        expect(values).toEqual(['', 'stable-2']);
+        await fireEvent.change(select, { target: { value: 'stable-2' } });
+        expect(onbackupschange).toHaveBeenCalledWith(['stable-2']);
+    });
+
+    it('shows the failover notice while on a backup', () => {
+        const current = { peerId: 'stable-2', hostName: 'backup-exit', online: true, mode: 'all', failedOver: true };
+        renderWith({ enabled: true, peers: [onlinePeer, offlinePeer], selectedPeerId: 'stable-1', backups: ['stable-2'], current });
+        expect(screen.getByText(/Failed over to backup-exit/)).toBeInTheDocument();
+        expect(screen.getByLabelText('Remove backup backup-exit')).toBeInTheDocument();
+    });
+
+    it('toggles the kill switch', async () => {
+        const onkillswitchchange = vi.fn();
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', mode: 'selective', onkillswitchchange });
+        const toggle = screen.getByText('Kill switch').closest('div.flex').querySelector('input[type="checkbox"]');
+        await fireEvent.click(toggle);
+        expect(onkillswitchchange).toHaveBeenCalledWith(true);
+    });
+
+    it('picks a schedule for the policy and marks the active one', async () => {
+        const onschedulechange = vi.fn();
+        const schedules = [{ id: 'w', name: 'Work', cron: ['* 8-16 * * mon-fri'], active: true }];
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', schedules, onschedulechange });
+        const select = screen.getByLabelText('Schedule');
+        expect(screen.getByText('Work (active now)')).toBeInTheDocument();
+        await fireEvent.change(select, { target: { value: 'w' } });
+        expect(onschedulechange).toHaveBeenCalledWith('w');
+    });
+
+    it('rejects a cron line without five fields', async () => {
+        const oncreateschedule = vi.fn();
+        renderWith({ enabled: true, peers: [onlinePeer], selectedPeerId: 'stable-1', oncreateschedule });
+        await fireEvent.input(screen.getByPlaceholderText('Schedule name'), { target: { value: 'Nights' } });
+        await fireEvent.input(screen.getByPlaceholderText('* 8-16 * * mon-fri'), { target: { value: '0 22 * *' } });
+        await fireEvent.click(screen.getByText('Add schedule'));
+        expect(screen.getByText(/needs 5 fields/)).toBeInTheDocument();
+        expect(oncreateschedule).not.toHaveBeenCalled();
+    });
 });
@@ -197,6 +197,52 @@ describe('TunnelCard', () => {
         expect(onUpdate).toHaveBeenCalled();
     });
 
+    it('shows failover group and live role', () => {
+        render(TunnelCard, {
+            tunnel: makeTunnel({
+                failover: { group: 'hq' },
+                failoverState: { group: 'hq', role: 'failed', since: '2026-01-01T00:00:00Z', reason: 'no handshake for 3m0s' },
+            }),
+            onUpdate: vi.fn(),
+            onDelete: vi.fn(),
+        });
+
+        expect(screen.getByText('hq')).toBeInTheDocument();
+        expect(screen.getByText('failed')).toHaveAttribute('title', 'no handshake for 3m0s');
+    });
+
+    it('shows remote unreachable when a probe fails on a connected tunnel', () => {
+        render(TunnelCard, {
+            tunnel: makeTunnel({
+                connected: true,
+                reachable: false,
+                probeResults: [{ kind: 'icmp', target: '10.0.0.1', reachable: false, loss: 0.5, lastError: 'timeout', checkedAt: '2026-01-01T00:00:00Z' }],
+            }),
+            onUpdate: vi.fn(),
+            onDelete: vi.fn(),
+        });
+
+        expect(screen.getByText('Remote unreachable')).toBeInTheDocument();
+        expect(screen.getByTitle('timeout')).toHaveTextContent('50% loss');
+    });
+
+    it('shows the current rate and the traffic graph', () => {
+        render(TunnelCard, {
+            tunnel: makeTunnel({
+                rate: { t: '2026-01-01T00:00:05Z', rx: 2048, tx: 1024 },
+                history: [
+                    { t: '2026-01-01T00:00:00Z', rx: 100, tx: 50 },
+                    { t: '2026-01-01T00:00:10Z', rx: 300, tx: 20 },
+                ],
+            }),
+            onUpdate: vi.fn(),
+            onDelete: vi.fn(),
+        });
+
+        expect(screen.getByText('2.0 KB/s down, 1.0 KB/s up')).toBeInTheDocument();
+        expect(screen.getByRole('img', { name: 'Traffic, last hour' })).toBeInTheDocument();
+    });
+
     it('shows delete confirmation when delete button is clicked', async () => {
         render(TunnelCard, {
             tunnel: makeTunnel(),
@@ -37,6 +37,8 @@ let status = $state({
 /** @type {import('../types.js').StoreError[]} */
 let errors = $state([]);
 let logs = $state([]);
+// Current rx/tx rates by series kind and ID, from the "traffic" event.
+let traffic = $state({ wgS2s: {}, peers: {} });
 /** @type {import('../types.js').UpdateInfo} */
 let updateInfo = $state({ available: false, version: '', currentVersion: '', changelogURL: '', dismissed: false });
 let changedFields = new SvelteSet();
@@ -62,6 +64,10 @@ export function getChangedFields() {
     return changedFields;
 }
 
+export function getTraffic() {
+    return traffic;
+}
+
 export function getUpdateInfo() {
     return updateInfo;
 }
@@ -212,6 +218,58 @@ export function connect() {
         }
     });
 
+    eventSource.addEventListener('traffic', (event) => {
+        try {
+            const data = JSON.parse(event.data);
+            traffic.wgS2s = data.wgS2s ?? {};
+            traffic.peers = data.peers ?? {};
+        } catch {
+            // A dropped sample only delays the rate display to the next tick.
+        }
+    });
+
+    eventSource.addEventListener('wg-s2s-endpoint', (event) => {
+        try {
+            const c = JSON.parse(event.data);
+            addLog('info', `WireGuard S2S "${c.tunnelName}": ${c.endpoint} now resolves to ${c.newAddress}`);
+        } catch (e) {
+            addLog('error', `Failed to parse endpoint event: ${e.message}`);
+        }
+    });
+
+    eventSource.addEventListener('wg-s2s-failover', (event) => {
+        try {
+            const e = JSON.parse(event.data);
+            const reason = e.reason ? ` (${e.reason})` : '';
+            addLog(e.to === 'failed' ? 'warn' : 'info', `WireGuard S2S failover "${e.group}": ${e.tunnelName} ${e.from} -> ${e.to}${reason}`);
+        } catch (err) {
+            addLog('error', `Failed to parse failover event: ${err.message}`);
+        }
+    });
+
+    eventSource.addEventListener('remote-exit-failover', (event) => {
+        try {
+            const e = JSON.parse(event.data);
+            addLog('warn', `Exit node failover: ${e.fromName} -> ${e.toName} (${e.reason})`);
+        } catch (err) {
+            addLog('error', `Failed to parse exit node failover event: ${err.message}`);
+        }
+    });
+
+    eventSource.addEventListener('wg-s2s-reachability', (event) => {
+        try {
+            const e = JSON.parse(event.data);
+            const target = e.port ? `${e.target}:${e.port}` : e.target;
+            if (e.reachable) {
+                addLog('info', `WireGuard S2S ${e.tunnelName}: ${target} reachable again`);
+            } else {
+                addLog('warn', `WireGuard S2S ${e.tunnelName}: ${target} unreachable (${e.error})`);
+            }
+        } catch (err) {
+            addLog('error', `Failed to parse reachability event: ${err.message}`);
+        }
+    });
+
     eventSource.onerror = () => {
         status.connected = false;
         if (sseErrorId === null) {
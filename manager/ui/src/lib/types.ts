@@ -38,8 +38,109 @@ export interface RouteStatus {
 }
 
 export interface ExitNodeClient {
-    ip: string;
+    ip?: string;
+    mac?: string;
     label?: string;
+    schedule?: string;
+}
+
+export interface ExitSchedule {
+    id: string;
+    name: string;
+    cron: string[];
+    active?: boolean;
+}
+
+export interface ExitSchedulesResponse {
+    schedules: ExitSchedule[];
+}
+
+export interface PolicyRule {
+    name: string;
+    direction: 'inbound' | 'outbound';
+    action: 'ALLOW' | 'BLOCK';
+    protocol?: 'TCP' | 'UDP';
+    ports?: number[];
+    destinations?: string[];
+}
+
+export interface PolicyTemplate {
+    zone: string;
+    rules: PolicyRule[];
+}
+
+export interface PolicyTemplatesResponse {
+    templates: PolicyTemplate[];
+}
+
+export interface SetPolicyTemplateResponse {
+    template: PolicyTemplate;
+    applied: boolean;
+}
+
+export interface FirewallDrift {
+    kind: 'zone_missing' | 'policy_missing' | 'policy_modified' | 'policy_stale';
+    zone?: string;
+    zoneId?: string;
+    wanPort?: string;
+    policy?: string;
+    policyId?: string;
+    fields?: string[];
+}
+
+export interface DriftReport {
+    checkedAt: string;
+    drift: FirewallDrift[];
+}
+
+export interface PlannedChange {
+    action: 'create' | 'delete';
+    kind: 'zone' | 'policy' | 'dns_policy' | 'udapi_rule' | 'ipset_entry';
+    name: string;
+    id?: string;
+    detail?: string;
+}
+
+export interface FirewallPlan<T = unknown> {
+    dryRun: true;
+    changes: PlannedChange[];
+    result?: T;
+}
+
+export interface IntegrationObject {
+    kind: 'zone' | 'policy' | 'dns_policy';
+    id: string;
+    name: string;
+    owner?: string;
+    orphan: boolean;
+}
+
+export interface IntegrationInventory {
+    checkedAt: string;
+    objects: IntegrationObject[];
+    orphans: number;
+}
+
+export interface OrphanGCResult {
+    deleted: IntegrationObject[];
+    failed?: (IntegrationObject & { error: string })[];
+}
+
+export interface ManifestSnapshot {
+    id: string;
+    takenAt: string;
+}
+
+export interface ManifestChange {
+    path: string;
+    from?: unknown;
+    to?: unknown;
+}
+
+export interface ManifestRestoreResult {
+    changes: ManifestChange[];
+    drift?: DriftReport;
+    errors?: string[];
 }
 
 export interface RemoteExitNodeStatus {
@@ -48,6 +149,28 @@ export interface RemoteExitNodeStatus {
     online: boolean;
     mode: string;
     clients?: ExitNodeClient[];
+    networks?: string[];
+    destinations?: string[];
+    domains?: string[];
+    killSwitch?: boolean;
+    schedule?: string;
+    candidates?: RemoteExitCandidate[];
+    failoverGraceSec?: number;
+    failedOver?: boolean;
+}
+
+export interface RemoteExitCandidate {
+    peerId: string;
+    hostName: string;
+    online: boolean;
+}
+
+export interface RemoteExitFailoverEvent {
+    from: string;
+    fromName: string;
+    to: string;
+    toName: string;
+    reason: string;
 }
 
 export interface ExitNodePeer {
@@ -68,6 +191,13 @@ export interface EnableRemoteExitRequest {
     peerId: string;
     mode: string;
     clients?: ExitNodeClient[];
+    networks?: string[];
+    destinations?: string[];
+    domains?: string[];
+    killSwitch?: boolean;
+    schedule?: string;
+    backups?: string[];
+    failoverGraceSec?: number;
     confirm: boolean;
 }
 
@@ -81,6 +211,7 @@ export interface SubnetEntry {
     cidr: string;
     name: string;
     type: string;
+    iface?: string;
 }
 
 export interface FirewallHealth {
@@ -115,6 +246,48 @@ export interface WgS2sStatus {
     localAddress: string;
     remoteSubnets: string[];
     forwardINOk: boolean;
+    keyCreatedAt: string;
+    keyStale?: boolean;
+    keyRotation?: WgKeyRotation;
+    failover?: WgFailoverState;
+    reachable?: boolean;
+    probes?: WgProbeResult[];
+}
+
+export interface WgProbeResult {
+    kind: 'icmp' | 'tcp';
+    target: string;
+    port?: number;
+    reachable: boolean;
+    latencyMs?: number;
+    loss: number;
+    lastSuccess?: string;
+    lastError?: string;
+    checkedAt: string;
+}
+
+export interface WgFailoverState {
+    group: string;
+    role: 'active' | 'standby' | 'failed';
+    since: string;
+    reason?: string;
+}
+
+export interface WgHealthProbe {
+    kind: 'icmp' | 'tcp';
+    target: string;
+    port?: number;
+}
+
+export interface WgFailover {
+    group: string;
+    probe?: WgHealthProbe;
+}
+
+export interface WgKeyRotation {
+    pendingPublicKey: string;
+    preparedAt: string;
+    scheduledAt?: string;
 }
 
 export interface TunnelConfig {
@@ -123,6 +296,7 @@ export interface TunnelConfig {
     interfaceName: string;
     listenPort: number;
     tunnelAddress: string;
+    tunnelAddresses?: string[];
     peerPublicKey: string;
     peerEndpoint: string;
     allowedIPs: string[];
@@ -132,6 +306,10 @@ export interface TunnelConfig {
     routeMetric?: number;
     enabled: boolean;
     createdAt: string;
+    keyCreatedAt?: string;
+    keyRotation?: WgKeyRotation;
+    failover?: WgFailover;
+    probes?: WgHealthProbe[];
 }
 
 export interface SettingsFields {
@@ -275,6 +453,25 @@ export interface DiagnosticsResponse {
     preferredDERP: number;
     derpRegions: DERPRegionInfo[];
     wgS2s?: WgS2sDiagnostics;
+    pathMTU?: PathMTUResult[];
+    pathMTUPending?: boolean;
+}
+
+export interface PathMTUResult {
+    kind: 'wgs2s' | 'derp';
+    tunnelID?: string;
+    name: string;
+    hosts: string[];
+    pathMTU?: number;
+    tunnelMTU: number;
+    fragments?: boolean;
+    recommendedMTU?: number;
+    error?: string;
+}
+
+export interface ApplyMTUResponse {
+    pathMTU: PathMTUResult;
+    tunnel?: TunnelUpdateResponse;
 }
 
 export interface SubnetConflict {
@@ -305,6 +502,10 @@ export interface TunnelCreateResponse extends TunnelInfo {
     firewall?: FirewallStatus;
 }
 
+export interface TunnelImportResponse extends TunnelCreateResponse {
+    ignored?: string[];
+}
+
 export interface TunnelUpdateResponse extends TunnelInfo {
     setupStatus?: string;
     firewall?: FirewallStatus;
@@ -328,12 +529,62 @@ export interface WgS2sCreateRequest extends TunnelConfig {
     createZone?: boolean;
 }
 
+export interface WgS2sImportRequest {
+    name: string;
+    config: string;
+    listenPort?: number;
+    localSubnets?: string[];
+    routeMetric?: number;
+    zoneId?: string;
+    zoneName?: string;
+    createZone?: boolean;
+}
+
+export interface PairingBundleResponse {
+    bundle: string;
+    expiresAt: string;
+    signer: string;
+}
+
+export interface PairingImportRequest {
+    bundle: string;
+    name?: string;
+    expectedSigner: string;
+    listenPort?: number;
+    routeMetric?: number;
+    zoneId?: string;
+    zoneName?: string;
+    createZone?: boolean;
+}
+
+export interface PairingImportResponse extends TunnelCreateResponse {
+    signer: string;
+    reply: string;
+    replySigner: string;
+}
+
+export interface PairingCompleteRequest {
+    reply: string;
+    expectedSigner: string;
+}
+
 export interface WgS2sZoneEntry {
     zoneId: string;
     zoneName: string;
     tunnelCount: number;
 }
 
+export interface TrafficPoint {
+    t: string;
+    rx: number;
+    tx: number;
+}
+
+export interface MetricsHistoryResponse {
+    range: 'hour' | 'day';
+    series: Record<string, Record<string, TrafficPoint[]>>;
+}
+
 export interface LogEntry {
     timestamp: string;
     level: string;
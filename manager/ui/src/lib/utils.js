@@ -114,6 +114,19 @@ function isValidHost(host) {
     return false;
 }
 
+// isValidMAC accepts an EUI-48 address with ':' or '-' separators.
+export function isValidMAC(value) {
+    return /^[0-9a-fA-F]{2}([:-])[0-9a-fA-F]{2}(\1[0-9a-fA-F]{2}){4}$/.test(value ?? '');
+}
+
+// isValidDomain accepts a dotted DNS name such as intranet.example.com; a
+// bare label or an IP address is not a domain.
+export function isValidDomain(value) {
+    if (!value || value.length > 253) return false;
+    if (/^\d{1,3}(\.\d{1,3}){3}$/.test(value)) return false;
+    return /^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$/.test(value);
+}
+
 export function isValidMTU(value) {
     const n = Number(value);
     return Number.isInteger(n) && n >= MTU_MIN && n <= PORT_MAX;
@@ -209,6 +222,7 @@ export function sortPeers(peers) {
 }
 
 export function tunnelStatusInfo(tunnel) {
+    if (tunnel.connected && tunnel.reachable === false) return { dot: 'bg-warning', label: 'Remote unreachable' };
     if (tunnel.connected) return { dot: 'bg-success', label: 'Connected' };
     if (tunnel.lastHandshake && tunnel.lastHandshake !== '0001-01-01T00:00:00Z') {
         return { dot: 'bg-warning', label: 'Handshake stale' };
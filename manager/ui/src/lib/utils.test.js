@@ -1,7 +1,7 @@
 import { describe, it, expect, vi, beforeEach, afterEach } from 'vitest';
 import {
     formatBytes, relativeTime, formatUptime, isValidCIDR,
-    isValidBase64Key, isValidPort, isValidEndpoint,
+    isValidBase64Key, isValidPort, isValidEndpoint, isValidDomain, isValidMAC,
     isValidMTU, isValidKeepalive, isValidRouteMetric, validateTunnelFields,
     stateColors, stateLabels,
 } from './utils.js';
@@ -473,3 +473,33 @@ describe('backend state tables', () => {
         expect(stateLabels.NoState).toBe('Connecting');
     });
 });
+
+describe('isValidDomain', () => {
+    it('accepts a dotted name', () => {
+        expect(isValidDomain('intranet.example.com')).toBe(true);
+    });
+
+    it('rejects a bare label', () => {
+        expect(isValidDomain('nas')).toBe(false);
+    });
+
+    it('rejects an IPv4 address', () => {
+        expect(isValidDomain('10.0.0.1')).toBe(false);
+    });
+
+    it('rejects a label starting with a hyphen', () => {
+        expect(isValidDomain('-bad.example.com')).toBe(false);
+    });
+});
+
+describe('isValidMAC', () => {
+    it('accepts colon and dash separators', () => {
+        expect(isValidMAC('aa:bb:cc:dd:ee:ff')).toBe(true);
+        expect(isValidMAC('AA-BB-CC-DD-EE-FF')).toBe(true);
+    });
+
+    it('rejects mixed separators and short addresses', () => {
+        expect(isValidMAC('aa:bb-cc:dd:ee:ff')).toBe(false);
+        expect(isValidMAC('aa:bb:cc')).toBe(false);
+    });
+});
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"math"
 	"net/netip"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
 	"unifi-tailscale/manager/internal/wgs2s"
 	"unifi-tailscale/manager/service"
 
@@ -58,6 +60,12 @@ func (s *Server) isDNSForwardingEnabled() bool {
 
 func (s *Server) runWatcher(ctx context.Context) {
 	go s.runStatusRefresh(ctx)
+	go s.runEndpointResolver(ctx)
+	go s.runFailoverMonitor(ctx)
+	go s.runReachabilityMonitor(ctx)
+	go s.runExitDestinationRefresh(ctx)
+	go s.runRemoteExitFailover(ctx)
+	go s.runIntegrationInventory(ctx)
 
 	for {
 		if err := s.watchLoop(ctx); err != nil {
@@ -95,10 +103,122 @@ func (s *Server) refreshTick(ctx context.Context) {
 	integrationStatus := s.integration.GetStatus(ctx)
 	integrationStatus = s.handleAPIKeyExpiry(ctx, integrationStatus)
 	integrationStatus = s.repairMissingPolicies(ctx, integrationStatus)
+	if s.wgManager != nil {
+		s.wgS2sSvc.CommitDueKeyRotations(ctx, time.Now())
+		s.wgS2sSvc.ExpirePairings(ctx, time.Now())
+	}
 	s.applyRefreshState(ctx, enrichment, integrationStatus)
+	s.recordTraffic(time.Now())
 	s.broadcastState()
 }
 
+// runEndpointResolver re-resolves DDNS endpoints of stale S2S peers on its
+// own ticker: the lookups can block for seconds on a bad resolver and must
+// not hold up the status refresh.
+func (s *Server) runEndpointResolver(ctx context.Context) {
+	ticker := time.NewTicker(config.WgS2sEndpointResolve)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.wgManager == nil {
+				continue
+			}
+			for _, c := range s.wgS2sSvc.ReResolveEndpoints(ctx, time.Now()) {
+				domain.BroadcastEvent(s.hub, "wg-s2s-endpoint", c)
+			}
+		}
+	}
+}
+
+// runFailoverMonitor drives the S2S failover health checks. Probes can take
+// seconds, so like the resolver it stays off the status refresh tick.
+func (s *Server) runFailoverMonitor(ctx context.Context) {
+	ticker := time.NewTicker(config.WgS2sFailoverCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.wgManager == nil {
+				continue
+			}
+			for _, e := range s.wgS2sSvc.CheckFailover(ctx, time.Now()) {
+				domain.BroadcastEvent(s.hub, "wg-s2s-failover", e)
+			}
+		}
+	}
+}
+
+// runReachabilityMonitor sends the S2S reachability probes. The results
+// reach the dashboard through the tunnel statuses of the next state
+// broadcast; only targets going down or coming back get their own event.
+func (s *Server) runReachabilityMonitor(ctx context.Context) {
+	ticker := time.NewTicker(config.WgS2sReachabilityCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.wgManager == nil {
+				continue
+			}
+			for _, e := range s.wgS2sSvc.RunReachabilityProbes(ctx, time.Now()) {
+				domain.BroadcastEvent(s.hub, "wg-s2s-reachability", e)
+			}
+		}
+	}
+}
+
+func (s *Server) runExitDestinationRefresh(ctx context.Context) {
+	ticker := time.NewTicker(config.ExitDestinationRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.exitSvc == nil {
+				continue
+			}
+			s.exitSvc.RefreshDestinations(ctx, s.remoteExitPolicy())
+		}
+	}
+}
+
+// runRemoteExitFailover moves the remote exit node between its failover
+// candidates. Every switch is broadcast and kept in the daemon log, where it
+// sits next to the tailscaled lines it explains.
+func (s *Server) runRemoteExitFailover(ctx context.Context) {
+	ticker := time.NewTicker(config.ExitFailoverCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.remoteExitSvc == nil {
+				continue
+			}
+			e := s.remoteExitSvc.CheckFailover(ctx, time.Now())
+			if e == nil {
+				continue
+			}
+			s.logBuf.Add(newLogEntry("warn", fmt.Sprintf("exit node failover %s -> %s: %s", e.FromName, e.ToName, e.Reason), "tailscale"))
+			domain.BroadcastEvent(s.hub, "remote-exit-failover", e)
+		}
+	}
+}
+
 func (s *Server) handleAPIKeyExpiry(ctx context.Context, status *service.IntegrationStatus) *service.IntegrationStatus {
 	if status == nil || status.Reason != "key_expired" || !s.ic.HasAPIKey() {
 		return status
@@ -310,16 +310,21 @@ func (s *Server) restoreExitNodeRules(ctx context.Context) {
 		}
 	}
 
-	rem := s.manifest.GetRemoteExitNode()
-	var policy domain.ExitNodePolicy
-	if rem != nil && rem.Mode != domain.ExitNodeOff {
-		policy = domain.ExitNodePolicy{Mode: rem.Mode, Clients: rem.Clients}
-	}
-	if err := s.exitSvc.Reconcile(ctx, policy); err != nil {
+	if err := s.exitSvc.Reconcile(ctx, s.remoteExitPolicy()); err != nil {
 		slog.Warn("exit node rule restore failed", "err", err)
 	}
 }
 
+// remoteExitPolicy is the local routing policy of the configured remote
+// exit node, or the zero policy when none is in use.
+func (s *Server) remoteExitPolicy() domain.ExitNodePolicy {
+	rem := s.manifest.GetRemoteExitNode()
+	if rem == nil || rem.Mode == domain.ExitNodeOff {
+		return domain.ExitNodePolicy{}
+	}
+	return rem.Policy()
+}
+
 func (s *Server) reconcileWanPortPolicies(ctx context.Context) {
 	if s.health.IsDegraded(WatcherFirewall) {
 		return
@@ -354,3 +359,37 @@ func (s *Server) reconcileWanPortPolicies(ctx context.Context) {
 		}
 	}
 }
+
+// runIntegrationInventory looks for orphaned Integration API objects right
+// away, which is when a manifest reset at load leaves them, and then every
+// IntegrationInventory. Orphans are only reported: deleting them is up to
+// the operator, through /api/integration/gc.
+func (s *Server) runIntegrationInventory(ctx context.Context) {
+	ticker := time.NewTicker(config.IntegrationInventory)
+	defer ticker.Stop()
+
+	for {
+		s.checkIntegrationOrphans(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) checkIntegrationOrphans(ctx context.Context) {
+	if s.fwOrch == nil || !s.integrationReady() || s.health.IsDegraded(WatcherFirewall) {
+		return
+	}
+	inv, err := s.fwOrch.Inventory(ctx)
+	if err != nil {
+		slog.Warn("integration inventory failed", "err", err)
+		return
+	}
+	if inv.Orphans == 0 {
+		return
+	}
+	slog.Warn("orphaned integration objects found; review them at /api/integration/inventory", "count", inv.Orphans)
+	domain.BroadcastEvent(s.hub, "integration-orphans", inv)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"unifi-tailscale/manager/config"
+	"unifi-tailscale/manager/domain"
+)
+
+// Traffic history series kinds, as keyed in /api/metrics/history and the
+// "traffic" SSE event.
+const (
+	trafficKindWgS2s = "wgS2s"
+	trafficKindPeers = "peers"
+)
+
+// recordTraffic feeds the counters of the state just refreshed into the
+// traffic history and streams the current rates.
+func (s *Server) recordTraffic(now time.Time) {
+	snap := s.state.Snapshot()
+	for _, t := range snap.WgS2sTunnels {
+		if t.Enabled {
+			s.traffic.Observe(trafficKindWgS2s, t.ID, now, t.TransferRx, t.TransferTx)
+		}
+	}
+	for _, p := range snap.Peers {
+		if p.ID != "" {
+			s.traffic.Observe(trafficKindPeers, p.ID, now, p.RxBytes, p.TxBytes)
+		}
+	}
+	s.traffic.Prune(now)
+	domain.BroadcastEvent(s.hub, "traffic", s.traffic.Latest())
+}
+
+// runTrafficHistorySaver persists the traffic history periodically and once
+// more on shutdown, so a restart or upgrade keeps the day graph.
+func (s *Server) runTrafficHistorySaver(ctx context.Context) {
+	ticker := time.NewTicker(config.TrafficHistorySave)
+	defer ticker.Stop()
+
+	save := func() {
+		if err := s.traffic.Save(config.TrafficHistoryPath); err != nil {
+			slog.Warn("traffic history save failed", "err", err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}